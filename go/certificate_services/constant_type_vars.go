@@ -0,0 +1,29 @@
+package certificateServices
+
+import (
+	"errors"
+)
+
+//goland:noinspection ALL
+const (
+	PEM_EC_PRIVATE_KEY        = "EC PRIVATE KEY"
+	PEM_ENCRYPTED_PRIVATE_KEY = "ENCRYPTED PRIVATE KEY"
+	PEM_PRIVATE_KEY           = "PRIVATE KEY"
+	PEM_RSA_PRIVATE_KEY       = "RSA PRIVATE KEY"
+	//
+	EXTENSION_TEMPORARY = ".tmp"
+	//
+	KEY_TYPE_ECDSA_P256 = "ecdsa-p256"
+	KEY_TYPE_ECDSA_P384 = "ecdsa-p384"
+	KEY_TYPE_ED25519    = "ed25519"
+	KEY_TYPE_RSA        = "rsa"
+	//
+	SERIAL_NUMBER_BITS = 128
+)
+
+var (
+	ErrKeyTypeInvalid     = errors.New("the key_type must be " + KEY_TYPE_RSA + ", " + KEY_TYPE_ECDSA_P256 + ", " + KEY_TYPE_ECDSA_P384 + " or " + KEY_TYPE_ED25519)
+	ErrPassphraseRequired = errors.New("the private key is encrypted, so a passphrase is required")
+	ErrPEMInvalid         = errors.New("the file does not hold exactly one PEM block of the expected type")
+	ErrRSABitsTooSmall    = errors.New("the rsa_bits is below the minimum")
+)
@@ -0,0 +1,10 @@
+module certificate_services
+
+go 1.22.3
+
+require (
+	github.com/sty-holdings/sharedServices/v2024 v2024.37.0
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78
+)
+
+require golang.org/x/crypto v0.22.0 // indirect
@@ -0,0 +1,155 @@
+package certificateServices
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	"github.com/youmark/pkcs8"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// publicKeyEqual - implemented by every public key type in the standard library.
+type publicKeyEqual interface {
+	Equal(x crypto.PublicKey) bool
+}
+
+// GenerateKey - creates a key of the key type. rsaBits is only used for RSA keys, and must be at least minRSABits.
+//
+//	Customer Messages: None
+//	Errors: ErrKeyTypeInvalid, ErrRSABitsTooSmall, errors returned by rsa, ecdsa and ed25519
+//	Verifications: None
+func GenerateKey(keyType string, rsaBits int, minRSABits int) (privateKey crypto.Signer, errorInfo errs.ErrorInfo) {
+
+	switch keyType {
+	case KEY_TYPE_RSA:
+		if rsaBits < minRSABits {
+			errorInfo = errs.NewErrorInfo(ErrRSABitsTooSmall, fmt.Sprintf("RSA Bits: %d Minimum: %d", rsaBits, minRSABits))
+			return
+		}
+		privateKey, errorInfo.Error = rsa.GenerateKey(rand.Reader, rsaBits)
+	case KEY_TYPE_ECDSA_P256:
+		privateKey, errorInfo.Error = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KEY_TYPE_ECDSA_P384:
+		privateKey, errorInfo.Error = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KEY_TYPE_ED25519:
+		_, privateKey, errorInfo.Error = ed25519.GenerateKey(rand.Reader)
+	default:
+		errorInfo.Error = ErrKeyTypeInvalid
+	}
+	if errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Key Type: %s", keyType))
+	}
+
+	return
+}
+
+// KeyUsageForKey - every key signs. Only RSA subject keys should also have the Key Encipherment Key Usage bit set. In the
+// context of TLS this Key Usage is particular to RSA key exchange and authentication. ECDSA and Ed25519 keys cannot encipher.
+func KeyUsageForKey(publicKey crypto.PublicKey) (keyUsage x509.KeyUsage) {
+
+	keyUsage = x509.KeyUsageDigitalSignature
+	if _, ok := publicKey.(*rsa.PublicKey); ok {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+
+	return
+}
+
+// ReadPrivateKey - reads a PEM private key in PKCS#8, encrypted PKCS#8, PKCS#1 or SEC 1 form. The passphrase is only used for
+// an encrypted key.
+//
+//	Customer Messages: None
+//	Errors: ErrPassphraseRequired, ErrPEMInvalid, errors returned by os, x509 and pkcs8
+//	Verifications: None
+func ReadPrivateKey(fqn string, passphrase string) (privateKey crypto.Signer, errorInfo errs.ErrorInfo) {
+
+	var (
+		tBlockPtr *pem.Block
+		tData     []byte
+		tKey      any
+		ok        bool
+	)
+
+	if tData, errorInfo.Error = os.ReadFile(fqn); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+	if tBlockPtr, _ = pem.Decode(tData); tBlockPtr == nil {
+		errorInfo = errs.NewErrorInfo(ErrPEMInvalid, fmt.Sprintf("File: %s Expected: %s", fqn, PEM_PRIVATE_KEY))
+		return
+	}
+
+	switch tBlockPtr.Type {
+	case PEM_ENCRYPTED_PRIVATE_KEY:
+		if passphrase == ctv.VAL_EMPTY {
+			errorInfo.Error = ErrPassphraseRequired
+			break
+		}
+		tKey, errorInfo.Error = pkcs8.ParsePKCS8PrivateKey(tBlockPtr.Bytes, []byte(passphrase))
+	case PEM_PRIVATE_KEY:
+		tKey, errorInfo.Error = x509.ParsePKCS8PrivateKey(tBlockPtr.Bytes)
+	case PEM_RSA_PRIVATE_KEY:
+		tKey, errorInfo.Error = x509.ParsePKCS1PrivateKey(tBlockPtr.Bytes)
+	case PEM_EC_PRIVATE_KEY:
+		tKey, errorInfo.Error = x509.ParseECPrivateKey(tBlockPtr.Bytes)
+	default:
+		errorInfo.Error = ErrPEMInvalid
+	}
+	if errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+	if privateKey, ok = tKey.(crypto.Signer); ok == false {
+		errorInfo = errs.NewErrorInfo(ErrPEMInvalid, fmt.Sprintf("File: %s", fqn))
+	}
+
+	return
+}
+
+// SamePublicKey - a key type without Equal, such as a DSA key parsed from a certificate, never matches.
+func SamePublicKey(publicKey crypto.PublicKey, other crypto.PublicKey) bool {
+
+	tPublicKey, ok := publicKey.(publicKeyEqual)
+
+	return ok && tPublicKey.Equal(other)
+}
+
+// SubjectKeyId - the SHA-1 hash of the subject public key bits, method (1) of RFC 5280 section 4.2.1.2.
+//
+//	Customer Messages: None
+//	Errors: errors returned by x509 and asn1
+//	Verifications: None
+func SubjectKeyId(publicKey crypto.PublicKey) (keyId []byte, errorInfo errs.ErrorInfo) {
+
+	var (
+		tPKIX          []byte
+		tPublicKeyInfo struct {
+			Algorithm asn1.RawValue
+			PublicKey asn1.BitString
+		}
+	)
+
+	if tPKIX, errorInfo.Error = x509.MarshalPKIXPublicKey(publicKey); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, "Subject Key Id")
+		return
+	}
+	if _, errorInfo.Error = asn1.Unmarshal(tPKIX, &tPublicKeyInfo); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, "Subject Key Id")
+		return
+	}
+	tSum := sha1.Sum(tPublicKeyInfo.PublicKey.Bytes)
+
+	return tSum[:], errorInfo
+}
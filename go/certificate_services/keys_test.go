@@ -0,0 +1,167 @@
+package certificateServices
+
+import (
+	"crypto"
+	"crypto/dsa"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/youmark/pkcs8"
+)
+
+const (
+	TEST_MIN_RSA_BITS = 2048
+	TEST_PASSPHRASE   = "correct horse"
+)
+
+func generateTestKey(t *testing.T, keyType string) crypto.Signer {
+
+	tPrivateKey, tErrorInfo := GenerateKey(keyType, TEST_MIN_RSA_BITS, TEST_MIN_RSA_BITS)
+	if tErrorInfo.Error != nil {
+		t.Fatalf("GenerateKey(%s): %s %s", keyType, tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	return tPrivateKey
+}
+
+func TestGenerateKey(t *testing.T) {
+
+	for _, tCase := range []struct {
+		keyType   string
+		rsaBits   int
+		wantErr   error
+		wantUsage x509.KeyUsage
+	}{
+		{keyType: KEY_TYPE_RSA, rsaBits: TEST_MIN_RSA_BITS, wantUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment},
+		{keyType: KEY_TYPE_RSA, rsaBits: TEST_MIN_RSA_BITS - 1, wantErr: ErrRSABitsTooSmall},
+		{keyType: KEY_TYPE_ECDSA_P256, wantUsage: x509.KeyUsageDigitalSignature},
+		{keyType: KEY_TYPE_ECDSA_P384, wantUsage: x509.KeyUsageDigitalSignature},
+		{keyType: KEY_TYPE_ED25519, wantUsage: x509.KeyUsageDigitalSignature},
+		{keyType: "dsa", wantErr: ErrKeyTypeInvalid},
+	} {
+		tPrivateKey, tErrorInfo := GenerateKey(tCase.keyType, tCase.rsaBits, TEST_MIN_RSA_BITS)
+		if tCase.wantErr != nil {
+			if errors.Is(tErrorInfo.Error, tCase.wantErr) == false {
+				t.Errorf("GenerateKey(%s, %d) error = %v, want %s", tCase.keyType, tCase.rsaBits, tErrorInfo.Error, tCase.wantErr)
+			}
+			continue
+		}
+		if tErrorInfo.Error != nil {
+			t.Fatalf("GenerateKey(%s): %s", tCase.keyType, tErrorInfo.Error)
+		}
+		if tUsage := KeyUsageForKey(tPrivateKey.Public()); tUsage != tCase.wantUsage {
+			t.Errorf("KeyUsageForKey(%s) = %d, want %d", tCase.keyType, tUsage, tCase.wantUsage)
+		}
+	}
+}
+
+// TestReadPrivateKey - every form the tools write or accept reads back as the same key.
+func TestReadPrivateKey(t *testing.T) {
+
+	var (
+		tDirectory = t.TempDir()
+		tECKey     = generateTestKey(t, KEY_TYPE_ECDSA_P256)
+		tRSAKey    = generateTestKey(t, KEY_TYPE_RSA)
+	)
+
+	tPKCS8, tErr := x509.MarshalPKCS8PrivateKey(tECKey)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	tSEC1, tErr := x509.MarshalECPrivateKey(tECKey.(*ecdsa.PrivateKey))
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	tEncrypted, tErr := pkcs8.MarshalPrivateKey(tECKey, []byte(TEST_PASSPHRASE), nil)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	for _, tCase := range []struct {
+		name       string
+		pemType    string
+		der        []byte
+		passphrase string
+		want       crypto.Signer
+		wantErr    error
+	}{
+		{name: "pkcs8", pemType: PEM_PRIVATE_KEY, der: tPKCS8, want: tECKey},
+		{name: "pkcs1", pemType: PEM_RSA_PRIVATE_KEY, der: x509.MarshalPKCS1PrivateKey(tRSAKey.(*rsa.PrivateKey)), want: tRSAKey},
+		{name: "sec1", pemType: PEM_EC_PRIVATE_KEY, der: tSEC1, want: tECKey},
+		{name: "encrypted", pemType: PEM_ENCRYPTED_PRIVATE_KEY, der: tEncrypted, passphrase: TEST_PASSPHRASE, want: tECKey},
+		{name: "encrypted without a passphrase", pemType: PEM_ENCRYPTED_PRIVATE_KEY, der: tEncrypted, wantErr: ErrPassphraseRequired},
+		{name: "certificate", pemType: "CERTIFICATE", der: tPKCS8, wantErr: ErrPEMInvalid},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			tFQN := filepath.Join(tDirectory, tCase.name)
+			if tErr := os.WriteFile(tFQN, pem.EncodeToMemory(&pem.Block{Type: tCase.pemType, Bytes: tCase.der}), 0600); tErr != nil {
+				t.Fatal(tErr)
+			}
+
+			tPrivateKey, tErrorInfo := ReadPrivateKey(tFQN, tCase.passphrase)
+			if tCase.wantErr != nil {
+				if errors.Is(tErrorInfo.Error, tCase.wantErr) == false {
+					t.Fatalf("ReadPrivateKey error = %v, want %s", tErrorInfo.Error, tCase.wantErr)
+				}
+				return
+			}
+			if tErrorInfo.Error != nil {
+				t.Fatalf("ReadPrivateKey: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+			}
+			if SamePublicKey(tPrivateKey.Public(), tCase.want.Public()) == false {
+				t.Error("ReadPrivateKey returned a different key")
+			}
+		})
+	}
+}
+
+// TestSamePublicKey - a DSA key, which x509 still parses from certificates, has no Equal, so it must not match instead of panicking.
+func TestSamePublicKey(t *testing.T) {
+
+	var (
+		tKey   = generateTestKey(t, KEY_TYPE_ED25519)
+		tOther = generateTestKey(t, KEY_TYPE_ED25519)
+	)
+
+	for _, tCase := range []struct {
+		name      string
+		publicKey crypto.PublicKey
+		other     crypto.PublicKey
+		want      bool
+	}{
+		{name: "same", publicKey: tKey.Public(), other: tKey.Public(), want: true},
+		{name: "different", publicKey: tKey.Public(), other: tOther.Public(), want: false},
+		{name: "dsa", publicKey: &dsa.PublicKey{}, other: tKey.Public(), want: false},
+		{name: "nil", publicKey: nil, other: tKey.Public(), want: false},
+	} {
+		if tGot := SamePublicKey(tCase.publicKey, tCase.other); tGot != tCase.want {
+			t.Errorf("%s: SamePublicKey = %t, want %t", tCase.name, tGot, tCase.want)
+		}
+	}
+}
+
+// TestSubjectKeyId - the identifier is the 20 byte SHA-1 of the key, the same every time and different for another key.
+func TestSubjectKeyId(t *testing.T) {
+
+	var (
+		tKey   = generateTestKey(t, KEY_TYPE_ECDSA_P256)
+		tOther = generateTestKey(t, KEY_TYPE_ECDSA_P256)
+	)
+
+	tKeyId, tErrorInfo := SubjectKeyId(tKey.Public())
+	if tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+	tAgain, _ := SubjectKeyId(tKey.Public())
+	tOtherKeyId, _ := SubjectKeyId(tOther.Public())
+
+	if len(tKeyId) != 20 || string(tKeyId) != string(tAgain) || string(tKeyId) == string(tOtherKeyId) {
+		t.Errorf("SubjectKeyId = %x, %x again and %x for another key", tKeyId, tAgain, tOtherKeyId)
+	}
+}
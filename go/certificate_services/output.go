@@ -0,0 +1,75 @@
+package certificateServices
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// NewSerialNumber - a random, positive serial number of up to SERIAL_NUMBER_BITS, as RFC 5280 section 4.1.2.2 allows.
+//
+//	Customer Messages: None
+//	Errors: errors returned by rand
+//	Verifications: None
+func NewSerialNumber() (serialNumber *big.Int, errorInfo errs.ErrorInfo) {
+
+	// Zero is not a valid serial number, so one less than the limit is drawn and one added.
+	tSerialNumberLimit := new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), SERIAL_NUMBER_BITS), big.NewInt(1))
+	if serialNumber, errorInfo.Error = rand.Int(rand.Reader, tSerialNumberLimit); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, "Serial Number")
+		return
+	}
+	serialNumber.Add(serialNumber, big.NewInt(1))
+
+	return
+}
+
+// WriteOutFile - writes the data to a temporary file in the same directory and renames it over fqn, so fqn is always either
+// the old file or the whole new one. The permissions are set before the data goes in, so a private key is never readable by others.
+//
+//	Customer Messages: None
+//	Errors: errors returned by os
+//	Verifications: None
+func WriteOutFile(fqn string, data []byte, permissions os.FileMode) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tFilePtr *os.File
+	)
+
+	if tFilePtr, errorInfo.Error = os.CreateTemp(filepath.Dir(fqn), "."+filepath.Base(fqn)+".*"+EXTENSION_TEMPORARY); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+	defer func() {
+		if errorInfo.Error != nil {
+			_ = tFilePtr.Close()
+			_ = os.Remove(tFilePtr.Name())
+		}
+	}()
+
+	if errorInfo.Error = tFilePtr.Chmod(permissions); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+	if _, errorInfo.Error = tFilePtr.Write(data); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+	if errorInfo.Error = tFilePtr.Sync(); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+	if errorInfo.Error = tFilePtr.Close(); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+	if errorInfo.Error = os.Rename(tFilePtr.Name(), fqn); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+	}
+
+	return
+}
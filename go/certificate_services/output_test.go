@@ -0,0 +1,50 @@
+package certificateServices
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewSerialNumber(t *testing.T) {
+
+	for range 100 {
+		tSerialNumber, tErrorInfo := NewSerialNumber()
+		if tErrorInfo.Error != nil {
+			t.Fatal(tErrorInfo.Error)
+		}
+		if tSerialNumber.Sign() <= 0 || tSerialNumber.BitLen() > SERIAL_NUMBER_BITS {
+			t.Fatalf("NewSerialNumber = %x, want positive and at most %d bits", tSerialNumber, SERIAL_NUMBER_BITS)
+		}
+	}
+}
+
+// TestWriteOutFile - the file is replaced whole, with the permissions, and no temporary file is left behind.
+func TestWriteOutFile(t *testing.T) {
+
+	var (
+		tDirectory = t.TempDir()
+		tFQN       = filepath.Join(tDirectory, "key")
+	)
+
+	for _, tData := range []string{"old", "new"} {
+		if tErrorInfo := WriteOutFile(tFQN, []byte(tData), 0600); tErrorInfo.Error != nil {
+			t.Fatalf("WriteOutFile: %s", tErrorInfo.Error)
+		}
+	}
+
+	tData, tErr := os.ReadFile(tFQN)
+	if tErr != nil || string(tData) != "new" {
+		t.Errorf("the file holds %q, %v, want new", tData, tErr)
+	}
+	if tInfo, tErr := os.Stat(tFQN); tErr != nil || tInfo.Mode().Perm() != 0600 {
+		t.Errorf("the file mode is %v, %v, want 0600", tInfo.Mode().Perm(), tErr)
+	}
+	if tEntries, _ := os.ReadDir(tDirectory); len(tEntries) != 1 {
+		t.Errorf("the directory holds %d files, want only the one written", len(tEntries))
+	}
+
+	if tErrorInfo := WriteOutFile(filepath.Join(tDirectory, "missing", "key"), []byte("data"), 0600); tErrorInfo.Error == nil {
+		t.Error("WriteOutFile into a missing directory succeeded")
+	}
+}
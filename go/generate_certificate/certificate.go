@@ -0,0 +1,213 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// certificateRequest - what to generate. File names are given without an extension.
+type certificateRequest struct {
+	CACertificateFQN string           // Optional. The issuing CA certificate, followed by the rest of its chain. Requires CAPrivateKeyFQN.
+	CAPrivateKeyFQN  string           // Optional. The issuing CA private key.
+	Backdate         time.Duration    // How far NotBefore is set before now, to absorb clock skew. Not used with NotBefore.
+	CertificateFQN   string           // The certificate is written to <CertificateFQN>.pem.
+	Exports          []string         // Optional. The EXPORT_ formats also written.
+	ExtraExtensions  []pkix.Extension // Set by sign to the CSR extensions that the profile copies unchanged.
+	KeepSubject      bool             // Set by sign, so the subject is the CSR's and the flags' without the profile's or the defaults.
+	KeyType          string           // One of the KEY_TYPE_ values.
+	NotAfter         string           // Optional. RFC 3339. Replaces ValidFor.
+	NotBefore        string           // Optional. RFC 3339. The default is now less Backdate.
+	PassphraseFQN    string           // Optional. The first line is the passphrase for the exports that need one.
+	PathLength       int              // The most CAs allowed below a CA certificate. Less than zero leaves it unlimited.
+	PrivateKeyFQN    string           // The private key is written here and the public key to <PrivateKeyFQN>.pub.
+	Profile          string           // The name of a built-in profile or one in ProfileFQN.
+	ProfileFQN       string           // Optional. A YAML file of profiles, read after the built-in ones.
+	RSABits          int              // Only used when KeyType is KEY_TYPE_RSA.
+	SANs             sanRequest       // At least one name, or Subject.CommonName, is required.
+	SelfCA           bool             // Self-signed only. The certificate is a root CA.
+	Subject          subjectRequest   // Empty fields take the profile's subject, then the DEFAULT_SUBJECT_ values.
+	ValidFor         string           // See parseValidity. Either ValidFor or NotAfter is required.
+}
+
+// generateCertificate - creates the key pair and the certificate, then reads the files back to check them. The certificate is
+// self-signed unless a CA certificate and key are given, in which case the chain bundle is also written. Nothing is written
+// until the certificate has been signed, so a CA that refuses it leaves no files behind.
+//
+//	Customer Messages: None
+//	Errors: ErrIssuerRequired, ErrSANRequired, ErrSelfCAWithIssuer, errors returned by checkExports, loadProfile, validityWindow,
+//	loadIssuer, certs.GenerateKey, generateCertificateFile, writeKeyFiles, verifyOutputFiles and exportFiles
+//	Verifications: None
+func generateCertificate(request certificateRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tIssuerPtr  *issuer
+		tPassphrase string
+		tPrivateKey crypto.Signer
+		tProfile    profile
+	)
+
+	if tPassphrase, errorInfo = checkExports(request.Exports, request.PassphraseFQN, true); errorInfo.Error != nil {
+		return
+	}
+	if tProfile, errorInfo = loadProfile(request.ProfileFQN, request.Profile); errorInfo.Error != nil {
+		return
+	}
+	if _, _, errorInfo = request.validityWindow(time.Now(), tProfile); errorInfo.Error != nil {
+		return
+	}
+	switch {
+	case request.SANs.empty() && request.Subject.CommonName == ctv.VAL_EMPTY:
+		errorInfo = errs.NewErrorInfo(ErrSANRequired, fmt.Sprintf("Certificate File: %s", request.CertificateFQN))
+		return
+	case request.SelfCA && request.CACertificateFQN != ctv.VAL_EMPTY:
+		errorInfo = errs.NewErrorInfo(ErrSelfCAWithIssuer, fmt.Sprintf("CA Certificate File: %s", request.CACertificateFQN))
+		return
+	case tProfile.IsCA && request.CACertificateFQN == ctv.VAL_EMPTY:
+		errorInfo = errs.NewErrorInfo(ErrIssuerRequired, fmt.Sprintf("Profile: %s", request.Profile))
+		return
+	}
+
+	if request.CACertificateFQN != ctv.VAL_EMPTY || request.CAPrivateKeyFQN != ctv.VAL_EMPTY {
+		if tIssuerPtr, errorInfo = loadIssuer(request.CACertificateFQN, request.CAPrivateKeyFQN); errorInfo.Error != nil {
+			return
+		}
+	}
+
+	if tPrivateKey, errorInfo = certs.GenerateKey(request.KeyType, request.RSABits, MIN_RSA_BITS); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = generateCertificateFile(request, tProfile, tPrivateKey.Public(), tPrivateKey, tIssuerPtr); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writeKeyFiles(request.PrivateKeyFQN, tPrivateKey); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = verifyOutputFiles(request, tIssuerPtr); errorInfo.Error != nil {
+		return
+	}
+
+	fmt.Println("The keys and certificate have been generated successfully.")
+	fmt.Printf("%sProfile: %s\n", ctv.SPACES_FOUR, request.Profile)
+	fmt.Printf("%sCertificate File: %s\n", ctv.SPACES_FOUR, request.CertificateFQN+EXTENSION_CERTIFICATE)
+	if tIssuerPtr != nil {
+		fmt.Printf("%sChain File: %s\n", ctv.SPACES_FOUR, request.CertificateFQN+EXTENSION_FULL_CHAIN)
+		fmt.Printf("%sIssuer: %s\n", ctv.SPACES_FOUR, tIssuerPtr.Chain[0].Subject)
+	}
+	fmt.Printf("%sPrivate Key File: %s\n", ctv.SPACES_FOUR, request.PrivateKeyFQN)
+	fmt.Printf("%sPublic Key File: %s\n", ctv.SPACES_FOUR, request.PrivateKeyFQN+EXTENSION_PUBLIC_KEY)
+
+	return exportFiles(request, tPassphrase, tPrivateKey)
+}
+
+// generateCertificateFile - creates the certificate for the public key and signs it with the issuer's key, or with privateKey
+// when there is no issuer, then writes it in the PEM format. The profile sets the key usages and whether it is a CA.
+//
+//	Customer Messages: None
+//	Errors: ErrSANInvalid, errors returned by validityWindow, profile and signCertificateFile
+//	Verifications: None
+func generateCertificateFile(request certificateRequest, certificateProfile profile, publicKey crypto.PublicKey, privateKey crypto.Signer, issuerPtr *issuer) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tNotAfter  time.Time
+		tNotBefore time.Time
+		tSubject   = request.Subject
+	)
+
+	if request.KeepSubject == false {
+		tSubject = tSubject.withDefaults(certificateProfile.Subject).withDefaults(defaultSubject)
+	}
+
+	if tNotBefore, tNotAfter, errorInfo = request.validityWindow(time.Now(), certificateProfile); errorInfo.Error != nil {
+		return
+	}
+
+	tCertificateTemplate := x509.Certificate{
+		Subject:               tSubject.name(),
+		NotBefore:             tNotBefore,
+		NotAfter:              tNotAfter,
+		BasicConstraintsValid: true,
+		IsCA:                  certificateProfile.IsCA,
+		ExtraExtensions:       request.ExtraExtensions,
+	}
+	if errorInfo = request.SANs.apply(&tCertificateTemplate); errorInfo.Error != nil {
+		return
+	}
+	if tCertificateTemplate.Subject.CommonName == ctv.VAL_EMPTY && len(tCertificateTemplate.DNSNames) > 0 {
+		tCertificateTemplate.Subject.CommonName = tCertificateTemplate.DNSNames[0]
+	}
+	if tCertificateTemplate.KeyUsage, errorInfo = certificateProfile.keyUsage(publicKey); errorInfo.Error != nil {
+		return
+	}
+	if len(certificateProfile.KeyUsage) == 0 {
+		tCertificateTemplate.KeyUsage = certs.KeyUsageForKey(publicKey)
+	}
+	if tCertificateTemplate.ExtKeyUsage, errorInfo = certificateProfile.extKeyUsage(); errorInfo.Error != nil {
+		return
+	}
+	if request.SelfCA {
+		tCertificateTemplate.IsCA = true
+		tCertificateTemplate.KeyUsage |= x509.KeyUsageCertSign
+	}
+	if tCertificateTemplate.IsCA && request.PathLength >= 0 {
+		tCertificateTemplate.MaxPathLen = request.PathLength
+		tCertificateTemplate.MaxPathLenZero = request.PathLength == 0
+	} else {
+		tCertificateTemplate.MaxPathLen = -1
+	}
+
+	return signCertificateFile(request.CertificateFQN, &tCertificateTemplate, publicKey, privateKey, issuerPtr)
+}
+
+// signCertificateFile - gives the template a new serial number and Subject Key Identifier, signs it with the issuer's key, or
+// with privateKey when there is no issuer, and writes <certificateFQN>.pem, and the chain file when there is an issuer.
+//
+//	Customer Messages: None
+//	Errors: ErrPathLengthExceeded, ErrValidityExceedsIssuer, errors returned by certs.NewSerialNumber, certs.SubjectKeyId, x509,
+//	writeOutPEMFile and writeChainFile
+//	Verifications: None
+func signCertificateFile(certificateFQN string, templatePtr *x509.Certificate, publicKey crypto.PublicKey, privateKey crypto.Signer, issuerPtr *issuer) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertificate []byte
+		tParentPtr   = templatePtr
+		tSigner      = privateKey
+	)
+
+	if templatePtr.SerialNumber, errorInfo = certs.NewSerialNumber(); errorInfo.Error != nil {
+		return
+	}
+	if templatePtr.SubjectKeyId, errorInfo = certs.SubjectKeyId(publicKey); errorInfo.Error != nil {
+		return
+	}
+
+	if issuerPtr != nil {
+		if errorInfo = issuerPtr.checkCanIssue(templatePtr); errorInfo.Error != nil {
+			return
+		}
+		tParentPtr = issuerPtr.Chain[0]
+		tSigner = issuerPtr.PrivateKey
+		templatePtr.AuthorityKeyId = issuerPtr.SubjectKeyId
+	}
+
+	if tCertificate, errorInfo.Error = x509.CreateCertificate(rand.Reader, templatePtr, tParentPtr, publicKey, tSigner); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Subject: %s", templatePtr.Subject))
+		return
+	}
+
+	if errorInfo = writeOutPEMFile(certificateFQN+EXTENSION_CERTIFICATE, tCertificate, PEM_CERTIFICATE); errorInfo.Error != nil {
+		return
+	}
+	if issuerPtr != nil {
+		errorInfo = writeChainFile(certificateFQN+EXTENSION_FULL_CHAIN, tCertificate, issuerPtr.Chain)
+	}
+
+	return
+}
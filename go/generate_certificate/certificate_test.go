@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+)
+
+const (
+	// UPDATE_GOLDEN_ENVIRONMENT_VARIABLE - set to 1 to rewrite testdata/*.golden from the generated files. flaggy parses
+	// the command line in init, so a -update flag is not possible.
+	UPDATE_GOLDEN_ENVIRONMENT_VARIABLE = "GENERATE_CERTIFICATE_UPDATE_GOLDEN"
+	TEST_PASSPHRASE                    = "correct horse battery staple"
+	TEST_RSA_BITS                      = 2048
+)
+
+// TestGenerateCertificateGolden - generates a root CA with each key type, and an intermediate, server and client certificate
+// under them, then parses every file written back and compares a description of it with testdata/<case>.golden. Keys,
+// serial numbers and dates change on every run, so the description records what they must be rather than their values.
+// The validities avoid years and months, whose length depends on the date, and NotBefore is in UTC, so they are fixed.
+func TestGenerateCertificateGolden(t *testing.T) {
+
+	var (
+		tDirectory = t.TempDir()
+		tNotBefore = time.Now().UTC().Truncate(time.Second).Format(time.RFC3339)
+	)
+
+	t.Setenv(PASSPHRASE_ENVIRONMENT_VARIABLE, TEST_PASSPHRASE)
+
+	tFQN := func(name string) string { return filepath.Join(tDirectory, name) }
+
+	for _, tCase := range []struct {
+		name    string
+		request certificateRequest
+	}{
+		{"root-rsa", certificateRequest{
+			Backdate:   DEFAULT_BACKDATE,
+			KeyType:    KEY_TYPE_RSA,
+			PathLength: 1,
+			Profile:    DEFAULT_PROFILE,
+			RSABits:    TEST_RSA_BITS,
+			SelfCA:     true,
+			Subject:    subjectRequest{CommonName: "Test Root CA RSA"},
+			ValidFor:   "8760h",
+		}},
+		{"root-ecdsa-p384", certificateRequest{
+			KeyType:    KEY_TYPE_ECDSA_P384,
+			NotBefore:  tNotBefore,
+			PathLength: DEFAULT_PATH_LENGTH,
+			Profile:    DEFAULT_PROFILE,
+			SelfCA:     true,
+			Subject:    subjectRequest{CommonName: "Test Root CA P-384", Organization: "Example Org", Country: "CA"},
+			ValidFor:   "365d",
+		}},
+		{"root-ed25519", certificateRequest{
+			Exports:    []string{EXPORT_DER, EXPORT_PKCS8_ENCRYPTED},
+			KeyType:    KEY_TYPE_ED25519,
+			NotBefore:  tNotBefore,
+			PathLength: 0,
+			Profile:    DEFAULT_PROFILE,
+			SANs:       sanRequest{DNSNames: []string{"ca.example.com"}},
+			SelfCA:     true,
+			ValidFor:   "104w",
+		}},
+		{"intermediate-ecdsa-p256", certificateRequest{
+			CACertificateFQN: tFQN("root-rsa" + EXTENSION_CERTIFICATE),
+			CAPrivateKeyFQN:  tFQN("root-rsa"),
+			KeyType:          KEY_TYPE_ECDSA_P256,
+			NotBefore:        tNotBefore,
+			PathLength:       DEFAULT_PATH_LENGTH,
+			Profile:          "intermediate",
+			Subject:          subjectRequest{CommonName: "Test Intermediate CA", OrganizationalUnit: "Issuing"},
+			ValidFor:         "180d",
+		}},
+		{"server-rsa", certificateRequest{
+			CACertificateFQN: tFQN("intermediate-ecdsa-p256" + EXTENSION_FULL_CHAIN),
+			CAPrivateKeyFQN:  tFQN("intermediate-ecdsa-p256"),
+			Exports:          []string{EXPORT_DER, EXPORT_PKCS12},
+			KeyType:          KEY_TYPE_RSA,
+			NotBefore:        tNotBefore,
+			PathLength:       DEFAULT_PATH_LENGTH,
+			Profile:          "server",
+			RSABits:          TEST_RSA_BITS,
+			SANs: sanRequest{
+				DNSNames:    []string{"WWW.Example.com.", "api.example.com", "www.example.com"},
+				IPAddresses: []string{"192.0.2.10", "2001:db8::10", "192.0.2.10"},
+			},
+			ValidFor: "90d",
+		}},
+		{"client-ed25519", certificateRequest{
+			CACertificateFQN: tFQN("root-ecdsa-p384" + EXTENSION_CERTIFICATE),
+			CAPrivateKeyFQN:  tFQN("root-ecdsa-p384"),
+			KeyType:          KEY_TYPE_ED25519,
+			NotBefore:        tNotBefore,
+			PathLength:       DEFAULT_PATH_LENGTH,
+			Profile:          "client",
+			SANs: sanRequest{
+				EmailAddresses: []string{"ops@example.com"},
+				URIs:           []string{"spiffe://example.com/nats"},
+			},
+			Subject:  subjectRequest{CommonName: "nats client"},
+			ValidFor: "2w",
+		}},
+		{"code-signing-ecdsa-p384", certificateRequest{
+			CACertificateFQN: tFQN("root-ed25519" + EXTENSION_CERTIFICATE),
+			CAPrivateKeyFQN:  tFQN("root-ed25519"),
+			KeyType:          KEY_TYPE_ECDSA_P384,
+			NotBefore:        tNotBefore,
+			PathLength:       DEFAULT_PATH_LENGTH,
+			Profile:          "code-signing",
+			Subject:          subjectRequest{CommonName: "Release Signing"},
+			ValidFor:         "52w1d",
+		}},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			tCase.request.CertificateFQN = tFQN(tCase.name)
+			tCase.request.PrivateKeyFQN = tFQN(tCase.name)
+			if tErrorInfo := generateCertificate(tCase.request); tErrorInfo.Error != nil {
+				t.Fatalf("generateCertificate: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+			}
+			compareGolden(t, tCase.name, describeOutput(t, tDirectory, tCase.name))
+		})
+	}
+}
+
+// compareGolden - compares the description with testdata/<name>.golden, or rewrites the file when
+// UPDATE_GOLDEN_ENVIRONMENT_VARIABLE is set.
+func compareGolden(t *testing.T, name string, description string) {
+
+	var (
+		tGoldenFQN = filepath.Join("testdata", name+".golden")
+	)
+
+	if os.Getenv(UPDATE_GOLDEN_ENVIRONMENT_VARIABLE) == "1" {
+		if tErr := os.WriteFile(tGoldenFQN, []byte(description), PUBLIC_FILE_PERMISSIONS); tErr != nil {
+			t.Fatal(tErr)
+		}
+		return
+	}
+
+	tGolden, tErr := os.ReadFile(tGoldenFQN)
+	if tErr != nil {
+		t.Fatalf("%s (set %s=1 to create it)", tErr, UPDATE_GOLDEN_ENVIRONMENT_VARIABLE)
+	}
+	if string(tGolden) != description {
+		t.Errorf("the output does not match %s.\ngot:\n%s\nwant:\n%s", tGoldenFQN, description, tGolden)
+	}
+}
+
+// describeOutput - a description of every file whose name starts with name, in name order. Certificates are checked to be
+// for the private key next to them, and every key identifier is resolved to the file of the certificate it belongs to.
+func describeOutput(t *testing.T, directory string, name string) string {
+
+	var (
+		tBuilder    strings.Builder
+		tOwners     = make(map[string]string) // Subject Key Id to the first certificate file with it.
+		tOutputFQNs []string
+	)
+
+	tFQNs, _ := filepath.Glob(filepath.Join(directory, "*"))
+	sort.Strings(tFQNs)
+	for _, tFQN := range tFQNs {
+		tBase := filepath.Base(tFQN)
+		if strings.HasSuffix(tBase, EXTENSION_CERTIFICATE) && strings.HasSuffix(tBase, EXTENSION_FULL_CHAIN) == false {
+			if tCertificates, tErrorInfo := readCertificates(tFQN); tErrorInfo.Error == nil {
+				tOwners[string(tCertificates[0].SubjectKeyId)] = tBase
+			}
+		}
+		if tBase == name || strings.HasPrefix(tBase, name+".") {
+			tOutputFQNs = append(tOutputFQNs, tFQN)
+		}
+	}
+
+	tPrivateKey, tErrorInfo := certs.ReadPrivateKey(filepath.Join(directory, name), ctv.VAL_EMPTY)
+	if tErrorInfo.Error != nil {
+		t.Fatalf("%s: %s", name, tErrorInfo.Error)
+	}
+
+	for _, tFQN := range tOutputFQNs {
+		tBase := filepath.Base(tFQN)
+		tInfoPtr, tErr := os.Stat(tFQN)
+		if tErr != nil {
+			t.Fatal(tErr)
+		}
+		fmt.Fprintf(&tBuilder, "%s %04o\n", tBase, tInfoPtr.Mode().Perm())
+
+		tData, _ := os.ReadFile(tFQN)
+		switch {
+		case strings.HasSuffix(tBase, EXTENSION_PKCS12):
+			verifyPKCS12Export(t, tFQN, tPrivateKey)
+			fmt.Fprintf(&tBuilder, "    PKCS#12, decrypts with the passphrase to the private key and the certificate chain\n")
+		case strings.HasSuffix(tBase, EXTENSION_DER_KEY):
+			tKey, tErr := x509.ParsePKCS8PrivateKey(tData)
+			if tErr != nil {
+				t.Fatalf("%s: %s", tBase, tErr)
+			}
+			fmt.Fprintf(&tBuilder, "    DER %s\n", describePrivateKey(tKey, tPrivateKey))
+		case strings.HasSuffix(tBase, EXTENSION_DER):
+			tCertificatePtr, tErr := x509.ParseCertificate(tData)
+			if tErr != nil {
+				t.Fatalf("%s: %s", tBase, tErr)
+			}
+			fmt.Fprintf(&tBuilder, "    DER certificate, same as %s: %t\n", name+EXTENSION_CERTIFICATE, bytes.Equal(tCertificatePtr.Raw, readFirstCertificate(t, filepath.Join(directory, name+EXTENSION_CERTIFICATE)).Raw))
+		default:
+			describePEMFile(t, &tBuilder, tFQN, tData, tPrivateKey, tOwners)
+		}
+	}
+
+	return tBuilder.String()
+}
+
+func describePEMFile(t *testing.T, builderPtr *strings.Builder, fqn string, data []byte, privateKey crypto.Signer, owners map[string]string) {
+
+	var (
+		tBase     = filepath.Base(fqn)
+		tBlockPtr *pem.Block
+	)
+
+	for {
+		if tBlockPtr, data = pem.Decode(data); tBlockPtr == nil {
+			break
+		}
+		fmt.Fprintf(builderPtr, "  %s\n", tBlockPtr.Type)
+		switch tBlockPtr.Type {
+		case PEM_CERTIFICATE:
+			tCertificatePtr, tErr := x509.ParseCertificate(tBlockPtr.Bytes)
+			if tErr != nil {
+				t.Fatalf("%s: %s", tBase, tErr)
+			}
+			describeCertificate(t, builderPtr, tCertificatePtr, privateKey, owners)
+		case PEM_PRIVATE_KEY:
+			tKey, tErr := x509.ParsePKCS8PrivateKey(tBlockPtr.Bytes)
+			if tErr != nil {
+				t.Fatalf("%s: %s", tBase, tErr)
+			}
+			fmt.Fprintf(builderPtr, "    %s\n", describePrivateKey(tKey, privateKey))
+		case PEM_ENCRYPTED_PRIVATE_KEY:
+			if tErrorInfo := verifyEncryptedKeyFile(fqn, TEST_PASSPHRASE, privateKey); tErrorInfo.Error != nil {
+				t.Fatalf("%s: %s", tBase, tErrorInfo.Error)
+			}
+			fmt.Fprintf(builderPtr, "    encrypted PKCS#8, decrypts with the passphrase to the private key\n")
+		case PEM_PUBLIC_KEY:
+			tKey, tErr := x509.ParsePKIXPublicKey(tBlockPtr.Bytes)
+			if tErr != nil {
+				t.Fatalf("%s: %s", tBase, tErr)
+			}
+			fmt.Fprintf(builderPtr, "    %s, matches the private key: %t\n", describePublicKey(tKey), certs.SamePublicKey(tKey, privateKey.Public()))
+		}
+	}
+}
+
+func describeCertificate(t *testing.T, builderPtr *strings.Builder, certificatePtr *x509.Certificate, privateKey crypto.Signer, owners map[string]string) {
+
+	tSubjectKeyId, _ := certs.SubjectKeyId(certificatePtr.PublicKey)
+
+	tLine := func(label string, value any) {
+		fmt.Fprintf(builderPtr, "    %-19s %v\n", label+":", value)
+	}
+
+	tLine("Subject", certificatePtr.Subject)
+	tLine("Issuer", certificatePtr.Issuer)
+	tLine("Public Key", describePublicKey(certificatePtr.PublicKey))
+	tLine("Own Key", certs.SamePublicKey(certificatePtr.PublicKey, privateKey.Public()))
+	tLine("Signature", certificatePtr.SignatureAlgorithm)
+	tLine("Serial", fmt.Sprintf("positive %t, at most %d bits %t", certificatePtr.SerialNumber.Sign() > 0, certs.SERIAL_NUMBER_BITS, certificatePtr.SerialNumber.BitLen() <= certs.SERIAL_NUMBER_BITS))
+	tLine("Validity", certificatePtr.NotAfter.Sub(certificatePtr.NotBefore))
+	switch {
+	case certificatePtr.IsCA && certificatePtr.MaxPathLen < 0, certificatePtr.IsCA && certificatePtr.MaxPathLen == 0 && certificatePtr.MaxPathLenZero == false:
+		tLine("Basic Constraints", "CA, unlimited path length")
+	case certificatePtr.IsCA:
+		tLine("Basic Constraints", fmt.Sprintf("CA, path length %d", certificatePtr.MaxPathLen))
+	default:
+		tLine("Basic Constraints", fmt.Sprintf("not a CA, present %t", certificatePtr.BasicConstraintsValid))
+	}
+	tLine("Key Usage", describeKeyUsage(certificatePtr.KeyUsage))
+	tLine("Ext Key Usage", describeExtKeyUsage(certificatePtr.ExtKeyUsage))
+	tLine("DNS Names", certificatePtr.DNSNames)
+	tLine("IP Addresses", certificatePtr.IPAddresses)
+	tLine("Email Addresses", certificatePtr.EmailAddresses)
+	tLine("URIs", certificatePtr.URIs)
+	tLine("Subject Key Id", fmt.Sprintf("SHA-1 of the public key %t", bytes.Equal(certificatePtr.SubjectKeyId, tSubjectKeyId)))
+	switch tOwner, ok := owners[string(certificatePtr.AuthorityKeyId)]; {
+	case len(certificatePtr.AuthorityKeyId) == 0:
+		tLine("Authority Key Id", "none")
+	case ok:
+		tLine("Authority Key Id", "Subject Key Id of "+tOwner)
+	default:
+		t.Errorf("%s: the Authority Key Id %x is not the Subject Key Id of any certificate", certificatePtr.Subject, certificatePtr.AuthorityKeyId)
+	}
+}
+
+func describeKeyUsage(keyUsage x509.KeyUsage) string {
+
+	var (
+		tNames []string
+	)
+
+	for tBit := x509.KeyUsage(1); tBit <= x509.KeyUsageDecipherOnly; tBit <<= 1 {
+		if keyUsage&tBit == 0 {
+			continue
+		}
+		for tName, tUsage := range keyUsageNames {
+			if tUsage == tBit {
+				tNames = append(tNames, tName)
+			}
+		}
+	}
+	if keyUsage>>bits.Len(uint(x509.KeyUsageDecipherOnly)) != 0 {
+		tNames = append(tNames, fmt.Sprintf("unknown %#x", uint(keyUsage)))
+	}
+
+	return strings.Join(tNames, ", ")
+}
+
+func describeExtKeyUsage(extKeyUsage []x509.ExtKeyUsage) string {
+
+	var (
+		tNames []string
+	)
+
+	if len(extKeyUsage) == 0 {
+		return "none"
+	}
+	for _, tUsage := range extKeyUsage {
+		tName := fmt.Sprintf("unknown %d", tUsage)
+		for tKnownName, tKnownUsage := range extKeyUsageNames {
+			if tKnownUsage == tUsage {
+				tName = tKnownName
+			}
+		}
+		tNames = append(tNames, tName)
+	}
+
+	return strings.Join(tNames, ", ")
+}
+
+func describePublicKey(publicKey crypto.PublicKey) string {
+
+	switch tPublicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", tPublicKey.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA " + tPublicKey.Curve.Params().Name
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+
+	return fmt.Sprintf("%T", publicKey)
+}
+
+func describePrivateKey(key any, privateKey crypto.Signer) string {
+
+	tSigner, ok := key.(crypto.Signer)
+	if ok == false {
+		return fmt.Sprintf("%T is not a signer", key)
+	}
+
+	return fmt.Sprintf("PKCS#8 %s private key, same key: %t", describePublicKey(tSigner.Public()), certs.SamePublicKey(tSigner.Public(), privateKey.Public()))
+}
+
+// generateTestCertificate - generates the certificate and key as <directory>/<name> and returns the base file name. Zero
+// fields take the command line defaults, except the key, which is Ed25519, and the validity, which is 30 days.
+func generateTestCertificate(t *testing.T, directory string, name string, request certificateRequest) (fqn string) {
+
+	t.Helper()
+
+	fqn = filepath.Join(directory, name)
+	request.CertificateFQN, request.PrivateKeyFQN = fqn, fqn
+	if request.Backdate == 0 {
+		request.Backdate = DEFAULT_BACKDATE
+	}
+	if request.KeyType == "" {
+		request.KeyType = KEY_TYPE_ED25519
+	}
+	if request.PathLength == 0 {
+		request.PathLength = DEFAULT_PATH_LENGTH
+	}
+	if request.Profile == "" {
+		request.Profile = DEFAULT_PROFILE
+	}
+	if request.ValidFor == "" && request.NotAfter == "" {
+		request.ValidFor = "30d"
+	}
+	if tErrorInfo := generateCertificate(request); tErrorInfo.Error != nil {
+		t.Fatalf("generateCertificate(%s): %s %s", name, tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	return
+}
+
+func readFirstCertificate(t *testing.T, fqn string) *x509.Certificate {
+
+	tCertificates, tErrorInfo := readCertificates(fqn)
+	if tErrorInfo.Error != nil {
+		t.Fatalf("%s: %s", fqn, tErrorInfo.Error)
+	}
+
+	return tCertificates[0]
+}
+
+func verifyPKCS12Export(t *testing.T, fqn string, privateKey crypto.Signer) {
+
+	tChainFQN := strings.TrimSuffix(fqn, EXTENSION_PKCS12) + EXTENSION_FULL_CHAIN
+	tCertificates, tErrorInfo := readCertificates(tChainFQN)
+	if tErrorInfo.Error != nil {
+		t.Fatalf("%s: %s", tChainFQN, tErrorInfo.Error)
+	}
+	if tErrorInfo = verifyPKCS12File(fqn, TEST_PASSPHRASE, privateKey, tCertificates); tErrorInfo.Error != nil {
+		t.Fatalf("%s: %s", fqn, tErrorInfo.Error)
+	}
+}
+
+// TestPostDatedCertificate - a certificate issued by a CA with a not_before a week away is not yet valid, which must not fail
+// the chain check once the files are written, whether it is generated or signed from a CSR.
+func TestPostDatedCertificate(t *testing.T) {
+
+	var (
+		tDirectory = t.TempDir()
+		tNotBefore = time.Now().AddDate(0, 0, 7).UTC().Truncate(time.Second)
+	)
+
+	tCAFQN := generateTestCertificate(t, tDirectory, "ca", certificateRequest{SelfCA: true, Subject: subjectRequest{CommonName: "Test CA"}, ValidFor: "365d"})
+	tCARequest := certificateRequest{
+		CACertificateFQN: tCAFQN + EXTENSION_CERTIFICATE,
+		CAPrivateKeyFQN:  tCAFQN,
+		NotBefore:        tNotBefore.Format(time.RFC3339),
+		Profile:          "server",
+		SANs:             sanRequest{DNSNames: []string{"www.example.com"}},
+	}
+
+	tGeneratedFQN := generateTestCertificate(t, tDirectory, "generated", tCARequest)
+
+	tSignedFQN := filepath.Join(tDirectory, "signed")
+	if tErrorInfo := generateCSR(csrRequest{CSRFQN: tSignedFQN, KeyType: KEY_TYPE_ED25519, PrivateKeyFQN: tSignedFQN, SANs: tCARequest.SANs}); tErrorInfo.Error != nil {
+		t.Fatalf("generateCSR: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+	tCARequest.CertificateFQN = tSignedFQN
+	tCARequest.PathLength = DEFAULT_PATH_LENGTH
+	tCARequest.ValidFor = "30d"
+	if tErrorInfo := signCSR(tCARequest, tSignedFQN+EXTENSION_CSR); tErrorInfo.Error != nil {
+		t.Fatalf("signCSR: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	for _, tFQN := range []string{tGeneratedFQN, tSignedFQN} {
+		if tGot := readFirstCertificate(t, tFQN+EXTENSION_CERTIFICATE).NotBefore; tGot.Equal(tNotBefore) == false {
+			t.Errorf("%s NotBefore = %s, want %s", tFQN, tGot, tNotBefore)
+		}
+	}
+}
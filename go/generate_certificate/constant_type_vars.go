@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	certs "certificate_services"
+)
+
+//goland:noinspection ALL
+const (
+	APPLICATION_NAME = "Generate Certificate"
+	VERSION          = "2024.1.0"
+)
+
+//goland:noinspection ALL
+const (
+	PEM_CERTIFICATE           = "CERTIFICATE"
+	PEM_CERTIFICATE_REQUEST   = "CERTIFICATE REQUEST"
+	PEM_EC_PRIVATE_KEY        = certs.PEM_EC_PRIVATE_KEY
+	PEM_ENCRYPTED_PRIVATE_KEY = certs.PEM_ENCRYPTED_PRIVATE_KEY
+	PEM_PRIVATE_KEY           = certs.PEM_PRIVATE_KEY
+	PEM_PUBLIC_KEY            = "PUBLIC KEY"
+	PEM_RSA_PRIVATE_KEY       = certs.PEM_RSA_PRIVATE_KEY
+	//
+	EXTENSION_BACKUP        = ".bak"
+	EXTENSION_CERTIFICATE   = ".pem"
+	EXTENSION_CSR           = ".csr"
+	EXTENSION_DER           = ".der"
+	EXTENSION_DER_KEY       = ".key.der"
+	EXTENSION_ENCRYPTED_KEY = ".encrypted"
+	EXTENSION_FULL_CHAIN    = ".fullchain.pem"
+	EXTENSION_PKCS12        = ".p12"
+	EXTENSION_PUBLIC_KEY    = ".pub"
+	//
+	DEFAULT_PATH_LENGTH = -1
+	DEFAULT_PROFILE     = "peer"
+	//
+	DEFAULT_SUBJECT_COUNTRY      = "US"
+	DEFAULT_SUBJECT_LOCALITY     = "San Francisco Bay Area"
+	DEFAULT_SUBJECT_ORGANIZATION = "STY Holdings Inc"
+	DEFAULT_SUBJECT_PROVINCE     = "California"
+	//
+	KEY_TYPE_ECDSA_P256 = certs.KEY_TYPE_ECDSA_P256
+	KEY_TYPE_ECDSA_P384 = certs.KEY_TYPE_ECDSA_P384
+	KEY_TYPE_ED25519    = certs.KEY_TYPE_ED25519
+	KEY_TYPE_RSA        = certs.KEY_TYPE_RSA
+	//
+	DEFAULT_KEY_TYPE = KEY_TYPE_RSA
+	DEFAULT_RSA_BITS = 4096
+	MIN_RSA_BITS     = 1024
+	//
+	DEFAULT_BACKDATE   = 5 * time.Minute
+	MAX_VALIDITY_YEARS = 100
+	//
+	DEFAULT_RENEW_WITHIN_DAYS = 30
+	//
+	PRIVATE_FILE_PERMISSIONS = 0600 // Private keys and PKCS#12 files.
+	PUBLIC_FILE_PERMISSIONS  = 0644 // Certificates, chains, public keys and CSRs.
+	//
+	EXPORT_DER             = "der"
+	EXPORT_FULL_CHAIN      = "fullchain"
+	EXPORT_PKCS12          = "pkcs12"
+	EXPORT_PKCS12_LEGACY   = "pkcs12_legacy"
+	EXPORT_PKCS8_ENCRYPTED = "pkcs8_encrypted"
+	//
+	PASSPHRASE_ENVIRONMENT_VARIABLE = "GENERATE_CERTIFICATE_PASSPHRASE"
+)
+
+var (
+	defaultSubject = subjectRequest{
+		Country:      DEFAULT_SUBJECT_COUNTRY,
+		Locality:     DEFAULT_SUBJECT_LOCALITY,
+		Organization: DEFAULT_SUBJECT_ORGANIZATION,
+		Province:     DEFAULT_SUBJECT_PROVINCE,
+	}
+)
+
+var (
+	ErrCertificateKeyMismatch = errors.New("the certificate public key does not match the private key")
+	ErrCertificateNameInvalid = errors.New("the certificate file must have the " + EXTENSION_CERTIFICATE + " extension")
+	ErrCSRExtensionNotAllowed = errors.New("the certificate signing request asks for an extension the profile does not allow")
+	ErrExportInvalid          = errors.New("the export must be " + EXPORT_DER + ", " + EXPORT_FULL_CHAIN + ", " + EXPORT_PKCS12 + ", " + EXPORT_PKCS12_LEGACY + " or " + EXPORT_PKCS8_ENCRYPTED)
+	ErrExportNeedsKey         = errors.New("the export holds the private key, which sign does not have")
+	ErrIssuerInvalid          = errors.New("the CA certificate must be an unexpired CA with the Certificate Sign key usage")
+	ErrIssuerMismatch         = errors.New("the ca_cert did not sign the certificate being renewed")
+	ErrIssuerRequired         = errors.New("both the ca_cert and the ca_key are required to issue a CA-signed certificate")
+	ErrKeyTypeInvalid         = certs.ErrKeyTypeInvalid
+	ErrPathLengthExceeded     = errors.New("the CA's path length constraint does not allow it to issue this CA certificate")
+	ErrPassphraseRequired     = errors.New("the export needs a passphrase from the passphrase_file or the " + PASSPHRASE_ENVIRONMENT_VARIABLE + " environment variable")
+	ErrPEMInvalid             = certs.ErrPEMInvalid
+	ErrPrivateKeyNotFound     = errors.New("no private key in the certificate's directory matches the certificate, so give it with key_name")
+	ErrProfileInvalid         = errors.New("the profile is not defined or has an invalid setting")
+	ErrRenewFailed            = errors.New("one or more certificates in the directory could not be renewed")
+	ErrRSABitsTooSmall        = certs.ErrRSABitsTooSmall
+	ErrSANInvalid             = errors.New("the subject alternative name is not a valid DNS name, IP address, email address or URI")
+	ErrSANRequired            = errors.New("at least one subject alternative name (hostname, dns, ip, email or uri) or a common_name is required")
+	ErrSelfCAWithIssuer       = errors.New("a certificate cannot be both its own CA (self_CA) and signed by another CA (ca_cert)")
+	ErrValidForInvalid        = errors.New("the valid_for must be <digits><unit> repeated, with units y, m (months), w and d, such as 90d or 2y6m, or a Go duration such as 720h, and at most 100 years")
+	ErrValidityConflict       = errors.New("give either the valid_for or the not_after, not both")
+	ErrValidityExceedsIssuer  = errors.New("the certificate cannot be valid for longer than the CA certificate that signs it")
+	ErrValidityExceedsProfile = errors.New("the certificate cannot be valid for longer than the profile's max_validity")
+	ErrValidityInvalid        = errors.New("the not_before and not_after must be RFC 3339 times, such as 2025-01-31T00:00:00Z, with not_after later and still to come, and the backdate cannot be negative")
+)
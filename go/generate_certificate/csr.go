@@ -0,0 +1,302 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"slices"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+var (
+	oidExtensionAuthorityKeyIdentifier = asn1.ObjectIdentifier{2, 5, 29, 35}
+	oidExtensionBasicConstraints       = asn1.ObjectIdentifier{2, 5, 29, 19}
+	oidExtensionExtendedKeyUsage       = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionKeyUsage               = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionSubjectAltName         = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionSubjectKeyIdentifier   = asn1.ObjectIdentifier{2, 5, 29, 14}
+	// The extended key usages in extKeyUsageNames, by OID.
+	extKeyUsageOIDs = map[string]x509.ExtKeyUsage{
+		"2.5.29.37.0":       x509.ExtKeyUsageAny,
+		"1.3.6.1.5.5.7.3.1": x509.ExtKeyUsageServerAuth,
+		"1.3.6.1.5.5.7.3.2": x509.ExtKeyUsageClientAuth,
+		"1.3.6.1.5.5.7.3.3": x509.ExtKeyUsageCodeSigning,
+		"1.3.6.1.5.5.7.3.4": x509.ExtKeyUsageEmailProtection,
+		"1.3.6.1.5.5.7.3.8": x509.ExtKeyUsageTimeStamping,
+		"1.3.6.1.5.5.7.3.9": x509.ExtKeyUsageOCSPSigning,
+	}
+)
+
+// csrRequest - what the csr command generates. File names are given without an extension.
+type csrRequest struct {
+	CSRFQN        string         // The request is written to <CSRFQN>.csr.
+	KeyType       string         // One of the KEY_TYPE_ values.
+	PrivateKeyFQN string         // The private key is written here and the public key to <PrivateKeyFQN>.pub.
+	RSABits       int            // Only used when KeyType is KEY_TYPE_RSA.
+	SANs          sanRequest     // At least one name, or Subject.CommonName, is required.
+	Subject       subjectRequest // Empty fields take the DEFAULT_SUBJECT_ values.
+}
+
+// generateCSR - creates a key pair and a PKCS#10 certificate signing request for it, then reads the files back to check them.
+// The request only carries the subject alternative names. The CA that signs it decides the rest.
+//
+//	Customer Messages: None
+//	Errors: ErrCertificateKeyMismatch, ErrSANRequired, errors returned by certs.GenerateKey, sanRequest.apply, x509, writeOutPEMFile,
+//	writeKeyFiles and readCSR
+//	Verifications: None
+func generateCSR(request csrRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCSR        []byte
+		tCSRPtr     *x509.CertificateRequest
+		tNames      x509.Certificate
+		tPrivateKey crypto.Signer
+		tSubject    = request.Subject.withDefaults(defaultSubject)
+	)
+
+	if request.SANs.empty() && request.Subject.CommonName == ctv.VAL_EMPTY {
+		errorInfo = errs.NewErrorInfo(ErrSANRequired, fmt.Sprintf("CSR File: %s", request.CSRFQN))
+		return
+	}
+	if errorInfo = request.SANs.apply(&tNames); errorInfo.Error != nil {
+		return
+	}
+	if tSubject.CommonName == ctv.VAL_EMPTY && len(tNames.DNSNames) > 0 {
+		tSubject.CommonName = tNames.DNSNames[0]
+	}
+
+	if tPrivateKey, errorInfo = certs.GenerateKey(request.KeyType, request.RSABits, MIN_RSA_BITS); errorInfo.Error != nil {
+		return
+	}
+	if tCSR, errorInfo.Error = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:        tSubject.name(),
+		DNSNames:       tNames.DNSNames,
+		EmailAddresses: tNames.EmailAddresses,
+		IPAddresses:    tNames.IPAddresses,
+		URIs:           tNames.URIs,
+	}, tPrivateKey); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Subject: %s", tSubject.name()))
+		return
+	}
+
+	if errorInfo = writeOutPEMFile(request.CSRFQN+EXTENSION_CSR, tCSR, PEM_CERTIFICATE_REQUEST); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writeKeyFiles(request.PrivateKeyFQN, tPrivateKey); errorInfo.Error != nil {
+		return
+	}
+	if tCSRPtr, errorInfo = readCSR(request.CSRFQN + EXTENSION_CSR); errorInfo.Error != nil {
+		return
+	}
+	if certs.SamePublicKey(tCSRPtr.PublicKey, tPrivateKey.Public()) == false {
+		errorInfo = errs.NewErrorInfo(ErrCertificateKeyMismatch, fmt.Sprintf("CSR File: %s", request.CSRFQN+EXTENSION_CSR))
+		return
+	}
+
+	fmt.Println("The keys and certificate signing request have been generated successfully.")
+	fmt.Printf("%sSubject: %s\n", ctv.SPACES_FOUR, tCSRPtr.Subject)
+	fmt.Printf("%sCSR File: %s\n", ctv.SPACES_FOUR, request.CSRFQN+EXTENSION_CSR)
+	fmt.Printf("%sPrivate Key File: %s\n", ctv.SPACES_FOUR, request.PrivateKeyFQN)
+	fmt.Printf("%sPublic Key File: %s\n", ctv.SPACES_FOUR, request.PrivateKeyFQN+EXTENSION_PUBLIC_KEY)
+
+	return
+}
+
+// signCSR - issues a certificate for the public key in the CSR, signed by the CA in the request. The subject and subject
+// alternative names come from the CSR, and the subject and SAN flags add to them. A subject field that neither has is left
+// out, not taken from the profile or the defaults. The profile decides the key usages, and a CSR that asks for an extension
+// the profile does not allow is refused.
+//
+//	Customer Messages: None
+//	Errors: ErrIssuerRequired, ErrSANRequired, ErrSelfCAWithIssuer, errors returned by checkExports, readCSR, loadProfile,
+//	validityWindow, loadIssuer, checkCSRExtensions, generateCertificateFile, verifySignedFiles and exportFiles
+//	Verifications: None
+func signCSR(request certificateRequest, csrFQN string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCSRPtr    *x509.CertificateRequest
+		tIssuerPtr *issuer
+		tProfile   profile
+	)
+
+	if request.SelfCA {
+		errorInfo = errs.NewErrorInfo(ErrSelfCAWithIssuer, fmt.Sprintf("CSR File: %s", csrFQN))
+		return
+	}
+	if _, errorInfo = checkExports(request.Exports, request.PassphraseFQN, false); errorInfo.Error != nil {
+		return
+	}
+	if tCSRPtr, errorInfo = readCSR(csrFQN); errorInfo.Error != nil {
+		return
+	}
+	if tProfile, errorInfo = loadProfile(request.ProfileFQN, request.Profile); errorInfo.Error != nil {
+		return
+	}
+	if _, _, errorInfo = request.validityWindow(time.Now(), tProfile); errorInfo.Error != nil {
+		return
+	}
+	if tIssuerPtr, errorInfo = loadIssuer(request.CACertificateFQN, request.CAPrivateKeyFQN); errorInfo.Error != nil {
+		return
+	}
+	if request.ExtraExtensions, errorInfo = checkCSRExtensions(tCSRPtr, tProfile, request.Profile); errorInfo.Error != nil {
+		return
+	}
+
+	request.KeepSubject = true
+	request.Subject = request.Subject.withDefaults(subjectFromName(tCSRPtr.Subject))
+	request.SANs.DNSNames = append(request.SANs.DNSNames, tCSRPtr.DNSNames...)
+	request.SANs.EmailAddresses = append(request.SANs.EmailAddresses, tCSRPtr.EmailAddresses...)
+	for _, tIP := range tCSRPtr.IPAddresses {
+		request.SANs.IPAddresses = append(request.SANs.IPAddresses, tIP.String())
+	}
+	for _, tURLPtr := range tCSRPtr.URIs {
+		request.SANs.URIs = append(request.SANs.URIs, tURLPtr.String())
+	}
+	if request.SANs.empty() && request.Subject.CommonName == ctv.VAL_EMPTY {
+		errorInfo = errs.NewErrorInfo(ErrSANRequired, fmt.Sprintf("CSR File: %s", csrFQN))
+		return
+	}
+
+	if errorInfo = generateCertificateFile(request, tProfile, tCSRPtr.PublicKey, nil, tIssuerPtr); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = verifySignedFiles(request, tCSRPtr.PublicKey, tIssuerPtr); errorInfo.Error != nil {
+		return
+	}
+
+	fmt.Println("The certificate signing request has been signed successfully.")
+	fmt.Printf("%sProfile: %s\n", ctv.SPACES_FOUR, request.Profile)
+	fmt.Printf("%sCertificate File: %s\n", ctv.SPACES_FOUR, request.CertificateFQN+EXTENSION_CERTIFICATE)
+	fmt.Printf("%sChain File: %s\n", ctv.SPACES_FOUR, request.CertificateFQN+EXTENSION_FULL_CHAIN)
+	fmt.Printf("%sIssuer: %s\n", ctv.SPACES_FOUR, tIssuerPtr.Chain[0].Subject)
+
+	return exportFiles(request, ctv.VAL_EMPTY, nil)
+}
+
+// checkCSRExtensions - every extension the CSR asks for must be allowed by the profile. Subject alternative names are always
+// allowed, and a Subject Key Identifier is ignored because a new one is computed. Key usages, extended key usages and a CA
+// basic constraint must be within the profile. Any other extension must be listed in the profile's csr_extensions, and those
+// are returned to be copied into the certificate.
+//
+//	Customer Messages: None
+//	Errors: ErrCSRExtensionNotAllowed, errors returned by asn1
+//	Verifications: None
+func checkCSRExtensions(csrPtr *x509.CertificateRequest, certificateProfile profile, profileName string) (extraExtensions []pkix.Extension, errorInfo errs.ErrorInfo) {
+
+	var (
+		tAllowedExtKeyUsage []x509.ExtKeyUsage
+		tAllowedKeyUsage    x509.KeyUsage
+	)
+
+	// loadProfile has already checked the usage names.
+	tAllowedKeyUsage, _ = certificateProfile.keyUsage(csrPtr.PublicKey)
+	if len(certificateProfile.KeyUsage) == 0 {
+		tAllowedKeyUsage = certs.KeyUsageForKey(csrPtr.PublicKey)
+	}
+	tAllowedExtKeyUsage, _ = certificateProfile.extKeyUsage()
+
+	notAllowed := func(extension pkix.Extension, detail string) errs.ErrorInfo {
+		return errs.NewErrorInfo(ErrCSRExtensionNotAllowed, fmt.Sprintf("Profile: %s Extension: %s %s", profileName, extension.Id, detail))
+	}
+
+	for _, tExtension := range csrPtr.Extensions {
+		switch {
+		case tExtension.Id.Equal(oidExtensionSubjectAltName), tExtension.Id.Equal(oidExtensionSubjectKeyIdentifier):
+		case tExtension.Id.Equal(oidExtensionKeyUsage):
+			var tBits asn1.BitString
+			if _, errorInfo.Error = asn1.Unmarshal(tExtension.Value, &tBits); errorInfo.Error != nil {
+				return nil, errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Extension: %s", tExtension.Id))
+			}
+			var tKeyUsage x509.KeyUsage
+			for tBit := 0; tBit < 9; tBit++ {
+				if tBits.At(tBit) != 0 {
+					tKeyUsage |= 1 << tBit
+				}
+			}
+			if tKeyUsage&^tAllowedKeyUsage != 0 {
+				return nil, notAllowed(tExtension, "asks for a key usage the profile does not have")
+			}
+		case tExtension.Id.Equal(oidExtensionExtendedKeyUsage):
+			var tOIDs []asn1.ObjectIdentifier
+			if _, errorInfo.Error = asn1.Unmarshal(tExtension.Value, &tOIDs); errorInfo.Error != nil {
+				return nil, errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Extension: %s", tExtension.Id))
+			}
+			for _, tOID := range tOIDs {
+				tExtKeyUsage, ok := extKeyUsageOIDs[tOID.String()]
+				if ok == false || (slices.Contains(tAllowedExtKeyUsage, tExtKeyUsage) == false && slices.Contains(tAllowedExtKeyUsage, x509.ExtKeyUsageAny) == false) {
+					return nil, notAllowed(tExtension, fmt.Sprintf("asks for the extended key usage %s, which the profile does not have", tOID))
+				}
+			}
+		case tExtension.Id.Equal(oidExtensionBasicConstraints):
+			var tConstraints struct {
+				IsCA       bool `asn1:"optional"`
+				MaxPathLen int  `asn1:"optional,default:-1"`
+			}
+			if _, errorInfo.Error = asn1.Unmarshal(tExtension.Value, &tConstraints); errorInfo.Error != nil {
+				return nil, errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Extension: %s", tExtension.Id))
+			}
+			if tConstraints.IsCA && certificateProfile.IsCA == false {
+				return nil, notAllowed(tExtension, "asks to be a CA and the profile is not is_ca")
+			}
+		case slices.Contains(certificateProfile.CSRExtensions, tExtension.Id.String()):
+			extraExtensions = append(extraExtensions, tExtension)
+		default:
+			return nil, notAllowed(tExtension, "is not in the profile's csr_extensions")
+		}
+	}
+
+	return
+}
+
+// readCSR - parses the PEM encoded request and checks its signature, which proves the requester holds the private key.
+//
+//	Customer Messages: None
+//	Errors: errors returned by readPEMFile and x509
+//	Verifications: None
+func readCSR(fqn string) (csrPtr *x509.CertificateRequest, errorInfo errs.ErrorInfo) {
+
+	var (
+		tDER []byte
+	)
+
+	if tDER, errorInfo = readPEMFile(fqn, PEM_CERTIFICATE_REQUEST); errorInfo.Error != nil {
+		return
+	}
+	if csrPtr, errorInfo.Error = x509.ParseCertificateRequest(tDER); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("CSR File: %s", fqn))
+		return
+	}
+	if errorInfo.Error = csrPtr.CheckSignature(); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("CSR File: %s", fqn))
+		return nil, errorInfo
+	}
+
+	return
+}
+
+// subjectFromName - the first value of each subject field the utility supports. Other fields are dropped.
+func subjectFromName(name pkix.Name) (subject subjectRequest) {
+
+	first := func(values []string) string {
+		if len(values) == 0 {
+			return ctv.VAL_EMPTY
+		}
+		return values[0]
+	}
+
+	return subjectRequest{
+		CommonName:         name.CommonName,
+		Country:            first(name.Country),
+		Locality:           first(name.Locality),
+		Organization:       first(name.Organization),
+		OrganizationalUnit: first(name.OrganizationalUnit),
+		Province:           first(name.Province),
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+)
+
+// newTestCSR - an Ed25519 request for www.example.com asking for the extensions.
+func newTestCSR(t *testing.T, extensions ...pkix.Extension) (csrPtr *x509.CertificateRequest) {
+
+	t.Helper()
+
+	tPrivateKey, tErrorInfo := certs.GenerateKey(KEY_TYPE_ED25519, 0, MIN_RSA_BITS)
+	if tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+	tDER, tErr := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		DNSNames:        []string{"www.example.com"},
+		ExtraExtensions: extensions,
+	}, tPrivateKey)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	if csrPtr, tErr = x509.ParseCertificateRequest(tDER); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	return
+}
+
+// testExtension - a CSR extension with the DER encoding of value.
+func testExtension(t *testing.T, id asn1.ObjectIdentifier, value any) pkix.Extension {
+
+	tValue, tErr := asn1.Marshal(value)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	return pkix.Extension{Id: id, Value: tValue}
+}
+
+// testKeyUsage - the key usage bit string, where bit 0 is digital_signature and bit 5 is cert_sign.
+func testKeyUsage(bits ...int) asn1.BitString {
+
+	var (
+		tBitString = asn1.BitString{Bytes: make([]byte, 2), BitLength: 9}
+	)
+
+	for _, tBit := range bits {
+		tBitString.Bytes[tBit/8] |= 0x80 >> (tBit % 8)
+	}
+
+	return tBitString
+}
+
+func TestCheckCSRExtensions(t *testing.T) {
+
+	var (
+		tCustomOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+		tProfiles  = make(map[string]profile)
+	)
+
+	for _, tName := range []string{"server", "intermediate"} {
+		tProfile, tErrorInfo := loadProfile("", tName)
+		if tErrorInfo.Error != nil {
+			t.Fatal(tErrorInfo.Error)
+		}
+		tProfiles[tName] = tProfile
+	}
+	tCustom := tProfiles["server"]
+	tCustom.CSRExtensions = []string{tCustomOID.String()}
+	tProfiles["custom"] = tCustom
+
+	for _, tCase := range []struct {
+		name      string
+		profile   string
+		extension pkix.Extension
+		wantErr   error
+		wantExtra bool
+	}{
+		{name: "subject key identifier", profile: "server", extension: testExtension(t, oidExtensionSubjectKeyIdentifier, []byte{1, 2, 3})},
+		{name: "digital signature", profile: "server", extension: testExtension(t, oidExtensionKeyUsage, testKeyUsage(0))},
+		{name: "cert sign", profile: "server", extension: testExtension(t, oidExtensionKeyUsage, testKeyUsage(0, 5)), wantErr: ErrCSRExtensionNotAllowed},
+		{name: "cert sign for a CA", profile: "intermediate", extension: testExtension(t, oidExtensionKeyUsage, testKeyUsage(0, 5))},
+		{name: "server auth", profile: "server", extension: testExtension(t, oidExtensionExtendedKeyUsage, []asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 1}})},
+		{name: "client auth", profile: "server", extension: testExtension(t, oidExtensionExtendedKeyUsage, []asn1.ObjectIdentifier{{1, 3, 6, 1, 5, 5, 7, 3, 2}}), wantErr: ErrCSRExtensionNotAllowed},
+		{name: "unknown extended key usage", profile: "server", extension: testExtension(t, oidExtensionExtendedKeyUsage, []asn1.ObjectIdentifier{tCustomOID}), wantErr: ErrCSRExtensionNotAllowed},
+		{name: "not a CA", profile: "server", extension: testExtension(t, oidExtensionBasicConstraints, struct{}{})},
+		{name: "CA", profile: "server", extension: testExtension(t, oidExtensionBasicConstraints, struct{ IsCA bool }{true}), wantErr: ErrCSRExtensionNotAllowed},
+		{name: "CA for a CA", profile: "intermediate", extension: testExtension(t, oidExtensionBasicConstraints, struct{ IsCA bool }{true})},
+		{name: "listed", profile: "custom", extension: testExtension(t, tCustomOID, "value"), wantExtra: true},
+		{name: "not listed", profile: "server", extension: testExtension(t, tCustomOID, "value"), wantErr: ErrCSRExtensionNotAllowed},
+		{name: "malformed key usage", profile: "server", extension: pkix.Extension{Id: oidExtensionKeyUsage, Value: []byte{0xff}}, wantErr: asn1.SyntaxError{}},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			tExtra, tErrorInfo := checkCSRExtensions(newTestCSR(t, tCase.extension), tProfiles[tCase.profile], tCase.profile)
+			switch {
+			case tCase.wantErr == nil && tErrorInfo.Error != nil:
+				t.Fatalf("checkCSRExtensions: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+			case tCase.wantErr == ErrCSRExtensionNotAllowed && errors.Is(tErrorInfo.Error, ErrCSRExtensionNotAllowed) == false:
+				t.Fatalf("checkCSRExtensions error = %v, want %s", tErrorInfo.Error, ErrCSRExtensionNotAllowed)
+			case tCase.wantErr != nil && tErrorInfo.Error == nil:
+				t.Fatal("checkCSRExtensions allowed a malformed extension")
+			}
+			if tGotExtra := slices.ContainsFunc(tExtra, func(extension pkix.Extension) bool { return extension.Id.Equal(tCustomOID) }); tGotExtra != tCase.wantExtra {
+				t.Errorf("the extension was returned to copy: %t, want %t", tGotExtra, tCase.wantExtra)
+			}
+		})
+	}
+}
+
+// TestGenerateAndSignCSR - a CSR from generateCSR is signed by a CA with signCSR. The certificate carries the CSR's key, names
+// and subject, which generateCSR filled from the defaults, plus the subject flags.
+func TestGenerateAndSignCSR(t *testing.T) {
+
+	var (
+		tDirectory = t.TempDir()
+		tCSRFQN    = filepath.Join(tDirectory, "www")
+		tKeyFQN    = filepath.Join(tDirectory, "www-key")
+	)
+
+	tCAFQN := generateTestCertificate(t, tDirectory, "ca", certificateRequest{SelfCA: true, Subject: subjectRequest{CommonName: "Test CA"}, ValidFor: "365d"})
+
+	if tErrorInfo := generateCSR(csrRequest{
+		CSRFQN:        tCSRFQN,
+		KeyType:       KEY_TYPE_ECDSA_P256,
+		PrivateKeyFQN: tKeyFQN,
+		SANs:          sanRequest{DNSNames: []string{"www.example.com"}, IPAddresses: []string{"192.0.2.1"}},
+		Subject:       subjectRequest{CommonName: "www.example.com", Organization: "Example Org", Country: "NZ"},
+	}); tErrorInfo.Error != nil {
+		t.Fatalf("generateCSR: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	if tErrorInfo := signCSR(certificateRequest{
+		Backdate:         DEFAULT_BACKDATE,
+		CACertificateFQN: tCAFQN + EXTENSION_CERTIFICATE,
+		CAPrivateKeyFQN:  tCAFQN,
+		CertificateFQN:   tCSRFQN,
+		PathLength:       DEFAULT_PATH_LENGTH,
+		Profile:          "server",
+		SANs:             sanRequest{DNSNames: []string{"api.example.com"}},
+		Subject:          subjectRequest{OrganizationalUnit: "Web"},
+		ValidFor:         "90d",
+	}, tCSRFQN+EXTENSION_CSR); tErrorInfo.Error != nil {
+		t.Fatalf("signCSR: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	tCertificatePtr := readFirstCertificate(t, tCSRFQN+EXTENSION_CERTIFICATE)
+	tPrivateKey, tErrorInfo := certs.ReadPrivateKey(tKeyFQN, ctv.VAL_EMPTY)
+	if tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+	if certs.SamePublicKey(tCertificatePtr.PublicKey, tPrivateKey.Public()) == false {
+		t.Error("the certificate is not for the CSR's key")
+	}
+	if tErr := tCertificatePtr.CheckSignatureFrom(readFirstCertificate(t, tCAFQN+EXTENSION_CERTIFICATE)); tErr != nil {
+		t.Errorf("the certificate is not signed by the CA: %s", tErr)
+	}
+
+	tWantSubject := "CN=www.example.com,OU=Web,O=Example Org,L=San Francisco Bay Area,ST=California,C=NZ"
+	if tCertificatePtr.Subject.String() != tWantSubject {
+		t.Errorf("subject = %s, want %s", tCertificatePtr.Subject, tWantSubject)
+	}
+	if slices.Equal(tCertificatePtr.DNSNames, []string{"api.example.com", "www.example.com"}) == false || len(tCertificatePtr.IPAddresses) != 1 {
+		t.Errorf("names = %v %v, want api.example.com, www.example.com and 192.0.2.1", tCertificatePtr.DNSNames, tCertificatePtr.IPAddresses)
+	}
+	if slices.Equal(tCertificatePtr.ExtKeyUsage, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}) == false {
+		t.Errorf("extended key usage = %v, want server auth", tCertificatePtr.ExtKeyUsage)
+	}
+}
+
+// TestSignCSRSubjectOnlyFromCSR - a CSR with only a common name gets no organization, locality or country from the defaults.
+func TestSignCSRSubjectOnlyFromCSR(t *testing.T) {
+
+	var (
+		tDirectory = t.TempDir()
+		tCSRFQN    = filepath.Join(tDirectory, "nats")
+	)
+
+	tCAFQN := generateTestCertificate(t, tDirectory, "ca", certificateRequest{SelfCA: true, Subject: subjectRequest{CommonName: "Test CA"}, ValidFor: "365d"})
+
+	// generateCSR fills the subject from the defaults, so the request is built here with only a common name.
+	tPrivateKey, tErrorInfo := certs.GenerateKey(KEY_TYPE_ED25519, 0, MIN_RSA_BITS)
+	if tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+	tDER, tErr := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "nats"}}, tPrivateKey)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	if tErrorInfo = writeOutPEMFile(tCSRFQN+EXTENSION_CSR, tDER, PEM_CERTIFICATE_REQUEST); tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+
+	if tErrorInfo = signCSR(certificateRequest{
+		Backdate:         DEFAULT_BACKDATE,
+		CACertificateFQN: tCAFQN + EXTENSION_CERTIFICATE,
+		CAPrivateKeyFQN:  tCAFQN,
+		CertificateFQN:   tCSRFQN,
+		PathLength:       DEFAULT_PATH_LENGTH,
+		Profile:          "client",
+		ValidFor:         "30d",
+	}, tCSRFQN+EXTENSION_CSR); tErrorInfo.Error != nil {
+		t.Fatalf("signCSR: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	if tSubject := readFirstCertificate(t, tCSRFQN+EXTENSION_CERTIFICATE).Subject.String(); tSubject != "CN=nats" {
+		t.Errorf("subject = %s, want CN=nats", tSubject)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/youmark/pkcs8"
+	"software.sslmate.com/src/go-pkcs12"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// exportFormats - the formats that need the private key are true.
+var exportFormats = map[string]bool{
+	EXPORT_DER:             false,
+	EXPORT_FULL_CHAIN:      false,
+	EXPORT_PKCS12:          true,
+	EXPORT_PKCS12_LEGACY:   true,
+	EXPORT_PKCS8_ENCRYPTED: true,
+}
+
+// checkExports - the formats must be known, and the private key must be at hand for those that hold it. The passphrase is read
+// when a format needs one, from the passphrase file or else the PASSPHRASE_ENVIRONMENT_VARIABLE. This runs before anything is
+// written, so a bad export leaves no files behind.
+//
+//	Customer Messages: None
+//	Errors: ErrExportInvalid, ErrExportNeedsKey, ErrPassphraseRequired, errors returned by os
+//	Verifications: None
+func checkExports(exports []string, passphraseFQN string, hasPrivateKey bool) (passphrase string, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData          []byte
+		tNeedsPassword bool
+	)
+
+	for _, tExport := range exports {
+		tNeedsKey, ok := exportFormats[tExport]
+		switch {
+		case ok == false:
+			errorInfo = errs.NewErrorInfo(ErrExportInvalid, fmt.Sprintf("Export: %s", tExport))
+			return
+		case tNeedsKey && hasPrivateKey == false:
+			errorInfo = errs.NewErrorInfo(ErrExportNeedsKey, fmt.Sprintf("Export: %s", tExport))
+			return
+		}
+		tNeedsPassword = tNeedsPassword || tNeedsKey
+	}
+	if slices.Contains(exports, EXPORT_PKCS12) && slices.Contains(exports, EXPORT_PKCS12_LEGACY) {
+		errorInfo = errs.NewErrorInfo(ErrExportInvalid, fmt.Sprintf("Export: %s and %s both write %s", EXPORT_PKCS12, EXPORT_PKCS12_LEGACY, EXTENSION_PKCS12))
+		return
+	}
+	if tNeedsPassword == false {
+		return
+	}
+
+	if passphraseFQN != ctv.VAL_EMPTY {
+		if tData, errorInfo.Error = os.ReadFile(passphraseFQN); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Passphrase File: %s", passphraseFQN))
+			return
+		}
+		// Only the first line, so a trailing newline from an editor or echo is not part of the passphrase.
+		passphrase, _, _ = strings.Cut(string(tData), "\n")
+		passphrase = strings.TrimSuffix(passphrase, "\r")
+	} else {
+		passphrase = os.Getenv(PASSPHRASE_ENVIRONMENT_VARIABLE)
+	}
+	if passphrase == ctv.VAL_EMPTY {
+		errorInfo = errs.NewErrorInfo(ErrPassphraseRequired, fmt.Sprintf("Exports: %s", strings.Join(exports, ", ")))
+	}
+
+	return
+}
+
+// exportFiles - writes the certificate, and the private key when there is one, in the other formats, reads each file back to
+// check it and prints its name.
+//
+//	Customer Messages: None
+//	Errors: ErrCertificateKeyMismatch, errors returned by readCertificates, x509, pkcs8, pkcs12 and certs.WriteOutFile
+//	Verifications: None
+func exportFiles(request certificateRequest, passphrase string, privateKey crypto.Signer) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertificates []*x509.Certificate
+		tChainFQN     = request.CertificateFQN + EXTENSION_FULL_CHAIN
+		tData         []byte
+		tEncoderPtr   = pkcs12.Modern
+		tFQN          string
+	)
+
+	if len(request.Exports) == 0 {
+		return
+	}
+
+	// The chain file is only there when a CA signed the certificate.
+	if _, errorInfo.Error = os.Stat(tChainFQN); errorInfo.Error != nil {
+		tChainFQN = request.CertificateFQN + EXTENSION_CERTIFICATE
+	}
+	if tCertificates, errorInfo = readCertificates(tChainFQN); errorInfo.Error != nil {
+		return
+	}
+
+	for _, tExport := range request.Exports {
+		switch tExport {
+		case EXPORT_DER:
+			tFQN = request.CertificateFQN + EXTENSION_DER
+			if errorInfo = certs.WriteOutFile(tFQN, tCertificates[0].Raw, PUBLIC_FILE_PERMISSIONS); errorInfo.Error != nil {
+				return
+			}
+			fmt.Printf("%sDER Certificate File: %s\n", ctv.SPACES_FOUR, tFQN)
+			if privateKey == nil {
+				continue
+			}
+			if tData, errorInfo.Error = x509.MarshalPKCS8PrivateKey(privateKey); errorInfo.Error != nil {
+				errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Private Key File: %s", request.PrivateKeyFQN))
+				return
+			}
+			tFQN = request.PrivateKeyFQN + EXTENSION_DER_KEY
+			if errorInfo = certs.WriteOutFile(tFQN, tData, PRIVATE_FILE_PERMISSIONS); errorInfo.Error != nil {
+				return
+			}
+			fmt.Printf("%sDER Private Key File: %s\n", ctv.SPACES_FOUR, tFQN)
+		case EXPORT_FULL_CHAIN:
+			tFQN = request.CertificateFQN + EXTENSION_FULL_CHAIN
+			if errorInfo = writeChainFile(tFQN, tCertificates[0].Raw, tCertificates[1:]); errorInfo.Error != nil {
+				return
+			}
+			fmt.Printf("%sChain File: %s\n", ctv.SPACES_FOUR, tFQN)
+		case EXPORT_PKCS12, EXPORT_PKCS12_LEGACY:
+			if tExport == EXPORT_PKCS12_LEGACY {
+				tEncoderPtr = pkcs12.LegacyDES
+			}
+			tFQN = request.CertificateFQN + EXTENSION_PKCS12
+			if tData, errorInfo.Error = tEncoderPtr.Encode(privateKey, tCertificates[0], tCertificates[1:], passphrase); errorInfo.Error != nil {
+				errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("PKCS#12 File: %s", tFQN))
+				return
+			}
+			if errorInfo = certs.WriteOutFile(tFQN, tData, PRIVATE_FILE_PERMISSIONS); errorInfo.Error != nil {
+				return
+			}
+			if errorInfo = verifyPKCS12File(tFQN, passphrase, privateKey, tCertificates); errorInfo.Error != nil {
+				return
+			}
+			fmt.Printf("%sPKCS#12 File: %s\n", ctv.SPACES_FOUR, tFQN)
+		case EXPORT_PKCS8_ENCRYPTED:
+			tFQN = request.PrivateKeyFQN + EXTENSION_ENCRYPTED_KEY
+			if tData, errorInfo.Error = pkcs8.MarshalPrivateKey(privateKey, []byte(passphrase), nil); errorInfo.Error != nil {
+				errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Encrypted Private Key File: %s", tFQN))
+				return
+			}
+			if errorInfo = writeOutPEMFile(tFQN, tData, PEM_ENCRYPTED_PRIVATE_KEY); errorInfo.Error != nil {
+				return
+			}
+			if errorInfo = verifyEncryptedKeyFile(tFQN, passphrase, privateKey); errorInfo.Error != nil {
+				return
+			}
+			fmt.Printf("%sEncrypted Private Key File: %s\n", ctv.SPACES_FOUR, tFQN)
+		}
+	}
+
+	return
+}
+
+// verifyEncryptedKeyFile - decrypts the key file with the passphrase and checks it is the private key.
+//
+//	Customer Messages: None
+//	Errors: ErrCertificateKeyMismatch, errors returned by readPEMFile and pkcs8
+//	Verifications: None
+func verifyEncryptedKeyFile(fqn string, passphrase string, privateKey crypto.Signer) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tDER []byte
+		tKey any
+	)
+
+	if tDER, errorInfo = readPEMFile(fqn, PEM_ENCRYPTED_PRIVATE_KEY); errorInfo.Error != nil {
+		return
+	}
+	if tKey, errorInfo.Error = pkcs8.ParsePKCS8PrivateKey(tDER, []byte(passphrase)); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Encrypted Private Key File: %s", fqn))
+		return
+	}
+	if tSigner, ok := tKey.(crypto.Signer); ok == false || certs.SamePublicKey(privateKey.Public(), tSigner.Public()) == false {
+		errorInfo = errs.NewErrorInfo(ErrCertificateKeyMismatch, fmt.Sprintf("Encrypted Private Key File: %s", fqn))
+	}
+
+	return
+}
+
+// verifyPKCS12File - decodes the file with the passphrase and checks it holds the private key and every certificate.
+//
+//	Customer Messages: None
+//	Errors: ErrCertificateKeyMismatch, errors returned by os and pkcs12
+//	Verifications: None
+func verifyPKCS12File(fqn string, passphrase string, privateKey crypto.Signer, certificates []*x509.Certificate) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCACertificates []*x509.Certificate
+		tCertificatePtr *x509.Certificate
+		tData           []byte
+		tKey            any
+	)
+
+	if tData, errorInfo.Error = os.ReadFile(fqn); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("PKCS#12 File: %s", fqn))
+		return
+	}
+	if tKey, tCertificatePtr, tCACertificates, errorInfo.Error = pkcs12.DecodeChain(tData, passphrase); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("PKCS#12 File: %s", fqn))
+		return
+	}
+
+	tSigner, ok := tKey.(crypto.Signer)
+	if ok == false || certs.SamePublicKey(privateKey.Public(), tSigner.Public()) == false || tCertificatePtr.Equal(certificates[0]) == false ||
+		slices.EqualFunc(tCACertificates, certificates[1:], func(a *x509.Certificate, b *x509.Certificate) bool { return a.Equal(b) }) == false {
+		errorInfo = errs.NewErrorInfo(ErrCertificateKeyMismatch, fmt.Sprintf("PKCS#12 File: %s", fqn))
+	}
+
+	return
+}
@@ -0,0 +1,16 @@
+module generate_certificate
+
+go 1.22.3
+
+require (
+	certificate_services v0.0.0-00010101000000-000000000000
+	github.com/integrii/flaggy v1.5.2
+	github.com/sty-holdings/sharedServices/v2024 v2024.37.0
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78
+	gopkg.in/yaml.v3 v3.0.1
+	software.sslmate.com/src/go-pkcs12 v0.7.3
+)
+
+require golang.org/x/crypto v0.22.0 // indirect
+
+replace certificate_services => ../certificate_services
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// issuer - the CA that signs the certificate. Chain[0] is the CA certificate and the rest of Chain is its own chain.
+type issuer struct {
+	Chain        []*x509.Certificate
+	PrivateKey   crypto.Signer
+	SubjectKeyId []byte
+}
+
+// loadIssuer - reads the CA certificate file, which may be a bundle with the CA certificate first, and the CA private key.
+// The certificate must be a CA that can sign certificates and the key must match it.
+//
+//	Customer Messages: None
+//	Errors: ErrCertificateKeyMismatch, ErrIssuerInvalid, ErrIssuerRequired, errors returned by readCertificates and certs.ReadPrivateKey
+//	Verifications: None
+func loadIssuer(caCertificateFQN string, caPrivateKeyFQN string) (issuerPtr *issuer, errorInfo errs.ErrorInfo) {
+
+	var (
+		tCAPtr *x509.Certificate
+	)
+
+	if caCertificateFQN == ctv.VAL_EMPTY || caPrivateKeyFQN == ctv.VAL_EMPTY {
+		errorInfo = errs.NewErrorInfo(ErrIssuerRequired, fmt.Sprintf("CA Certificate File: %s CA Key File: %s", caCertificateFQN, caPrivateKeyFQN))
+		return
+	}
+
+	issuerPtr = &issuer{}
+	if issuerPtr.Chain, errorInfo = readCertificates(caCertificateFQN); errorInfo.Error != nil {
+		return nil, errorInfo
+	}
+	if issuerPtr.PrivateKey, errorInfo = certs.ReadPrivateKey(caPrivateKeyFQN, ctv.VAL_EMPTY); errorInfo.Error != nil {
+		return nil, errorInfo
+	}
+
+	tCAPtr = issuerPtr.Chain[0]
+	switch {
+	case tCAPtr.IsCA == false || tCAPtr.BasicConstraintsValid == false:
+		errorInfo = errs.NewErrorInfo(ErrIssuerInvalid, fmt.Sprintf("CA Certificate File: %s is not a CA", caCertificateFQN))
+	case tCAPtr.KeyUsage != 0 && tCAPtr.KeyUsage&x509.KeyUsageCertSign == 0:
+		errorInfo = errs.NewErrorInfo(ErrIssuerInvalid, fmt.Sprintf("CA Certificate File: %s does not have the Certificate Sign key usage", caCertificateFQN))
+	case time.Now().After(tCAPtr.NotAfter):
+		errorInfo = errs.NewErrorInfo(ErrIssuerInvalid, fmt.Sprintf("CA Certificate File: %s expired %s", caCertificateFQN, tCAPtr.NotAfter.Format(time.RFC3339)))
+	case tCAPtr.PublicKeyAlgorithm == x509.DSA:
+		errorInfo = errs.NewErrorInfo(ErrIssuerInvalid, fmt.Sprintf("CA Certificate File: %s has a DSA key, which cannot sign certificates", caCertificateFQN))
+	case certs.SamePublicKey(tCAPtr.PublicKey, issuerPtr.PrivateKey.Public()) == false:
+		errorInfo = errs.NewErrorInfo(ErrCertificateKeyMismatch, fmt.Sprintf("CA Certificate File: %s CA Key File: %s", caCertificateFQN, caPrivateKeyFQN))
+	}
+	if errorInfo.Error != nil {
+		return nil, errorInfo
+	}
+
+	// A CA without a Subject Key Identifier still gets an Authority Key Identifier in what it issues.
+	if issuerPtr.SubjectKeyId = tCAPtr.SubjectKeyId; len(issuerPtr.SubjectKeyId) == 0 {
+		if issuerPtr.SubjectKeyId, errorInfo = certs.SubjectKeyId(tCAPtr.PublicKey); errorInfo.Error != nil {
+			return nil, errorInfo
+		}
+	}
+
+	return
+}
+
+// checkCanIssue - enforces the CA's path length constraint and validity on the certificate it is about to sign.
+//
+//	Customer Messages: None
+//	Errors: ErrPathLengthExceeded, ErrValidityExceedsIssuer
+//	Verifications: None
+func (issuerPtr *issuer) checkCanIssue(templatePtr *x509.Certificate) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCAPtr           = issuerPtr.Chain[0]
+		tCAHasPathLength = tCAPtr.MaxPathLen > 0 || (tCAPtr.MaxPathLen == 0 && tCAPtr.MaxPathLenZero)
+	)
+
+	if templatePtr.IsCA && tCAHasPathLength {
+		switch {
+		case tCAPtr.MaxPathLen == 0:
+			errorInfo = errs.NewErrorInfo(ErrPathLengthExceeded, fmt.Sprintf("Issuer: %s has a path length of 0 and cannot issue CA certificates", tCAPtr.Subject))
+			return
+		case templatePtr.MaxPathLen < 0 || templatePtr.MaxPathLen >= tCAPtr.MaxPathLen:
+			// Unlimited, or as long as the issuer's, is tightened to the most the issuer allows.
+			templatePtr.MaxPathLen = tCAPtr.MaxPathLen - 1
+			templatePtr.MaxPathLenZero = templatePtr.MaxPathLen == 0
+		}
+	}
+
+	if templatePtr.NotAfter.After(tCAPtr.NotAfter) {
+		errorInfo = errs.NewErrorInfo(ErrValidityExceedsIssuer, fmt.Sprintf("Not After: %s Issuer Not After: %s", templatePtr.NotAfter.Format(time.RFC3339), tCAPtr.NotAfter.Format(time.RFC3339)))
+	}
+
+	return
+}
+
+// readCertificates - every CERTIFICATE block in the file, in order. Other block types are skipped.
+//
+//	Customer Messages: None
+//	Errors: ErrPEMInvalid, errors returned by os and x509
+//	Verifications: None
+func readCertificates(fqn string) (certificates []*x509.Certificate, errorInfo errs.ErrorInfo) {
+
+	var (
+		tBlockPtr       *pem.Block
+		tCertificatePtr *x509.Certificate
+		tData           []byte
+	)
+
+	if tData, errorInfo.Error = os.ReadFile(fqn); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+
+	for {
+		if tBlockPtr, tData = pem.Decode(tData); tBlockPtr == nil {
+			break
+		}
+		if tBlockPtr.Type != PEM_CERTIFICATE {
+			continue
+		}
+		if tCertificatePtr, errorInfo.Error = x509.ParseCertificate(tBlockPtr.Bytes); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+			return
+		}
+		certificates = append(certificates, tCertificatePtr)
+	}
+
+	if len(certificates) == 0 {
+		errorInfo = errs.NewErrorInfo(ErrPEMInvalid, fmt.Sprintf("File: %s Expected: %s", fqn, PEM_CERTIFICATE))
+	}
+
+	return
+}
+
+// writeChainFile - the certificate followed by the issuer's chain, the order TLS servers send them in.
+//
+//	Customer Messages: None
+//	Errors: errors returned by certs.WriteOutFile
+//	Verifications: None
+func writeChainFile(fqn string, certificate []byte, chain []*x509.Certificate) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tBuffer bytes.Buffer
+	)
+
+	_ = pem.Encode(&tBuffer, &pem.Block{Type: PEM_CERTIFICATE, Bytes: certificate})
+	for _, tCertificatePtr := range chain {
+		_ = pem.Encode(&tBuffer, &pem.Block{Type: PEM_CERTIFICATE, Bytes: tCertificatePtr.Raw})
+	}
+
+	return certs.WriteOutFile(fqn, tBuffer.Bytes(), PUBLIC_FILE_PERMISSIONS)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// writeKeyFiles - writes the private key in PKCS#8 and the public key in PKIX, both PEM encoded.
+//
+//	Customer Messages: None
+//	Errors: errors returned by writePrivateKey and writePublicKey
+//	Verifications: None
+func writeKeyFiles(privateKeyFQN string, privateKey crypto.Signer) (errorInfo errs.ErrorInfo) {
+
+	if errorInfo = writePrivateKey(privateKeyFQN, privateKey); errorInfo.Error != nil {
+		return
+	}
+	errorInfo = writePublicKey(privateKeyFQN+EXTENSION_PUBLIC_KEY, privateKey.Public())
+
+	return
+}
+
+// writePrivateKey - PKCS#8, PEM encoded.
+//
+//	Customer Messages: None
+//	Errors: errors returned by x509 and writeOutPEMFile
+//	Verifications: None
+func writePrivateKey(privateKeyFQN string, privateKey crypto.PrivateKey) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tMarshalledPrivateKey []byte
+	)
+
+	if tMarshalledPrivateKey, errorInfo.Error = x509.MarshalPKCS8PrivateKey(privateKey); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Private Key File: %s", privateKeyFQN))
+		return
+	}
+
+	return writeOutPEMFile(privateKeyFQN, tMarshalledPrivateKey, PEM_PRIVATE_KEY)
+}
+
+// writePublicKey - PKIX, PEM encoded.
+//
+//	Customer Messages: None
+//	Errors: errors returned by x509 and writeOutPEMFile
+//	Verifications: None
+func writePublicKey(publicKeyFQN string, publicKey crypto.PublicKey) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tMarshalledPublicKey []byte
+	)
+
+	if tMarshalledPublicKey, errorInfo.Error = x509.MarshalPKIXPublicKey(publicKey); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Public Key File: %s", publicKeyFQN))
+		return
+	}
+
+	return writeOutPEMFile(publicKeyFQN, tMarshalledPublicKey, PEM_PUBLIC_KEY)
+}
+
+// keyTypeOf - the key type and, for RSA, the size of the public key, so a new key can be generated like it.
+//
+//	Customer Messages: None
+//	Errors: ErrKeyTypeInvalid
+//	Verifications: None
+func keyTypeOf(publicKey crypto.PublicKey) (keyType string, rsaBits int, errorInfo errs.ErrorInfo) {
+
+	switch tPublicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		keyType, rsaBits = KEY_TYPE_RSA, tPublicKey.N.BitLen()
+	case *ecdsa.PublicKey:
+		switch tPublicKey.Curve {
+		case elliptic.P256():
+			keyType = KEY_TYPE_ECDSA_P256
+		case elliptic.P384():
+			keyType = KEY_TYPE_ECDSA_P384
+		default:
+			errorInfo = errs.NewErrorInfo(ErrKeyTypeInvalid, fmt.Sprintf("Curve: %s", tPublicKey.Curve.Params().Name))
+		}
+	case ed25519.PublicKey:
+		keyType = KEY_TYPE_ED25519
+	default:
+		errorInfo = errs.NewErrorInfo(ErrKeyTypeInvalid, fmt.Sprintf("Public Key: %T", publicKey))
+	}
+
+	return
+}
@@ -1,48 +1,115 @@
-// Copyright 2009 The Go Authors. All rights reserved.
-// Use of this source code is governed by a BSD-style
-// license that can be found in the LICENSE file.
+// Package main.go
+/*
+This utility generates a key pair and an X.509 certificate. The key is RSA, ECDSA (P-256 or P-384) or Ed25519.
+The certificate is self-signed, or signed by an existing CA given with --ca_cert and --ca_key.
 
-// Generate a self-signed X.509 certificate for a TLS server. Outputs to
-// 'cert.pem' and 'key.pem' and will overwrite existing files.
+RESTRICTIONS:
+    * There is no log for this utility. All messages are output to the console.
+    * Existing files are overwritten, except by renew, which keeps a .bak copy.
+    * A CA-signed certificate cannot outlive its CA, and a CA certificate is only issued when the CA's path length allows it.
+    * A certificate cannot be valid for longer than its profile's max_validity, or than MAX_VALIDITY_YEARS.
 
+NOTES:
+    Key files are output with no extension for the private key (PKCS#8) and .pub for the public key (PKIX).
+    The certificate is output with .pem. A CA-signed certificate is also output with its CA's chain as .fullchain.pem.
+    Once written, the files are read back and checked to belong together, and the chain is verified.
+    The profile sets the certificate's key usages: server, client, peer (TLS server and client), code-signing or intermediate
+    (a CA that signs certificates). The built-in profiles are in profiles.yaml and more can be given in a YAML file.
+    The subject alternative names (--dns, --ip, --email and --uri) can be repeated. Every certificate carries a Subject Key
+    Identifier and a CA-signed one an Authority Key Identifier.
+    The validity is --valid_for, such as 90d, 2y6m or 720h, from now, or from --not_before. --not_after sets the end instead.
+    NotBefore is backdated by --backdate, 5 minutes by default, to allow for clock skew.
+    --export also writes DER files, a PKCS#12 file, a chain file or an encrypted PKCS#8 private key. The PKCS#12 file and the
+    encrypted key use the passphrase in --passphrase_file or the GENERATE_CERTIFICATE_PASSPHRASE environment variable.
+    Private keys and PKCS#12 files are readable only by the owner (0600). Everything else is 0644.
+    The renew subcommand issues a new certificate with the subject, names and extensions of an old one, reusing its key or,
+    with --rotate_key, a new one of the same type. It renews one certificate, or every certificate in a directory that
+    expires within --within days. The files it replaces are kept with a .bak extension, and put back if the renewal fails.
+    Files are written to a temporary file and renamed, so a failure never leaves a partly written file.
+
+COPYRIGHT:
+	Copyright 2022
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
 package main
 
 import (
 	"fmt"
-	"regexp"
+	"os"
+	"strings"
 
-	cmd "albert/Utilities/generate_certificate/src"
-	"albert/constants"
 	"github.com/integrii/flaggy"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
 )
 
-//goland:noinspection ALL
-const (
-	VERSION          = "2023.1.0"
-	APPLICATION_NAME = "Generate Certificate"
+var (
+	csrCmdPtr   *flaggy.Subcommand
+	renewCmdPtr *flaggy.Subcommand
+	signCmdPtr  *flaggy.Subcommand
 )
 
 var (
-	host     string
-	validFor string
-	selfCA   bool
-	rsaBits  = 4096
-	//
-	keyFileName  string
-	certFileName string
+	backdate           = DEFAULT_BACKDATE
+	caCertFileName     string
+	caKeyFileName      string
+	certFileName       string
+	commonName         string
+	country            string
+	csrFileName        string
+	dnsNames           []string
+	emailAddresses     []string
+	exports            []string
+	host               string
+	ipAddresses        []string
+	keyFileName        string
+	keyType            = DEFAULT_KEY_TYPE
+	notAfter           string
+	notBefore          string
+	locality           string
+	organization       string
+	organizationalUnit string
+	passphraseFileName string
+	pathLength         = DEFAULT_PATH_LENGTH
+	profileFileName    string
+	profileName        = DEFAULT_PROFILE
+	province           string
+	renewDirectory     string
+	renewFileName      string
+	renewWithinDays    = DEFAULT_RENEW_WITHIN_DAYS
+	rotateKey          bool
+	rsaBits            = DEFAULT_RSA_BITS
+	selfCA             bool
+	uris               []string
+	validFor           string
 )
 
 func init() {
 
-	appDescription := "Generate certificate will create a csr and key file that are self-signed.\n" +
+	appDescription := "Generate certificate will create a key pair and a certificate that is self-signed or signed by a CA.\n" +
 		"\nVersion: \n" +
-		constants.FOUR_SPACES + "- " + VERSION + "\n" +
+		ctv.SPACES_FOUR + "- " + VERSION + "\n" +
 		"\nConstraints: \n" +
-		constants.FOUR_SPACES + "- There is no log for this utility. All messages are output to the console.\n" +
-		constants.FOUR_SPACES + "- Only Self-Signed RSA certificates are created.\n" +
+		ctv.SPACES_FOUR + "- There is no log for this utility. All messages are output to the console.\n" +
+		ctv.SPACES_FOUR + "- A CA-signed certificate cannot be valid for longer than its CA, or than the profile's max_validity.\n" +
 		"\nNotes:\n" +
-		constants.FOUR_SPACES + "Key files will be output with no extension for the private key, .pub for the public key, and .pem for the cert.\n" +
-		constants.FOUR_SPACES + "The files permissions are set to 0744.\n" +
+		ctv.SPACES_FOUR + "Key files will be output with no extension for the private key, .pub for the public key, and .pem for the cert.\n" +
+		ctv.SPACES_FOUR + "A CA-signed cert is also output with the CA chain as .fullchain.pem.\n" +
+		ctv.SPACES_FOUR + "Without a subcommand, a key pair and certificate are generated. The csr subcommand generates a key pair\n" +
+		ctv.SPACES_FOUR + "and a certificate signing request, and the sign subcommand issues a certificate for a request.\n" +
+		ctv.SPACES_FOUR + "The renew subcommand renews a certificate, or those in a directory that are due, and keeps .bak copies.\n" +
+		ctv.SPACES_FOUR + "Private keys and PKCS#12 files are set to 0600 and all other files to 0644.\n" +
 		"\nFor more info, see link below:\n"
 
 	// Set your program's name and description.  These appear in help output.
@@ -54,16 +121,57 @@ func init() {
 	flaggy.DefaultParser.ShowHelpOnUnexpected = true
 
 	// You can set a help prepend or append on the default parser.
-	flaggy.DefaultParser.AdditionalHelpPrepend = "https://github.com/styh-dev/albert/utilitiles/generate_certificate"
+	flaggy.DefaultParser.AdditionalHelpPrepend = "https://github.com/sty-holdings/utilities"
 
 	// Add a flag to the main program (this will be available in all subcommands as well).
-	flaggy.String(&host, "n", "hostname", "REQUIRED: The DNS name of the system where the certificate will be installed.")
-	flaggy.String(&validFor, "v", "valid_for", "REQUIRED: The length of time the certificate is valid, expressed in <digits><unit>."+
-		"\n\t\t\t<digits> is any number from 1 to 10"+"\n\t\t\t<period> can be d | D for days, m | M for months, or y | Y for years.")
-	flaggy.String(&keyFileName, "k", "key_name", "REQUIRED: The directory and filename of the out key file. DO NOT provide an extension to the name.")
-	flaggy.String(&certFileName, "c", "cert_name", "REQUIRED: The directory and filename of the out certificate file. DO NOT provide an extension to the name.")
+	flaggy.String(&host, "n", "hostname", "The DNS name of the system where the certificate will be installed. It is added to the dns names.")
+	flaggy.StringSlice(&dnsNames, "", "dns", "A DNS name for the certificate. Repeat the flag or separate the names with commas.")
+	flaggy.StringSlice(&ipAddresses, "", "ip", "An IP address for the certificate. Repeat the flag or separate the addresses with commas.")
+	flaggy.StringSlice(&emailAddresses, "", "email", "An email address for the certificate. Repeat the flag or separate the addresses with commas.")
+	flaggy.StringSlice(&uris, "", "uri", "A URI for the certificate, such as spiffe://example.com/nats. Repeat the flag or separate the URIs with commas.")
+	flaggy.String(&commonName, "", "common_name", "The subject common name. The default is the first DNS name.")
+	flaggy.String(&organization, "", "organization", "The subject organization. The default is "+DEFAULT_SUBJECT_ORGANIZATION+".")
+	flaggy.String(&organizationalUnit, "", "organizational_unit", "The subject organizational unit.")
+	flaggy.String(&locality, "", "locality", "The subject locality. The default is "+DEFAULT_SUBJECT_LOCALITY+".")
+	flaggy.String(&province, "", "province", "The subject state or province. The default is "+DEFAULT_SUBJECT_PROVINCE+".")
+	flaggy.String(&country, "", "country", "The subject two letter country code. The default is "+DEFAULT_SUBJECT_COUNTRY+".")
+	flaggy.String(&validFor, "v", "valid_for", "REQUIRED, except for csr, renew or with not_after: The length of time the certificate is valid."+
+		"\n\t\t\t<digits><unit> repeated, where <unit> is y for years, m for months, w for weeks or d for days, such as 90d, 13m or 2y6m,"+
+		"\n\t\t\tor a Go duration such as 720h.")
+	flaggy.String(&notBefore, "", "not_before", "When the certificate becomes valid, in RFC 3339, such as 2025-01-31T00:00:00Z. The default is now less the backdate.")
+	flaggy.String(&notAfter, "", "not_after", "When the certificate expires, in RFC 3339. Use instead of valid_for.")
+	flaggy.Duration(&backdate, "", "backdate", "How far before now the certificate becomes valid, to allow for clock skew. The default is 5m. Not used with not_before.")
+	flaggy.String(&keyFileName, "k", "key_name", "REQUIRED, except for sign and renew: The directory and filename of the out key file. DO NOT provide an extension to the name.")
+	flaggy.String(&certFileName, "c", "cert_name", "REQUIRED, except for csr: The directory and filename of the out certificate file. DO NOT provide an extension to the name.")
 	flaggy.Bool(&selfCA, "s", "self_CA", "Will this certification be its own Certificate Authority. The default is false.")
-	flaggy.Int(&rsaBits, "r", "rsa_bits", "Size of RSA key to generate. The value must be 1024 or higher when supplied. The default is 4096.")
+	flaggy.String(&keyType, "t", "key_type", "The key algorithm: rsa | ecdsa-p256 | ecdsa-p384 | ed25519. The default is rsa.")
+	flaggy.String(&profileName, "p", "profile", "The use of the certificate: server | client | peer | code-signing | intermediate, or a profile in the profile_file. The default is peer.")
+	flaggy.String(&profileFileName, "f", "profile_file", "A YAML file of profiles. They are added to the built-in profiles and replace those with the same name.")
+	flaggy.String(&caCertFileName, "a", "ca_cert", "The CA certificate file that signs the certificate. It may be followed by the rest of the CA's chain. Requires ca_key.")
+	flaggy.String(&caKeyFileName, "b", "ca_key", "The private key file of the CA certificate. Requires ca_cert.")
+	flaggy.Int(&pathLength, "l", "path_length", "The most CA certificates allowed below this one. Only valid for self_CA and the intermediate profile. The default is unlimited, or one less than the CA's.")
+	flaggy.Int(&rsaBits, "r", "rsa_bits", "Size of RSA key to generate. The value must be 1024 or higher when supplied. The default is 4096. Only valid for the 'rsa' key_type.")
+
+	flaggy.StringSlice(&exports, "e", "export", "Also write the certificate as: der | fullchain | pkcs12 | pkcs12_legacy | pkcs8_encrypted. Repeat the flag or separate the formats with commas.")
+	flaggy.String(&passphraseFileName, "", "passphrase_file", "The file whose first line is the passphrase for pkcs12, pkcs12_legacy and pkcs8_encrypted. The default is the "+PASSPHRASE_ENVIRONMENT_VARIABLE+" environment variable.")
+
+	csrCmdPtr = flaggy.NewSubcommand("csr")
+	csrCmdPtr.Description = "Generate a key pair and a PKCS#10 certificate signing request with the subject and SANs."
+	csrCmdPtr.String(&csrFileName, "o", "csr_name", "REQUIRED: The directory and filename of the out request file. DO NOT provide an extension to the name.")
+	flaggy.AttachSubcommand(csrCmdPtr, 1)
+
+	signCmdPtr = flaggy.NewSubcommand("sign")
+	signCmdPtr.Description = "Issue a certificate for a certificate signing request with ca_cert and ca_key, applying the profile."
+	signCmdPtr.String(&csrFileName, "i", "csr", "REQUIRED: The certificate signing request file, with its extension.")
+	flaggy.AttachSubcommand(signCmdPtr, 1)
+
+	renewCmdPtr = flaggy.NewSubcommand("renew")
+	renewCmdPtr.Description = "Renew a certificate, or every certificate in a directory that is due, keeping its subject, names and extensions."
+	renewCmdPtr.String(&renewFileName, "i", "cert", "REQUIRED, unless dir is given: The certificate file to renew, with its .pem extension.")
+	renewCmdPtr.String(&renewDirectory, "d", "dir", "REQUIRED, unless cert is given: Renew every certificate .pem file in the directory that expires within the days.")
+	renewCmdPtr.Int(&renewWithinDays, "w", "within", "With dir, renew the certificates that expire within this many days. The default is 30.")
+	renewCmdPtr.Bool(&rotateKey, "", "rotate_key", "Generate a new key of the same type and size instead of reusing the old one. The default is false.")
+	flaggy.AttachSubcommand(renewCmdPtr, 1)
 
 	// Set the version and parse all inputs into variables.
 	flaggy.SetVersion(VERSION)
@@ -72,27 +180,109 @@ func init() {
 
 func main() {
 
-	if host == constants.EMPTY || validFor == constants.EMPTY || keyFileName == constants.EMPTY || certFileName == constants.EMPTY {
-		flaggy.ShowHelpAndExit(fmt.Sprintln(constants.COLOR_RED, "ERROR: Please review the usage and supplied all required arguments."))
+	var (
+		errorInfo errs.ErrorInfo
+	)
+
+	fmt.Println()
+
+	if host != ctv.VAL_EMPTY {
+		dnsNames = append([]string{host}, dnsNames...)
 	}
 
-	if match, _ := regexp.MatchString("^([1-9]|10)[dDmMyY]", validFor); match == false {
-		flaggy.ShowHelpAndExit(fmt.Sprintln(constants.COLOR_RED, "ERROR: Please review the format for the 'valid_for' argument."))
+	switch {
+	case csrCmdPtr.Used:
+		if csrFileName == ctv.VAL_EMPTY || keyFileName == ctv.VAL_EMPTY {
+			flaggy.ShowHelpAndExit("ERROR: Please review the usage and supplied all required arguments.")
+		}
+		errorInfo = generateCSR(csrRequest{
+			CSRFQN:        csrFileName,
+			KeyType:       strings.ToLower(keyType),
+			PrivateKeyFQN: keyFileName,
+			RSABits:       rsaBits,
+			SANs:          buildSANRequest(),
+			Subject:       buildSubjectRequest(),
+		})
+	case signCmdPtr.Used:
+		if csrFileName == ctv.VAL_EMPTY || (validFor == ctv.VAL_EMPTY && notAfter == ctv.VAL_EMPTY) || certFileName == ctv.VAL_EMPTY {
+			flaggy.ShowHelpAndExit("ERROR: Please review the usage and supplied all required arguments.")
+		}
+		errorInfo = signCSR(buildCertificateRequest(), csrFileName)
+	case renewCmdPtr.Used:
+		if (renewFileName == ctv.VAL_EMPTY) == (renewDirectory == ctv.VAL_EMPTY) || renewWithinDays < 0 {
+			flaggy.ShowHelpAndExit("ERROR: Please review the usage and supplied all required arguments.")
+		}
+		errorInfo = renewCertificates(renewRequest{
+			Backdate:         backdate,
+			CACertificateFQN: caCertFileName,
+			CAPrivateKeyFQN:  caKeyFileName,
+			CertificateFQN:   renewFileName,
+			Directory:        renewDirectory,
+			NotAfter:         notAfter,
+			NotBefore:        notBefore,
+			PrivateKeyFQN:    keyFileName,
+			RotateKey:        rotateKey,
+			ValidFor:         validFor,
+			WithinDays:       renewWithinDays,
+		})
+	default:
+		if (validFor == ctv.VAL_EMPTY && notAfter == ctv.VAL_EMPTY) || keyFileName == ctv.VAL_EMPTY || certFileName == ctv.VAL_EMPTY {
+			flaggy.ShowHelpAndExit("ERROR: Please review the usage and supplied all required arguments.")
+		}
+		errorInfo = generateCertificate(buildCertificateRequest())
 	}
 
-	if rsaBits < 1024 {
-		flaggy.ShowHelpAndExit(fmt.Sprintln(constants.COLOR_RED, "ERROR: 'rsa_bits' must be 1024 or higher."))
+	if errorInfo.Error != nil {
+		errs.PrintErrorInfo(errorInfo)
+		os.Exit(1)
 	}
+}
+
+// buildCertificateRequest - the certificateRequest from the flags.
+func buildCertificateRequest() certificateRequest {
+
+	return certificateRequest{
+		Backdate:         backdate,
+		CACertificateFQN: caCertFileName,
+		CAPrivateKeyFQN:  caKeyFileName,
+		CertificateFQN:   certFileName,
+		Exports:          exports,
+		KeyType:          strings.ToLower(keyType),
+		NotAfter:         notAfter,
+		NotBefore:        notBefore,
+		PassphraseFQN:    passphraseFileName,
+		PathLength:       pathLength,
+		PrivateKeyFQN:    keyFileName,
+		Profile:          strings.ToLower(profileName),
+		ProfileFQN:       profileFileName,
+		RSABits:          rsaBits,
+		SANs:             buildSANRequest(),
+		SelfCA:           selfCA,
+		Subject:          buildSubjectRequest(),
+		ValidFor:         validFor,
+	}
+}
+
+// buildSANRequest - the subject alternative names from the flags.
+func buildSANRequest() sanRequest {
 
-	cmd.Run(coreJWT.GenerateCertificate{
-		CertFileName:       certFileName,
-		Certificate:        nil,
-		Host:               host,
-		PublicKey:          nil,
-		PrivateKey:         nil,
-		PrivateKeyFileName: keyFileName,
-		RSABits:            rsaBits,
-		SelfCA:             selfCA,
-		ValidFor:           validFor,
-	})
+	return sanRequest{
+		DNSNames:       dnsNames,
+		EmailAddresses: emailAddresses,
+		IPAddresses:    ipAddresses,
+		URIs:           uris,
+	}
+}
+
+// buildSubjectRequest - the subject from the flags.
+func buildSubjectRequest() subjectRequest {
+
+	return subjectRequest{
+		CommonName:         commonName,
+		Country:            country,
+		Locality:           locality,
+		Organization:       organization,
+		OrganizationalUnit: organizationalUnit,
+		Province:           province,
+	}
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"strings"
+
+	certs "certificate_services"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// readPEMFile - returns the bytes of the only PEM block in the file, which must be of pemType.
+//
+//	Customer Messages: None
+//	Errors: ErrPEMInvalid, errors returned by os
+//	Verifications: None
+func readPEMFile(fqn string, pemType string) (der []byte, errorInfo errs.ErrorInfo) {
+
+	var (
+		tBlockPtr *pem.Block
+		tData     []byte
+		tRest     []byte
+	)
+
+	if tData, errorInfo.Error = os.ReadFile(fqn); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+	if tBlockPtr, tRest = pem.Decode(tData); tBlockPtr == nil || tBlockPtr.Type != pemType || len(bytes.TrimSpace(tRest)) > 0 {
+		errorInfo = errs.NewErrorInfo(ErrPEMInvalid, fmt.Sprintf("File: %s Expected: %s", fqn, pemType))
+		return
+	}
+
+	return tBlockPtr.Bytes, errorInfo
+}
+
+// verifyOutputFiles - parses the written files back and checks that the certificate, the private key and the public key belong together.
+// When there is an issuer, the chain file must also verify up to the last certificate of the issuer's chain.
+//
+//	Customer Messages: None
+//	Errors: ErrCertificateKeyMismatch, ErrPEMInvalid, errors returned by os and x509
+//	Verifications: None
+func verifyOutputFiles(request certificateRequest, issuerPtr *issuer) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertificatePtr *x509.Certificate
+		tDER            []byte
+		tPrivateKey     any
+		tPublicKey      any
+	)
+
+	if tDER, errorInfo = readPEMFile(request.CertificateFQN+EXTENSION_CERTIFICATE, PEM_CERTIFICATE); errorInfo.Error != nil {
+		return
+	}
+	if tCertificatePtr, errorInfo.Error = x509.ParseCertificate(tDER); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", request.CertificateFQN+EXTENSION_CERTIFICATE))
+		return
+	}
+
+	if tDER, errorInfo = readPEMFile(request.PrivateKeyFQN, PEM_PRIVATE_KEY); errorInfo.Error != nil {
+		return
+	}
+	if tPrivateKey, errorInfo.Error = x509.ParsePKCS8PrivateKey(tDER); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", request.PrivateKeyFQN))
+		return
+	}
+
+	if tDER, errorInfo = readPEMFile(request.PrivateKeyFQN+EXTENSION_PUBLIC_KEY, PEM_PUBLIC_KEY); errorInfo.Error != nil {
+		return
+	}
+	if tPublicKey, errorInfo.Error = x509.ParsePKIXPublicKey(tDER); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", request.PrivateKeyFQN+EXTENSION_PUBLIC_KEY))
+		return
+	}
+
+	tSigner, ok := tPrivateKey.(crypto.Signer)
+	if ok == false || certs.SamePublicKey(tCertificatePtr.PublicKey, tSigner.Public()) == false || certs.SamePublicKey(tCertificatePtr.PublicKey, tPublicKey) == false {
+		errorInfo = errs.NewErrorInfo(ErrCertificateKeyMismatch, fmt.Sprintf("Certificate File: %s", request.CertificateFQN+EXTENSION_CERTIFICATE))
+		return
+	}
+
+	if issuerPtr != nil {
+		errorInfo = verifyChainFile(request.CertificateFQN + EXTENSION_FULL_CHAIN)
+	}
+
+	return
+}
+
+// verifySignedFiles - parses the certificate signed from a CSR, or renewed, back, checks it is for the public key and, when a CA
+// signed it, verifies the chain file.
+//
+//	Customer Messages: None
+//	Errors: ErrCertificateKeyMismatch, ErrPEMInvalid, errors returned by os, x509 and verifyChainFile
+//	Verifications: None
+func verifySignedFiles(request certificateRequest, publicKey crypto.PublicKey, issuerPtr *issuer) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertificatePtr *x509.Certificate
+		tDER            []byte
+	)
+
+	if tDER, errorInfo = readPEMFile(request.CertificateFQN+EXTENSION_CERTIFICATE, PEM_CERTIFICATE); errorInfo.Error != nil {
+		return
+	}
+	if tCertificatePtr, errorInfo.Error = x509.ParseCertificate(tDER); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", request.CertificateFQN+EXTENSION_CERTIFICATE))
+		return
+	}
+	if certs.SamePublicKey(tCertificatePtr.PublicKey, publicKey) == false {
+		errorInfo = errs.NewErrorInfo(ErrCertificateKeyMismatch, fmt.Sprintf("Certificate File: %s", request.CertificateFQN+EXTENSION_CERTIFICATE))
+		return
+	}
+	if issuerPtr == nil {
+		return
+	}
+
+	return verifyChainFile(request.CertificateFQN + EXTENSION_FULL_CHAIN)
+}
+
+// verifyChainFile - the first certificate in the file must chain through the others to the last one, which is trusted as the root.
+// The chain is verified at the latest NotBefore in it, so a certificate post-dated with not_before is not refused as not yet valid.
+//
+//	Customer Messages: None
+//	Errors: errors returned by readCertificates and x509
+//	Verifications: None
+func verifyChainFile(fqn string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertificates []*x509.Certificate
+		tOptions      = x509.VerifyOptions{
+			Intermediates: x509.NewCertPool(),
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+			Roots:         x509.NewCertPool(),
+		}
+	)
+
+	if tCertificates, errorInfo = readCertificates(fqn); errorInfo.Error != nil {
+		return
+	}
+
+	tOptions.Roots.AddCert(tCertificates[len(tCertificates)-1])
+	for _, tCertificatePtr := range tCertificates[1 : len(tCertificates)-1] {
+		tOptions.Intermediates.AddCert(tCertificatePtr)
+	}
+	for _, tCertificatePtr := range tCertificates {
+		if tCertificatePtr.NotBefore.After(tOptions.CurrentTime) {
+			tOptions.CurrentTime = tCertificatePtr.NotBefore
+		}
+	}
+	if _, errorInfo.Error = tCertificates[0].Verify(tOptions); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Chain File: %s", fqn))
+	}
+
+	return
+}
+
+// writeOutPEMFile - creates or truncates the file and writes one PEM block. Private keys get PRIVATE_FILE_PERMISSIONS and
+// everything else PUBLIC_FILE_PERMISSIONS.
+//
+//	Customer Messages: None
+//	Errors: errors returned by certs.WriteOutFile
+//	Verifications: None
+func writeOutPEMFile(fqn string, derData []byte, pemType string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tPermissions os.FileMode = PUBLIC_FILE_PERMISSIONS
+	)
+
+	if strings.HasSuffix(pemType, PEM_PRIVATE_KEY) {
+		tPermissions = PRIVATE_FILE_PERMISSIONS
+	}
+
+	return certs.WriteOutFile(fqn, pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: derData}), tPermissions)
+}
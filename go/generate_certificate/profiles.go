@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+//go:embed profiles.yaml
+var builtInProfiles []byte
+
+var (
+	extKeyUsageNames = map[string]x509.ExtKeyUsage{
+		"any":              x509.ExtKeyUsageAny,
+		"client_auth":      x509.ExtKeyUsageClientAuth,
+		"code_signing":     x509.ExtKeyUsageCodeSigning,
+		"email_protection": x509.ExtKeyUsageEmailProtection,
+		"ocsp_signing":     x509.ExtKeyUsageOCSPSigning,
+		"server_auth":      x509.ExtKeyUsageServerAuth,
+		"time_stamping":    x509.ExtKeyUsageTimeStamping,
+	}
+	keyUsageNames = map[string]x509.KeyUsage{
+		"cert_sign":          x509.KeyUsageCertSign,
+		"content_commitment": x509.KeyUsageContentCommitment,
+		"crl_sign":           x509.KeyUsageCRLSign,
+		"data_encipherment":  x509.KeyUsageDataEncipherment,
+		"decipher_only":      x509.KeyUsageDecipherOnly,
+		"digital_signature":  x509.KeyUsageDigitalSignature,
+		"encipher_only":      x509.KeyUsageEncipherOnly,
+		"key_agreement":      x509.KeyUsageKeyAgreement,
+		"key_encipherment":   x509.KeyUsageKeyEncipherment,
+	}
+)
+
+// profile - what a certificate is for. The usage names are the keys of keyUsageNames and extKeyUsageNames.
+type profile struct {
+	CSRExtensions []string       `yaml:"csr_extensions"` // The OIDs of other CSR extensions that sign copies unchanged.
+	ExtKeyUsage   []string       `yaml:"ext_key_usage"`
+	IsCA          bool           `yaml:"is_ca"`
+	KeyUsage      []string       `yaml:"key_usage"`
+	MaxValidity   string         `yaml:"max_validity"` // Optional. The longest validity allowed, in the valid_for format.
+	Subject       subjectRequest `yaml:"subject"`
+}
+
+type profileFile struct {
+	Profiles map[string]profile `yaml:"profiles"`
+}
+
+// loadProfile - finds the named profile in the profile file, when there is one, or in the built-in profiles and checks it.
+//
+//	Customer Messages: None
+//	Errors: ErrProfileInvalid, errors returned by os and yaml
+//	Verifications: None
+func loadProfile(profileFQN string, name string) (selected profile, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData     []byte
+		tProfiles = make(map[string]profile)
+		ok        bool
+	)
+
+	if errorInfo = decodeProfiles(builtInProfiles, "built-in profiles", tProfiles); errorInfo.Error != nil {
+		return
+	}
+	if profileFQN != ctv.VAL_EMPTY {
+		if tData, errorInfo.Error = os.ReadFile(profileFQN); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Profile File: %s", profileFQN))
+			return
+		}
+		if errorInfo = decodeProfiles(tData, profileFQN, tProfiles); errorInfo.Error != nil {
+			return
+		}
+	}
+
+	if selected, ok = tProfiles[name]; ok == false {
+		errorInfo = errs.NewErrorInfo(ErrProfileInvalid, fmt.Sprintf("Profile: %s is not defined", name))
+		return
+	}
+	if _, errorInfo = selected.keyUsage(nil); errorInfo.Error != nil {
+		return
+	}
+	if _, errorInfo = selected.extKeyUsage(); errorInfo.Error != nil {
+		return
+	}
+	if tKeyUsage, _ := selected.keyUsage(nil); selected.IsCA && tKeyUsage&x509.KeyUsageCertSign == 0 {
+		errorInfo = errs.NewErrorInfo(ErrProfileInvalid, fmt.Sprintf("Profile: %s is_ca needs the cert_sign key usage", name))
+		return
+	}
+	if selected.MaxValidity != ctv.VAL_EMPTY {
+		if _, errorInfo = parseValidity(selected.MaxValidity); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(ErrProfileInvalid, fmt.Sprintf("Profile: %s max_validity: %s", name, selected.MaxValidity))
+		}
+	}
+
+	return
+}
+
+// decodeProfiles - adds the profiles in the YAML to profiles, replacing any with the same name. Unknown fields are rejected
+// so a misspelt usage list is not silently ignored.
+//
+//	Customer Messages: None
+//	Errors: errors returned by yaml
+//	Verifications: None
+func decodeProfiles(data []byte, source string, profiles map[string]profile) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tDecoder     = yaml.NewDecoder(bytes.NewReader(data))
+		tProfileFile profileFile
+	)
+
+	tDecoder.KnownFields(true)
+	if errorInfo.Error = tDecoder.Decode(&tProfileFile); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Profile File: %s", source))
+		return
+	}
+	for tName, tProfile := range tProfileFile.Profiles {
+		profiles[strings.ToLower(tName)] = tProfile
+	}
+
+	return
+}
+
+// extKeyUsage - the profile's extended key usages.
+//
+//	Customer Messages: None
+//	Errors: ErrProfileInvalid
+//	Verifications: None
+func (p profile) extKeyUsage() (extKeyUsage []x509.ExtKeyUsage, errorInfo errs.ErrorInfo) {
+
+	for _, tName := range p.ExtKeyUsage {
+		tExtKeyUsage, ok := extKeyUsageNames[strings.ToLower(tName)]
+		if ok == false {
+			errorInfo = errs.NewErrorInfo(ErrProfileInvalid, fmt.Sprintf("Extended Key Usage: %s", tName))
+			return nil, errorInfo
+		}
+		extKeyUsage = append(extKeyUsage, tExtKeyUsage)
+	}
+
+	return
+}
+
+// keyUsage - the profile's key usages for the public key. Key Encipherment is only kept for RSA keys, for the reason given
+// on certs.KeyUsageForKey. A nil publicKey keeps every usage.
+//
+//	Customer Messages: None
+//	Errors: ErrProfileInvalid
+//	Verifications: None
+func (p profile) keyUsage(publicKey crypto.PublicKey) (keyUsage x509.KeyUsage, errorInfo errs.ErrorInfo) {
+
+	for _, tName := range p.KeyUsage {
+		tKeyUsage, ok := keyUsageNames[strings.ToLower(tName)]
+		if ok == false {
+			errorInfo = errs.NewErrorInfo(ErrProfileInvalid, fmt.Sprintf("Key Usage: %s", tName))
+			return 0, errorInfo
+		}
+		keyUsage |= tKeyUsage
+	}
+
+	if _, ok := publicKey.(*rsa.PublicKey); ok == false && publicKey != nil {
+		keyUsage &^= x509.KeyUsageKeyEncipherment
+	}
+
+	return
+}
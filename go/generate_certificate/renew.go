@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+var (
+	// renewRegeneratedExtensions - the extensions signCertificateFile makes again for the new certificate. Every other
+	// extension is copied unchanged.
+	renewRegeneratedExtensions = map[string]bool{
+		oidExtensionAuthorityKeyIdentifier.String(): true,
+		oidExtensionBasicConstraints.String():       true,
+		oidExtensionSubjectKeyIdentifier.String():   true,
+	}
+)
+
+// renewRequest - what the renew command renews. Either CertificateFQN or Directory is required.
+type renewRequest struct {
+	Backdate         time.Duration // See certificateRequest.
+	CACertificateFQN string        // Required for certificates that are not self-signed. It must be the CA that signed them.
+	CAPrivateKeyFQN  string        // The private key of CACertificateFQN.
+	CertificateFQN   string        // The certificate file, with its .pem extension.
+	Directory        string        // Every certificate .pem file in the directory that expires within WithinDays.
+	NotAfter         string        // See certificateRequest.
+	NotBefore        string        // See certificateRequest.
+	PrivateKeyFQN    string        // Optional with CertificateFQN. The default is the key in the certificate's directory that matches it.
+	RotateKey        bool          // Generate a new key of the same type and size instead of reusing the old one.
+	ValidFor         string        // See certificateRequest. The default is the old certificate's validity.
+	WithinDays       int           // Only used with Directory.
+}
+
+// renewCertificates - renews the certificate, or every certificate in the directory that expires within WithinDays. A failure
+// in the directory does not stop the others from being renewed.
+//
+//	Customer Messages: None
+//	Errors: ErrRenewFailed, errors returned by loadIssuer, os and renewCertificate
+//	Verifications: None
+func renewCertificates(request renewRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertificateFQNs []string
+		tEntries         []os.DirEntry
+		tFailed          int
+		tIssuerPtr       *issuer
+		tRenewBefore     = time.Now().AddDate(0, 0, request.WithinDays)
+	)
+
+	if request.CACertificateFQN != ctv.VAL_EMPTY || request.CAPrivateKeyFQN != ctv.VAL_EMPTY {
+		if tIssuerPtr, errorInfo = loadIssuer(request.CACertificateFQN, request.CAPrivateKeyFQN); errorInfo.Error != nil {
+			return
+		}
+	}
+
+	if request.Directory == ctv.VAL_EMPTY {
+		return renewCertificate(request, request.CertificateFQN, tIssuerPtr)
+	}
+
+	if tEntries, errorInfo.Error = os.ReadDir(request.Directory); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Directory: %s", request.Directory))
+		return
+	}
+	for _, tEntry := range tEntries {
+		if tEntry.Type().IsRegular() && strings.HasSuffix(tEntry.Name(), EXTENSION_CERTIFICATE) && strings.HasSuffix(tEntry.Name(), EXTENSION_FULL_CHAIN) == false {
+			tCertificateFQNs = append(tCertificateFQNs, filepath.Join(request.Directory, tEntry.Name()))
+		}
+	}
+	sort.Strings(tCertificateFQNs)
+
+	// A private key is never taken from the command line for a directory, because each certificate has its own.
+	request.PrivateKeyFQN = ctv.VAL_EMPTY
+	for _, tCertificateFQN := range tCertificateFQNs {
+		tCertificates, tErrorInfo := readCertificates(tCertificateFQN)
+		switch {
+		case tErrorInfo.Error != nil:
+			continue // Not a certificate file.
+		case tIssuerPtr != nil && tCertificates[0].Equal(tIssuerPtr.Chain[0]):
+			continue
+		case tCertificates[0].NotAfter.After(tRenewBefore):
+			fmt.Printf("Not due: %s expires %s\n", tCertificateFQN, tCertificates[0].NotAfter.Format(time.RFC3339))
+			continue
+		}
+		if tErrorInfo = renewCertificate(request, tCertificateFQN, tIssuerPtr); tErrorInfo.Error != nil {
+			errs.PrintErrorInfo(tErrorInfo)
+			tFailed++
+		}
+	}
+
+	if tFailed > 0 {
+		errorInfo = errs.NewErrorInfo(ErrRenewFailed, fmt.Sprintf("Directory: %s Failed: %d", request.Directory, tFailed))
+	}
+
+	return
+}
+
+// renewCertificate - issues a new certificate with the subject, subject alternative names and extensions of the old one, a new
+// serial number and a new validity. A self-signed certificate is signed by its own key and any other by the issuer, which must
+// be the CA that signed the old one. The old files are kept with a .bak extension and put back if the renewal fails, and the
+// files the renewal created are removed.
+//
+//	Customer Messages: None
+//	Errors: ErrCertificateNameInvalid, ErrIssuerMismatch, ErrIssuerRequired, ErrValidForInvalid, errors returned by readCertificates, findPrivateKey,
+//	certs.ReadPrivateKey, validityWindow, keyTypeOf, certs.GenerateKey, backupFiles, signCertificateFile, writeKeyFiles and verifySignedFiles
+//	Verifications: None
+func renewCertificate(request renewRequest, certificateFQN string, issuerPtr *issuer) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tBackups         []string
+		tCertificates    []*x509.Certificate
+		tCreated         []string
+		tKeyType         string
+		tNewKey          crypto.Signer
+		tOldPtr          *x509.Certificate
+		tPrivateKey      crypto.Signer
+		tPrivateKeyFQN   = request.PrivateKeyFQN
+		tRSABits         int
+		tSelfSigned      bool
+		tTargetFQNs      []string
+		tTemplate        x509.Certificate
+		tValidity        time.Duration
+		tValidityRequest = certificateRequest{
+			Backdate:  request.Backdate,
+			NotAfter:  request.NotAfter,
+			NotBefore: request.NotBefore,
+			ValidFor:  request.ValidFor,
+		}
+	)
+
+	if strings.HasSuffix(certificateFQN, EXTENSION_CERTIFICATE) == false {
+		errorInfo = errs.NewErrorInfo(ErrCertificateNameInvalid, fmt.Sprintf("Certificate File: %s", certificateFQN))
+		return
+	}
+	tBaseFQN := strings.TrimSuffix(certificateFQN, EXTENSION_CERTIFICATE)
+
+	if tCertificates, errorInfo = readCertificates(certificateFQN); errorInfo.Error != nil {
+		return
+	}
+	tOldPtr = tCertificates[0]
+
+	if tPrivateKeyFQN == ctv.VAL_EMPTY {
+		if tPrivateKeyFQN, tPrivateKey, errorInfo = findPrivateKey(filepath.Dir(certificateFQN), tOldPtr.PublicKey); errorInfo.Error != nil {
+			return
+		}
+	} else {
+		if tPrivateKey, errorInfo = certs.ReadPrivateKey(tPrivateKeyFQN, ctv.VAL_EMPTY); errorInfo.Error != nil {
+			return
+		}
+		if certs.SamePublicKey(tOldPtr.PublicKey, tPrivateKey.Public()) == false {
+			errorInfo = errs.NewErrorInfo(ErrCertificateKeyMismatch, fmt.Sprintf("Certificate File: %s Key File: %s", certificateFQN, tPrivateKeyFQN))
+			return
+		}
+	}
+
+	tSelfSigned = bytes.Equal(tOldPtr.RawIssuer, tOldPtr.RawSubject) && tOldPtr.CheckSignatureFrom(tOldPtr) == nil
+	switch {
+	case tSelfSigned:
+		issuerPtr = nil
+	case issuerPtr == nil:
+		errorInfo = errs.NewErrorInfo(ErrIssuerRequired, fmt.Sprintf("Certificate File: %s Issuer: %s", certificateFQN, tOldPtr.Issuer))
+		return
+	case tOldPtr.CheckSignatureFrom(issuerPtr.Chain[0]) != nil:
+		errorInfo = errs.NewErrorInfo(ErrIssuerMismatch, fmt.Sprintf("Certificate File: %s Issuer: %s CA: %s", certificateFQN, tOldPtr.Issuer, issuerPtr.Chain[0].Subject))
+		return
+	}
+
+	if request.ValidFor == ctv.VAL_EMPTY && request.NotAfter == ctv.VAL_EMPTY {
+		if tValidity = tOldPtr.NotAfter.Sub(tOldPtr.NotBefore); tValidity <= 0 {
+			errorInfo = errs.NewErrorInfo(ErrValidForInvalid, fmt.Sprintf("Certificate File: %s has no validity to reuse, so valid_for or not_after is needed", certificateFQN))
+			return
+		}
+		// Duration.String always has a seconds unit, such as 8760h0m0s, so it is parsed as a Go duration and never as months.
+		tValidityRequest.ValidFor = tValidity.String()
+	}
+	tTemplate = templateFromCertificate(tOldPtr)
+	if tTemplate.NotBefore, tTemplate.NotAfter, errorInfo = tValidityRequest.validityWindow(time.Now(), profile{}); errorInfo.Error != nil {
+		return
+	}
+
+	tNewKey = tPrivateKey
+	tTargetFQNs = []string{certificateFQN}
+	if issuerPtr != nil {
+		tTargetFQNs = append(tTargetFQNs, tBaseFQN+EXTENSION_FULL_CHAIN)
+	}
+	if request.RotateKey {
+		if tKeyType, tRSABits, errorInfo = keyTypeOf(tPrivateKey.Public()); errorInfo.Error != nil {
+			return
+		}
+		if tNewKey, errorInfo = certs.GenerateKey(tKeyType, tRSABits, MIN_RSA_BITS); errorInfo.Error != nil {
+			return
+		}
+		tTargetFQNs = append(tTargetFQNs, tPrivateKeyFQN, tPrivateKeyFQN+EXTENSION_PUBLIC_KEY)
+	}
+
+	if tBackups, tCreated, errorInfo = backupFiles(tTargetFQNs); errorInfo.Error != nil {
+		return
+	}
+	defer func() {
+		if errorInfo.Error != nil {
+			restoreBackups(tBackups, tCreated)
+		}
+	}()
+
+	if errorInfo = signCertificateFile(tBaseFQN, &tTemplate, tNewKey.Public(), tNewKey, issuerPtr); errorInfo.Error != nil {
+		return
+	}
+	if request.RotateKey {
+		if errorInfo = writeKeyFiles(tPrivateKeyFQN, tNewKey); errorInfo.Error != nil {
+			return
+		}
+	}
+	if errorInfo = verifySignedFiles(certificateRequest{CertificateFQN: tBaseFQN}, tNewKey.Public(), issuerPtr); errorInfo.Error != nil {
+		return
+	}
+
+	fmt.Printf("Renewed: %s\n", certificateFQN)
+	fmt.Printf("%sSubject: %s\n", ctv.SPACES_FOUR, tOldPtr.Subject)
+	fmt.Printf("%sNot After: %s (was %s)\n", ctv.SPACES_FOUR, tTemplate.NotAfter.UTC().Format(time.RFC3339), tOldPtr.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Printf("%sSerial Number: %x\n", ctv.SPACES_FOUR, tTemplate.SerialNumber)
+	if request.RotateKey {
+		fmt.Printf("%sNew Private Key File: %s\n", ctv.SPACES_FOUR, tPrivateKeyFQN)
+	} else {
+		fmt.Printf("%sPrivate Key File: %s (reused)\n", ctv.SPACES_FOUR, tPrivateKeyFQN)
+	}
+	fmt.Printf("%sBackups: %s\n", ctv.SPACES_FOUR, strings.Join(tBackups, ", "))
+
+	return
+}
+
+// backupFiles - copies each file that exists to <file>.bak, with the same permissions. It returns the files it copied and the
+// files that do not exist yet, which the renewal will create.
+//
+//	Customer Messages: None
+//	Errors: errors returned by os and certs.WriteOutFile
+//	Verifications: None
+func backupFiles(fqns []string) (backedUp []string, created []string, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData []byte
+		tInfo os.FileInfo
+	)
+
+	for _, tFQN := range fqns {
+		if tInfo, errorInfo.Error = os.Stat(tFQN); os.IsNotExist(errorInfo.Error) {
+			errorInfo.Error = nil
+			created = append(created, tFQN)
+			continue
+		}
+		if errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", tFQN))
+			return
+		}
+		if tData, errorInfo.Error = os.ReadFile(tFQN); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", tFQN))
+			return
+		}
+		if errorInfo = certs.WriteOutFile(tFQN+EXTENSION_BACKUP, tData, tInfo.Mode().Perm()); errorInfo.Error != nil {
+			return
+		}
+		backedUp = append(backedUp, tFQN)
+	}
+
+	return
+}
+
+// restoreBackups - puts each <file>.bak back and removes the files the renewal created. A file that cannot be restored or
+// removed is reported, and a backup is left in place.
+func restoreBackups(fqns []string, created []string) {
+
+	for _, tFQN := range created {
+		if tErr := os.Remove(tFQN); tErr != nil && os.IsNotExist(tErr) == false {
+			fmt.Printf("%sCould not remove %s: %s\n", ctv.SPACES_FOUR, tFQN, tErr)
+		}
+	}
+
+	for _, tFQN := range fqns {
+		tData, tErr := os.ReadFile(tFQN + EXTENSION_BACKUP)
+		if tErr == nil {
+			var tInfo os.FileInfo
+			if tInfo, tErr = os.Stat(tFQN + EXTENSION_BACKUP); tErr == nil {
+				tErr = certs.WriteOutFile(tFQN, tData, tInfo.Mode().Perm()).Error
+			}
+		}
+		if tErr != nil {
+			fmt.Printf("%sCould not restore %s from %s: %s\n", ctv.SPACES_FOUR, tFQN, tFQN+EXTENSION_BACKUP, tErr)
+		}
+	}
+}
+
+// findPrivateKey - the first file in the directory, by name, that holds the private key for the public key.
+//
+//	Customer Messages: None
+//	Errors: ErrPrivateKeyNotFound, errors returned by os
+//	Verifications: None
+func findPrivateKey(directory string, publicKey crypto.PublicKey) (privateKeyFQN string, privateKey crypto.Signer, errorInfo errs.ErrorInfo) {
+
+	var (
+		tEntries []os.DirEntry
+	)
+
+	if tEntries, errorInfo.Error = os.ReadDir(directory); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Directory: %s", directory))
+		return
+	}
+
+	for _, tEntry := range tEntries {
+		if tEntry.Type().IsRegular() == false || strings.HasSuffix(tEntry.Name(), EXTENSION_BACKUP) {
+			continue
+		}
+		tFQN := filepath.Join(directory, tEntry.Name())
+		if tKey, tErrorInfo := certs.ReadPrivateKey(tFQN, ctv.VAL_EMPTY); tErrorInfo.Error == nil && certs.SamePublicKey(publicKey, tKey.Public()) {
+			return tFQN, tKey, errorInfo
+		}
+	}
+
+	errorInfo = errs.NewErrorInfo(ErrPrivateKeyNotFound, fmt.Sprintf("Directory: %s", directory))
+
+	return
+}
+
+// templateFromCertificate - a template with the old certificate's subject, names, constraints and extensions. Only the
+// extensions in renewRegeneratedExtensions are left for signCertificateFile to make again.
+func templateFromCertificate(oldPtr *x509.Certificate) (template x509.Certificate) {
+
+	template = x509.Certificate{
+		RawSubject:                  oldPtr.RawSubject,
+		Subject:                     oldPtr.Subject,
+		BasicConstraintsValid:       oldPtr.BasicConstraintsValid,
+		IsCA:                        oldPtr.IsCA,
+		MaxPathLen:                  oldPtr.MaxPathLen,
+		MaxPathLenZero:              oldPtr.MaxPathLenZero,
+		KeyUsage:                    oldPtr.KeyUsage,
+		ExtKeyUsage:                 oldPtr.ExtKeyUsage,
+		UnknownExtKeyUsage:          oldPtr.UnknownExtKeyUsage,
+		DNSNames:                    oldPtr.DNSNames,
+		EmailAddresses:              oldPtr.EmailAddresses,
+		IPAddresses:                 oldPtr.IPAddresses,
+		URIs:                        oldPtr.URIs,
+		CRLDistributionPoints:       oldPtr.CRLDistributionPoints,
+		IssuingCertificateURL:       oldPtr.IssuingCertificateURL,
+		OCSPServer:                  oldPtr.OCSPServer,
+		PolicyIdentifiers:           oldPtr.PolicyIdentifiers,
+		PermittedDNSDomainsCritical: oldPtr.PermittedDNSDomainsCritical,
+		PermittedDNSDomains:         oldPtr.PermittedDNSDomains,
+		ExcludedDNSDomains:          oldPtr.ExcludedDNSDomains,
+		PermittedIPRanges:           oldPtr.PermittedIPRanges,
+		ExcludedIPRanges:            oldPtr.ExcludedIPRanges,
+		PermittedEmailAddresses:     oldPtr.PermittedEmailAddresses,
+		ExcludedEmailAddresses:      oldPtr.ExcludedEmailAddresses,
+		PermittedURIDomains:         oldPtr.PermittedURIDomains,
+		ExcludedURIDomains:          oldPtr.ExcludedURIDomains,
+	}
+	if oldPtr.MaxPathLen == 0 && oldPtr.MaxPathLenZero == false {
+		template.MaxPathLen = -1
+	}
+
+	// The raw extensions override those made from the fields above, so what the fields cannot hold is kept too.
+	for _, tExtension := range oldPtr.Extensions {
+		if renewRegeneratedExtensions[tExtension.Id.String()] == false {
+			template.ExtraExtensions = append(template.ExtraExtensions, tExtension)
+		}
+	}
+
+	return
+}
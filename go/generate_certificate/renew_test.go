@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"os"
+	"testing"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+)
+
+// newTestLeaf - a CA and a server certificate for www.example.com that it issued, valid for validFor, in a new directory.
+func newTestLeaf(t *testing.T, validFor string) (caFQN string, leafFQN string) {
+
+	t.Helper()
+
+	tDirectory := t.TempDir()
+	caFQN = generateTestCertificate(t, tDirectory, "ca", certificateRequest{SelfCA: true, Subject: subjectRequest{CommonName: "Test CA"}, ValidFor: "365d"})
+	leafFQN = generateTestCertificate(t, tDirectory, "leaf", certificateRequest{
+		CACertificateFQN: caFQN + EXTENSION_CERTIFICATE,
+		CAPrivateKeyFQN:  caFQN,
+		Profile:          "server",
+		SANs:             sanRequest{DNSNames: []string{"www.example.com"}},
+		ValidFor:         validFor,
+	})
+
+	return
+}
+
+func readTestFile(t *testing.T, fqn string) []byte {
+
+	tData, tErr := os.ReadFile(fqn)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	return tData
+}
+
+// TestRenewCertificate - the renewed certificate keeps the old subject, names and validity, down to the second, and either the
+// old key or a new one. The replaced files are kept as .bak copies.
+func TestRenewCertificate(t *testing.T) {
+
+	for _, tCase := range []struct {
+		name      string
+		rotateKey bool
+	}{
+		{name: "same key", rotateKey: false},
+		{name: "rotated key", rotateKey: true},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			// Twenty minutes is under the half hour that rounding to the hour used to turn into 0s.
+			tCAFQN, tLeafFQN := newTestLeaf(t, "1200s")
+			tOldPtr := readFirstCertificate(t, tLeafFQN+EXTENSION_CERTIFICATE)
+			tOldCertificate := readTestFile(t, tLeafFQN+EXTENSION_CERTIFICATE)
+			tOldKey := readTestFile(t, tLeafFQN)
+
+			if tErrorInfo := renewCertificates(renewRequest{
+				CACertificateFQN: tCAFQN + EXTENSION_CERTIFICATE,
+				CAPrivateKeyFQN:  tCAFQN,
+				CertificateFQN:   tLeafFQN + EXTENSION_CERTIFICATE,
+				RotateKey:        tCase.rotateKey,
+			}); tErrorInfo.Error != nil {
+				t.Fatalf("renewCertificates: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+			}
+
+			tNewPtr := readFirstCertificate(t, tLeafFQN+EXTENSION_CERTIFICATE)
+			switch {
+			case tNewPtr.SerialNumber.Cmp(tOldPtr.SerialNumber) == 0:
+				t.Error("the serial number was not changed")
+			case tNewPtr.Subject.String() != tOldPtr.Subject.String() || tNewPtr.DNSNames[0] != tOldPtr.DNSNames[0]:
+				t.Errorf("renewed %s %v, want %s %v", tNewPtr.Subject, tNewPtr.DNSNames, tOldPtr.Subject, tOldPtr.DNSNames)
+			case tNewPtr.NotAfter.Sub(tNewPtr.NotBefore) != tOldPtr.NotAfter.Sub(tOldPtr.NotBefore):
+				t.Errorf("validity = %s, want %s", tNewPtr.NotAfter.Sub(tNewPtr.NotBefore), tOldPtr.NotAfter.Sub(tOldPtr.NotBefore))
+			}
+			if certs.SamePublicKey(tNewPtr.PublicKey, tOldPtr.PublicKey) == tCase.rotateKey {
+				t.Errorf("the key was rotated: %t, want %t", tCase.rotateKey == false, tCase.rotateKey)
+			}
+
+			// verifyOutputFiles checks the certificate, both key files and the chain belong together.
+			if tErrorInfo := verifyOutputFiles(certificateRequest{CertificateFQN: tLeafFQN, PrivateKeyFQN: tLeafFQN}, &issuer{}); tErrorInfo.Error != nil {
+				t.Errorf("verifyOutputFiles: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+			}
+			if bytes.Equal(readTestFile(t, tLeafFQN+EXTENSION_CERTIFICATE+EXTENSION_BACKUP), tOldCertificate) == false {
+				t.Error("the certificate backup is not the old certificate")
+			}
+			if _, tErr := os.Stat(tLeafFQN + EXTENSION_BACKUP); (tErr == nil) != tCase.rotateKey {
+				t.Errorf("a backup of the key: %v, want one only when rotating", tErr)
+			}
+			if tCase.rotateKey && bytes.Equal(readTestFile(t, tLeafFQN+EXTENSION_BACKUP), tOldKey) == false {
+				t.Error("the key backup is not the old key")
+			}
+		})
+	}
+}
+
+// TestRenewCertificateRollsBack - the CA is replaced by one with the same key that only permits example.org, so the renewed
+// chain fails verification after every file has been written. The old files must be put back and the chain file, which did not
+// exist before, removed.
+func TestRenewCertificateRollsBack(t *testing.T) {
+
+	var (
+		tInvalidErr x509.CertificateInvalidError
+	)
+
+	tCAFQN, tLeafFQN := newTestLeaf(t, "30d")
+
+	tCAKey, tErrorInfo := certs.ReadPrivateKey(tCAFQN, ctv.VAL_EMPTY)
+	if tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+	tCAPtr := readFirstCertificate(t, tCAFQN+EXTENSION_CERTIFICATE)
+	tCAPtr.PermittedDNSDomains = []string{"example.org"}
+	tCA, tErr := x509.CreateCertificate(rand.Reader, tCAPtr, tCAPtr, tCAKey.Public(), tCAKey)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	if tErrorInfo = writeOutPEMFile(tCAFQN+EXTENSION_CERTIFICATE, tCA, PEM_CERTIFICATE); tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+	if tErr = os.Remove(tLeafFQN + EXTENSION_FULL_CHAIN); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	tOld := make(map[string][]byte)
+	for _, tFQN := range []string{tLeafFQN + EXTENSION_CERTIFICATE, tLeafFQN, tLeafFQN + EXTENSION_PUBLIC_KEY} {
+		tOld[tFQN] = readTestFile(t, tFQN)
+	}
+
+	tErrorInfo = renewCertificates(renewRequest{
+		CACertificateFQN: tCAFQN + EXTENSION_CERTIFICATE,
+		CAPrivateKeyFQN:  tCAFQN,
+		CertificateFQN:   tLeafFQN + EXTENSION_CERTIFICATE,
+		RotateKey:        true,
+	})
+	if tErrorInfo.Error == nil {
+		t.Fatal("renewCertificates succeeded with a CA that does not permit the name")
+	}
+	if errors.As(tErrorInfo.Error, &tInvalidErr) == false || tInvalidErr.Reason != x509.CANotAuthorizedForThisName {
+		t.Fatalf("renewCertificates error = %s, want a name constraint failure", tErrorInfo.Error)
+	}
+
+	for tFQN, tData := range tOld {
+		if bytes.Equal(readTestFile(t, tFQN), tData) == false {
+			t.Errorf("%s was not restored", tFQN)
+		}
+	}
+	if _, tErr = os.Stat(tLeafFQN + EXTENSION_FULL_CHAIN); os.IsNotExist(tErr) == false {
+		t.Errorf("the chain file the renewal created was not removed: %v", tErr)
+	}
+}
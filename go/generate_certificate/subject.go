@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// subjectRequest - the subject's distinguished name. Empty fields are left out of the certificate.
+type subjectRequest struct {
+	CommonName         string `yaml:"common_name"`
+	Country            string `yaml:"country"`
+	Locality           string `yaml:"locality"`
+	Organization       string `yaml:"organization"`
+	OrganizationalUnit string `yaml:"organizational_unit"`
+	Province           string `yaml:"province"`
+}
+
+// sanRequest - the subject alternative names, as given on the command line.
+type sanRequest struct {
+	DNSNames       []string
+	EmailAddresses []string
+	IPAddresses    []string
+	URIs           []string
+}
+
+// withDefaults - fills the empty fields from defaults.
+func (s subjectRequest) withDefaults(defaults subjectRequest) subjectRequest {
+
+	for _, tField := range []struct {
+		value        *string
+		defaultValue string
+	}{
+		{&s.CommonName, defaults.CommonName},
+		{&s.Country, defaults.Country},
+		{&s.Locality, defaults.Locality},
+		{&s.Organization, defaults.Organization},
+		{&s.OrganizationalUnit, defaults.OrganizationalUnit},
+		{&s.Province, defaults.Province},
+	} {
+		if *tField.value == ctv.VAL_EMPTY {
+			*tField.value = tField.defaultValue
+		}
+	}
+
+	return s
+}
+
+// name - the subject as a pkix.Name.
+func (s subjectRequest) name() (name pkix.Name) {
+
+	name.CommonName = s.CommonName
+	for _, tField := range []struct {
+		value  string
+		target *[]string
+	}{
+		{s.Country, &name.Country},
+		{s.Locality, &name.Locality},
+		{s.Organization, &name.Organization},
+		{s.OrganizationalUnit, &name.OrganizationalUnit},
+		{s.Province, &name.Province},
+	} {
+		if tField.value != ctv.VAL_EMPTY {
+			*tField.target = []string{tField.value}
+		}
+	}
+
+	return
+}
+
+// empty - there are no subject alternative names.
+func (s sanRequest) empty() bool {
+	return len(s.DNSNames) == 0 && len(s.EmailAddresses) == 0 && len(s.IPAddresses) == 0 && len(s.URIs) == 0
+}
+
+// apply - parses the subject alternative names into the template. Duplicates are dropped.
+//
+//	Customer Messages: None
+//	Errors: ErrSANInvalid
+//	Verifications: None
+func (s sanRequest) apply(templatePtr *x509.Certificate) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tSeen = make(map[string]bool)
+	)
+
+	isNew := func(kind string, value string) bool {
+		tKey := kind + ":" + strings.ToLower(value)
+		if tSeen[tKey] {
+			return false
+		}
+		tSeen[tKey] = true
+		return true
+	}
+
+	for _, tDNSName := range s.DNSNames {
+		tDNSName = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(tDNSName)), ".")
+		if tDNSName == ctv.VAL_EMPTY || strings.ContainsAny(tDNSName, " /:@") {
+			errorInfo = errs.NewErrorInfo(ErrSANInvalid, fmt.Sprintf("DNS Name: %s", tDNSName))
+			return
+		}
+		if isNew("dns", tDNSName) {
+			templatePtr.DNSNames = append(templatePtr.DNSNames, tDNSName)
+		}
+	}
+
+	for _, tIPAddress := range s.IPAddresses {
+		tIP := net.ParseIP(strings.TrimSpace(tIPAddress))
+		if tIP == nil {
+			errorInfo = errs.NewErrorInfo(ErrSANInvalid, fmt.Sprintf("IP Address: %s", tIPAddress))
+			return
+		}
+		if isNew("ip", tIP.String()) {
+			templatePtr.IPAddresses = append(templatePtr.IPAddresses, tIP)
+		}
+	}
+
+	for _, tEmailAddress := range s.EmailAddresses {
+		tAddressPtr, tErr := mail.ParseAddress(strings.TrimSpace(tEmailAddress))
+		if tErr != nil || tAddressPtr.Name != ctv.VAL_EMPTY {
+			errorInfo = errs.NewErrorInfo(ErrSANInvalid, fmt.Sprintf("Email Address: %s", tEmailAddress))
+			return
+		}
+		if isNew("email", tAddressPtr.Address) {
+			templatePtr.EmailAddresses = append(templatePtr.EmailAddresses, tAddressPtr.Address)
+		}
+	}
+
+	for _, tURI := range s.URIs {
+		tURLPtr, tErr := url.Parse(strings.TrimSpace(tURI))
+		if tErr != nil || tURLPtr.Scheme == ctv.VAL_EMPTY || tURLPtr.Host == ctv.VAL_EMPTY {
+			errorInfo = errs.NewErrorInfo(ErrSANInvalid, fmt.Sprintf("URI: %s", tURI))
+			return
+		}
+		if isNew("uri", tURLPtr.String()) {
+			templatePtr.URIs = append(templatePtr.URIs, tURLPtr)
+		}
+	}
+
+	return
+}
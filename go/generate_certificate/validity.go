@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// calendarValidityRegex - one or more <digits><unit> where the unit is y, m (months), w or d, such as 2y6m.
+var calendarValidityRegex = regexp.MustCompile(`^(\d{1,5}[ymwd])+$`)
+
+// validity - a length of time. The calendar units are added with AddDate, so a month ends on the same day of the next month,
+// or past it when that month is shorter (January 31 plus 1m is March 3). Duration is added after them.
+type validity struct {
+	Days     int
+	Duration time.Duration
+	Months   int
+	Years    int
+}
+
+// parseValidity - accepts the calendar form, such as 90d, 13m or 2y6m, where m is months, or a Go duration such as 720h or
+// 36h30m. The calendar form is tried first, so 30m is 30 months, not 30 minutes. The result must be more than zero and
+// at most MAX_VALIDITY_YEARS.
+//
+//	Customer Messages: None
+//	Errors: ErrValidForInvalid
+//	Verifications: None
+func parseValidity(value string) (parsed validity, errorInfo errs.ErrorInfo) {
+
+	var (
+		tSeen  = make(map[byte]bool)
+		tStart = time.Now()
+		tValue = strings.ToLower(strings.TrimSpace(value))
+	)
+
+	switch {
+	case calendarValidityRegex.MatchString(tValue):
+		for _, tPart := range regexp.MustCompile(`\d+[ymwd]`).FindAllString(tValue, -1) {
+			tUnit := tPart[len(tPart)-1]
+			if tSeen[tUnit] {
+				errorInfo = errs.NewErrorInfo(ErrValidForInvalid, fmt.Sprintf("Valid For: %s repeats the unit %c", value, tUnit))
+				return
+			}
+			tSeen[tUnit] = true
+			tNumber, _ := strconv.Atoi(tPart[:len(tPart)-1]) // The regex limits it to five digits.
+			switch tUnit {
+			case 'y':
+				parsed.Years = tNumber
+			case 'm':
+				parsed.Months = tNumber
+			case 'w':
+				parsed.Days += tNumber * 7
+			case 'd':
+				parsed.Days += tNumber
+			}
+		}
+	default:
+		if parsed.Duration, errorInfo.Error = time.ParseDuration(tValue); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(ErrValidForInvalid, fmt.Sprintf("Valid For: %s", value))
+			return
+		}
+	}
+
+	if tEnd := parsed.addTo(tStart); tEnd.After(tStart) == false || tEnd.After(tStart.AddDate(MAX_VALIDITY_YEARS, 0, 0)) {
+		errorInfo = errs.NewErrorInfo(ErrValidForInvalid, fmt.Sprintf("Valid For: %s", value))
+	}
+
+	return
+}
+
+// addTo - the time the validity ends when it starts at start.
+func (v validity) addTo(start time.Time) time.Time {
+	return start.AddDate(v.Years, v.Months, v.Days).Add(v.Duration)
+}
+
+// validityWindow - the certificate's NotBefore and NotAfter. NotBefore is request.NotBefore, or now less the backdate.
+// NotAfter is request.NotAfter, or ValidFor added to request.NotBefore or to now. The backdate only moves NotBefore, so a
+// certificate is still valid for ValidFor from when it was issued. The window cannot be longer than the profile's max_validity,
+// or than MAX_VALIDITY_YEARS.
+//
+//	Customer Messages: None
+//	Errors: ErrValidForInvalid, ErrValidityConflict, ErrValidityExceedsProfile, ErrValidityInvalid
+//	Verifications: None
+func (request certificateRequest) validityWindow(now time.Time, certificateProfile profile) (notBefore time.Time, notAfter time.Time, errorInfo errs.ErrorInfo) {
+
+	var (
+		tMaxValidity validity
+		tStart       = now
+		tValidFor    validity
+	)
+
+	switch {
+	case request.ValidFor != ctv.VAL_EMPTY && request.NotAfter != ctv.VAL_EMPTY:
+		errorInfo = errs.NewErrorInfo(ErrValidityConflict, fmt.Sprintf("Valid For: %s Not After: %s", request.ValidFor, request.NotAfter))
+		return
+	case request.ValidFor == ctv.VAL_EMPTY && request.NotAfter == ctv.VAL_EMPTY:
+		errorInfo = errs.NewErrorInfo(ErrValidForInvalid, "Valid For: none and no Not After")
+		return
+	case request.Backdate < 0:
+		errorInfo = errs.NewErrorInfo(ErrValidityInvalid, fmt.Sprintf("Backdate: %s", request.Backdate))
+		return
+	}
+
+	notBefore = now.Add(-request.Backdate)
+	if request.NotBefore != ctv.VAL_EMPTY {
+		if tStart, errorInfo.Error = time.Parse(time.RFC3339, request.NotBefore); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(ErrValidityInvalid, fmt.Sprintf("Not Before: %s", request.NotBefore))
+			return
+		}
+		notBefore = tStart
+	}
+
+	if request.NotAfter != ctv.VAL_EMPTY {
+		if notAfter, errorInfo.Error = time.Parse(time.RFC3339, request.NotAfter); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(ErrValidityInvalid, fmt.Sprintf("Not After: %s", request.NotAfter))
+			return
+		}
+	} else {
+		if tValidFor, errorInfo = parseValidity(request.ValidFor); errorInfo.Error != nil {
+			return
+		}
+		notAfter = tValidFor.addTo(tStart)
+	}
+
+	switch {
+	case notAfter.After(notBefore) == false:
+		errorInfo = errs.NewErrorInfo(ErrValidityInvalid, fmt.Sprintf("Not Before: %s Not After: %s", notBefore.Format(time.RFC3339), notAfter.Format(time.RFC3339)))
+		return
+	case notAfter.After(now) == false:
+		errorInfo = errs.NewErrorInfo(ErrValidityInvalid, fmt.Sprintf("Not After: %s has passed", notAfter.Format(time.RFC3339)))
+		return
+	case notAfter.After(tStart.AddDate(MAX_VALIDITY_YEARS, 0, 0)):
+		errorInfo = errs.NewErrorInfo(ErrValidityInvalid, fmt.Sprintf("Not After: %s is more than %d years away", notAfter.Format(time.RFC3339), MAX_VALIDITY_YEARS))
+		return
+	case certificateProfile.MaxValidity == ctv.VAL_EMPTY:
+		return
+	}
+
+	// loadProfile has already checked max_validity.
+	tMaxValidity, _ = parseValidity(certificateProfile.MaxValidity)
+	if notAfter.After(tMaxValidity.addTo(tStart)) {
+		errorInfo = errs.NewErrorInfo(ErrValidityExceedsProfile, fmt.Sprintf("Not After: %s Profile Max Validity: %s", notAfter.Format(time.RFC3339), certificateProfile.MaxValidity))
+	}
+
+	return
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseValidity(t *testing.T) {
+
+	for _, tCase := range []struct {
+		value   string
+		want    validity
+		wantErr error
+	}{
+		{value: "90d", want: validity{Days: 90}},
+		{value: "13m", want: validity{Months: 13}},
+		{value: "2y6m", want: validity{Years: 2, Months: 6}},
+		{value: "1y2m3w4d", want: validity{Years: 1, Months: 2, Days: 25}},
+		{value: "6m1y", want: validity{Years: 1, Months: 6}},
+		{value: " 90D ", want: validity{Days: 90}},
+		{value: "100y", want: validity{Years: MAX_VALIDITY_YEARS}},
+		{value: "720h", want: validity{Duration: 720 * time.Hour}},
+		{value: "36h30m", want: validity{Duration: 36*time.Hour + 30*time.Minute}},
+		{value: "90s", want: validity{Duration: 90 * time.Second}},
+		// m alone is months, so this is two and a half years, not half an hour.
+		{value: "30m", want: validity{Months: 30}},
+		{value: "0h30m", want: validity{Duration: 30 * time.Minute}},
+		{value: "1y1y", wantErr: ErrValidForInvalid},
+		{value: "2w3w", wantErr: ErrValidForInvalid},
+		{value: "1d2w3d", wantErr: ErrValidForInvalid},
+		{value: "0d", wantErr: ErrValidForInvalid},
+		{value: "0y0m", wantErr: ErrValidForInvalid},
+		{value: "0", wantErr: ErrValidForInvalid},
+		{value: "0h", wantErr: ErrValidForInvalid},
+		{value: "-1h", wantErr: ErrValidForInvalid},
+		{value: "-5d", wantErr: ErrValidForInvalid},
+		{value: "101y", wantErr: ErrValidForInvalid},
+		{value: "99y13m", wantErr: ErrValidForInvalid},
+		{value: "1201m", wantErr: ErrValidForInvalid},
+		{value: "900000h", wantErr: ErrValidForInvalid},
+		{value: "123456d", wantErr: ErrValidForInvalid},
+		{value: "", wantErr: ErrValidForInvalid},
+		{value: "d", wantErr: ErrValidForInvalid},
+		{value: "5x", wantErr: ErrValidForInvalid},
+		{value: "1y 6m", wantErr: ErrValidForInvalid},
+	} {
+		t.Run(tCase.value, func(t *testing.T) {
+			tParsed, tErrorInfo := parseValidity(tCase.value)
+			if tCase.wantErr != nil {
+				if errors.Is(tErrorInfo.Error, tCase.wantErr) == false {
+					t.Fatalf("parseValidity(%q) = %+v, %v, want %s", tCase.value, tParsed, tErrorInfo.Error, tCase.wantErr)
+				}
+				return
+			}
+			if tErrorInfo.Error != nil {
+				t.Fatalf("parseValidity(%q): %s %s", tCase.value, tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+			}
+			if tParsed != tCase.want {
+				t.Errorf("parseValidity(%q) = %+v, want %+v", tCase.value, tParsed, tCase.want)
+			}
+		})
+	}
+}
+
+func TestValidityAddTo(t *testing.T) {
+
+	tStart := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	for _, tCase := range []struct {
+		value string
+		want  time.Time
+	}{
+		{"1m", time.Date(2024, 3, 2, 12, 0, 0, 0, time.UTC)}, // February 2024 has 29 days.
+		{"1y", time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)},
+		{"2w", time.Date(2024, 2, 14, 12, 0, 0, 0, time.UTC)},
+		{"36h30m", time.Date(2024, 2, 2, 0, 30, 0, 0, time.UTC)},
+	} {
+		tParsed, tErrorInfo := parseValidity(tCase.value)
+		if tErrorInfo.Error != nil {
+			t.Fatalf("parseValidity(%q): %s", tCase.value, tErrorInfo.Error)
+		}
+		if tEnd := tParsed.addTo(tStart); tEnd.Equal(tCase.want) == false {
+			t.Errorf("%s after %s = %s, want %s", tCase.value, tStart.Format(time.RFC3339), tEnd.Format(time.RFC3339), tCase.want.Format(time.RFC3339))
+		}
+	}
+}
+
+func TestValidityWindow(t *testing.T) {
+
+	var (
+		tNow = time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)
+	)
+
+	for _, tCase := range []struct {
+		name          string
+		request       certificateRequest
+		profile       profile
+		wantNotBefore time.Time
+		wantNotAfter  time.Time
+		wantErr       error
+	}{
+		{
+			name:          "valid_for from now, backdated",
+			request:       certificateRequest{Backdate: DEFAULT_BACKDATE, ValidFor: "90d"},
+			wantNotBefore: tNow.Add(-DEFAULT_BACKDATE),
+			wantNotAfter:  tNow.AddDate(0, 0, 90),
+		},
+		{
+			name:          "a month from January 31",
+			request:       certificateRequest{ValidFor: "1m"},
+			wantNotBefore: tNow,
+			wantNotAfter:  time.Date(2025, 3, 3, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "Go duration",
+			request:       certificateRequest{Backdate: time.Minute, ValidFor: "720h"},
+			wantNotBefore: tNow.Add(-time.Minute),
+			wantNotAfter:  tNow.Add(720 * time.Hour),
+		},
+		{
+			name:          "valid_for from not_before, backdate not used",
+			request:       certificateRequest{Backdate: DEFAULT_BACKDATE, NotBefore: "2025-02-01T00:00:00Z", ValidFor: "2y6m"},
+			wantNotBefore: time.Date(2025, 2, 1, 0, 0, 0, 0, time.UTC),
+			wantNotAfter:  time.Date(2027, 8, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "not_after",
+			request:       certificateRequest{Backdate: DEFAULT_BACKDATE, NotAfter: "2025-06-30T00:00:00Z"},
+			wantNotBefore: tNow.Add(-DEFAULT_BACKDATE),
+			wantNotAfter:  time.Date(2025, 6, 30, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "not_before and not_after with an offset",
+			request:       certificateRequest{NotBefore: "2025-01-01T00:00:00-08:00", NotAfter: "2026-01-01T00:00:00-08:00"},
+			wantNotBefore: time.Date(2025, 1, 1, 8, 0, 0, 0, time.UTC),
+			wantNotAfter:  time.Date(2026, 1, 1, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:          "within the profile max_validity",
+			request:       certificateRequest{ValidFor: "397d"},
+			profile:       profile{MaxValidity: "397d"},
+			wantNotBefore: tNow,
+			wantNotAfter:  tNow.AddDate(0, 0, 397),
+		},
+		{
+			name:          "the backdate does not count against max_validity",
+			request:       certificateRequest{Backdate: time.Hour, ValidFor: "13m"},
+			profile:       profile{MaxValidity: "13m"},
+			wantNotBefore: tNow.Add(-time.Hour),
+			wantNotAfter:  tNow.AddDate(0, 13, 0),
+		},
+		{
+			name:    "valid_for and not_after",
+			request: certificateRequest{NotAfter: "2025-06-30T00:00:00Z", ValidFor: "90d"},
+			wantErr: ErrValidityConflict,
+		},
+		{
+			name:    "neither valid_for nor not_after",
+			request: certificateRequest{NotBefore: "2025-02-01T00:00:00Z"},
+			wantErr: ErrValidForInvalid,
+		},
+		{
+			name:    "negative backdate",
+			request: certificateRequest{Backdate: -time.Minute, ValidFor: "90d"},
+			wantErr: ErrValidityInvalid,
+		},
+		{
+			name:    "negative backdate with not_before",
+			request: certificateRequest{Backdate: -time.Minute, NotBefore: "2025-02-01T00:00:00Z", ValidFor: "90d"},
+			wantErr: ErrValidityInvalid,
+		},
+		{
+			name:    "not_before without a time",
+			request: certificateRequest{NotBefore: "2025-02-01", ValidFor: "90d"},
+			wantErr: ErrValidityInvalid,
+		},
+		{
+			name:    "not_after without a zone",
+			request: certificateRequest{NotAfter: "2025-06-30T00:00:00"},
+			wantErr: ErrValidityInvalid,
+		},
+		{
+			name:    "not_after before not_before",
+			request: certificateRequest{NotBefore: "2025-06-01T00:00:00Z", NotAfter: "2025-05-01T00:00:00Z"},
+			wantErr: ErrValidityInvalid,
+		},
+		{
+			name:    "not_after equal to not_before",
+			request: certificateRequest{NotBefore: "2025-06-01T00:00:00Z", NotAfter: "2025-06-01T00:00:00Z"},
+			wantErr: ErrValidityInvalid,
+		},
+		{
+			name:    "not_after has passed",
+			request: certificateRequest{NotAfter: "2025-01-31T11:59:59Z"},
+			wantErr: ErrValidityInvalid,
+		},
+		{
+			name:    "valid_for from a not_before that ends in the past",
+			request: certificateRequest{NotBefore: "2024-01-01T00:00:00Z", ValidFor: "30d"},
+			wantErr: ErrValidityInvalid,
+		},
+		{
+			name:    "valid_for over MAX_VALIDITY_YEARS",
+			request: certificateRequest{ValidFor: "101y"},
+			wantErr: ErrValidForInvalid,
+		},
+		{
+			name:    "not_after over MAX_VALIDITY_YEARS",
+			request: certificateRequest{NotAfter: "2999-01-01T00:00:00Z"},
+			wantErr: ErrValidityInvalid,
+		},
+		{
+			name:    "valid_for repeats a unit",
+			request: certificateRequest{ValidFor: "1y1y"},
+			wantErr: ErrValidForInvalid,
+		},
+		{
+			name:    "valid_for over the profile max_validity",
+			request: certificateRequest{ValidFor: "398d"},
+			profile: profile{MaxValidity: "397d"},
+			wantErr: ErrValidityExceedsProfile,
+		},
+		{
+			name:    "not_after over the profile max_validity",
+			request: certificateRequest{NotBefore: "2025-02-01T00:00:00Z", NotAfter: "2026-03-06T00:00:00Z"},
+			profile: profile{MaxValidity: "397d"},
+			wantErr: ErrValidityExceedsProfile,
+		},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			tNotBefore, tNotAfter, tErrorInfo := tCase.request.validityWindow(tNow, tCase.profile)
+			if tCase.wantErr != nil {
+				if errors.Is(tErrorInfo.Error, tCase.wantErr) == false {
+					t.Fatalf("validityWindow = %s, %s, %v, want %s", tNotBefore, tNotAfter, tErrorInfo.Error, tCase.wantErr)
+				}
+				return
+			}
+			if tErrorInfo.Error != nil {
+				t.Fatalf("validityWindow: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+			}
+			if tNotBefore.Equal(tCase.wantNotBefore) == false || tNotAfter.Equal(tCase.wantNotAfter) == false {
+				t.Errorf("validityWindow = %s - %s, want %s - %s", tNotBefore.Format(time.RFC3339), tNotAfter.Format(time.RFC3339), tCase.wantNotBefore.Format(time.RFC3339), tCase.wantNotAfter.Format(time.RFC3339))
+			}
+		})
+	}
+}
@@ -0,0 +1,1052 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/mail"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// acmeServeRequest - the ACME server that acme serve runs in front of the intermediate CA.
+type acmeServeRequest struct {
+	CADirectory   string
+	HTTP01Port    int    // The port http-01 challenges are fetched from, 80 unless a stand-in answers elsewhere.
+	Host          string // The name or address clients reach the server by. Its own TLS certificate is issued for it.
+	ListenAddress string
+	Resolver      string // A DNS server, such as the standin at 127.0.0.1:8053, used in place of the system's to validate.
+	ValidDays     int    // For the certificates it issues.
+}
+
+// acmeServer - the state of a running ACME server. Every request holds the mutex, so the accounts, orders and nonces are
+// only ever changed by one at a time. Validation runs outside it.
+type acmeServer struct {
+	Authority *authority
+	Validator *acmeValidator
+	ValidDays int
+	mutex     sync.Mutex
+	nonces    map[string]time.Time // The nonces handed out and not yet used, with when they expire.
+	state     acmeState
+}
+
+// acmeRequest - a POST whose JWS has been verified. AccountPtr is nil when it was signed with a JWK rather than an account.
+type acmeRequest struct {
+	AccountPtr *acmeAccount
+	BaseURL    string
+	JWK        json.RawMessage
+	Payload    []byte // Empty for a POST-as-GET.
+	PublicKey  crypto.PublicKey
+}
+
+// acmeHandler - answers a verified request, writing the response itself, or returns the problem to send instead.
+type acmeHandler func(w http.ResponseWriter, r *http.Request, request acmeRequest) (problemPtr *acmeProblem)
+
+var (
+	// acmeProblemStatuses - the HTTP status of each ACME error that is not 400 Bad Request.
+	acmeProblemStatuses = map[string]int{
+		ACME_ERROR_ORDER_NOT_READY: http.StatusForbidden,
+		ACME_ERROR_SERVER_INTERNAL: http.StatusInternalServerError,
+		ACME_ERROR_UNAUTHORIZED:    http.StatusForbidden,
+	}
+)
+
+// runACME - answers RFC 8555 ACME requests over HTTPS until interrupted, issuing certificates from the intermediate CA for
+// identifiers whose http-01 or dns-01 challenge validates. Accounts, orders and authorizations are kept in acme/state.json.
+// The server's own certificate, acme/server.pem, is issued from the intermediate for the host when there is none, it does not
+// cover the host, or it is close to expiring, so clients that trust the root can reach it.
+//
+//	Customer Messages: None
+//	Errors: ErrHTTP01PortInvalid, ErrValidDaysInvalid, errors returned by loadAuthority, readACMEState,
+//	acmeServer.serverCertificate and net
+//	Verifications: None
+func runACME(request acmeServeRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertificate tls.Certificate
+		tListener    net.Listener
+		tServerPtr   = &acmeServer{ValidDays: request.ValidDays, nonces: map[string]time.Time{}}
+	)
+
+	switch {
+	case request.ValidDays < 1:
+		errorInfo = errs.NewErrorInfo(ErrValidDaysInvalid, fmt.Sprintf("Valid Days: %d", request.ValidDays))
+		return
+	case request.HTTP01Port < 1 || request.HTTP01Port > 65535:
+		errorInfo = errs.NewErrorInfo(ErrHTTP01PortInvalid, fmt.Sprintf("HTTP-01 Port: %d", request.HTTP01Port))
+		return
+	}
+	if tServerPtr.Authority, errorInfo = loadAuthority(request.CADirectory); errorInfo.Error != nil {
+		return
+	}
+	if tServerPtr.state, errorInfo = readACMEState(request.CADirectory); errorInfo.Error != nil {
+		return
+	}
+	// A validation that was running when the server stopped never finished, so the client can try it again.
+	for _, tAuthorizationPtr := range tServerPtr.state.Authorizations {
+		for _, tChallengePtr := range tAuthorizationPtr.Challenges {
+			if tChallengePtr.Status == ACME_STATUS_PROCESSING {
+				tChallengePtr.Status = ACME_STATUS_PENDING
+			}
+		}
+	}
+	tServerPtr.Validator = newACMEValidator(request.Resolver, request.HTTP01Port)
+	if tCertificate, errorInfo = tServerPtr.serverCertificate(request.Host); errorInfo.Error != nil {
+		return
+	}
+	if tListener, errorInfo.Error = net.Listen("tcp", request.ListenAddress); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Listen Address: %s", request.ListenAddress))
+		return
+	}
+
+	tContext, tStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer tStop()
+
+	tHTTPServerPtr := &http.Server{
+		Handler:           tServerPtr.handler(),
+		ReadHeaderTimeout: HTTP_READ_HEADER_TIMEOUT,
+		TLSConfig:         &tls.Config{Certificates: []tls.Certificate{tCertificate}, MinVersion: tls.VersionTLS12},
+	}
+	go func() {
+		if tErr := tHTTPServerPtr.ServeTLS(tListener, ctv.VAL_EMPTY, ctv.VAL_EMPTY); tErr != nil && errors.Is(tErr, http.ErrServerClosed) == false {
+			errs.PrintErrorInfo(errs.NewErrorInfo(tErr, fmt.Sprintf("Listen Address: %s", request.ListenAddress)))
+			tStop()
+		}
+	}()
+	_, tPort, _ := net.SplitHostPort(tListener.Addr().String())
+	fmt.Printf("Answering ACME requests at https://%s/directory for %s\n", net.JoinHostPort(request.Host, tPort), tServerPtr.Authority.Intermediate.Subject)
+	if request.Resolver != ctv.VAL_EMPTY {
+		fmt.Printf("%sChallenges are validated with the DNS server at %s and http-01 on port %d.\n", ctv.SPACES_FOUR, request.Resolver, request.HTTP01Port)
+	}
+	printCertificate("ACME Server", tCertificate.Leaf)
+
+	<-tContext.Done()
+
+	tShutdownContext, tCancel := context.WithTimeout(context.Background(), HTTP_SHUTDOWN_TIMEOUT)
+	defer tCancel()
+	_ = tHTTPServerPtr.Shutdown(tShutdownContext)
+
+	return
+}
+
+// serverCertificate - the server's TLS certificate and key from the acme directory, or a new one issued for the host when
+// they are missing, do not cover the host or expire within ACME_SERVER_RENEW_BEFORE.
+//
+//	Customer Messages: None
+//	Errors: errors returned by os, certs.GenerateKey, authority.issue, writePrivateKey and writeCertificatesFile
+//	Verifications: None
+func (s *acmeServer) serverCertificate(host string) (certificate tls.Certificate, errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertificateFQN = filepath.Join(s.Authority.Directory, DIRECTORY_ACME, FILE_ACME_SERVER_CERTIFICATE)
+		tCertificatePtr *x509.Certificate
+		tCertificates   []*x509.Certificate
+		tKey            crypto.Signer
+		tKeyFQN         = filepath.Join(s.Authority.Directory, DIRECTORY_ACME, FILE_ACME_SERVER_KEY)
+		tNow            = time.Now()
+	)
+
+	if tCertificates, errorInfo = readCertificates(tCertificateFQN); errorInfo.Error == nil {
+		if tKey, errorInfo = certs.ReadPrivateKey(tKeyFQN, ctv.VAL_EMPTY); errorInfo.Error == nil &&
+			certs.SamePublicKey(tCertificates[0].PublicKey, tKey.Public()) &&
+			tCertificates[0].VerifyHostname(host) == nil &&
+			tCertificates[0].NotAfter.Sub(tNow) > ACME_SERVER_RENEW_BEFORE {
+			return tls.Certificate{Certificate: s.Authority.chain(tCertificates[0]), PrivateKey: tKey, Leaf: tCertificates[0]}, errorInfo
+		}
+	}
+	errorInfo = errs.ErrorInfo{}
+
+	if errorInfo.Error = os.MkdirAll(filepath.Join(s.Authority.Directory, DIRECTORY_ACME), DIRECTORY_PERMISSIONS); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Directory: %s", filepath.Join(s.Authority.Directory, DIRECTORY_ACME)))
+		return
+	}
+	if tKey, errorInfo = certs.GenerateKey(KEY_TYPE_ECDSA_P256, 0, MIN_RSA_BITS); errorInfo.Error != nil {
+		return
+	}
+	tTemplate := x509.Certificate{
+		Subject:     pkix.Name{CommonName: host},
+		NotBefore:   tNow.Add(-BACKDATE),
+		NotAfter:    tNow.Add(ACME_SERVER_RENEW_BEFORE).AddDate(0, 0, s.ValidDays),
+		KeyUsage:    certs.KeyUsageForKey(tKey.Public()),
+		ExtKeyUsage: profiles[PROFILE_SERVER],
+	}
+	if tIPAddress := net.ParseIP(host); tIPAddress != nil {
+		tTemplate.IPAddresses = []net.IP{tIPAddress}
+	} else {
+		tTemplate.DNSNames = []string{host}
+	}
+	if tTemplate.NotAfter.After(s.Authority.Intermediate.NotAfter) {
+		tTemplate.NotAfter = s.Authority.Intermediate.NotAfter
+	}
+	if tCertificatePtr, errorInfo = s.Authority.issue(&tTemplate, tKey.Public(), PROFILE_SERVER); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writePrivateKey(tKeyFQN, tKey, ctv.VAL_EMPTY); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writeCertificatesFile(tCertificateFQN, []*x509.Certificate{tCertificatePtr}); errorInfo.Error != nil {
+		return
+	}
+
+	return tls.Certificate{Certificate: s.Authority.chain(tCertificatePtr), PrivateKey: tKey, Leaf: tCertificatePtr}, errorInfo
+}
+
+// handler - the ACME resources. Every POST is a JWS signed with the account key, or for new-account and revoke-cert possibly a
+// JWK, and a GET is only for the directory and a nonce.
+func (s *acmeServer) handler() http.Handler {
+
+	tMux := http.NewServeMux()
+	tMux.HandleFunc("GET /directory", s.directory)
+	tMux.HandleFunc("GET /new-nonce", s.newNonce)
+	tMux.HandleFunc("POST /new-account", s.post(true, false, s.newAccount))
+	tMux.HandleFunc("POST /account/{id}", s.post(false, true, s.account))
+	tMux.HandleFunc("POST /account/{id}/orders", s.post(false, true, s.accountOrders))
+	tMux.HandleFunc("POST /new-order", s.post(false, true, s.newOrder))
+	tMux.HandleFunc("POST /order/{id}", s.post(false, true, s.order))
+	tMux.HandleFunc("POST /order/{id}/finalize", s.post(false, true, s.finalize))
+	tMux.HandleFunc("POST /authz/{id}", s.post(false, true, s.authorization))
+	tMux.HandleFunc("POST /challenge/{id}/{type}", s.post(false, true, s.challenge))
+	tMux.HandleFunc("POST /certificate/{serial}", s.post(false, true, s.certificate))
+	tMux.HandleFunc("POST /revoke-cert", s.post(true, true, s.revokeCertificate))
+
+	return tMux
+}
+
+// directory - the URLs of the resources (RFC 8555 section 7.1.1).
+func (s *acmeServer) directory(w http.ResponseWriter, r *http.Request) {
+
+	tBaseURL := "https://" + r.Host
+	writeACMEJSON(w, http.StatusOK, map[string]any{
+		"newNonce":   tBaseURL + "/new-nonce",
+		"newAccount": tBaseURL + "/new-account",
+		"newOrder":   tBaseURL + "/new-order",
+		"revokeCert": tBaseURL + "/revoke-cert",
+		"meta":       map[string]any{"externalAccountRequired": false},
+	})
+}
+
+// newNonce - a fresh nonce in the Replay-Nonce header (RFC 8555 section 7.2). HEAD gets 200 and GET 204.
+func (s *acmeServer) newNonce(w http.ResponseWriter, r *http.Request) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.setHeaders(w, r)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// post - checks the JWS of a POST before the handler sees it (RFC 8555 section 6.2): the content type, that the nonce was
+// handed out and not used, that the url is the one requested, and the signature. allowJWK and allowKID say whether the key
+// may be in the request, or must be an account's. The mutex is held until the handler returns.
+func (s *acmeServer) post(allowJWK bool, allowKID bool, handler acmeHandler) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var (
+			tBody      []byte
+			tErr       error
+			tHeader    acmeProtectedHeader
+			tJWS       acmeJWS
+			tProtected []byte
+			tRequest   = acmeRequest{BaseURL: "https://" + r.Host}
+			tSignature []byte
+		)
+
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		s.setHeaders(w, r)
+		if tMediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); tMediaType != CONTENT_TYPE_JOSE {
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_MALFORMED, Status: http.StatusUnsupportedMediaType, Detail: "The Content-Type must be " + CONTENT_TYPE_JOSE + "."})
+			return
+		}
+		if tBody, tErr = io.ReadAll(http.MaxBytesReader(w, r.Body, ACME_MAX_REQUEST_BYTES)); tErr != nil {
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: fmt.Sprintf("Reading the request: %s", tErr)})
+			return
+		}
+		if tErr = json.Unmarshal(tBody, &tJWS); tErr == nil {
+			if tProtected, tErr = base64.RawURLEncoding.DecodeString(tJWS.Protected); tErr == nil {
+				if tErr = json.Unmarshal(tProtected, &tHeader); tErr == nil {
+					if tRequest.Payload, tErr = base64.RawURLEncoding.DecodeString(tJWS.Payload); tErr == nil {
+						tSignature, tErr = base64.RawURLEncoding.DecodeString(tJWS.Signature)
+					}
+				}
+			}
+		}
+		if tErr != nil {
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: fmt.Sprintf("The request is not a flattened JWS: %s", tErr)})
+			return
+		}
+
+		if tExpires, ok := s.nonces[tHeader.Nonce]; ok == false || time.Now().After(tExpires) {
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_BAD_NONCE, Detail: "The nonce was not handed out by this server, has been used or has expired."})
+			return
+		}
+		delete(s.nonces, tHeader.Nonce)
+		if tHeader.URL != tRequest.BaseURL+r.URL.Path {
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_UNAUTHORIZED, Detail: fmt.Sprintf("The url in the protected header is not %s.", tRequest.BaseURL+r.URL.Path)})
+			return
+		}
+		if _, ok := jwsHashes[tHeader.Algorithm]; ok == false && tHeader.Algorithm != JWS_ALGORITHM_EDDSA {
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_BAD_SIGNATURE_ALGORITHM, Detail: ErrJWSAlgorithmInvalid.Error()})
+			return
+		}
+
+		switch {
+		case len(tHeader.JWK) > 0 && tHeader.KeyID != ctv.VAL_EMPTY:
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: "The protected header cannot have both a jwk and a kid."})
+			return
+		case len(tHeader.JWK) > 0 && allowJWK:
+			tRequest.JWK = tHeader.JWK
+		case tHeader.KeyID != ctv.VAL_EMPTY && allowKID:
+			// Only this server's account URLs name an account. A bare ID or another prefix does not.
+			if tAccountID, ok := strings.CutPrefix(tHeader.KeyID, tRequest.BaseURL+"/account/"); ok {
+				tRequest.AccountPtr = s.state.Accounts[tAccountID]
+			}
+			if tRequest.AccountPtr == nil {
+				writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_ACCOUNT_DOES_NOT_EXIST, Detail: fmt.Sprintf("There is no account %s.", tHeader.KeyID)})
+				return
+			}
+			if tRequest.AccountPtr.Status != ACME_STATUS_VALID {
+				writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_UNAUTHORIZED, Detail: fmt.Sprintf("The account is %s.", tRequest.AccountPtr.Status)})
+				return
+			}
+			tRequest.JWK = tRequest.AccountPtr.JWK
+		case allowJWK:
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: "The protected header must have a jwk."})
+			return
+		default:
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: "The protected header must have the account URL as its kid."})
+			return
+		}
+
+		if tRequest.PublicKey, tErr = parseJWK(tRequest.JWK); tErr != nil {
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: tErr.Error()})
+			return
+		}
+		if tErr = verifyJWS(tRequest.PublicKey, tHeader.Algorithm, tJWS.Protected+"."+tJWS.Payload, tSignature); errors.Is(tErr, ErrJWSAlgorithmInvalid) {
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_BAD_SIGNATURE_ALGORITHM, Detail: tErr.Error()})
+			return
+		} else if tErr != nil {
+			writeACMEProblem(w, &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: tErr.Error()})
+			return
+		}
+
+		if tProblemPtr := handler(w, r, tRequest); tProblemPtr != nil {
+			writeACMEProblem(w, tProblemPtr)
+		}
+	}
+}
+
+// newAccount - creates an account for the key, or finds the one it already has (RFC 8555 section 7.3).
+func (s *acmeServer) newAccount(w http.ResponseWriter, _ *http.Request, request acmeRequest) (problemPtr *acmeProblem) {
+
+	var (
+		tAccountPtr *acmeAccount
+		tErr        error
+		tErrorInfo  errs.ErrorInfo
+		tPayload    struct {
+			Contact            []string `json:"contact"`
+			OnlyReturnExisting bool     `json:"onlyReturnExisting"`
+		}
+		tThumbprint string
+	)
+
+	if problemPtr = unmarshalACMEPayload(request.Payload, &tPayload); problemPtr != nil {
+		return
+	}
+	if tThumbprint, tErr = jwkThumbprint(request.PublicKey); tErr != nil {
+		return &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: tErr.Error()}
+	}
+	for _, tExistingPtr := range s.state.Accounts {
+		if tExistingPtr.Thumbprint == tThumbprint {
+			if tExistingPtr.Status != ACME_STATUS_VALID {
+				return &acmeProblem{Type: ACME_ERROR_UNAUTHORIZED, Detail: fmt.Sprintf("The account for the key is %s.", tExistingPtr.Status)}
+			}
+			w.Header().Set("Location", request.BaseURL+"/account/"+tExistingPtr.ID)
+			writeACMEJSON(w, http.StatusOK, tExistingPtr.accountJSON(request.BaseURL))
+			return
+		}
+	}
+	if tPayload.OnlyReturnExisting {
+		return &acmeProblem{Type: ACME_ERROR_ACCOUNT_DOES_NOT_EXIST, Detail: "There is no account for the key."}
+	}
+	if problemPtr = checkACMEContacts(tPayload.Contact); problemPtr != nil {
+		return
+	}
+
+	tAccountPtr = &acmeAccount{Contact: tPayload.Contact, Created: time.Now().UTC(), JWK: request.JWK, Status: ACME_STATUS_VALID, Thumbprint: tThumbprint}
+	if tAccountPtr.ID, tErrorInfo = newACMEID(ACME_ID_BYTES); tErrorInfo.Error != nil {
+		return s.internalProblem(tErrorInfo)
+	}
+	s.state.Accounts[tAccountPtr.ID] = tAccountPtr
+	if problemPtr = s.save(); problemPtr != nil {
+		return
+	}
+
+	w.Header().Set("Location", request.BaseURL+"/account/"+tAccountPtr.ID)
+	writeACMEJSON(w, http.StatusCreated, tAccountPtr.accountJSON(request.BaseURL))
+
+	return
+}
+
+// account - the account, with its contacts changed or deactivated when the payload asks (RFC 8555 section 7.3.2 and 7.3.6).
+func (s *acmeServer) account(w http.ResponseWriter, r *http.Request, request acmeRequest) (problemPtr *acmeProblem) {
+
+	var (
+		tPayload struct {
+			Contact *[]string `json:"contact"`
+			Status  string    `json:"status"`
+		}
+	)
+
+	if r.PathValue("id") != request.AccountPtr.ID {
+		return &acmeProblem{Type: ACME_ERROR_UNAUTHORIZED, Detail: "The request is not signed by the account's key."}
+	}
+	if len(request.Payload) > 0 {
+		if problemPtr = unmarshalACMEPayload(request.Payload, &tPayload); problemPtr != nil {
+			return
+		}
+		if tPayload.Contact != nil {
+			if problemPtr = checkACMEContacts(*tPayload.Contact); problemPtr != nil {
+				return
+			}
+			request.AccountPtr.Contact = *tPayload.Contact
+		}
+		switch tPayload.Status {
+		case ctv.VAL_EMPTY:
+		case ACME_STATUS_DEACTIVATED:
+			request.AccountPtr.Status = ACME_STATUS_DEACTIVATED
+		default:
+			return &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: "An account can only be changed to " + ACME_STATUS_DEACTIVATED + "."}
+		}
+		if problemPtr = s.save(); problemPtr != nil {
+			return
+		}
+	}
+
+	w.Header().Set("Location", request.BaseURL+"/account/"+request.AccountPtr.ID)
+	writeACMEJSON(w, http.StatusOK, request.AccountPtr.accountJSON(request.BaseURL))
+
+	return
+}
+
+// accountOrders - the URLs of the account's orders, oldest first (RFC 8555 section 7.1.2.1).
+func (s *acmeServer) accountOrders(w http.ResponseWriter, r *http.Request, request acmeRequest) (problemPtr *acmeProblem) {
+
+	var (
+		tOrders []*acmeOrder
+		tURLs   = []string{}
+	)
+
+	if r.PathValue("id") != request.AccountPtr.ID {
+		return &acmeProblem{Type: ACME_ERROR_UNAUTHORIZED, Detail: "The request is not signed by the account's key."}
+	}
+	for _, tOrderPtr := range s.state.Orders {
+		if tOrderPtr.AccountID == request.AccountPtr.ID {
+			tOrders = append(tOrders, tOrderPtr)
+		}
+	}
+	sort.Slice(tOrders, func(i, j int) bool { return tOrders[i].Created.Before(tOrders[j].Created) })
+	for _, tOrderPtr := range tOrders {
+		tURLs = append(tURLs, request.BaseURL+"/order/"+tOrderPtr.ID)
+	}
+	writeACMEJSON(w, http.StatusOK, map[string][]string{"orders": tURLs})
+
+	return
+}
+
+// newOrder - an order for the identifiers, with an authorization for each (RFC 8555 section 7.4). DNS names, including
+// wildcards, and IP addresses are accepted when the intermediate's name constraints allow them. A wildcard can only be
+// validated with dns-01 and an IP address only with http-01. The account's valid authorizations are reused.
+func (s *acmeServer) newOrder(w http.ResponseWriter, _ *http.Request, request acmeRequest) (problemPtr *acmeProblem) {
+
+	var (
+		tErrorInfo errs.ErrorInfo
+		tNow       = time.Now().UTC()
+		tOrderPtr  *acmeOrder
+		tPayload   struct {
+			Identifiers []acmeIdentifier `json:"identifiers"`
+			NotAfter    string           `json:"notAfter"`
+			NotBefore   string           `json:"notBefore"`
+		}
+	)
+
+	if problemPtr = unmarshalACMEPayload(request.Payload, &tPayload); problemPtr != nil {
+		return
+	}
+	switch {
+	case len(tPayload.Identifiers) == 0 || len(tPayload.Identifiers) > ACME_MAX_IDENTIFIERS:
+		return &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: fmt.Sprintf("An order must have 1 to %d identifiers.", ACME_MAX_IDENTIFIERS)}
+	case tPayload.NotBefore != ctv.VAL_EMPTY || tPayload.NotAfter != ctv.VAL_EMPTY:
+		return &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: fmt.Sprintf("notBefore and notAfter are not supported. Certificates are valid for %d days.", s.ValidDays)}
+	}
+
+	tOrderPtr = &acmeOrder{AccountID: request.AccountPtr.ID, Created: tNow, Expires: tNow.Add(ACME_ORDER_LIFETIME), Status: ACME_STATUS_PENDING}
+	for _, tIdentifier := range tPayload.Identifiers {
+		if tIdentifier, problemPtr = s.checkIdentifier(tIdentifier); problemPtr != nil {
+			return
+		}
+		if slices.Contains(tOrderPtr.Identifiers, tIdentifier) {
+			continue
+		}
+		tOrderPtr.Identifiers = append(tOrderPtr.Identifiers, tIdentifier)
+	}
+	for _, tIdentifier := range tOrderPtr.Identifiers {
+		var tAuthorizationPtr *acmeAuthorization
+		if tAuthorizationPtr, problemPtr = s.authorizationFor(request.AccountPtr.ID, tIdentifier, tOrderPtr.Expires); problemPtr != nil {
+			return
+		}
+		tOrderPtr.Authorizations = append(tOrderPtr.Authorizations, tAuthorizationPtr.ID)
+	}
+	if tOrderPtr.ID, tErrorInfo = newACMEID(ACME_ID_BYTES); tErrorInfo.Error != nil {
+		return s.internalProblem(tErrorInfo)
+	}
+	s.state.Orders[tOrderPtr.ID] = tOrderPtr
+	tOrderPtr.refresh(s.state, tNow)
+	if problemPtr = s.save(); problemPtr != nil {
+		return
+	}
+
+	w.Header().Set("Location", request.BaseURL+"/order/"+tOrderPtr.ID)
+	writeACMEJSON(w, http.StatusCreated, tOrderPtr.orderJSON(request.BaseURL))
+
+	return
+}
+
+// checkIdentifier - the identifier in the form it is kept and issued with, a DNS name in lower case and an IP address as Go
+// prints it, or the problem with it.
+func (s *acmeServer) checkIdentifier(identifier acmeIdentifier) (checked acmeIdentifier, problemPtr *acmeProblem) {
+
+	checked = acmeIdentifier{Type: identifier.Type, Value: strings.ToLower(strings.TrimSpace(identifier.Value))}
+	switch identifier.Type {
+	case ACME_IDENTIFIER_DNS:
+		tName := strings.TrimPrefix(checked.Value, "*.")
+		if strings.HasPrefix(tName, ".") || domainRegex.MatchString(tName) == false || net.ParseIP(tName) != nil {
+			return checked, &acmeProblem{Type: ACME_ERROR_REJECTED_IDENTIFIER, Detail: fmt.Sprintf("%s is not a valid DNS name.", identifier.Value)}
+		}
+		if permitsDNSName(s.Authority.Intermediate, checked.Value) == false {
+			return checked, &acmeProblem{Type: ACME_ERROR_REJECTED_IDENTIFIER, Detail: fmt.Sprintf("The CA's name constraints do not allow %s.", checked.Value)}
+		}
+	case ACME_IDENTIFIER_IP:
+		tIPAddress := net.ParseIP(checked.Value)
+		if tIPAddress == nil {
+			return checked, &acmeProblem{Type: ACME_ERROR_REJECTED_IDENTIFIER, Detail: fmt.Sprintf("%s is not a valid IP address.", identifier.Value)}
+		}
+		checked.Value = tIPAddress.String()
+		if permitsIPAddress(s.Authority.Intermediate, tIPAddress) == false {
+			return checked, &acmeProblem{Type: ACME_ERROR_REJECTED_IDENTIFIER, Detail: fmt.Sprintf("The CA's name constraints do not allow %s.", checked.Value)}
+		}
+	default:
+		return checked, &acmeProblem{Type: ACME_ERROR_UNSUPPORTED_IDENTIFIER, Detail: fmt.Sprintf("The identifier type %s is not supported. It must be %s or %s.", identifier.Type, ACME_IDENTIFIER_DNS, ACME_IDENTIFIER_IP)}
+	}
+
+	return
+}
+
+// authorizationFor - the account's valid authorization for the identifier, or a new pending one that expires with the order.
+func (s *acmeServer) authorizationFor(accountID string, identifier acmeIdentifier, expires time.Time) (authorizationPtr *acmeAuthorization, problemPtr *acmeProblem) {
+
+	var (
+		tChallengeTypes []string
+		tErrorInfo      errs.ErrorInfo
+		tNow            = time.Now()
+	)
+
+	authorizationPtr = &acmeAuthorization{AccountID: accountID, Expires: expires, Identifier: identifier, Status: ACME_STATUS_PENDING}
+	if strings.HasPrefix(identifier.Value, "*.") {
+		authorizationPtr.Identifier.Value = strings.TrimPrefix(identifier.Value, "*.")
+		authorizationPtr.Wildcard = true
+	}
+	for _, tExistingPtr := range s.state.Authorizations {
+		if tExistingPtr.AccountID == accountID && tExistingPtr.Identifier == authorizationPtr.Identifier && tExistingPtr.Wildcard == authorizationPtr.Wildcard &&
+			tExistingPtr.Status == ACME_STATUS_VALID && tExistingPtr.Expires.After(tNow) {
+			return tExistingPtr, nil
+		}
+	}
+
+	switch {
+	case authorizationPtr.Wildcard:
+		tChallengeTypes = []string{ACME_CHALLENGE_DNS01}
+	case identifier.Type == ACME_IDENTIFIER_IP:
+		tChallengeTypes = []string{ACME_CHALLENGE_HTTP01}
+	default:
+		tChallengeTypes = []string{ACME_CHALLENGE_HTTP01, ACME_CHALLENGE_DNS01}
+	}
+	for _, tChallengeType := range tChallengeTypes {
+		tChallengePtr := &acmeChallenge{Status: ACME_STATUS_PENDING, Type: tChallengeType}
+		if tChallengePtr.Token, tErrorInfo = newACMEID(ACME_TOKEN_BYTES); tErrorInfo.Error != nil {
+			return nil, s.internalProblem(tErrorInfo)
+		}
+		authorizationPtr.Challenges = append(authorizationPtr.Challenges, tChallengePtr)
+	}
+	if authorizationPtr.ID, tErrorInfo = newACMEID(ACME_ID_BYTES); tErrorInfo.Error != nil {
+		return nil, s.internalProblem(tErrorInfo)
+	}
+	s.state.Authorizations[authorizationPtr.ID] = authorizationPtr
+
+	return
+}
+
+// order - the account's order, moved on from its authorizations (RFC 8555 section 7.1.3).
+func (s *acmeServer) order(w http.ResponseWriter, r *http.Request, request acmeRequest) (problemPtr *acmeProblem) {
+
+	tOrderPtr, problemPtr := s.accountOrder(r.PathValue("id"), request.AccountPtr)
+	if problemPtr != nil {
+		return
+	}
+	tStatus := tOrderPtr.Status
+	if tOrderPtr.refresh(s.state, time.Now()); tOrderPtr.Status != tStatus {
+		if problemPtr = s.save(); problemPtr != nil {
+			return
+		}
+	}
+
+	writeACMEJSON(w, http.StatusOK, tOrderPtr.orderJSON(request.BaseURL))
+
+	return
+}
+
+// finalize - issues the certificate for a ready order from its CSR (RFC 8555 section 7.4). The CSR must name exactly the
+// order's identifiers, in its subject alternative names and optionally its common name, and its key cannot be the account's.
+func (s *acmeServer) finalize(w http.ResponseWriter, r *http.Request, request acmeRequest) (problemPtr *acmeProblem) {
+
+	var (
+		tCertificatePtr *x509.Certificate
+		tCSRDER         []byte
+		tCSRPtr         *x509.CertificateRequest
+		tErr            error
+		tErrorInfo      errs.ErrorInfo
+		tNow            = time.Now()
+		tPayload        struct {
+			CSR string `json:"csr"`
+		}
+	)
+
+	tOrderPtr, problemPtr := s.accountOrder(r.PathValue("id"), request.AccountPtr)
+	if problemPtr != nil {
+		return
+	}
+	tStatus := tOrderPtr.Status
+	if tOrderPtr.refresh(s.state, tNow); tOrderPtr.Status != tStatus {
+		if problemPtr = s.save(); problemPtr != nil {
+			return
+		}
+	}
+	if tOrderPtr.Status != ACME_STATUS_READY {
+		return &acmeProblem{Type: ACME_ERROR_ORDER_NOT_READY, Detail: fmt.Sprintf("The order is %s, not %s.", tOrderPtr.Status, ACME_STATUS_READY)}
+	}
+	if problemPtr = unmarshalACMEPayload(request.Payload, &tPayload); problemPtr != nil {
+		return
+	}
+	if tCSRDER, tErr = base64.RawURLEncoding.DecodeString(tPayload.CSR); tErr == nil {
+		if tCSRPtr, tErr = x509.ParseCertificateRequest(tCSRDER); tErr == nil {
+			tErr = tCSRPtr.CheckSignature()
+		}
+	}
+	if tErr != nil {
+		return &acmeProblem{Type: ACME_ERROR_BAD_CSR, Detail: fmt.Sprintf("The csr is not a valid, signed certificate signing request: %s", tErr)}
+	}
+	if problemPtr = checkACMECSR(tCSRPtr, tOrderPtr.Identifiers, request.PublicKey); problemPtr != nil {
+		return
+	}
+
+	tTemplate := x509.Certificate{
+		DNSNames:    tCSRPtr.DNSNames,
+		IPAddresses: tCSRPtr.IPAddresses,
+		NotBefore:   tNow.Add(-BACKDATE),
+		NotAfter:    tNow.AddDate(0, 0, s.ValidDays),
+		KeyUsage:    certs.KeyUsageForKey(tCSRPtr.PublicKey),
+		ExtKeyUsage: profiles[PROFILE_SERVER],
+	}
+	if tCSRPtr.Subject.CommonName != ctv.VAL_EMPTY {
+		tTemplate.Subject = pkix.Name{CommonName: tCSRPtr.Subject.CommonName}
+	}
+	if tCertificatePtr, tErrorInfo = s.Authority.issue(&tTemplate, tCSRPtr.PublicKey, PROFILE_SERVER); tErrorInfo.Error != nil {
+		tOrderPtr.Status = ACME_STATUS_INVALID
+		tOrderPtr.Error = s.internalProblem(tErrorInfo)
+		if problemPtr = s.save(); problemPtr != nil {
+			return
+		}
+		return tOrderPtr.Error
+	}
+	tOrderPtr.Certificate = serialHex(tCertificatePtr.SerialNumber)
+	tOrderPtr.Status = ACME_STATUS_VALID
+	if problemPtr = s.save(); problemPtr != nil {
+		return
+	}
+
+	w.Header().Set("Location", request.BaseURL+"/order/"+tOrderPtr.ID)
+	writeACMEJSON(w, http.StatusOK, tOrderPtr.orderJSON(request.BaseURL))
+
+	return
+}
+
+// authorization - the account's authorization, deactivated when the payload asks (RFC 8555 section 7.5 and 7.5.2).
+func (s *acmeServer) authorization(w http.ResponseWriter, r *http.Request, request acmeRequest) (problemPtr *acmeProblem) {
+
+	var (
+		tPayload struct {
+			Status string `json:"status"`
+		}
+	)
+
+	tAuthorizationPtr, problemPtr := s.accountAuthorization(r.PathValue("id"), request.AccountPtr)
+	if problemPtr != nil {
+		return
+	}
+	tAuthorizationPtr.refresh(time.Now())
+	if len(request.Payload) > 0 {
+		if problemPtr = unmarshalACMEPayload(request.Payload, &tPayload); problemPtr != nil {
+			return
+		}
+		if tPayload.Status != ACME_STATUS_DEACTIVATED || (tAuthorizationPtr.Status != ACME_STATUS_PENDING && tAuthorizationPtr.Status != ACME_STATUS_VALID) {
+			return &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: "Only a pending or valid authorization can be changed, and only to " + ACME_STATUS_DEACTIVATED + "."}
+		}
+		tAuthorizationPtr.Status = ACME_STATUS_DEACTIVATED
+		tAuthorizationPtr.settle(nil)
+		if problemPtr = s.save(); problemPtr != nil {
+			return
+		}
+	}
+
+	writeACMEJSON(w, http.StatusOK, tAuthorizationPtr.authorizationJSON(request.BaseURL))
+
+	return
+}
+
+// challenge - the challenge, and when the payload is an empty object, the client's signal that it is ready (RFC 8555 section
+// 7.5.1). The challenge is then processing while it is validated in the background, and the client polls the authorization.
+func (s *acmeServer) challenge(w http.ResponseWriter, r *http.Request, request acmeRequest) (problemPtr *acmeProblem) {
+
+	tAuthorizationPtr, problemPtr := s.accountAuthorization(r.PathValue("id"), request.AccountPtr)
+	if problemPtr != nil {
+		return
+	}
+	tChallengePtr := tAuthorizationPtr.challenge(r.PathValue("type"))
+	if tChallengePtr == nil {
+		return &acmeProblem{Type: ACME_ERROR_MALFORMED, Status: http.StatusNotFound, Detail: fmt.Sprintf("The authorization has no %s challenge.", r.PathValue("type"))}
+	}
+
+	tAuthorizationPtr.refresh(time.Now())
+	if len(request.Payload) > 0 && tAuthorizationPtr.Status == ACME_STATUS_PENDING && tChallengePtr.Status == ACME_STATUS_PENDING {
+		tChallengePtr.Status = ACME_STATUS_PROCESSING
+		if problemPtr = s.save(); problemPtr != nil {
+			return
+		}
+		go s.validateChallenge(tAuthorizationPtr, tChallengePtr, tAuthorizationPtr.Identifier, acmeKeyAuthorization(tChallengePtr.Token, request.AccountPtr.Thumbprint))
+	}
+
+	w.Header().Add("Link", fmt.Sprintf("<%s/authz/%s>;rel=\"up\"", request.BaseURL, tAuthorizationPtr.ID))
+	writeACMEJSON(w, http.StatusOK, tAuthorizationPtr.challengeJSON(request.BaseURL, tChallengePtr))
+
+	return
+}
+
+// validateChallenge - validates the challenge and records the result on it and its authorization. It runs without the mutex
+// until the result is in, so a slow validation does not hold up other requests. The result is only recorded while the
+// authorization is still pending and the challenge still processing, and the authorization's other processing challenges
+// are then invalid.
+func (s *acmeServer) validateChallenge(authorizationPtr *acmeAuthorization, challengePtr *acmeChallenge, identifier acmeIdentifier, keyAuthorization string) {
+
+	tProblemPtr := s.Validator.validate(challengePtr.Type, identifier, challengePtr.Token, keyAuthorization)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// The authorization may have been deactivated or have expired while the validation ran. It keeps that status.
+	authorizationPtr.refresh(time.Now())
+	if authorizationPtr.Status != ACME_STATUS_PENDING || challengePtr.Status != ACME_STATUS_PROCESSING {
+		return
+	}
+	if tProblemPtr != nil {
+		challengePtr.Status, challengePtr.Error = ACME_STATUS_INVALID, tProblemPtr
+		authorizationPtr.Status = ACME_STATUS_INVALID
+	} else {
+		challengePtr.Status, challengePtr.Validated = ACME_STATUS_VALID, time.Now().UTC()
+		authorizationPtr.Status = ACME_STATUS_VALID
+	}
+	authorizationPtr.settle(challengePtr)
+	// There is no request to answer, so a failure is only printed. The result stays in memory and goes out with the next save.
+	if tErrorInfo := s.state.write(s.Authority.Directory); tErrorInfo.Error != nil {
+		errs.PrintErrorInfo(tErrorInfo)
+	}
+}
+
+// certificate - the issued certificate followed by the intermediate, for the account that ordered it (RFC 8555 section 7.4.2).
+func (s *acmeServer) certificate(w http.ResponseWriter, r *http.Request, request acmeRequest) (problemPtr *acmeProblem) {
+
+	var (
+		tCertificates []*x509.Certificate
+		tChain        []byte
+		tErrorInfo    errs.ErrorInfo
+	)
+
+	tSerial := r.PathValue("serial")
+	tFound := false
+	for _, tOrderPtr := range s.state.Orders {
+		if tOrderPtr.Certificate == tSerial && tOrderPtr.AccountID == request.AccountPtr.ID {
+			tFound = true
+			break
+		}
+	}
+	if tFound == false {
+		return &acmeProblem{Type: ACME_ERROR_MALFORMED, Status: http.StatusNotFound, Detail: fmt.Sprintf("The account has no certificate %s.", tSerial)}
+	}
+	if tCertificates, tErrorInfo = readCertificates(filepath.Join(s.Authority.Directory, DIRECTORY_CERTIFICATES, tSerial+EXTENSION_CERTIFICATE)); tErrorInfo.Error != nil {
+		return s.internalProblem(tErrorInfo)
+	}
+	for _, tDER := range s.Authority.chain(tCertificates[0]) {
+		tChain = append(tChain, pem.EncodeToMemory(&pem.Block{Type: PEM_CERTIFICATE, Bytes: tDER})...)
+	}
+
+	w.Header().Set("Content-Type", CONTENT_TYPE_PEM_CHAIN)
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(tChain)
+
+	return
+}
+
+// revokeCertificate - revokes a certificate issued by the intermediate (RFC 8555 section 7.6), when the request is signed by
+// the account that ordered it or by the certificate's own key.
+func (s *acmeServer) revokeCertificate(w http.ResponseWriter, _ *http.Request, request acmeRequest) (problemPtr *acmeProblem) {
+
+	var (
+		tCertificateDER []byte
+		tCertificatePtr *x509.Certificate
+		tDatabasePtr    *database
+		tErr            error
+		tErrorInfo      errs.ErrorInfo
+		tPayload        struct {
+			Certificate string `json:"certificate"`
+			Reason      int    `json:"reason"`
+		}
+		tUnlock func()
+	)
+
+	if problemPtr = unmarshalACMEPayload(request.Payload, &tPayload); problemPtr != nil {
+		return
+	}
+	if tCertificateDER, tErr = base64.RawURLEncoding.DecodeString(tPayload.Certificate); tErr == nil {
+		if tCertificatePtr, tErr = x509.ParseCertificate(tCertificateDER); tErr == nil {
+			tErr = tCertificatePtr.CheckSignatureFrom(s.Authority.Intermediate)
+		}
+	}
+	if tErr != nil {
+		return &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: fmt.Sprintf("The certificate was not issued by this CA: %s", tErr)}
+	}
+	if _, ok := revocationReasons[tPayload.Reason]; ok == false {
+		return &acmeProblem{Type: ACME_ERROR_BAD_REVOCATION_REASON, Detail: fmt.Sprintf("%d is not an RFC 5280 reason code a certificate can be revoked with.", tPayload.Reason)}
+	}
+
+	tSerial := serialHex(tCertificatePtr.SerialNumber)
+	tAllowed := false
+	if request.AccountPtr == nil {
+		tAllowed = certs.SamePublicKey(tCertificatePtr.PublicKey, request.PublicKey)
+	} else {
+		for _, tOrderPtr := range s.state.Orders {
+			if tOrderPtr.Certificate == tSerial && tOrderPtr.AccountID == request.AccountPtr.ID {
+				tAllowed = true
+				break
+			}
+		}
+	}
+	if tAllowed == false {
+		return &acmeProblem{Type: ACME_ERROR_UNAUTHORIZED, Detail: "Only the account that ordered the certificate, or its key, can revoke it."}
+	}
+
+	if tUnlock, tErrorInfo = lockDatabase(s.Authority.Directory); tErrorInfo.Error != nil {
+		return s.internalProblem(tErrorInfo)
+	}
+	defer tUnlock()
+	if tDatabasePtr, tErrorInfo = readDatabase(s.Authority.Directory); tErrorInfo.Error != nil {
+		return s.internalProblem(tErrorInfo)
+	}
+	if tErrorInfo = tDatabasePtr.revoke(tCertificatePtr.SerialNumber, tPayload.Reason, time.Now()); errors.Is(tErrorInfo.Error, ErrAlreadyRevoked) {
+		return &acmeProblem{Type: ACME_ERROR_ALREADY_REVOKED, Detail: fmt.Sprintf("The certificate %s is already revoked.", tSerial)}
+	} else if tErrorInfo.Error != nil {
+		return s.internalProblem(tErrorInfo)
+	}
+	if tErrorInfo = tDatabasePtr.write(); tErrorInfo.Error != nil {
+		return s.internalProblem(tErrorInfo)
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	return
+}
+
+// accountOrder - the order, when it belongs to the account.
+func (s *acmeServer) accountOrder(id string, accountPtr *acmeAccount) (orderPtr *acmeOrder, problemPtr *acmeProblem) {
+
+	if orderPtr = s.state.Orders[id]; orderPtr == nil || orderPtr.AccountID != accountPtr.ID {
+		return nil, &acmeProblem{Type: ACME_ERROR_MALFORMED, Status: http.StatusNotFound, Detail: fmt.Sprintf("The account has no order %s.", id)}
+	}
+
+	return
+}
+
+// accountAuthorization - the authorization, when it belongs to the account.
+func (s *acmeServer) accountAuthorization(id string, accountPtr *acmeAccount) (authorizationPtr *acmeAuthorization, problemPtr *acmeProblem) {
+
+	if authorizationPtr = s.state.Authorizations[id]; authorizationPtr == nil || authorizationPtr.AccountID != accountPtr.ID {
+		return nil, &acmeProblem{Type: ACME_ERROR_MALFORMED, Status: http.StatusNotFound, Detail: fmt.Sprintf("The account has no authorization %s.", id)}
+	}
+
+	return
+}
+
+// setHeaders - the headers of every response: a new nonce, the directory as the index, and no caching.
+func (s *acmeServer) setHeaders(w http.ResponseWriter, r *http.Request) {
+
+	var (
+		tErrorInfo errs.ErrorInfo
+		tNonce     string
+		tNow       = time.Now()
+	)
+
+	if len(s.nonces) >= ACME_MAX_NONCES {
+		for tUnused, tExpires := range s.nonces {
+			if tNow.After(tExpires) || len(s.nonces) >= ACME_MAX_NONCES {
+				delete(s.nonces, tUnused)
+			}
+		}
+	}
+	if tNonce, tErrorInfo = newACMEID(ACME_ID_BYTES); tErrorInfo.Error != nil {
+		errs.PrintErrorInfo(tErrorInfo)
+	} else {
+		s.nonces[tNonce] = tNow.Add(ACME_NONCE_LIFETIME)
+		w.Header().Set("Replay-Nonce", tNonce)
+	}
+	w.Header().Set("Link", fmt.Sprintf("<https://%s/directory>;rel=\"index\"", r.Host))
+	w.Header().Set("Cache-Control", "no-store")
+}
+
+// save - writes the state, or returns a serverInternal problem when it cannot.
+func (s *acmeServer) save() (problemPtr *acmeProblem) {
+
+	if tErrorInfo := s.state.write(s.Authority.Directory); tErrorInfo.Error != nil {
+		return s.internalProblem(tErrorInfo)
+	}
+
+	return
+}
+
+// internalProblem - prints the error for the operator and returns a serverInternal problem that does not reveal it.
+func (s *acmeServer) internalProblem(errorInfo errs.ErrorInfo) (problemPtr *acmeProblem) {
+
+	errs.PrintErrorInfo(errorInfo)
+
+	return &acmeProblem{Type: ACME_ERROR_SERVER_INTERNAL, Detail: "The server could not complete the request. The error is in its output."}
+}
+
+// checkACMEContacts - each contact must be a mailto URL with one email address (RFC 8555 section 7.3).
+func checkACMEContacts(contacts []string) (problemPtr *acmeProblem) {
+
+	for _, tContact := range contacts {
+		tAddress, ok := strings.CutPrefix(tContact, "mailto:")
+		if ok == false {
+			return &acmeProblem{Type: ACME_ERROR_UNSUPPORTED_CONTACT, Detail: fmt.Sprintf("%s is not a mailto URL.", tContact)}
+		}
+		if _, tErr := mail.ParseAddress(tAddress); tErr != nil || strings.ContainsAny(tAddress, ",<>?") {
+			return &acmeProblem{Type: ACME_ERROR_INVALID_CONTACT, Detail: fmt.Sprintf("%s is not a single email address.", tContact)}
+		}
+	}
+
+	return
+}
+
+// checkACMECSR - the CSR's DNS names and IP addresses must be the order's identifiers, with a common name only if it is one of
+// them, and nothing else. The key must not be the account's, and an RSA key must have at least MIN_RSA_BITS.
+func checkACMECSR(csrPtr *x509.CertificateRequest, identifiers []acmeIdentifier, accountKey crypto.PublicKey) (problemPtr *acmeProblem) {
+
+	var (
+		tNames []acmeIdentifier
+	)
+
+	for _, tName := range csrPtr.DNSNames {
+		tNames = append(tNames, acmeIdentifier{Type: ACME_IDENTIFIER_DNS, Value: strings.ToLower(tName)})
+	}
+	for _, tIPAddress := range csrPtr.IPAddresses {
+		tNames = append(tNames, acmeIdentifier{Type: ACME_IDENTIFIER_IP, Value: tIPAddress.String()})
+	}
+
+	switch {
+	case len(csrPtr.EmailAddresses) > 0 || len(csrPtr.URIs) > 0:
+		return &acmeProblem{Type: ACME_ERROR_BAD_CSR, Detail: "The CSR can only have DNS names and IP addresses."}
+	case len(tNames) != len(identifiers):
+		return &acmeProblem{Type: ACME_ERROR_BAD_CSR, Detail: "The CSR must have exactly the order's identifiers as its subject alternative names."}
+	case csrPtr.Subject.CommonName != ctv.VAL_EMPTY && slices.ContainsFunc(tNames, func(name acmeIdentifier) bool { return strings.EqualFold(name.Value, csrPtr.Subject.CommonName) }) == false:
+		return &acmeProblem{Type: ACME_ERROR_BAD_CSR, Detail: fmt.Sprintf("The CSR's common name %s is not one of its subject alternative names.", csrPtr.Subject.CommonName)}
+	case certs.SamePublicKey(csrPtr.PublicKey, accountKey):
+		return &acmeProblem{Type: ACME_ERROR_BAD_CSR, Detail: "The CSR's key cannot be the account key."}
+	}
+	for _, tIdentifier := range identifiers {
+		if slices.Contains(tNames, tIdentifier) == false {
+			return &acmeProblem{Type: ACME_ERROR_BAD_CSR, Detail: fmt.Sprintf("The CSR does not have %s.", tIdentifier.Value)}
+		}
+	}
+	if tRSAKeyPtr, ok := csrPtr.PublicKey.(*rsa.PublicKey); ok && tRSAKeyPtr.N.BitLen() < MIN_RSA_BITS {
+		return &acmeProblem{Type: ACME_ERROR_BAD_CSR, Detail: fmt.Sprintf("The CSR's RSA key has %d bits and must have at least %d.", tRSAKeyPtr.N.BitLen(), MIN_RSA_BITS)}
+	}
+
+	return
+}
+
+// unmarshalACMEPayload - decodes the JSON payload, or returns a malformed problem.
+func unmarshalACMEPayload(payload []byte, value any) (problemPtr *acmeProblem) {
+
+	if tErr := json.Unmarshal(payload, value); tErr != nil {
+		return &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: fmt.Sprintf("The payload is not valid JSON for the request: %s", tErr)}
+	}
+
+	return
+}
+
+// writeACMEJSON - writes the value as the JSON response.
+func writeACMEJSON(w http.ResponseWriter, status int, value any) {
+
+	w.Header().Set("Content-Type", CONTENT_TYPE_JSON)
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
+
+// writeACMEProblem - writes the problem document, with its HTTP status also in the document.
+func writeACMEProblem(w http.ResponseWriter, problemPtr *acmeProblem) {
+
+	if problemPtr.Status == 0 {
+		if problemPtr.Status = acmeProblemStatuses[problemPtr.Type]; problemPtr.Status == 0 {
+			problemPtr.Status = http.StatusBadRequest
+		}
+	}
+	w.Header().Set("Content-Type", CONTENT_TYPE_PROBLEM)
+	w.WriteHeader(problemPtr.Status)
+	_ = json.NewEncoder(w).Encode(problemPtr)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// acmeJWS - a request body, which is a JWS in the flattened JSON serialization (RFC 8555 section 6.2).
+type acmeJWS struct {
+	Payload   string `json:"payload"`
+	Protected string `json:"protected"`
+	Signature string `json:"signature"`
+}
+
+// acmeProtectedHeader - the protected header of a request. It has either the key, for new-account and revoke-cert, or the
+// account URL as the key ID.
+type acmeProtectedHeader struct {
+	Algorithm string          `json:"alg"`
+	JWK       json.RawMessage `json:"jwk,omitempty"`
+	KeyID     string          `json:"kid,omitempty"`
+	Nonce     string          `json:"nonce"`
+	URL       string          `json:"url"`
+}
+
+// acmeJWK - the members of a JSON Web Key (RFC 7517) that EC, RSA and Ed25519 public keys use.
+type acmeJWK struct {
+	Curve    string `json:"crv,omitempty"`
+	Exponent string `json:"e,omitempty"`
+	KeyType  string `json:"kty"`
+	Modulus  string `json:"n,omitempty"`
+	X        string `json:"x,omitempty"`
+	Y        string `json:"y,omitempty"`
+}
+
+var (
+	// jwsCurves - the curve of each ECDSA JWS algorithm.
+	jwsCurves = map[string]elliptic.Curve{
+		JWS_ALGORITHM_ES256: elliptic.P256(),
+		JWS_ALGORITHM_ES384: elliptic.P384(),
+		JWS_ALGORITHM_ES512: elliptic.P521(),
+	}
+	// jwsHashes - the hash of each JWS algorithm that signs a digest.
+	jwsHashes = map[string]crypto.Hash{
+		JWS_ALGORITHM_ES256: crypto.SHA256,
+		JWS_ALGORITHM_ES384: crypto.SHA384,
+		JWS_ALGORITHM_ES512: crypto.SHA512,
+		JWS_ALGORITHM_RS256: crypto.SHA256,
+	}
+	// jwkCurveNames - the JWK crv of each curve.
+	jwkCurveNames = map[elliptic.Curve]string{
+		elliptic.P256(): "P-256",
+		elliptic.P384(): "P-384",
+		elliptic.P521(): "P-521",
+	}
+)
+
+// parseJWK - the public key in a JWK. RSA keys must have at least MIN_RSA_BITS, and EC points must be on the curve.
+func parseJWK(data []byte) (publicKey crypto.PublicKey, err error) {
+
+	var (
+		tJWK acmeJWK
+	)
+
+	if err = json.Unmarshal(data, &tJWK); err != nil {
+		return
+	}
+
+	switch tJWK.KeyType {
+	case "EC":
+		for tCurve, tName := range jwkCurveNames {
+			if tName != tJWK.Curve {
+				continue
+			}
+			tKeyPtr := &ecdsa.PublicKey{Curve: tCurve, X: decodeBigInt(tJWK.X), Y: decodeBigInt(tJWK.Y)}
+			if tKeyPtr.X == nil || tKeyPtr.Y == nil {
+				break
+			}
+			// ECDH fails for a point that is not on the curve.
+			if _, err = tKeyPtr.ECDH(); err != nil {
+				return
+			}
+			return tKeyPtr, nil
+		}
+	case "RSA":
+		tModulus, tExponent := decodeBigInt(tJWK.Modulus), decodeBigInt(tJWK.Exponent)
+		if tModulus == nil || tExponent == nil || tModulus.BitLen() < MIN_RSA_BITS || tExponent.IsInt64() == false || tExponent.Int64() < 3 || tExponent.Int64() > 1<<31-1 {
+			break
+		}
+		return &rsa.PublicKey{N: tModulus, E: int(tExponent.Int64())}, nil
+	case "OKP":
+		if tX, tErr := base64.RawURLEncoding.DecodeString(tJWK.X); tErr == nil && tJWK.Curve == "Ed25519" && len(tX) == ed25519.PublicKeySize {
+			return ed25519.PublicKey(tX), nil
+		}
+	}
+
+	return nil, fmt.Errorf("the JWK is not a supported EC, RSA or Ed25519 public key: %s", tJWK.KeyType)
+}
+
+// jwkThumbprint - the RFC 7638 thumbprint of the key, base64url encoded. The JWK members are rebuilt from the key, so a
+// client that pads its numbers differently gets the same thumbprint.
+func jwkThumbprint(publicKey crypto.PublicKey) (thumbprint string, err error) {
+
+	var (
+		tCanonical string
+	)
+
+	switch tPublicKey := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		tSize := (tPublicKey.Curve.Params().BitSize + 7) / 8
+		tCanonical = fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`, jwkCurveNames[tPublicKey.Curve],
+			base64.RawURLEncoding.EncodeToString(tPublicKey.X.FillBytes(make([]byte, tSize))),
+			base64.RawURLEncoding.EncodeToString(tPublicKey.Y.FillBytes(make([]byte, tSize))))
+	case *rsa.PublicKey:
+		tCanonical = fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`,
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(tPublicKey.E)).Bytes()),
+			base64.RawURLEncoding.EncodeToString(tPublicKey.N.Bytes()))
+	case ed25519.PublicKey:
+		tCanonical = fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64.RawURLEncoding.EncodeToString(tPublicKey))
+	default:
+		return thumbprint, fmt.Errorf("the key is not a supported EC, RSA or Ed25519 public key: %T", publicKey)
+	}
+
+	tSum := sha256.Sum256([]byte(tCanonical))
+
+	return base64.RawURLEncoding.EncodeToString(tSum[:]), nil
+}
+
+// verifyJWS - checks the JWS signature over the signing input, which is the protected header and the payload, both base64url
+// encoded and joined with a dot. The algorithm must suit the key: RS256 for RSA, ES256, ES384 or ES512 for the matching curve,
+// and EdDSA for Ed25519.
+func verifyJWS(publicKey crypto.PublicKey, algorithm string, signingInput string, signature []byte) (err error) {
+
+	var (
+		tDigest []byte
+	)
+
+	if tHash, ok := jwsHashes[algorithm]; ok {
+		tDigestHash := tHash.New()
+		tDigestHash.Write([]byte(signingInput))
+		tDigest = tDigestHash.Sum(nil)
+	}
+
+	switch tPublicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		if algorithm == JWS_ALGORITHM_RS256 {
+			return rsa.VerifyPKCS1v15(tPublicKey, crypto.SHA256, tDigest, signature)
+		}
+	case *ecdsa.PublicKey:
+		if jwsCurves[algorithm] == tPublicKey.Curve {
+			// An ECDSA JWS signature is R and S, each the size of the curve, one after the other.
+			tSize := (tPublicKey.Curve.Params().BitSize + 7) / 8
+			if len(signature) != 2*tSize {
+				return errors.New("the JWS signature is not the size of the curve")
+			}
+			if ecdsa.Verify(tPublicKey, tDigest, new(big.Int).SetBytes(signature[:tSize]), new(big.Int).SetBytes(signature[tSize:])) == false {
+				return errors.New("the JWS signature does not verify")
+			}
+			return nil
+		}
+	case ed25519.PublicKey:
+		if algorithm == JWS_ALGORITHM_EDDSA {
+			if ed25519.Verify(tPublicKey, []byte(signingInput), signature) == false {
+				return errors.New("the JWS signature does not verify")
+			}
+			return nil
+		}
+	}
+
+	return ErrJWSAlgorithmInvalid
+}
+
+// decodeBigInt - a base64url encoded, big-endian unsigned number, or nil when it is not valid base64url or is empty.
+func decodeBigInt(value string) *big.Int {
+
+	tBytes, tErr := base64.RawURLEncoding.DecodeString(value)
+	if tErr != nil || len(tBytes) == 0 {
+		return nil
+	}
+
+	return new(big.Int).SetBytes(tBytes)
+}
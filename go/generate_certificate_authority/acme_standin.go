@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/net/dns/dnsmessage"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// standinRequest - the local stand-ins that acme standin runs in place of the HTTP servers and DNS zones of the names being
+// validated. What they answer comes from files in Directory, which an ACME client writes like it would to a web root or a
+// DNS provider.
+type standinRequest struct {
+	Address           string // The A or AAAA answer for every name, so http-01 for any name reaches HTTPListenAddress.
+	CADirectory       string
+	Directory         string // Holds http-01/<token> and dns-01/<name>. Empty is the standin directory in the CA directory.
+	DNSListenAddress  string // UDP, such as :8053.
+	HTTPListenAddress string // Such as :5002.
+}
+
+// runStandin - serves the http-01 files over HTTP and answers DNS queries over UDP until interrupted. A query for A or AAAA
+// gets the address, and one for TXT gets the lines of dns-01/<name>, such as dns-01/_acme-challenge.nats.example.com.
+//
+//	Customer Messages: None
+//	Errors: ErrStandinAddressInvalid, errors returned by os and net
+//	Verifications: None
+func runStandin(request standinRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tAddress    = net.ParseIP(request.Address)
+		tConnection net.PacketConn
+		tListener   net.Listener
+	)
+
+	if tAddress == nil {
+		errorInfo = errs.NewErrorInfo(ErrStandinAddressInvalid, fmt.Sprintf("Address: %s", request.Address))
+		return
+	}
+	if request.Directory == ctv.VAL_EMPTY {
+		request.Directory = filepath.Join(request.CADirectory, DIRECTORY_STANDIN)
+	}
+	for _, tDirectory := range []string{DIRECTORY_STANDIN_HTTP01, DIRECTORY_STANDIN_DNS01} {
+		if errorInfo.Error = os.MkdirAll(filepath.Join(request.Directory, tDirectory), DIRECTORY_PERMISSIONS); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Directory: %s", filepath.Join(request.Directory, tDirectory)))
+			return
+		}
+	}
+	if tListener, errorInfo.Error = net.Listen("tcp", request.HTTPListenAddress); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("HTTP Listen Address: %s", request.HTTPListenAddress))
+		return
+	}
+	if tConnection, errorInfo.Error = net.ListenPacket("udp", request.DNSListenAddress); errorInfo.Error != nil {
+		_ = tListener.Close()
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("DNS Listen Address: %s", request.DNSListenAddress))
+		return
+	}
+	defer tConnection.Close()
+
+	tContext, tStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer tStop()
+
+	tServerPtr := &http.Server{Handler: standinHandler(request.Directory), ReadHeaderTimeout: HTTP_READ_HEADER_TIMEOUT}
+	go func() {
+		if tErr := tServerPtr.Serve(tListener); tErr != nil && errors.Is(tErr, http.ErrServerClosed) == false {
+			errs.PrintErrorInfo(errs.NewErrorInfo(tErr, fmt.Sprintf("HTTP Listen Address: %s", request.HTTPListenAddress)))
+			tStop()
+		}
+	}()
+	go func() {
+		tBuffer := make([]byte, STANDIN_DNS_MAX_MESSAGE_BYTES)
+		for {
+			tSize, tClientAddress, tErr := tConnection.ReadFrom(tBuffer)
+			if tErr != nil {
+				// The connection is closed on shutdown.
+				return
+			}
+			if tResponse, tErr := standinDNSAnswer(tBuffer[:tSize], tAddress, request.Directory); tErr == nil {
+				_, _ = tConnection.WriteTo(tResponse, tClientAddress)
+			}
+		}
+	}()
+
+	fmt.Printf("The stand-ins are answering from %s.\n", request.Directory)
+	fmt.Printf("%sHTTP: http://%s%s<token> from %s\n", ctv.SPACES_FOUR, tListener.Addr(), ACME_HTTP01_PATH, filepath.Join(request.Directory, DIRECTORY_STANDIN_HTTP01))
+	fmt.Printf("%sDNS: %s, every name is %s, TXT from %s\n", ctv.SPACES_FOUR, tConnection.LocalAddr(), tAddress, filepath.Join(request.Directory, DIRECTORY_STANDIN_DNS01))
+
+	<-tContext.Done()
+
+	tShutdownContext, tCancel := context.WithTimeout(context.Background(), HTTP_SHUTDOWN_TIMEOUT)
+	defer tCancel()
+	_ = tServerPtr.Shutdown(tShutdownContext)
+
+	return
+}
+
+// standinHandler - serves the key authorization in http-01/<token>. The files are read for each request, so a client can
+// write one just before it accepts the challenge.
+func standinHandler(directory string) http.Handler {
+
+	tMux := http.NewServeMux()
+	tMux.HandleFunc("GET "+ACME_HTTP01_PATH+"{token}", func(w http.ResponseWriter, r *http.Request) {
+		tFileName, ok := standinFileName(r.PathValue("token"))
+		if ok == false {
+			http.NotFound(w, r)
+			return
+		}
+		tData, tErr := os.ReadFile(filepath.Join(directory, DIRECTORY_STANDIN_HTTP01, tFileName))
+		if tErr != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write(tData)
+	})
+
+	return tMux
+}
+
+// standinDNSAnswer - the response to a DNS query. Every name has the address, and TXT records come from dns-01/<name>, one
+// record a line. A name without a file has no TXT records.
+func standinDNSAnswer(query []byte, address net.IP, directory string) (response []byte, err error) {
+
+	var (
+		tHeader    dnsmessage.Header
+		tParser    dnsmessage.Parser
+		tQuestions []dnsmessage.Question
+	)
+
+	if tHeader, err = tParser.Start(query); err != nil {
+		return
+	}
+	if tQuestions, err = tParser.AllQuestions(); err != nil {
+		return
+	}
+
+	tBuilder := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: tHeader.ID, Response: true, Authoritative: true, RecursionDesired: tHeader.RecursionDesired})
+	tBuilder.EnableCompression()
+	if err = tBuilder.StartQuestions(); err != nil {
+		return
+	}
+	for _, tQuestion := range tQuestions {
+		if err = tBuilder.Question(tQuestion); err != nil {
+			return
+		}
+	}
+	if err = tBuilder.StartAnswers(); err != nil {
+		return
+	}
+
+	for _, tQuestion := range tQuestions {
+		tResourceHeader := dnsmessage.ResourceHeader{Name: tQuestion.Name, Class: dnsmessage.ClassINET}
+		switch {
+		case tQuestion.Type == dnsmessage.TypeA && address.To4() != nil:
+			err = tBuilder.AResource(tResourceHeader, dnsmessage.AResource{A: [4]byte(address.To4())})
+		case tQuestion.Type == dnsmessage.TypeAAAA && address.To4() == nil:
+			err = tBuilder.AAAAResource(tResourceHeader, dnsmessage.AAAAResource{AAAA: [16]byte(address.To16())})
+		case tQuestion.Type == dnsmessage.TypeTXT:
+			tFileName, ok := standinFileName(strings.TrimSuffix(strings.ToLower(tQuestion.Name.String()), "."))
+			if ok == false {
+				continue
+			}
+			tData, tErr := os.ReadFile(filepath.Join(directory, DIRECTORY_STANDIN_DNS01, tFileName))
+			if tErr != nil {
+				continue
+			}
+			// Each line is its own record, because a resolver joins the strings of one record together.
+			for _, tLine := range strings.Split(string(tData), "\n") {
+				if tLine = strings.TrimSpace(tLine); tLine != ctv.VAL_EMPTY && err == nil {
+					err = tBuilder.TXTResource(tResourceHeader, dnsmessage.TXTResource{TXT: []string{tLine}})
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+
+	return tBuilder.Finish()
+}
+
+// standinFileName - the name as a file name, when it is only letters, digits, dots, hyphens and underscores, and does not
+// start with a dot, so it cannot leave the stand-in directory.
+func standinFileName(name string) (fileName string, ok bool) {
+
+	if name == ctv.VAL_EMPTY || strings.HasPrefix(name, ".") {
+		return
+	}
+	for _, tCharacter := range name {
+		switch {
+		case tCharacter >= 'a' && tCharacter <= 'z', tCharacter >= 'A' && tCharacter <= 'Z', tCharacter >= '0' && tCharacter <= '9':
+		case tCharacter == '.', tCharacter == '-', tCharacter == '_':
+		default:
+			return
+		}
+	}
+
+	return name, true
+}
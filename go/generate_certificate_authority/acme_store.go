@@ -0,0 +1,297 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// acmeState - the accounts, orders and authorizations of the ACME server, kept in the acme directory of the CA directory so
+// they outlive a restart. Certificates themselves are in the database.
+type acmeState struct {
+	Accounts       map[string]*acmeAccount       `json:"accounts"`
+	Authorizations map[string]*acmeAuthorization `json:"authorizations"`
+	Orders         map[string]*acmeOrder         `json:"orders"`
+}
+
+type acmeAccount struct {
+	Contact    []string        `json:"contact,omitempty"`
+	Created    time.Time       `json:"created"`
+	ID         string          `json:"id"`
+	JWK        json.RawMessage `json:"jwk"`
+	Status     string          `json:"status"`
+	Thumbprint string          `json:"thumbprint"` // Only one account can have a key.
+}
+
+type acmeOrder struct {
+	AccountID      string           `json:"account_id"`
+	Authorizations []string         `json:"authorizations"`
+	Certificate    string           `json:"certificate,omitempty"` // The serial number in hex, once issued.
+	Created        time.Time        `json:"created"`
+	Error          *acmeProblem     `json:"error,omitempty"`
+	Expires        time.Time        `json:"expires"`
+	ID             string           `json:"id"`
+	Identifiers    []acmeIdentifier `json:"identifiers"`
+	Status         string           `json:"status"`
+}
+
+// acmeAuthorization - the proof of control of one identifier. A wildcard's identifier is the domain below the *.
+type acmeAuthorization struct {
+	AccountID  string           `json:"account_id"`
+	Challenges []*acmeChallenge `json:"challenges"`
+	Expires    time.Time        `json:"expires"`
+	ID         string           `json:"id"`
+	Identifier acmeIdentifier   `json:"identifier"`
+	Status     string           `json:"status"`
+	Wildcard   bool             `json:"wildcard,omitempty"`
+}
+
+type acmeChallenge struct {
+	Error     *acmeProblem `json:"error,omitempty"`
+	Status    string       `json:"status"`
+	Token     string       `json:"token"`
+	Type      string       `json:"type"`
+	Validated time.Time    `json:"validated"`
+}
+
+type acmeIdentifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// acmeProblem - an RFC 7807 problem document with an ACME error type (RFC 8555 section 6.7).
+type acmeProblem struct {
+	Detail string `json:"detail,omitempty"`
+	Status int    `json:"status,omitempty"`
+	Type   string `json:"type"`
+}
+
+// The objects as RFC 8555 section 7.1 sends them, with URLs in place of IDs.
+type acmeAccountJSON struct {
+	Contact []string `json:"contact,omitempty"`
+	Orders  string   `json:"orders"`
+	Status  string   `json:"status"`
+}
+
+type acmeOrderJSON struct {
+	Authorizations []string         `json:"authorizations"`
+	Certificate    string           `json:"certificate,omitempty"`
+	Error          *acmeProblem     `json:"error,omitempty"`
+	Expires        string           `json:"expires"`
+	Finalize       string           `json:"finalize"`
+	Identifiers    []acmeIdentifier `json:"identifiers"`
+	Status         string           `json:"status"`
+}
+
+type acmeAuthorizationJSON struct {
+	Challenges []acmeChallengeJSON `json:"challenges"`
+	Expires    string              `json:"expires"`
+	Identifier acmeIdentifier      `json:"identifier"`
+	Status     string              `json:"status"`
+	Wildcard   bool                `json:"wildcard,omitempty"`
+}
+
+type acmeChallengeJSON struct {
+	Error     *acmeProblem `json:"error,omitempty"`
+	Status    string       `json:"status"`
+	Token     string       `json:"token"`
+	Type      string       `json:"type"`
+	URL       string       `json:"url"`
+	Validated string       `json:"validated,omitempty"`
+}
+
+// readACMEState - reads the state file in the acme directory. A missing file is a server with no accounts.
+//
+//	Customer Messages: None
+//	Errors: errors returned by os and json
+//	Verifications: None
+func readACMEState(caDirectory string) (state acmeState, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData     []byte
+		tStateFQN = filepath.Join(caDirectory, DIRECTORY_ACME, FILE_ACME_STATE)
+	)
+
+	state = acmeState{Accounts: map[string]*acmeAccount{}, Authorizations: map[string]*acmeAuthorization{}, Orders: map[string]*acmeOrder{}}
+	if tData, errorInfo.Error = os.ReadFile(tStateFQN); errors.Is(errorInfo.Error, os.ErrNotExist) {
+		errorInfo.Error = nil
+		return
+	}
+	if errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("ACME State File: %s", tStateFQN))
+		return
+	}
+	if errorInfo.Error = json.Unmarshal(tData, &state); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("ACME State File: %s", tStateFQN))
+	}
+
+	return
+}
+
+// write - replaces the state file in the acme directory.
+//
+//	Customer Messages: None
+//	Errors: errors returned by json and certs.WriteOutFile
+//	Verifications: None
+func (s acmeState) write(caDirectory string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tData     []byte
+		tStateFQN = filepath.Join(caDirectory, DIRECTORY_ACME, FILE_ACME_STATE)
+	)
+
+	if tData, errorInfo.Error = json.MarshalIndent(s, ctv.VAL_EMPTY, "  "); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("ACME State File: %s", tStateFQN))
+		return
+	}
+
+	return certs.WriteOutFile(tStateFQN, append(tData, '\n'), PRIVATE_FILE_PERMISSIONS)
+}
+
+// challenge - the authorization's challenge of the type, or nil.
+func (a *acmeAuthorization) challenge(challengeType string) *acmeChallenge {
+
+	for _, tChallengePtr := range a.Challenges {
+		if tChallengePtr.Type == challengeType {
+			return tChallengePtr
+		}
+	}
+
+	return nil
+}
+
+// settle - marks the authorization's processing challenges, other than the one that settled it, invalid once it is no longer
+// pending, so a client polling one of them is told it will not be validated.
+func (a *acmeAuthorization) settle(challengePtr *acmeChallenge) {
+
+	for _, tChallengePtr := range a.Challenges {
+		if tChallengePtr != challengePtr && tChallengePtr.Status == ACME_STATUS_PROCESSING {
+			tChallengePtr.Status = ACME_STATUS_INVALID
+			tChallengePtr.Error = &acmeProblem{Type: ACME_ERROR_UNAUTHORIZED, Detail: fmt.Sprintf("The authorization is %s, so this challenge was not used.", a.Status)}
+		}
+	}
+}
+
+// refresh - a pending or valid authorization expires at its expiry time.
+func (a *acmeAuthorization) refresh(now time.Time) {
+
+	if (a.Status == ACME_STATUS_PENDING || a.Status == ACME_STATUS_VALID) && now.After(a.Expires) {
+		a.Status = ACME_STATUS_EXPIRED
+	}
+}
+
+// refresh - moves a pending or ready order on from its authorizations: ready when all are valid, and invalid when one has
+// failed, been deactivated or expired, or the order itself has expired. A ready order goes back to invalid, so it cannot be
+// finalized on an authorization that is no longer valid.
+func (o *acmeOrder) refresh(state acmeState, now time.Time) {
+
+	if o.Status != ACME_STATUS_PENDING && o.Status != ACME_STATUS_READY {
+		return
+	}
+
+	tAllValid := true
+	for _, tAuthorizationID := range o.Authorizations {
+		tAuthorizationPtr := state.Authorizations[tAuthorizationID]
+		tAuthorizationPtr.refresh(now)
+		switch tAuthorizationPtr.Status {
+		case ACME_STATUS_VALID:
+		case ACME_STATUS_PENDING:
+			tAllValid = false
+		default:
+			o.Status = ACME_STATUS_INVALID
+			o.Error = &acmeProblem{Type: ACME_ERROR_UNAUTHORIZED, Detail: fmt.Sprintf("The authorization for %s is %s.", tAuthorizationPtr.Identifier.Value, tAuthorizationPtr.Status)}
+			return
+		}
+	}
+	switch {
+	case now.After(o.Expires):
+		o.Status = ACME_STATUS_INVALID
+		o.Error = &acmeProblem{Type: ACME_ERROR_UNAUTHORIZED, Detail: "The order expired before it was finalized."}
+	case tAllValid:
+		o.Status = ACME_STATUS_READY
+	}
+}
+
+// accountJSON - the account as the API sends it.
+func (a *acmeAccount) accountJSON(baseURL string) acmeAccountJSON {
+
+	return acmeAccountJSON{Contact: a.Contact, Orders: baseURL + "/account/" + a.ID + "/orders", Status: a.Status}
+}
+
+// orderJSON - the order as the API sends it.
+func (o *acmeOrder) orderJSON(baseURL string) (orderJSON acmeOrderJSON) {
+
+	orderJSON = acmeOrderJSON{
+		Error:       o.Error,
+		Expires:     o.Expires.UTC().Format(time.RFC3339),
+		Finalize:    baseURL + "/order/" + o.ID + "/finalize",
+		Identifiers: o.Identifiers,
+		Status:      o.Status,
+	}
+	for _, tAuthorizationID := range o.Authorizations {
+		orderJSON.Authorizations = append(orderJSON.Authorizations, baseURL+"/authz/"+tAuthorizationID)
+	}
+	if o.Certificate != ctv.VAL_EMPTY {
+		orderJSON.Certificate = baseURL + "/certificate/" + o.Certificate
+	}
+
+	return
+}
+
+// authorizationJSON - the authorization as the API sends it.
+func (a *acmeAuthorization) authorizationJSON(baseURL string) (authorizationJSON acmeAuthorizationJSON) {
+
+	authorizationJSON = acmeAuthorizationJSON{
+		Expires:    a.Expires.UTC().Format(time.RFC3339),
+		Identifier: a.Identifier,
+		Status:     a.Status,
+		Wildcard:   a.Wildcard,
+	}
+	for _, tChallengePtr := range a.Challenges {
+		authorizationJSON.Challenges = append(authorizationJSON.Challenges, a.challengeJSON(baseURL, tChallengePtr))
+	}
+
+	return
+}
+
+// challengeJSON - the authorization's challenge as the API sends it.
+func (a *acmeAuthorization) challengeJSON(baseURL string, challengePtr *acmeChallenge) (challengeJSON acmeChallengeJSON) {
+
+	challengeJSON = acmeChallengeJSON{
+		Error:  challengePtr.Error,
+		Status: challengePtr.Status,
+		Token:  challengePtr.Token,
+		Type:   challengePtr.Type,
+		URL:    baseURL + "/challenge/" + a.ID + "/" + challengePtr.Type,
+	}
+	if challengePtr.Validated.IsZero() == false {
+		challengeJSON.Validated = challengePtr.Validated.UTC().Format(time.RFC3339)
+	}
+
+	return
+}
+
+// newACMEID - a random, unguessable ID for an account, order or authorization, or a challenge token, base64url encoded.
+//
+//	Customer Messages: None
+//	Errors: errors returned by rand
+//	Verifications: None
+func newACMEID(size int) (id string, errorInfo errs.ErrorInfo) {
+
+	tBytes := make([]byte, size)
+	if _, errorInfo.Error = rand.Read(tBytes); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, "ACME ID")
+		return
+	}
+
+	return base64.RawURLEncoding.EncodeToString(tBytes), errorInfo
+}
@@ -0,0 +1,519 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/acme"
+
+	certs "certificate_services"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+const (
+	TEST_ACME_HOST = "127.0.0.1"
+)
+
+// acmeTarget - an ACME server and the stand-ins for the names it validates, listening on loopback in the test process. Every
+// name resolves to 127.0.0.1 on the stand-in DNS server, so http-01 reaches the stand-in HTTP server.
+type acmeTarget struct {
+	authorityPtr *authority
+	directoryURL string
+	roots        *x509.CertPool
+	standinDir   string
+}
+
+func newACMETarget(t *testing.T) (target acmeTarget) {
+
+	var (
+		tCertificate tls.Certificate
+		tConnection  net.PacketConn
+		tErr         error
+		tErrorInfo   errs.ErrorInfo
+	)
+
+	target.authorityPtr = newTestAuthority(t, "ACME Test")
+	target.roots = x509.NewCertPool()
+	target.roots.AddCert(target.authorityPtr.Root)
+
+	target.standinDir = filepath.Join(t.TempDir(), DIRECTORY_STANDIN)
+	for _, tDirectory := range []string{DIRECTORY_STANDIN_HTTP01, DIRECTORY_STANDIN_DNS01} {
+		if tErr = os.MkdirAll(filepath.Join(target.standinDir, tDirectory), DIRECTORY_PERMISSIONS); tErr != nil {
+			t.Fatal(tErr)
+		}
+	}
+	tStandinHTTPPtr := httptest.NewServer(standinHandler(target.standinDir))
+	t.Cleanup(tStandinHTTPPtr.Close)
+	if tConnection, tErr = net.ListenPacket("udp", net.JoinHostPort(TEST_ACME_HOST, "0")); tErr != nil {
+		t.Fatal(tErr)
+	}
+	t.Cleanup(func() { _ = tConnection.Close() })
+	go func() {
+		tBuffer := make([]byte, STANDIN_DNS_MAX_MESSAGE_BYTES)
+		for {
+			tSize, tClientAddress, tErr := tConnection.ReadFrom(tBuffer)
+			if tErr != nil {
+				return
+			}
+			if tResponse, tErr := standinDNSAnswer(tBuffer[:tSize], net.ParseIP(TEST_ACME_HOST), target.standinDir); tErr == nil {
+				_, _ = tConnection.WriteTo(tResponse, tClientAddress)
+			}
+		}
+	}()
+
+	_, tHTTPPort, _ := net.SplitHostPort(tStandinHTTPPtr.Listener.Addr().String())
+	tPort, _ := strconv.Atoi(tHTTPPort)
+	tServerPtr := &acmeServer{
+		Authority: target.authorityPtr,
+		Validator: newACMEValidator(tConnection.LocalAddr().String(), tPort),
+		ValidDays: 30,
+		nonces:    map[string]time.Time{},
+	}
+	if tServerPtr.state, tErrorInfo = readACMEState(target.authorityPtr.Directory); tErrorInfo.Error != nil {
+		t.Fatalf("readACMEState: %s", tErrorInfo.Error)
+	}
+	if tCertificate, tErrorInfo = tServerPtr.serverCertificate(TEST_ACME_HOST); tErrorInfo.Error != nil {
+		t.Fatalf("serverCertificate: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	tACMEServerPtr := httptest.NewUnstartedServer(tServerPtr.handler())
+	tACMEServerPtr.TLS = &tls.Config{Certificates: []tls.Certificate{tCertificate}, MinVersion: tls.VersionTLS12}
+	tACMEServerPtr.StartTLS()
+	t.Cleanup(tACMEServerPtr.Close)
+	target.directoryURL = tACMEServerPtr.URL + "/directory"
+
+	return
+}
+
+// client - an ACME client with the key, trusting only the test root, as a client of the CA would.
+func (target acmeTarget) client(key crypto.Signer) *acme.Client {
+
+	return &acme.Client{
+		DirectoryURL: target.directoryURL,
+		HTTPClient:   &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: target.roots}}},
+		Key:          key,
+	}
+}
+
+// authorize - orders a certificate for the DNS names and answers each pending authorization with the challenge type through
+// the stand-in files. The order is returned once it is ready.
+func (target acmeTarget) authorize(t *testing.T, ctx context.Context, clientPtr *acme.Client, challengeType string, names ...string) (orderPtr *acme.Order) {
+
+	var (
+		tErr error
+		tIDs []acme.AuthzID
+	)
+
+	for _, tName := range names {
+		tIDs = append(tIDs, acme.AuthzID{Type: ACME_IDENTIFIER_DNS, Value: tName})
+	}
+	if orderPtr, tErr = clientPtr.AuthorizeOrder(ctx, tIDs); tErr != nil {
+		t.Fatalf("AuthorizeOrder %v: %s", names, tErr)
+	}
+
+	for _, tURL := range orderPtr.AuthzURLs {
+		tAuthorizationPtr, tErr := clientPtr.GetAuthorization(ctx, tURL)
+		if tErr != nil {
+			t.Fatal(tErr)
+		}
+		if tAuthorizationPtr.Status == acme.StatusValid {
+			continue
+		}
+		var tChallengePtr *acme.Challenge
+		for _, tOfferedPtr := range tAuthorizationPtr.Challenges {
+			if tOfferedPtr.Type == challengeType {
+				tChallengePtr = tOfferedPtr
+			}
+		}
+		if tChallengePtr == nil {
+			t.Fatalf("the authorization for %s has no %s challenge", tAuthorizationPtr.Identifier.Value, challengeType)
+		}
+
+		switch challengeType {
+		case ACME_CHALLENGE_HTTP01:
+			tResponse, _ := clientPtr.HTTP01ChallengeResponse(tChallengePtr.Token)
+			tErr = os.WriteFile(filepath.Join(target.standinDir, DIRECTORY_STANDIN_HTTP01, tChallengePtr.Token), []byte(tResponse), PUBLIC_FILE_PERMISSIONS)
+		case ACME_CHALLENGE_DNS01:
+			tRecord, _ := clientPtr.DNS01ChallengeRecord(tChallengePtr.Token)
+			tErr = os.WriteFile(filepath.Join(target.standinDir, DIRECTORY_STANDIN_DNS01, "_acme-challenge."+tAuthorizationPtr.Identifier.Value), []byte(tRecord+"\n"), PUBLIC_FILE_PERMISSIONS)
+		}
+		if tErr != nil {
+			t.Fatal(tErr)
+		}
+
+		if _, tErr = clientPtr.Accept(ctx, tChallengePtr); tErr != nil {
+			t.Fatalf("Accept %s %s: %s", challengeType, tAuthorizationPtr.Identifier.Value, tErr)
+		}
+		if _, tErr = clientPtr.WaitAuthorization(ctx, tAuthorizationPtr.URI); tErr != nil {
+			t.Fatalf("WaitAuthorization %s %s: %s", challengeType, tAuthorizationPtr.Identifier.Value, tErr)
+		}
+	}
+	// WaitOrder reads the URL from a Location header, which only a new order has, so it is kept from AuthorizeOrder.
+	tOrderURL := orderPtr.URI
+	if orderPtr, tErr = clientPtr.WaitOrder(ctx, tOrderURL); tErr != nil {
+		t.Fatalf("WaitOrder: %s", tErr)
+	}
+	orderPtr.URI = tOrderURL
+
+	return
+}
+
+// obtain - authorizes an order for the DNS names with the challenge type, and downloads the certificate with its chain.
+func (target acmeTarget) obtain(t *testing.T, ctx context.Context, clientPtr *acme.Client, challengeType string, certificateKey crypto.Signer, names ...string) (chain [][]byte) {
+
+	var (
+		tErr error
+	)
+
+	tOrderPtr := target.authorize(t, ctx, clientPtr, challengeType, names...)
+	if chain, _, tErr = clientPtr.CreateOrderCert(ctx, tOrderPtr.FinalizeURL, newTestCSR(t, certificateKey, names...), true); tErr != nil {
+		t.Fatalf("CreateOrderCert: %s", tErr)
+	}
+
+	return
+}
+
+// newTestCSR - a DER certificate signing request for the DNS names, with the first as the common name.
+func newTestCSR(t *testing.T, certificateKey crypto.Signer, names ...string) (csr []byte) {
+
+	var (
+		tErr error
+	)
+
+	if csr, tErr = x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: names[0]}, DNSNames: names}, certificateKey); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	return
+}
+
+// verifyChain - the leaf of the chain, which must verify to the root for the name and have the key.
+func (target acmeTarget) verifyChain(t *testing.T, chain [][]byte, name string, certificateKey crypto.Signer) (leafPtr *x509.Certificate) {
+
+	var (
+		tErr           error
+		tIntermediates = x509.NewCertPool()
+	)
+
+	if len(chain) != 2 {
+		t.Fatalf("the chain has %d certificates, want the leaf and the intermediate", len(chain))
+	}
+	if leafPtr, tErr = x509.ParseCertificate(chain[0]); tErr != nil {
+		t.Fatal(tErr)
+	}
+	tIntermediatePtr, tErr := x509.ParseCertificate(chain[1])
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	tIntermediates.AddCert(tIntermediatePtr)
+	if _, tErr = leafPtr.Verify(x509.VerifyOptions{DNSName: name, Roots: target.roots, Intermediates: tIntermediates}); tErr != nil {
+		t.Errorf("the certificate for %s does not verify: %s", name, tErr)
+	}
+	if certs.SamePublicKey(leafPtr.PublicKey, certificateKey.Public()) == false {
+		t.Errorf("the certificate for %s is not for the CSR key", name)
+	}
+
+	return
+}
+
+// recordFor - the database record of the certificate.
+func (target acmeTarget) recordFor(t *testing.T, certificatePtr *x509.Certificate) record {
+
+	tDatabasePtr, tErrorInfo := readDatabase(target.authorityPtr.Directory)
+	if tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+	tIndex := tDatabasePtr.find(certificatePtr.SerialNumber)
+	if tIndex < 0 {
+		t.Fatalf("serial %s is not in the database", serialHex(certificatePtr.SerialNumber))
+	}
+
+	return tDatabasePtr.Records[tIndex]
+}
+
+func TestACMEFlow(t *testing.T) {
+
+	tTarget := newACMETarget(t)
+	tContext, tCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer tCancel()
+
+	tAccountKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tClientPtr := tTarget.client(tAccountKey)
+	tAccountPtr, tErr := tClientPtr.Register(tContext, &acme.Account{Contact: []string{"mailto:ops@example.com"}}, acme.AcceptTOS)
+	if tErr != nil {
+		t.Fatalf("Register: %s", tErr)
+	}
+	if tAccountPtr.Status != acme.StatusValid || tAccountPtr.URI == "" {
+		t.Errorf("account %+v, want a valid account with a URL", tAccountPtr)
+	}
+	if _, tErr = tClientPtr.Register(tContext, &acme.Account{}, acme.AcceptTOS); errors.Is(tErr, acme.ErrAccountAlreadyExists) == false {
+		t.Errorf("registering the key again = %v, want %s", tErr, acme.ErrAccountAlreadyExists)
+	}
+
+	tHTTPKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tHTTPChain := tTarget.obtain(t, tContext, tClientPtr, ACME_CHALLENGE_HTTP01, tHTTPKey, "www.example.com", "api.example.com")
+	tHTTPLeafPtr := tTarget.verifyChain(t, tHTTPChain, "api.example.com", tHTTPKey)
+
+	// A wildcard can only be validated with dns-01.
+	tDNSKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	tDNSChain := tTarget.obtain(t, tContext, tClientPtr, ACME_CHALLENGE_DNS01, tDNSKey, "*.svc.example.com", "svc.example.com")
+	tDNSLeafPtr := tTarget.verifyChain(t, tDNSChain, "nats.svc.example.com", tDNSKey)
+
+	// Another account can neither download nor revoke the certificates.
+	tOtherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tOtherClientPtr := tTarget.client(tOtherKey)
+	if _, tErr = tOtherClientPtr.Register(tContext, &acme.Account{}, acme.AcceptTOS); tErr != nil {
+		t.Fatalf("Register the other account: %s", tErr)
+	}
+	if tErr = tOtherClientPtr.RevokeCert(tContext, nil, tHTTPChain[0], acme.CRLReasonKeyCompromise); tErr == nil {
+		t.Error("another account revoked the certificate")
+	}
+	if tRecord := tTarget.recordFor(t, tHTTPLeafPtr); tRecord.Status != STATUS_VALID {
+		t.Fatalf("status after the other account's revocation = %s, want %s", tRecord.Status, STATUS_VALID)
+	}
+
+	for _, tCase := range []struct {
+		name           string
+		certificatePtr *x509.Certificate
+		revoke         func() error
+		wantReason     int
+	}{
+		{
+			name:           "by the account",
+			certificatePtr: tHTTPLeafPtr,
+			revoke:         func() error { return tClientPtr.RevokeCert(tContext, nil, tHTTPChain[0], acme.CRLReasonKeyCompromise) },
+			wantReason:     int(acme.CRLReasonKeyCompromise),
+		},
+		{
+			name:           "by the certificate key",
+			certificatePtr: tDNSLeafPtr,
+			revoke: func() error {
+				return tOtherClientPtr.RevokeCert(tContext, tDNSKey, tDNSChain[0], acme.CRLReasonSuperseded)
+			},
+			wantReason: int(acme.CRLReasonSuperseded),
+		},
+	} {
+		if tErr = tCase.revoke(); tErr != nil {
+			t.Fatalf("RevokeCert %s: %s", tCase.name, tErr)
+		}
+		if tRecord := tTarget.recordFor(t, tCase.certificatePtr); tRecord.Status != STATUS_REVOKED || tRecord.Reason != tCase.wantReason {
+			t.Errorf("revoked %s: status %s reason %d, want %s %d", tCase.name, tRecord.Status, tRecord.Reason, STATUS_REVOKED, tCase.wantReason)
+		}
+	}
+}
+
+// TestValidateChallengeKeepsStatus - a validation that finishes after its authorization has been deactivated or has expired
+// leaves the authorization and challenge as they are.
+func TestValidateChallengeKeepsStatus(t *testing.T) {
+
+	var (
+		tNow = time.Now().UTC()
+	)
+
+	// http-01 for 127.0.0.1 fails at once on a port nothing listens on.
+	tListener, tErr := net.Listen("tcp", net.JoinHostPort(TEST_ACME_HOST, "0"))
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	_, tClosedPort, _ := net.SplitHostPort(tListener.Addr().String())
+	_ = tListener.Close()
+	tPort, _ := strconv.Atoi(tClosedPort)
+
+	tServerPtr := &acmeServer{Authority: newTestAuthority(t, "ACME Test"), Validator: newACMEValidator("", tPort)}
+
+	for _, tCase := range []struct {
+		name              string
+		authorization     string
+		challenge         string
+		expires           time.Time
+		wantAuthorization string
+		wantChallenge     string
+	}{
+		{"pending and processing", ACME_STATUS_PENDING, ACME_STATUS_PROCESSING, tNow.Add(time.Hour), ACME_STATUS_INVALID, ACME_STATUS_INVALID},
+		{"deactivated", ACME_STATUS_DEACTIVATED, ACME_STATUS_PROCESSING, tNow.Add(time.Hour), ACME_STATUS_DEACTIVATED, ACME_STATUS_PROCESSING},
+		{"expired", ACME_STATUS_PENDING, ACME_STATUS_PROCESSING, tNow.Add(-time.Second), ACME_STATUS_EXPIRED, ACME_STATUS_PROCESSING},
+		{"challenge no longer processing", ACME_STATUS_PENDING, ACME_STATUS_PENDING, tNow.Add(time.Hour), ACME_STATUS_PENDING, ACME_STATUS_PENDING},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			tChallengePtr := &acmeChallenge{Status: tCase.challenge, Token: "token", Type: ACME_CHALLENGE_HTTP01}
+			tAuthorizationPtr := &acmeAuthorization{
+				Challenges: []*acmeChallenge{tChallengePtr},
+				Expires:    tCase.expires,
+				ID:         "authz",
+				Identifier: acmeIdentifier{Type: ACME_IDENTIFIER_IP, Value: TEST_ACME_HOST},
+				Status:     tCase.authorization,
+			}
+
+			tServerPtr.validateChallenge(tAuthorizationPtr, tChallengePtr, tAuthorizationPtr.Identifier, "token.thumbprint")
+
+			if tAuthorizationPtr.Status != tCase.wantAuthorization || tChallengePtr.Status != tCase.wantChallenge {
+				t.Errorf("authorization %s challenge %s, want %s %s", tAuthorizationPtr.Status, tChallengePtr.Status, tCase.wantAuthorization, tCase.wantChallenge)
+			}
+		})
+	}
+}
+
+// TestFinalizeAfterDeactivation - an order that was ready cannot be finalized once one of its authorizations is deactivated.
+func TestFinalizeAfterDeactivation(t *testing.T) {
+
+	var (
+		tACMEErrPtr *acme.Error
+	)
+
+	tTarget := newACMETarget(t)
+	tContext, tCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer tCancel()
+
+	tAccountKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tClientPtr := tTarget.client(tAccountKey)
+	if _, tErr := tClientPtr.Register(tContext, &acme.Account{}, acme.AcceptTOS); tErr != nil {
+		t.Fatalf("Register: %s", tErr)
+	}
+
+	tOrderPtr := tTarget.authorize(t, tContext, tClientPtr, ACME_CHALLENGE_HTTP01, "deactivated.example.com")
+	if tOrderPtr.Status != acme.StatusReady {
+		t.Fatalf("order status %s, want %s", tOrderPtr.Status, acme.StatusReady)
+	}
+	if tErr := tClientPtr.RevokeAuthorization(tContext, tOrderPtr.AuthzURLs[0]); tErr != nil {
+		t.Fatalf("RevokeAuthorization: %s", tErr)
+	}
+
+	tCertificateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, _, tErr := tClientPtr.CreateOrderCert(tContext, tOrderPtr.FinalizeURL, newTestCSR(t, tCertificateKey, "deactivated.example.com"), false)
+	if errors.As(tErr, &tACMEErrPtr) == false || tACMEErrPtr.ProblemType != ACME_ERROR_ORDER_NOT_READY {
+		t.Fatalf("CreateOrderCert after the deactivation = %v, want %s", tErr, ACME_ERROR_ORDER_NOT_READY)
+	}
+	if tOrderPtr, tErr = tClientPtr.GetOrder(tContext, tOrderPtr.URI); tErr != nil || tOrderPtr.Status != acme.StatusInvalid {
+		t.Errorf("order after the deactivation = %+v, %v, want %s", tOrderPtr, tErr, acme.StatusInvalid)
+	}
+}
+
+// TestOrderRefresh - a pending or ready order follows its authorizations and its expiry. A valid authorization expires too.
+func TestOrderRefresh(t *testing.T) {
+
+	var (
+		tNow = time.Now()
+	)
+
+	for _, tCase := range []struct {
+		name                 string
+		order                string
+		orderExpires         time.Time
+		authorization        string
+		authorizationExpires time.Time
+		wantOrder            string
+		wantAuthorization    string
+	}{
+		{"pending to ready", ACME_STATUS_PENDING, tNow.Add(time.Hour), ACME_STATUS_VALID, tNow.Add(time.Hour), ACME_STATUS_READY, ACME_STATUS_VALID},
+		{"pending stays pending", ACME_STATUS_PENDING, tNow.Add(time.Hour), ACME_STATUS_PENDING, tNow.Add(time.Hour), ACME_STATUS_PENDING, ACME_STATUS_PENDING},
+		{"ready stays ready", ACME_STATUS_READY, tNow.Add(time.Hour), ACME_STATUS_VALID, tNow.Add(time.Hour), ACME_STATUS_READY, ACME_STATUS_VALID},
+		{"ready with a deactivated authorization", ACME_STATUS_READY, tNow.Add(time.Hour), ACME_STATUS_DEACTIVATED, tNow.Add(time.Hour), ACME_STATUS_INVALID, ACME_STATUS_DEACTIVATED},
+		{"ready with an expired authorization", ACME_STATUS_READY, tNow.Add(time.Hour), ACME_STATUS_VALID, tNow.Add(-time.Second), ACME_STATUS_INVALID, ACME_STATUS_EXPIRED},
+		{"ready and expired", ACME_STATUS_READY, tNow.Add(-time.Second), ACME_STATUS_VALID, tNow.Add(time.Hour), ACME_STATUS_INVALID, ACME_STATUS_VALID},
+		{"pending with all valid and expired", ACME_STATUS_PENDING, tNow.Add(-time.Second), ACME_STATUS_VALID, tNow.Add(time.Hour), ACME_STATUS_INVALID, ACME_STATUS_VALID},
+		{"valid is left alone", ACME_STATUS_VALID, tNow.Add(-time.Second), ACME_STATUS_VALID, tNow.Add(-time.Second), ACME_STATUS_VALID, ACME_STATUS_VALID},
+	} {
+		tAuthorizationPtr := &acmeAuthorization{Expires: tCase.authorizationExpires, ID: "authz", Identifier: acmeIdentifier{Type: ACME_IDENTIFIER_DNS, Value: "www.example.com"}, Status: tCase.authorization}
+		tOrderPtr := &acmeOrder{Authorizations: []string{tAuthorizationPtr.ID}, Expires: tCase.orderExpires, Status: tCase.order}
+
+		tOrderPtr.refresh(acmeState{Authorizations: map[string]*acmeAuthorization{tAuthorizationPtr.ID: tAuthorizationPtr}}, tNow)
+
+		if tOrderPtr.Status != tCase.wantOrder || tAuthorizationPtr.Status != tCase.wantAuthorization {
+			t.Errorf("%s: order %s authorization %s, want %s %s", tCase.name, tOrderPtr.Status, tAuthorizationPtr.Status, tCase.wantOrder, tCase.wantAuthorization)
+		}
+		if (tOrderPtr.Status == ACME_STATUS_INVALID) != (tOrderPtr.Error != nil) {
+			t.Errorf("%s: order %s with error %v", tCase.name, tOrderPtr.Status, tOrderPtr.Error)
+		}
+	}
+}
+
+// TestAccountKeyIDPrefix - the kid must be the account URL. The account ID alone, or under another path, names no account.
+func TestAccountKeyIDPrefix(t *testing.T) {
+
+	var (
+		tACMEErrPtr *acme.Error
+	)
+
+	tTarget := newACMETarget(t)
+	tContext, tCancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer tCancel()
+
+	tAccountKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tAccountPtr, tErr := tTarget.client(tAccountKey).Register(tContext, &acme.Account{}, acme.AcceptTOS)
+	if tErr != nil {
+		t.Fatalf("Register: %s", tErr)
+	}
+	tAccountID := path.Base(tAccountPtr.URI)
+
+	for _, tCase := range []struct {
+		name    string
+		keyID   string
+		wantErr string
+	}{
+		{name: "account URL", keyID: tAccountPtr.URI},
+		{name: "account ID", keyID: tAccountID, wantErr: ACME_ERROR_ACCOUNT_DOES_NOT_EXIST},
+		{name: "another path", keyID: path.Dir(path.Dir(tAccountPtr.URI)) + "/order/" + tAccountID, wantErr: ACME_ERROR_ACCOUNT_DOES_NOT_EXIST},
+	} {
+		tClientPtr := tTarget.client(tAccountKey)
+		tClientPtr.KID = acme.KeyID(tCase.keyID)
+		// GetReg looks the account up by its key, so an order is what sends the kid.
+		_, tErr = tClientPtr.AuthorizeOrder(tContext, []acme.AuthzID{{Type: ACME_IDENTIFIER_DNS, Value: "kid.example.com"}})
+		switch {
+		case tCase.wantErr == "" && tErr != nil:
+			t.Errorf("%s: AuthorizeOrder: %s", tCase.name, tErr)
+		case tCase.wantErr != "" && (errors.As(tErr, &tACMEErrPtr) == false || tACMEErrPtr.ProblemType != tCase.wantErr):
+			t.Errorf("%s: AuthorizeOrder = %v, want %s", tCase.name, tErr, tCase.wantErr)
+		}
+	}
+}
+
+// TestValidateChallengeSettlesOthers - once one challenge settles the authorization, its other processing challenge is invalid.
+func TestValidateChallengeSettlesOthers(t *testing.T) {
+
+	// http-01 for 127.0.0.1 fails at once on a port nothing listens on.
+	tListener, tErr := net.Listen("tcp", net.JoinHostPort(TEST_ACME_HOST, "0"))
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	_, tClosedPort, _ := net.SplitHostPort(tListener.Addr().String())
+	_ = tListener.Close()
+	tPort, _ := strconv.Atoi(tClosedPort)
+
+	tServerPtr := &acmeServer{Authority: newTestAuthority(t, "ACME Test"), Validator: newACMEValidator("", tPort)}
+
+	tHTTPPtr := &acmeChallenge{Status: ACME_STATUS_PROCESSING, Token: "token", Type: ACME_CHALLENGE_HTTP01}
+	tOtherPtr := &acmeChallenge{Status: ACME_STATUS_PROCESSING, Token: "other", Type: ACME_CHALLENGE_DNS01}
+	tAuthorizationPtr := &acmeAuthorization{
+		Challenges: []*acmeChallenge{tHTTPPtr, tOtherPtr},
+		Expires:    time.Now().Add(time.Hour),
+		ID:         "authz",
+		Identifier: acmeIdentifier{Type: ACME_IDENTIFIER_IP, Value: TEST_ACME_HOST},
+		Status:     ACME_STATUS_PENDING,
+	}
+
+	tServerPtr.validateChallenge(tAuthorizationPtr, tHTTPPtr, tAuthorizationPtr.Identifier, "token.thumbprint")
+
+	if tAuthorizationPtr.Status != ACME_STATUS_INVALID || tHTTPPtr.Status != ACME_STATUS_INVALID {
+		t.Fatalf("authorization %s challenge %s, want %s %s", tAuthorizationPtr.Status, tHTTPPtr.Status, ACME_STATUS_INVALID, ACME_STATUS_INVALID)
+	}
+	if tOtherPtr.Status != ACME_STATUS_INVALID || tOtherPtr.Error == nil {
+		t.Errorf("the other challenge is %s with error %v, want %s with an error", tOtherPtr.Status, tOtherPtr.Error, ACME_STATUS_INVALID)
+	}
+}
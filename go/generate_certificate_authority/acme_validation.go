@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+)
+
+// acmeValidator - checks http-01 and dns-01 challenges. With a resolver address, names are looked up on that DNS server, such
+// as the standin, rather than the system's, and http-01 connects to HTTP01Port rather than 80.
+type acmeValidator struct {
+	HTTP01Port int
+	Resolver   *net.Resolver
+}
+
+// newACMEValidator - a validator that uses the DNS server at resolverAddress, or the system resolver when it is empty.
+func newACMEValidator(resolverAddress string, http01Port int) (validatorPtr *acmeValidator) {
+
+	validatorPtr = &acmeValidator{HTTP01Port: http01Port, Resolver: net.DefaultResolver}
+	if resolverAddress != ctv.VAL_EMPTY {
+		validatorPtr.Resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network string, _ string) (net.Conn, error) {
+				var tDialer net.Dialer
+				return tDialer.DialContext(ctx, network, resolverAddress)
+			},
+		}
+	}
+
+	return
+}
+
+// validate - nil when the challenge for the identifier has the key authorization in place, or the problem that explains why
+// not.
+func (v *acmeValidator) validate(challengeType string, identifier acmeIdentifier, token string, keyAuthorization string) (problemPtr *acmeProblem) {
+
+	tContext, tCancel := context.WithTimeout(context.Background(), ACME_VALIDATION_TIMEOUT)
+	defer tCancel()
+
+	switch challengeType {
+	case ACME_CHALLENGE_HTTP01:
+		return v.validateHTTP01(tContext, identifier, token, keyAuthorization)
+	case ACME_CHALLENGE_DNS01:
+		return v.validateDNS01(tContext, identifier, keyAuthorization)
+	}
+
+	return &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: fmt.Sprintf("The challenge type %s is not supported.", challengeType)}
+}
+
+// validateHTTP01 - fetches http://<identifier>/.well-known/acme-challenge/<token> (RFC 8555 section 8.3), connecting to the
+// identifier's address on HTTP01Port, and compares the body to the key authorization. Redirects are not followed.
+func (v *acmeValidator) validateHTTP01(ctx context.Context, identifier acmeIdentifier, token string, keyAuthorization string) (problemPtr *acmeProblem) {
+
+	var (
+		tBody        []byte
+		tErr         error
+		tRequestPtr  *http.Request
+		tResponsePtr *http.Response
+	)
+
+	tClient := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+				tHost, _, tErr := net.SplitHostPort(address)
+				if tErr != nil {
+					return nil, tErr
+				}
+				tAddresses, tErr := v.Resolver.LookupIPAddr(ctx, tHost)
+				if tErr != nil {
+					return nil, tErr
+				}
+				var tDialer net.Dialer
+				return tDialer.DialContext(ctx, network, net.JoinHostPort(tAddresses[0].IP.String(), strconv.Itoa(v.HTTP01Port)))
+			},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	tHost := identifier.Value
+	if identifier.Type == ACME_IDENTIFIER_IP && strings.Contains(tHost, ":") {
+		tHost = "[" + tHost + "]"
+	}
+	tURL := "http://" + tHost + ACME_HTTP01_PATH + token
+	if tRequestPtr, tErr = http.NewRequestWithContext(ctx, http.MethodGet, tURL, nil); tErr != nil {
+		return &acmeProblem{Type: ACME_ERROR_MALFORMED, Detail: tErr.Error()}
+	}
+	if tResponsePtr, tErr = tClient.Do(tRequestPtr); tErr != nil {
+		return &acmeProblem{Type: ACME_ERROR_CONNECTION, Detail: fmt.Sprintf("Fetching %s: %s", tURL, tErr)}
+	}
+	defer tResponsePtr.Body.Close()
+
+	if tResponsePtr.StatusCode != http.StatusOK {
+		return &acmeProblem{Type: ACME_ERROR_UNAUTHORIZED, Detail: fmt.Sprintf("Fetching %s returned %s.", tURL, tResponsePtr.Status)}
+	}
+	if tBody, tErr = io.ReadAll(io.LimitReader(tResponsePtr.Body, ACME_HTTP01_MAX_BODY_BYTES)); tErr != nil {
+		return &acmeProblem{Type: ACME_ERROR_CONNECTION, Detail: fmt.Sprintf("Fetching %s: %s", tURL, tErr)}
+	}
+	if strings.TrimSpace(string(tBody)) != keyAuthorization {
+		return &acmeProblem{Type: ACME_ERROR_INCORRECT_RESPONSE, Detail: fmt.Sprintf("The key authorization at %s is not %s.", tURL, keyAuthorization)}
+	}
+
+	return nil
+}
+
+// validateDNS01 - looks up the TXT records of _acme-challenge.<identifier> (RFC 8555 section 8.4) for the base64url SHA-256
+// digest of the key authorization.
+func (v *acmeValidator) validateDNS01(ctx context.Context, identifier acmeIdentifier, keyAuthorization string) (problemPtr *acmeProblem) {
+
+	var (
+		tErr     error
+		tName    = ACME_DNS01_LABEL + identifier.Value + "."
+		tRecords []string
+	)
+
+	tDigest := sha256.Sum256([]byte(keyAuthorization))
+	tExpected := base64.RawURLEncoding.EncodeToString(tDigest[:])
+
+	if tRecords, tErr = v.Resolver.LookupTXT(ctx, tName); tErr != nil {
+		return &acmeProblem{Type: ACME_ERROR_DNS, Detail: fmt.Sprintf("Looking up the TXT records of %s: %s", tName, tErr)}
+	}
+	for _, tRecord := range tRecords {
+		if tRecord == tExpected {
+			return nil
+		}
+	}
+
+	return &acmeProblem{Type: ACME_ERROR_INCORRECT_RESPONSE, Detail: fmt.Sprintf("No TXT record of %s is %s.", tName, tExpected)}
+}
+
+// acmeKeyAuthorization - the token and the account key's thumbprint, joined with a dot (RFC 8555 section 8.1).
+func acmeKeyAuthorization(token string, thumbprint string) string {
+
+	return token + "." + thumbprint
+}
@@ -0,0 +1,399 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// authority - the intermediate CA that issues certificates, with the root that signed it. The root key is never loaded.
+type authority struct {
+	Directory       string
+	Intermediate    *x509.Certificate
+	IntermediateKey crypto.Signer
+	Root            *x509.Certificate
+	Settings        settings
+}
+
+// initRequest - the root and intermediate CA that init creates. Empty names take a default built from the organization.
+type initRequest struct {
+	CADirectory            string
+	Country                string
+	CRLURL                 string // Put in issued certificates as their CRL Distribution Point.
+	EncryptRootKey         bool   // The passphrase comes from PassphraseFQN or the PASSPHRASE_ENVIRONMENT_VARIABLE.
+	IntermediateName       string
+	IntermediatePathLength int
+	IntermediateValidYears int
+	KeyType                string // One of the KEY_TYPE_ values. Both CAs use the same type.
+	NameConstraints        nameConstraintsRequest
+	OCSPURL                string // Put in issued certificates as their OCSP responder.
+	Organization           string
+	PassphraseFQN          string
+	RootName               string
+	RootPathLength         int
+	RootValidYears         int
+	RSABits                int // Only used when KeyType is KEY_TYPE_RSA.
+}
+
+// initAuthority - creates a self-signed root CA and an intermediate CA signed by it, and writes them to the CA directory. The
+// intermediate carries the name constraints. Both have random serial numbers and Subject Key Identifiers, and the intermediate
+// an Authority Key Identifier. Nothing is written until both are signed and the chain verifies, and a failed write removes
+// the files, and the directory, this init created.
+//
+//	Customer Messages: None
+//	Errors: ErrCAExists, ErrPassphraseRequired, ErrPathLengthInvalid, ErrValidityInvalid, errors returned by os, readPassphrase,
+//	certs.GenerateKey, nameConstraintsRequest.apply, signCertificate, x509, writePrivateKey and writeCertificatesFile
+//	Verifications: None
+func initAuthority(request initRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCreatedDirectory bool
+		tFileNames        = []string{FILE_ROOT_CERTIFICATE, FILE_ROOT_KEY, FILE_INTERMEDIATE_CERTIFICATE, FILE_INTERMEDIATE_KEY, FILE_INTERMEDIATE_FULL_CHAIN, FILE_INDEX}
+		tIntermediateKey  crypto.Signer
+		tIntermediatePtr  *x509.Certificate
+		tNow              = time.Now()
+		tPassphrase       string
+		tRootKey          crypto.Signer
+		tRootPtr          *x509.Certificate
+	)
+
+	switch {
+	case request.IntermediatePathLength < 0 || request.IntermediatePathLength >= request.RootPathLength:
+		errorInfo = errs.NewErrorInfo(ErrPathLengthInvalid, fmt.Sprintf("Root Path Length: %d Intermediate Path Length: %d", request.RootPathLength, request.IntermediatePathLength))
+		return
+	case request.RootValidYears < 1 || request.IntermediateValidYears < 1 || request.IntermediateValidYears > request.RootValidYears:
+		errorInfo = errs.NewErrorInfo(ErrValidityInvalid, fmt.Sprintf("Root Valid Years: %d Intermediate Valid Years: %d", request.RootValidYears, request.IntermediateValidYears))
+		return
+	}
+	if request.CRLURL, errorInfo = updateURL(ctv.VAL_EMPTY, request.CRLURL); errorInfo.Error != nil {
+		return
+	}
+	if request.OCSPURL, errorInfo = updateURL(ctv.VAL_EMPTY, request.OCSPURL); errorInfo.Error != nil {
+		return
+	}
+	if request.EncryptRootKey {
+		if tPassphrase, errorInfo = readPassphrase(request.PassphraseFQN); errorInfo.Error != nil {
+			return
+		}
+		if tPassphrase == ctv.VAL_EMPTY {
+			errorInfo = errs.NewErrorInfo(ErrPassphraseRequired, fmt.Sprintf("CA Directory: %s", request.CADirectory))
+			return
+		}
+	}
+	if request.RootName == ctv.VAL_EMPTY {
+		request.RootName = request.Organization + " Root CA"
+	}
+	if request.IntermediateName == ctv.VAL_EMPTY {
+		request.IntermediateName = request.Organization + " Intermediate CA"
+	}
+
+	if _, tErr := os.Stat(request.CADirectory); errors.Is(tErr, os.ErrNotExist) {
+		tCreatedDirectory = true
+	}
+	if errorInfo.Error = os.MkdirAll(request.CADirectory, DIRECTORY_PERMISSIONS); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("CA Directory: %s", request.CADirectory))
+		return
+	}
+	for _, tFileName := range tFileNames {
+		if _, tErr := os.Stat(filepath.Join(request.CADirectory, tFileName)); errors.Is(tErr, os.ErrNotExist) == false {
+			errorInfo = errs.NewErrorInfo(ErrCAExists, fmt.Sprintf("File: %s", filepath.Join(request.CADirectory, tFileName)))
+			return
+		}
+	}
+	if _, tErr := os.Stat(filepath.Join(request.CADirectory, FILE_SETTINGS)); errors.Is(tErr, os.ErrNotExist) {
+		tFileNames = append(tFileNames, FILE_SETTINGS)
+	}
+	// A partly written CA would make the next init fail with ErrCAExists, so everything this init created is removed.
+	defer func() {
+		if errorInfo.Error != nil {
+			removeCreated(request.CADirectory, tFileNames, tCreatedDirectory)
+		}
+	}()
+
+	if tRootKey, errorInfo = certs.GenerateKey(request.KeyType, request.RSABits, MIN_RSA_BITS); errorInfo.Error != nil {
+		return
+	}
+	tRootTemplate := x509.Certificate{
+		Subject:               pkix.Name{CommonName: request.RootName, Organization: []string{request.Organization}, Country: []string{request.Country}},
+		NotBefore:             tNow.Add(-BACKDATE),
+		NotAfter:              tNow.AddDate(request.RootValidYears, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            request.RootPathLength,
+		MaxPathLenZero:        request.RootPathLength == 0,
+	}
+	if tRootPtr, errorInfo = signCertificate(&tRootTemplate, nil, tRootKey.Public(), tRootKey); errorInfo.Error != nil {
+		return
+	}
+
+	if tIntermediateKey, errorInfo = certs.GenerateKey(request.KeyType, request.RSABits, MIN_RSA_BITS); errorInfo.Error != nil {
+		return
+	}
+	tIntermediateTemplate := x509.Certificate{
+		Subject:               pkix.Name{CommonName: request.IntermediateName, Organization: []string{request.Organization}, Country: []string{request.Country}},
+		NotBefore:             tNow.Add(-BACKDATE),
+		NotAfter:              tNow.AddDate(request.IntermediateValidYears, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLen:            request.IntermediatePathLength,
+		MaxPathLenZero:        request.IntermediatePathLength == 0,
+	}
+	if errorInfo = request.NameConstraints.apply(&tIntermediateTemplate); errorInfo.Error != nil {
+		return
+	}
+	if tIntermediatePtr, errorInfo = signCertificate(&tIntermediateTemplate, tRootPtr, tIntermediateKey.Public(), tRootKey); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = verifyIntermediate(tIntermediatePtr, tRootPtr); errorInfo.Error != nil {
+		return
+	}
+
+	if errorInfo = writePrivateKey(filepath.Join(request.CADirectory, FILE_ROOT_KEY), tRootKey, tPassphrase); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writePrivateKey(filepath.Join(request.CADirectory, FILE_INTERMEDIATE_KEY), tIntermediateKey, ctv.VAL_EMPTY); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writeCertificatesFile(filepath.Join(request.CADirectory, FILE_ROOT_CERTIFICATE), []*x509.Certificate{tRootPtr}); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writeCertificatesFile(filepath.Join(request.CADirectory, FILE_INTERMEDIATE_CERTIFICATE), []*x509.Certificate{tIntermediatePtr}); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writeCertificatesFile(filepath.Join(request.CADirectory, FILE_INTERMEDIATE_FULL_CHAIN), []*x509.Certificate{tIntermediatePtr, tRootPtr}); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = certs.WriteOutFile(filepath.Join(request.CADirectory, FILE_INDEX), nil, PUBLIC_FILE_PERMISSIONS); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = (settings{CRLURL: request.CRLURL, OCSPURL: request.OCSPURL}).write(request.CADirectory); errorInfo.Error != nil {
+		return
+	}
+
+	fmt.Printf("The certificate authority has been created in %s.\n", request.CADirectory)
+	printCertificate("Root CA", tRootPtr)
+	if request.EncryptRootKey {
+		fmt.Printf("%sThe root key is encrypted.\n", ctv.SPACES_FOUR)
+	} else {
+		fmt.Printf("%sThe root key is NOT encrypted. Use encrypt_root_key, or keep %s offline.\n", ctv.SPACES_FOUR, FILE_ROOT_KEY)
+	}
+	printCertificate("Intermediate CA", tIntermediatePtr)
+	if request.CRLURL != ctv.VAL_EMPTY {
+		fmt.Printf("%sIssued certificates have the CRL Distribution Point %s.\n", ctv.SPACES_FOUR, request.CRLURL)
+	}
+	if request.OCSPURL != ctv.VAL_EMPTY {
+		fmt.Printf("%sIssued certificates have the OCSP responder %s.\n", ctv.SPACES_FOUR, request.OCSPURL)
+	}
+
+	return
+}
+
+// removeCreated - removes the files init created in the CA directory, and the directory when init created it. A file that
+// cannot be removed is reported, so it can be removed by hand before init is run again.
+func removeCreated(caDirectory string, fileNames []string, createdDirectory bool) {
+
+	for _, tFileName := range fileNames {
+		if tErr := os.Remove(filepath.Join(caDirectory, tFileName)); tErr != nil && errors.Is(tErr, os.ErrNotExist) == false {
+			fmt.Printf("%sCould not remove %s: %s\n", ctv.SPACES_FOUR, filepath.Join(caDirectory, tFileName), tErr)
+		}
+	}
+	if createdDirectory {
+		if tErr := os.Remove(caDirectory); tErr != nil {
+			fmt.Printf("%sCould not remove %s: %s\n", ctv.SPACES_FOUR, caDirectory, tErr)
+		}
+	}
+}
+
+// loadAuthority - reads the intermediate CA, its key and the root from the CA directory, and checks they belong together.
+//
+//	Customer Messages: None
+//	Errors: ErrCertificateKeyMismatch, errors returned by readCertificates, certs.ReadPrivateKey and verifyIntermediate
+//	Verifications: None
+func loadAuthority(caDirectory string) (authorityPtr *authority, errorInfo errs.ErrorInfo) {
+
+	var (
+		tIntermediates []*x509.Certificate
+		tRoots         []*x509.Certificate
+	)
+
+	authorityPtr = &authority{Directory: caDirectory}
+	if tRoots, errorInfo = readCertificates(filepath.Join(caDirectory, FILE_ROOT_CERTIFICATE)); errorInfo.Error != nil {
+		return
+	}
+	if tIntermediates, errorInfo = readCertificates(filepath.Join(caDirectory, FILE_INTERMEDIATE_CERTIFICATE)); errorInfo.Error != nil {
+		return
+	}
+	authorityPtr.Root, authorityPtr.Intermediate = tRoots[0], tIntermediates[0]
+	if authorityPtr.IntermediateKey, errorInfo = certs.ReadPrivateKey(filepath.Join(caDirectory, FILE_INTERMEDIATE_KEY), ctv.VAL_EMPTY); errorInfo.Error != nil {
+		return
+	}
+	if certs.SamePublicKey(authorityPtr.Intermediate.PublicKey, authorityPtr.IntermediateKey.Public()) == false {
+		errorInfo = errs.NewErrorInfo(ErrCertificateKeyMismatch, fmt.Sprintf("File: %s", filepath.Join(caDirectory, FILE_INTERMEDIATE_KEY)))
+		return
+	}
+	if errorInfo = verifyIntermediate(authorityPtr.Intermediate, authorityPtr.Root); errorInfo.Error != nil {
+		return
+	}
+	authorityPtr.Settings, errorInfo = readSettings(caDirectory)
+
+	return
+}
+
+// issue - signs the template with the intermediate CA and records the certificate in the database. The serial number, Subject
+// Key Identifier and Authority Key Identifier are set here, and the CRL Distribution Point and OCSP responder when the settings
+// have their URLs. The certificate cannot outlive the intermediate, and must verify to the root, which also checks its names
+// are inside the intermediate's name constraints. A copy is kept in the certs directory, and removed again if the index cannot
+// be written.
+//
+//	Customer Messages: None
+//	Errors: ErrSerialDuplicate, ErrValidityExceedsIssuer, errors returned by lockDatabase, readDatabase, certs.NewSerialNumber,
+//	signCertificate, x509, os, writeCertificatesFile and database.write
+//	Verifications: None
+func (a *authority) issue(templatePtr *x509.Certificate, publicKey crypto.PublicKey, profileName string) (certificatePtr *x509.Certificate, errorInfo errs.ErrorInfo) {
+
+	var (
+		tDatabasePtr *database
+		tFileName    string
+		tUnlock      func()
+	)
+
+	if templatePtr.NotAfter.After(a.Intermediate.NotAfter) {
+		errorInfo = errs.NewErrorInfo(ErrValidityExceedsIssuer, fmt.Sprintf("Not After: %s Intermediate Not After: %s", templatePtr.NotAfter.Format(time.RFC3339), a.Intermediate.NotAfter.Format(time.RFC3339)))
+		return
+	}
+
+	if a.Settings.CRLURL != ctv.VAL_EMPTY {
+		templatePtr.CRLDistributionPoints = []string{a.Settings.CRLURL}
+	}
+	if a.Settings.OCSPURL != ctv.VAL_EMPTY {
+		templatePtr.OCSPServer = []string{a.Settings.OCSPURL}
+	}
+
+	if tUnlock, errorInfo = lockDatabase(a.Directory); errorInfo.Error != nil {
+		return
+	}
+	defer tUnlock()
+	if tDatabasePtr, errorInfo = readDatabase(a.Directory); errorInfo.Error != nil {
+		return
+	}
+	if templatePtr.SerialNumber, errorInfo = certs.NewSerialNumber(); errorInfo.Error != nil {
+		return
+	}
+	if tDatabasePtr.find(templatePtr.SerialNumber) >= 0 {
+		errorInfo = errs.NewErrorInfo(ErrSerialDuplicate, fmt.Sprintf("Serial Number: %s", serialHex(templatePtr.SerialNumber)))
+		return
+	}
+
+	if certificatePtr, errorInfo = signCertificate(templatePtr, a.Intermediate, publicKey, a.IntermediateKey); errorInfo.Error != nil {
+		return
+	}
+	tRoots := x509.NewCertPool()
+	tRoots.AddCert(a.Root)
+	tIntermediates := x509.NewCertPool()
+	tIntermediates.AddCert(a.Intermediate)
+	if _, errorInfo.Error = certificatePtr.Verify(x509.VerifyOptions{Roots: tRoots, Intermediates: tIntermediates, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Subject: %s", certificatePtr.Subject))
+		return
+	}
+
+	tFileName = filepath.Join(DIRECTORY_CERTIFICATES, serialHex(certificatePtr.SerialNumber)+EXTENSION_CERTIFICATE)
+	if errorInfo.Error = os.MkdirAll(filepath.Join(a.Directory, DIRECTORY_CERTIFICATES), DIRECTORY_PERMISSIONS); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Directory: %s", filepath.Join(a.Directory, DIRECTORY_CERTIFICATES)))
+		return
+	}
+	if errorInfo = tDatabasePtr.add(certificatePtr, tFileName, profileName); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writeCertificatesFile(filepath.Join(a.Directory, tFileName), []*x509.Certificate{certificatePtr}); errorInfo.Error != nil {
+		return
+	}
+	// A copy in the certs directory that the index does not list would be a certificate nobody can revoke.
+	if errorInfo = tDatabasePtr.write(); errorInfo.Error != nil {
+		_ = os.Remove(filepath.Join(a.Directory, tFileName))
+	}
+
+	return
+}
+
+// chain - the issued certificate followed by the intermediate, as a TLS server sends it. The root is left out.
+func (a *authority) chain(certificatePtr *x509.Certificate) (chain [][]byte) {
+
+	return [][]byte{certificatePtr.Raw, a.Intermediate.Raw}
+}
+
+// signCertificate - sets the key identifiers and, unless the template has one, a random serial number, and signs the template.
+// A nil parent makes it self-signed.
+//
+//	Customer Messages: None
+//	Errors: errors returned by certs.NewSerialNumber, certs.SubjectKeyId and x509
+//	Verifications: None
+func signCertificate(templatePtr *x509.Certificate, parentPtr *x509.Certificate, publicKey crypto.PublicKey, signer crypto.Signer) (certificatePtr *x509.Certificate, errorInfo errs.ErrorInfo) {
+
+	var (
+		tDER []byte
+	)
+
+	if templatePtr.SerialNumber == nil {
+		if templatePtr.SerialNumber, errorInfo = certs.NewSerialNumber(); errorInfo.Error != nil {
+			return
+		}
+	}
+	if templatePtr.SubjectKeyId, errorInfo = certs.SubjectKeyId(publicKey); errorInfo.Error != nil {
+		return
+	}
+	if parentPtr == nil {
+		parentPtr = templatePtr
+	} else {
+		templatePtr.AuthorityKeyId = parentPtr.SubjectKeyId
+	}
+
+	if tDER, errorInfo.Error = x509.CreateCertificate(rand.Reader, templatePtr, parentPtr, publicKey, signer); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Subject: %s", templatePtr.Subject))
+		return
+	}
+	if certificatePtr, errorInfo.Error = x509.ParseCertificate(tDER); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Subject: %s", templatePtr.Subject))
+	}
+
+	return
+}
+
+// verifyIntermediate - the intermediate must chain to the root.
+//
+//	Customer Messages: None
+//	Errors: errors returned by x509
+//	Verifications: None
+func verifyIntermediate(intermediatePtr *x509.Certificate, rootPtr *x509.Certificate) (errorInfo errs.ErrorInfo) {
+
+	tRoots := x509.NewCertPool()
+	tRoots.AddCert(rootPtr)
+	if _, errorInfo.Error = intermediatePtr.Verify(x509.VerifyOptions{Roots: tRoots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny}}); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Intermediate: %s Root: %s", intermediatePtr.Subject, rootPtr.Subject))
+	}
+
+	return
+}
+
+// printCertificate - the certificate's subject, serial number, expiry, path length when it is a CA and Subject Key Identifier.
+func printCertificate(label string, certificatePtr *x509.Certificate) {
+
+	fmt.Printf("%s%s: %s\n", ctv.SPACES_FOUR, label, certificatePtr.Subject)
+	fmt.Printf("%s%sSerial Number: %x\n", ctv.SPACES_FOUR, ctv.SPACES_FOUR, certificatePtr.SerialNumber)
+	fmt.Printf("%s%sNot After: %s\n", ctv.SPACES_FOUR, ctv.SPACES_FOUR, certificatePtr.NotAfter.UTC().Format(time.RFC3339))
+	if certificatePtr.IsCA {
+		fmt.Printf("%s%sPath Length: %d\n", ctv.SPACES_FOUR, ctv.SPACES_FOUR, certificatePtr.MaxPathLen)
+	}
+	fmt.Printf("%s%sSubject Key Id: %x\n", ctv.SPACES_FOUR, ctv.SPACES_FOUR, certificatePtr.SubjectKeyId)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestInitAuthorityRemovesPartialCA - the settings file cannot be written, because a directory has its name, so init fails
+// after the keys and certificates are written. They must be removed, so init succeeds once the cause is fixed.
+func TestInitAuthorityRemovesPartialCA(t *testing.T) {
+
+	var (
+		tDirectory = t.TempDir()
+		tRequest   = initRequest{
+			CADirectory:            tDirectory,
+			IntermediatePathLength: 0,
+			IntermediateValidYears: 1,
+			KeyType:                KEY_TYPE_ECDSA_P256,
+			Organization:           "Test",
+			RootPathLength:         1,
+			RootValidYears:         2,
+		}
+	)
+
+	if tErr := os.Mkdir(filepath.Join(tDirectory, FILE_SETTINGS), DIRECTORY_PERMISSIONS); tErr != nil {
+		t.Fatal(tErr)
+	}
+	if tErrorInfo := initAuthority(tRequest); tErrorInfo.Error == nil {
+		t.Fatal("initAuthority succeeded without writing the settings")
+	}
+	if tEntries, _ := os.ReadDir(tDirectory); len(tEntries) != 1 {
+		t.Errorf("the CA directory holds %d entries after the failed init, want only the settings directory", len(tEntries))
+	}
+
+	if tErr := os.Remove(filepath.Join(tDirectory, FILE_SETTINGS)); tErr != nil {
+		t.Fatal(tErr)
+	}
+	if tErrorInfo := initAuthority(tRequest); tErrorInfo.Error != nil {
+		t.Fatalf("initAuthority after the failure: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+	if tErrorInfo := initAuthority(tRequest); errors.Is(tErrorInfo.Error, ErrCAExists) == false {
+		t.Errorf("a second initAuthority error = %v, want %s", tErrorInfo.Error, ErrCAExists)
+	}
+}
+
+// TestInitAuthorityRemovesCreatedDirectory - a CA directory that init created is removed again when init fails.
+func TestInitAuthorityRemovesCreatedDirectory(t *testing.T) {
+
+	tDirectory := filepath.Join(t.TempDir(), "ca")
+
+	if tErrorInfo := initAuthority(initRequest{
+		CADirectory:            tDirectory,
+		IntermediatePathLength: 0,
+		IntermediateValidYears: 1,
+		KeyType:                "dsa",
+		RootPathLength:         1,
+		RootValidYears:         2,
+	}); errors.Is(tErrorInfo.Error, ErrKeyTypeInvalid) == false {
+		t.Fatalf("initAuthority error = %v, want %s", tErrorInfo.Error, ErrKeyTypeInvalid)
+	}
+	if _, tErr := os.Stat(tDirectory); errors.Is(tErr, os.ErrNotExist) == false {
+		t.Errorf("the CA directory init created was left behind: %v", tErr)
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	certs "certificate_services"
+)
+
+//goland:noinspection ALL
+const (
+	APPLICATION_NAME = "Generate Certificate Authority"
+	VERSION          = "2024.1.0"
+)
+
+//goland:noinspection ALL
+const (
+	PEM_CERTIFICATE           = "CERTIFICATE"
+	PEM_CERTIFICATE_REQUEST   = "CERTIFICATE REQUEST"
+	PEM_EC_PRIVATE_KEY        = certs.PEM_EC_PRIVATE_KEY
+	PEM_ENCRYPTED_PRIVATE_KEY = certs.PEM_ENCRYPTED_PRIVATE_KEY
+	PEM_PRIVATE_KEY           = certs.PEM_PRIVATE_KEY
+	PEM_RSA_PRIVATE_KEY       = certs.PEM_RSA_PRIVATE_KEY
+	PEM_X509_CRL              = "X509 CRL"
+	//
+	EXTENSION_CERTIFICATE = ".pem"
+	EXTENSION_FULL_CHAIN  = ".fullchain.pem"
+	//
+	FILE_INTERMEDIATE_CERTIFICATE = "intermediate.pem"
+	FILE_INTERMEDIATE_FULL_CHAIN  = "intermediate.fullchain.pem"
+	FILE_INTERMEDIATE_KEY         = "intermediate.key"
+	FILE_ROOT_CERTIFICATE         = "root.pem"
+	FILE_ROOT_KEY                 = "root.key"
+	FILE_INDEX                    = "index.txt"
+	FILE_INDEX_LOCK               = "index.txt.lock"
+	DIRECTORY_CERTIFICATES        = "certs"
+	FILE_CRL_DER                  = "crl.der"
+	FILE_CRL_NUMBER               = "crlnumber"
+	FILE_CRL_PEM                  = "crl.pem"
+	FILE_SETTINGS                 = "settings.json"
+	FILE_OCSP_CERTIFICATE         = "ocsp.pem"
+	FILE_OCSP_KEY                 = "ocsp.key"
+	DIRECTORY_OCSP_RESPONSES      = "ocsp"
+	EXTENSION_OCSP_RESPONSE       = ".der"
+	DIRECTORY_ACME                = "acme"
+	FILE_ACME_STATE               = "state.json"
+	FILE_ACME_SERVER_CERTIFICATE  = "server.pem"
+	FILE_ACME_SERVER_KEY          = "server.key"
+	DIRECTORY_STANDIN             = "standin"
+	DIRECTORY_STANDIN_DNS01       = "dns-01"
+	DIRECTORY_STANDIN_HTTP01      = "http-01"
+	//
+	INDEX_COLUMNS         = 9
+	STATUS_EXPIRED        = "E"
+	STATUS_REVOKED        = "R"
+	STATUS_VALID          = "V"
+	DATABASE_LOCK_RETRY   = 50 * time.Millisecond
+	DATABASE_LOCK_TIMEOUT = 10 * time.Second
+	//
+	PROFILE_CLIENT     = "client"
+	PROFILE_OCSP       = "ocsp" // The delegated OCSP responder. It cannot be used with issue.
+	PROFILE_PEER       = "peer"
+	PROFILE_SERVER     = "server"
+	DEFAULT_PROFILE    = PROFILE_SERVER
+	DEFAULT_VALID_DAYS = 90
+	//
+	DEFAULT_CRL_VALIDITY = 7 * 24 * time.Hour
+	SETTING_NONE         = "none"
+	//
+	DEFAULT_OCSP_LISTEN_ADDRESS       = ":8081"
+	DEFAULT_OCSP_RESPONDER_KEY_TYPE   = KEY_TYPE_ECDSA_P256
+	DEFAULT_OCSP_RESPONDER_VALID_DAYS = 30
+	DEFAULT_OCSP_VALIDITY             = 24 * time.Hour
+	OCSP_MAX_NONCE_BYTES              = 32
+	OCSP_MAX_REQUEST_BYTES            = 10000
+	//
+	DEFAULT_ACME_HOST                   = "localhost"
+	DEFAULT_ACME_HTTP01_PORT            = 80
+	DEFAULT_ACME_LISTEN_ADDRESS         = ":8443"
+	DEFAULT_STANDIN_ADDRESS             = "127.0.0.1"
+	DEFAULT_STANDIN_DNS_LISTEN_ADDRESS  = ":8053"
+	DEFAULT_STANDIN_HTTP_LISTEN_ADDRESS = ":5002"
+	STANDIN_DNS_MAX_MESSAGE_BYTES       = 1232
+	//
+	ACME_DNS01_LABEL           = "_acme-challenge."
+	ACME_HTTP01_MAX_BODY_BYTES = 1024
+	ACME_HTTP01_PATH           = "/.well-known/acme-challenge/"
+	ACME_ID_BYTES              = 16
+	ACME_MAX_IDENTIFIERS       = 100
+	ACME_MAX_NONCES            = 10000
+	ACME_MAX_REQUEST_BYTES     = 65536
+	ACME_NONCE_LIFETIME        = time.Hour
+	ACME_ORDER_LIFETIME        = 7 * 24 * time.Hour
+	ACME_SERVER_RENEW_BEFORE   = 30 * 24 * time.Hour // The server's own TLS certificate is reissued when it has less left.
+	ACME_TOKEN_BYTES           = 32
+	ACME_VALIDATION_TIMEOUT    = 10 * time.Second
+	//
+	ACME_CHALLENGE_DNS01  = "dns-01"
+	ACME_CHALLENGE_HTTP01 = "http-01"
+	ACME_IDENTIFIER_DNS   = "dns"
+	ACME_IDENTIFIER_IP    = "ip"
+	//
+	ACME_STATUS_DEACTIVATED = "deactivated"
+	ACME_STATUS_EXPIRED     = "expired"
+	ACME_STATUS_INVALID     = "invalid"
+	ACME_STATUS_PENDING     = "pending"
+	ACME_STATUS_PROCESSING  = "processing"
+	ACME_STATUS_READY       = "ready"
+	ACME_STATUS_VALID       = "valid"
+	//
+	ACME_ERROR_ACCOUNT_DOES_NOT_EXIST  = ACME_ERROR_PREFIX + "accountDoesNotExist"
+	ACME_ERROR_ALREADY_REVOKED         = ACME_ERROR_PREFIX + "alreadyRevoked"
+	ACME_ERROR_BAD_CSR                 = ACME_ERROR_PREFIX + "badCSR"
+	ACME_ERROR_BAD_NONCE               = ACME_ERROR_PREFIX + "badNonce"
+	ACME_ERROR_BAD_REVOCATION_REASON   = ACME_ERROR_PREFIX + "badRevocationReason"
+	ACME_ERROR_BAD_SIGNATURE_ALGORITHM = ACME_ERROR_PREFIX + "badSignatureAlgorithm"
+	ACME_ERROR_CONNECTION              = ACME_ERROR_PREFIX + "connection"
+	ACME_ERROR_DNS                     = ACME_ERROR_PREFIX + "dns"
+	ACME_ERROR_INCORRECT_RESPONSE      = ACME_ERROR_PREFIX + "incorrectResponse"
+	ACME_ERROR_INVALID_CONTACT         = ACME_ERROR_PREFIX + "invalidContact"
+	ACME_ERROR_MALFORMED               = ACME_ERROR_PREFIX + "malformed"
+	ACME_ERROR_ORDER_NOT_READY         = ACME_ERROR_PREFIX + "orderNotReady"
+	ACME_ERROR_PREFIX                  = "urn:ietf:params:acme:error:"
+	ACME_ERROR_REJECTED_IDENTIFIER     = ACME_ERROR_PREFIX + "rejectedIdentifier"
+	ACME_ERROR_SERVER_INTERNAL         = ACME_ERROR_PREFIX + "serverInternal"
+	ACME_ERROR_UNAUTHORIZED            = ACME_ERROR_PREFIX + "unauthorized"
+	ACME_ERROR_UNSUPPORTED_CONTACT     = ACME_ERROR_PREFIX + "unsupportedContact"
+	ACME_ERROR_UNSUPPORTED_IDENTIFIER  = ACME_ERROR_PREFIX + "unsupportedIdentifier"
+	//
+	JWS_ALGORITHM_EDDSA = "EdDSA"
+	JWS_ALGORITHM_ES256 = "ES256"
+	JWS_ALGORITHM_ES384 = "ES384"
+	JWS_ALGORITHM_ES512 = "ES512"
+	JWS_ALGORITHM_RS256 = "RS256"
+	//
+	CONTENT_TYPE_CRL           = "application/pkix-crl"
+	CONTENT_TYPE_JOSE          = "application/jose+json"
+	CONTENT_TYPE_JSON          = "application/json"
+	CONTENT_TYPE_OCSP_RESPONSE = "application/ocsp-response"
+	CONTENT_TYPE_PEM           = "application/x-pem-file"
+	CONTENT_TYPE_PEM_CHAIN     = "application/pem-certificate-chain"
+	CONTENT_TYPE_PROBLEM       = "application/problem+json"
+	HTTP_READ_HEADER_TIMEOUT   = 10 * time.Second
+	HTTP_SHUTDOWN_TIMEOUT      = 5 * time.Second
+	//
+	DEFAULT_INTERMEDIATE_PATH_LENGTH = 0
+	DEFAULT_INTERMEDIATE_VALID_YEARS = 5
+	DEFAULT_ROOT_PATH_LENGTH         = 1
+	DEFAULT_ROOT_VALID_YEARS         = 20
+	//
+	DEFAULT_SUBJECT_COUNTRY      = "US"
+	DEFAULT_SUBJECT_ORGANIZATION = "STY Holdings Inc"
+	//
+	KEY_TYPE_ECDSA_P256 = certs.KEY_TYPE_ECDSA_P256
+	KEY_TYPE_ECDSA_P384 = certs.KEY_TYPE_ECDSA_P384
+	KEY_TYPE_ED25519    = certs.KEY_TYPE_ED25519
+	KEY_TYPE_RSA        = certs.KEY_TYPE_RSA
+	//
+	DEFAULT_KEY_TYPE = KEY_TYPE_ECDSA_P384
+	DEFAULT_RSA_BITS = 4096
+	MIN_RSA_BITS     = 2048
+	//
+	BACKDATE = 5 * time.Minute
+	//
+	PRIVATE_FILE_PERMISSIONS = 0600 // Private keys.
+	PUBLIC_FILE_PERMISSIONS  = 0644 // Certificates and chains.
+	DIRECTORY_PERMISSIONS    = 0700
+	//
+	PASSPHRASE_ENVIRONMENT_VARIABLE = "GENERATE_CERTIFICATE_AUTHORITY_PASSPHRASE"
+	//
+	SELF_TEST_HOST      = "localhost"
+	SELF_TEST_RESPONSE  = "success!"
+	SELF_TEST_SUBDOMAIN = "self-test"
+	SELF_TEST_VALIDITY  = time.Hour
+)
+
+//goland:noinspection ALL
+var (
+	ErrAlreadyRevoked          = errors.New("the certificate is already revoked")
+	ErrCAExists                = errors.New("the ca_dir already holds a certificate authority")
+	ErrCertificateKeyMismatch  = errors.New("the certificate public key does not match the private key")
+	ErrCRLNumberInvalid        = errors.New("the crlnumber file must hold a positive hex number")
+	ErrCRLScheduleInvalid      = errors.New("the crl_validity must be more than zero, and the every less than the crl_validity so a new CRL is out before the last one expires")
+	ErrDatabaseInvalid         = errors.New("the index file has a line that is not a valid record")
+	ErrDatabaseLocked          = errors.New("another process has held the index lock too long")
+	ErrHTTP01PortInvalid       = errors.New("the http01_port must be 1 to 65535")
+	ErrJWSAlgorithmInvalid     = errors.New("the JWS algorithm does not suit the key. It must be RS256 for RSA, ES256, ES384 or ES512 for the matching curve, or EdDSA for Ed25519")
+	ErrKeyTypeInvalid          = certs.ErrKeyTypeInvalid
+	ErrNameConstraintInvalid   = errors.New("the name constraint is not a valid DNS domain, CIDR, email address or URI domain")
+	ErrOCSPPathInvalid         = errors.New("a GET request must be sent to the path of the OCSP URL, followed by the base64 request")
+	ErrOCSPValidityInvalid     = errors.New("the response_validity must be more than zero")
+	ErrPassphraseRequired      = errors.New("the root key is encrypted, so a passphrase is required from the passphrase_file or the " + PASSPHRASE_ENVIRONMENT_VARIABLE + " environment variable")
+	ErrPathLengthInvalid       = errors.New("the intermediate_path_length must be zero or more and less than the root_path_length")
+	ErrPEMInvalid              = certs.ErrPEMInvalid
+	ErrProfileInvalid          = errors.New("the profile must be " + PROFILE_SERVER + ", " + PROFILE_CLIENT + " or " + PROFILE_PEER)
+	ErrReasonInvalid           = errors.New("the reason must be unspecified, keyCompromise, CACompromise, affiliationChanged, superseded, cessationOfOperation, certificateHold, privilegeWithdrawn or AACompromise")
+	ErrResponderInvalid        = errors.New("the OCSP responder certificate must have the OCSP Signing extended key usage and be in date. Create a new one with ocsp responder")
+	ErrResponderKeyTypeInvalid = errors.New("the OCSP responder key_type must be " + KEY_TYPE_RSA + ", " + KEY_TYPE_ECDSA_P256 + " or " + KEY_TYPE_ECDSA_P384 + ", which every OCSP client can verify")
+	ErrRSABitsTooSmall         = certs.ErrRSABitsTooSmall
+	ErrSelfTestFailed          = errors.New("the self-test server did not return the expected response")
+	ErrSerialDuplicate         = errors.New("the serial number has already been issued")
+	ErrSerialInvalid           = errors.New("the serial must be a positive hex number, with or without colons")
+	ErrSerialNotFound          = errors.New("no issued certificate has the serial number")
+	ErrStandinAddressInvalid   = errors.New("the address must be an IPv4 or IPv6 address")
+	ErrStatusInvalid           = errors.New("the status must be " + STATUS_VALID + ", " + STATUS_REVOKED + " or " + STATUS_EXPIRED)
+	ErrURLInvalid              = errors.New("the URL must be an absolute http or https URL, or none to remove it")
+	ErrValidDaysInvalid        = errors.New("the valid_days must be 1 or more")
+	ErrValidityExceedsIssuer   = errors.New("the certificate cannot be valid for longer than the intermediate CA that signs it")
+	ErrValidityInvalid         = errors.New("the root_valid_years must be 1 or more, and the intermediate_valid_years 1 or more and no more than the root's")
+)
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+var (
+	// domainRegex - a DNS domain of letters, digits and hyphens, optionally with a leading dot.
+	domainRegex = regexp.MustCompile(`^\.?([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)*[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+)
+
+// nameConstraintsRequest - the names the intermediate CA may, and may not, issue certificates for (RFC 5280 section 4.2.1.10).
+// A domain matches itself and its subdomains. A leading dot matches only the subdomains.
+type nameConstraintsRequest struct {
+	ExcludedDNSDomains      []string
+	ExcludedEmailAddresses  []string // An address, a domain, or a domain with a leading dot.
+	ExcludedIPRanges        []string // CIDR, such as 10.0.0.0/8.
+	ExcludedURIDomains      []string
+	PermittedDNSDomains     []string
+	PermittedEmailAddresses []string
+	PermittedIPRanges       []string
+	PermittedURIDomains     []string
+}
+
+// apply - checks the constraints and sets them on the template. The extension is marked critical, as RFC 5280 requires.
+//
+//	Customer Messages: None
+//	Errors: ErrNameConstraintInvalid
+//	Verifications: None
+func (n nameConstraintsRequest) apply(templatePtr *x509.Certificate) (errorInfo errs.ErrorInfo) {
+
+	if templatePtr.PermittedDNSDomains, errorInfo = checkDomains(n.PermittedDNSDomains); errorInfo.Error != nil {
+		return
+	}
+	if templatePtr.ExcludedDNSDomains, errorInfo = checkDomains(n.ExcludedDNSDomains); errorInfo.Error != nil {
+		return
+	}
+	if templatePtr.PermittedURIDomains, errorInfo = checkDomains(n.PermittedURIDomains); errorInfo.Error != nil {
+		return
+	}
+	if templatePtr.ExcludedURIDomains, errorInfo = checkDomains(n.ExcludedURIDomains); errorInfo.Error != nil {
+		return
+	}
+	if templatePtr.PermittedEmailAddresses, errorInfo = checkEmailConstraints(n.PermittedEmailAddresses); errorInfo.Error != nil {
+		return
+	}
+	if templatePtr.ExcludedEmailAddresses, errorInfo = checkEmailConstraints(n.ExcludedEmailAddresses); errorInfo.Error != nil {
+		return
+	}
+	if templatePtr.PermittedIPRanges, errorInfo = checkIPRanges(n.PermittedIPRanges); errorInfo.Error != nil {
+		return
+	}
+	if templatePtr.ExcludedIPRanges, errorInfo = checkIPRanges(n.ExcludedIPRanges); errorInfo.Error != nil {
+		return
+	}
+
+	templatePtr.PermittedDNSDomainsCritical = len(templatePtr.PermittedDNSDomains)+len(templatePtr.ExcludedDNSDomains)+
+		len(templatePtr.PermittedURIDomains)+len(templatePtr.ExcludedURIDomains)+
+		len(templatePtr.PermittedEmailAddresses)+len(templatePtr.ExcludedEmailAddresses)+
+		len(templatePtr.PermittedIPRanges)+len(templatePtr.ExcludedIPRanges) > 0
+
+	return
+}
+
+// checkDomains - the domains in lower case.
+//
+//	Customer Messages: None
+//	Errors: ErrNameConstraintInvalid
+//	Verifications: None
+func checkDomains(domains []string) (checked []string, errorInfo errs.ErrorInfo) {
+
+	for _, tDomain := range domains {
+		tDomain = strings.ToLower(strings.TrimSpace(tDomain))
+		if domainRegex.MatchString(tDomain) == false {
+			errorInfo = errs.NewErrorInfo(ErrNameConstraintInvalid, fmt.Sprintf("Domain: %s", tDomain))
+			return
+		}
+		checked = append(checked, tDomain)
+	}
+
+	return
+}
+
+// checkEmailConstraints - a full address keeps its local part as given. Only the domain is put in lower case.
+//
+//	Customer Messages: None
+//	Errors: ErrNameConstraintInvalid
+//	Verifications: None
+func checkEmailConstraints(constraints []string) (checked []string, errorInfo errs.ErrorInfo) {
+
+	for _, tConstraint := range constraints {
+		tConstraint = strings.TrimSpace(tConstraint)
+		tLocal, tDomain, tHasLocal := strings.Cut(tConstraint, "@")
+		if tHasLocal == false {
+			tLocal, tDomain = "", tConstraint
+		}
+		tDomain = strings.ToLower(tDomain)
+		if (tHasLocal && (tLocal == "" || strings.HasPrefix(tDomain, "."))) || domainRegex.MatchString(tDomain) == false {
+			errorInfo = errs.NewErrorInfo(ErrNameConstraintInvalid, fmt.Sprintf("Email Address: %s", tConstraint))
+			return
+		}
+		if tHasLocal {
+			tDomain = tLocal + "@" + tDomain
+		}
+		checked = append(checked, tDomain)
+	}
+
+	return
+}
+
+// checkIPRanges - each range must be in CIDR form.
+//
+//	Customer Messages: None
+//	Errors: ErrNameConstraintInvalid
+//	Verifications: None
+func checkIPRanges(ranges []string) (checked []*net.IPNet, errorInfo errs.ErrorInfo) {
+
+	for _, tRange := range ranges {
+		_, tIPNetPtr, tErr := net.ParseCIDR(strings.TrimSpace(tRange))
+		if tErr != nil {
+			errorInfo = errs.NewErrorInfo(ErrNameConstraintInvalid, fmt.Sprintf("IP Range: %s", tRange))
+			return
+		}
+		checked = append(checked, tIPNetPtr)
+	}
+
+	return
+}
+
+// permitsDNSName - whether the CA's name constraints allow the DNS name, so a request for it can be turned away before any
+// challenge is tried. The name must not be in an excluded domain and, when there are permitted domains, must be in one.
+func permitsDNSName(certificatePtr *x509.Certificate, name string) bool {
+
+	tInDomain := func(domain string) bool {
+		if strings.HasPrefix(domain, ".") {
+			return strings.HasSuffix(name, domain)
+		}
+		return name == domain || strings.HasSuffix(name, "."+domain)
+	}
+
+	name = strings.ToLower(name)
+	for _, tDomain := range certificatePtr.ExcludedDNSDomains {
+		if tInDomain(tDomain) {
+			return false
+		}
+	}
+	for _, tDomain := range certificatePtr.PermittedDNSDomains {
+		if tInDomain(tDomain) {
+			return true
+		}
+	}
+
+	return len(certificatePtr.PermittedDNSDomains) == 0
+}
+
+// permitsIPAddress - whether the CA's name constraints allow the IP address, as permitsDNSName does for DNS names.
+func permitsIPAddress(certificatePtr *x509.Certificate, address net.IP) bool {
+
+	for _, tIPNetPtr := range certificatePtr.ExcludedIPRanges {
+		if tIPNetPtr.Contains(address) {
+			return false
+		}
+	}
+	for _, tIPNetPtr := range certificatePtr.PermittedIPRanges {
+		if tIPNetPtr.Contains(address) {
+			return true
+		}
+	}
+
+	return len(certificatePtr.PermittedIPRanges) == 0
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// crlRequest - how the crl command generates and publishes the intermediate CA's CRL.
+type crlRequest struct {
+	CADirectory  string
+	Every        time.Duration // Generate a new CRL this often. Zero generates it once.
+	ServeAddress string        // Serve the CRL over HTTP on this address, such as :8080. Empty does not serve it.
+	Validity     time.Duration // The time from this update to the next update.
+}
+
+// runCRL - generates the CRL and, with Every or ServeAddress, keeps generating or serving it until interrupted.
+//
+//	Customer Messages: None
+//	Errors: ErrCRLScheduleInvalid, errors returned by generateCRL and net
+//	Verifications: None
+func runCRL(request crlRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tListener  net.Listener
+		tServerPtr *http.Server
+	)
+
+	if request.Validity <= 0 || request.Every < 0 || request.Every >= request.Validity {
+		errorInfo = errs.NewErrorInfo(ErrCRLScheduleInvalid, fmt.Sprintf("Every: %s CRL Validity: %s", request.Every, request.Validity))
+		return
+	}
+	if errorInfo = generateCRL(request.CADirectory, request.Validity); errorInfo.Error != nil {
+		return
+	}
+	if request.Every == 0 && request.ServeAddress == ctv.VAL_EMPTY {
+		return
+	}
+
+	tContext, tStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer tStop()
+
+	if request.ServeAddress != ctv.VAL_EMPTY {
+		if tListener, errorInfo.Error = net.Listen("tcp", request.ServeAddress); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Serve Address: %s", request.ServeAddress))
+			return
+		}
+		tServerPtr = &http.Server{Handler: crlHandler(request.CADirectory), ReadHeaderTimeout: HTTP_READ_HEADER_TIMEOUT}
+		go func() {
+			if tErr := tServerPtr.Serve(tListener); tErr != nil && errors.Is(tErr, http.ErrServerClosed) == false {
+				errs.PrintErrorInfo(errs.NewErrorInfo(tErr, fmt.Sprintf("Serve Address: %s", request.ServeAddress)))
+				tStop()
+			}
+		}()
+		fmt.Printf("Serving the CRL at http://%s/%s and http://%s/%s\n", tListener.Addr(), FILE_CRL_DER, tListener.Addr(), FILE_CRL_PEM)
+	}
+
+	if request.Every > 0 {
+		tTicker := time.NewTicker(request.Every)
+		defer tTicker.Stop()
+		for tRunning := true; tRunning; {
+			select {
+			case <-tContext.Done():
+				tRunning = false
+			case <-tTicker.C:
+				// A failure is reported and the next tick tries again, while the last CRL is still valid.
+				if tErrorInfo := generateCRL(request.CADirectory, request.Validity); tErrorInfo.Error != nil {
+					errs.PrintErrorInfo(tErrorInfo)
+				}
+			}
+		}
+	} else {
+		<-tContext.Done()
+	}
+
+	if tServerPtr != nil {
+		tShutdownContext, tCancel := context.WithTimeout(context.Background(), HTTP_SHUTDOWN_TIMEOUT)
+		defer tCancel()
+		_ = tServerPtr.Shutdown(tShutdownContext)
+	}
+
+	return
+}
+
+// generateCRL - signs a version 2 CRL with the intermediate CA, listing every revoked certificate in the database that has
+// not expired, with its revocation time and reason. Each CRL has the next CRL number, which is kept in the CA directory. The
+// CRL is written as DER and PEM.
+//
+//	Customer Messages: None
+//	Errors: errors returned by loadAuthority, lockDatabase, readDatabase, readCRLNumber, x509, certs.WriteOutFile and writeOutPEMFile
+//	Verifications: None
+func generateCRL(caDirectory string, validity time.Duration) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tAuthorityPtr *authority
+		tCRLPtr       *x509.RevocationList
+		tDatabasePtr  *database
+		tDER          []byte
+		tNow          = time.Now().UTC().Truncate(time.Second)
+		tNumber       *big.Int
+		tUnlock       func()
+	)
+
+	if tAuthorityPtr, errorInfo = loadAuthority(caDirectory); errorInfo.Error != nil {
+		return
+	}
+	if tUnlock, errorInfo = lockDatabase(caDirectory); errorInfo.Error != nil {
+		return
+	}
+	defer tUnlock()
+	if tDatabasePtr, errorInfo = readDatabase(caDirectory); errorInfo.Error != nil {
+		return
+	}
+	if tNumber, errorInfo = readCRLNumber(caDirectory); errorInfo.Error != nil {
+		return
+	}
+
+	tTemplate := x509.RevocationList{
+		Number:     tNumber,
+		ThisUpdate: tNow,
+		NextUpdate: tNow.Add(validity),
+	}
+	for _, tRecord := range tDatabasePtr.Records {
+		// RFC 5280 lets an expired certificate leave the CRL, which keeps it from growing forever.
+		if tRecord.Status == STATUS_REVOKED && tRecord.NotAfter.After(tNow) {
+			tTemplate.RevokedCertificateEntries = append(tTemplate.RevokedCertificateEntries, x509.RevocationListEntry{
+				SerialNumber:   tRecord.Serial,
+				RevocationTime: tRecord.RevokedAt,
+				ReasonCode:     tRecord.Reason,
+			})
+		}
+	}
+
+	if tDER, errorInfo.Error = x509.CreateRevocationList(rand.Reader, &tTemplate, tAuthorityPtr.Intermediate, tAuthorityPtr.IntermediateKey); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("CRL Number: %s", tNumber))
+		return
+	}
+	if tCRLPtr, errorInfo.Error = x509.ParseRevocationList(tDER); errorInfo.Error == nil {
+		errorInfo.Error = tCRLPtr.CheckSignatureFrom(tAuthorityPtr.Intermediate)
+	}
+	if errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("CRL Number: %s", tNumber))
+		return
+	}
+
+	if errorInfo = certs.WriteOutFile(filepath.Join(caDirectory, FILE_CRL_DER), tDER, PUBLIC_FILE_PERMISSIONS); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writeOutPEMFile(filepath.Join(caDirectory, FILE_CRL_PEM), tDER, PEM_X509_CRL, PUBLIC_FILE_PERMISSIONS); errorInfo.Error != nil {
+		return
+	}
+	// Like OpenSSL, the file holds the number of the next CRL.
+	if errorInfo = certs.WriteOutFile(filepath.Join(caDirectory, FILE_CRL_NUMBER), []byte(serialHex(new(big.Int).Add(tNumber, big.NewInt(1)))+"\n"), PUBLIC_FILE_PERMISSIONS); errorInfo.Error != nil {
+		return
+	}
+
+	fmt.Printf("%s CRL %s generated with %d revoked certificate(s). Next Update: %s\n", tNow.Format(time.RFC3339), serialHex(tNumber),
+		len(tTemplate.RevokedCertificateEntries), tTemplate.NextUpdate.Format(time.RFC3339))
+
+	return
+}
+
+// readCRLNumber - the number of the next CRL, in hex, from the CA directory. A missing file is the first CRL, number 1.
+//
+//	Customer Messages: None
+//	Errors: ErrCRLNumberInvalid, errors returned by os
+//	Verifications: None
+func readCRLNumber(caDirectory string) (number *big.Int, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData      []byte
+		tNumberFQN = filepath.Join(caDirectory, FILE_CRL_NUMBER)
+		ok         bool
+	)
+
+	if tData, errorInfo.Error = os.ReadFile(tNumberFQN); errors.Is(errorInfo.Error, os.ErrNotExist) {
+		errorInfo.Error = nil
+		return big.NewInt(1), errorInfo
+	}
+	if errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("CRL Number File: %s", tNumberFQN))
+		return
+	}
+	if number, ok = parseSerial(strings.TrimSpace(string(tData))); ok == false {
+		errorInfo = errs.NewErrorInfo(ErrCRLNumberInvalid, fmt.Sprintf("CRL Number File: %s", tNumberFQN))
+	}
+
+	return
+}
+
+// crlHandler - serves the CRL files from the CA directory. They are read for each request, so a CRL generated by another
+// process is served as soon as it is written.
+func crlHandler(caDirectory string) http.Handler {
+
+	tMux := http.NewServeMux()
+	for tFileName, tContentType := range map[string]string{FILE_CRL_DER: CONTENT_TYPE_CRL, FILE_CRL_PEM: CONTENT_TYPE_PEM} {
+		tFQN, tContentType := filepath.Join(caDirectory, tFileName), tContentType
+		tMux.HandleFunc("GET /"+tFileName, func(w http.ResponseWriter, r *http.Request) {
+			tData, tErr := os.ReadFile(tFQN)
+			if tErr != nil {
+				http.Error(w, "The CRL is not available.", http.StatusServiceUnavailable)
+				return
+			}
+			tModified := time.Time{}
+			if tInfo, tErr := os.Stat(tFQN); tErr == nil {
+				tModified = tInfo.ModTime()
+			}
+			w.Header().Set("Content-Type", tContentType)
+			http.ServeContent(w, r, tFileName, tModified, bytes.NewReader(tData))
+		})
+	}
+
+	return tMux
+}
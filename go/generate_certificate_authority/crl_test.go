@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const (
+	TEST_CRL_VALIDITY = time.Hour
+)
+
+// readTestCRL - the DER CRL in the CA directory, parsed and checked against the intermediate's signature.
+func readTestCRL(t *testing.T, authorityPtr *authority) (crlPtr *x509.RevocationList) {
+
+	tDER, tErr := os.ReadFile(filepath.Join(authorityPtr.Directory, FILE_CRL_DER))
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	if crlPtr, tErr = x509.ParseRevocationList(tDER); tErr != nil {
+		t.Fatalf("ParseRevocationList: %s", tErr)
+	}
+	if tErr = crlPtr.CheckSignatureFrom(authorityPtr.Intermediate); tErr != nil {
+		t.Fatalf("the CRL is not signed by the intermediate: %s", tErr)
+	}
+
+	return
+}
+
+// TestGenerateCRL - the CRL lists the revoked certificates with their reasons, and not the valid one, and each CRL has the
+// next number.
+func TestGenerateCRL(t *testing.T) {
+
+	var (
+		tAuthorityPtr = newTestAuthority(t, "CRL Test")
+		tReasons      = make(map[string]int)
+	)
+
+	issueTestCertificate(t, tAuthorityPtr, "good.example.com")
+	for _, tRevoke := range []struct {
+		name   string
+		reason string
+		code   int
+	}{
+		{name: "compromised.example.com", reason: "keyCompromise", code: 1},
+		{name: "superseded.example.com", reason: "superseded", code: 4},
+	} {
+		tCertificatePtr := issueTestCertificate(t, tAuthorityPtr, tRevoke.name)
+		if tErrorInfo := revokeCertificate(tAuthorityPtr.Directory, serialHex(tCertificatePtr.SerialNumber), tRevoke.reason); tErrorInfo.Error != nil {
+			t.Fatalf("revokeCertificate: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+		}
+		tReasons[serialHex(tCertificatePtr.SerialNumber)] = tRevoke.code
+	}
+
+	for tNumber := int64(1); tNumber <= 2; tNumber++ {
+		if tErrorInfo := generateCRL(tAuthorityPtr.Directory, TEST_CRL_VALIDITY); tErrorInfo.Error != nil {
+			t.Fatalf("generateCRL: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+		}
+
+		tCRLPtr := readTestCRL(t, tAuthorityPtr)
+		if tCRLPtr.Number.Cmp(big.NewInt(tNumber)) != 0 {
+			t.Errorf("CRL number = %s, want %d", tCRLPtr.Number, tNumber)
+		}
+		if tCRLPtr.NextUpdate.Sub(tCRLPtr.ThisUpdate) != TEST_CRL_VALIDITY {
+			t.Errorf("next update is %s after this update, want %s", tCRLPtr.NextUpdate.Sub(tCRLPtr.ThisUpdate), TEST_CRL_VALIDITY)
+		}
+		if len(tCRLPtr.RevokedCertificateEntries) != len(tReasons) {
+			t.Errorf("the CRL lists %d certificates, want %d", len(tCRLPtr.RevokedCertificateEntries), len(tReasons))
+		}
+		for _, tEntry := range tCRLPtr.RevokedCertificateEntries {
+			if tCode, ok := tReasons[serialHex(tEntry.SerialNumber)]; ok == false || tEntry.ReasonCode != tCode {
+				t.Errorf("CRL entry %s has reason %d, want a revoked certificate with its reason", serialHex(tEntry.SerialNumber), tEntry.ReasonCode)
+			}
+		}
+
+		tPEM, tErr := os.ReadFile(filepath.Join(tAuthorityPtr.Directory, FILE_CRL_PEM))
+		if tErr != nil {
+			t.Fatal(tErr)
+		}
+		if tBlockPtr, _ := pem.Decode(tPEM); tBlockPtr == nil || tBlockPtr.Type != PEM_X509_CRL || bytes.Equal(tBlockPtr.Bytes, tCRLPtr.Raw) == false {
+			t.Errorf("%s does not hold the DER CRL", FILE_CRL_PEM)
+		}
+	}
+
+	tNextNumber, tErrorInfo := readCRLNumber(tAuthorityPtr.Directory)
+	if tErrorInfo.Error != nil || tNextNumber.Cmp(big.NewInt(3)) != 0 {
+		t.Errorf("readCRLNumber = %v, %v, want 3", tNextNumber, tErrorInfo.Error)
+	}
+}
+
+// TestRunCRLSchedule - a new CRL must be out before the last one expires, so every must be less than the validity.
+func TestRunCRLSchedule(t *testing.T) {
+
+	tAuthorityPtr := newTestAuthority(t, "CRL Schedule Test")
+
+	for _, tCase := range []struct {
+		name     string
+		every    time.Duration
+		validity time.Duration
+		wantErr  error
+	}{
+		{name: "once", every: 0, validity: TEST_CRL_VALIDITY},
+		{name: "no validity", every: 0, validity: 0, wantErr: ErrCRLScheduleInvalid},
+		{name: "negative every", every: -time.Minute, validity: TEST_CRL_VALIDITY, wantErr: ErrCRLScheduleInvalid},
+		{name: "every equal to the validity", every: TEST_CRL_VALIDITY, validity: TEST_CRL_VALIDITY, wantErr: ErrCRLScheduleInvalid},
+		{name: "every over the validity", every: 2 * TEST_CRL_VALIDITY, validity: TEST_CRL_VALIDITY, wantErr: ErrCRLScheduleInvalid},
+	} {
+		tErrorInfo := runCRL(crlRequest{CADirectory: tAuthorityPtr.Directory, Every: tCase.every, Validity: tCase.validity})
+		switch {
+		case tCase.wantErr == nil && tErrorInfo.Error != nil:
+			t.Errorf("%s: runCRL: %s %s", tCase.name, tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+		case tCase.wantErr != nil && errors.Is(tErrorInfo.Error, tCase.wantErr) == false:
+			t.Errorf("%s: runCRL error = %v, want %s", tCase.name, tErrorInfo.Error, tCase.wantErr)
+		}
+	}
+
+	// Only the valid schedule generated a CRL.
+	if tCRLPtr := readTestCRL(t, tAuthorityPtr); tCRLPtr.Number.Cmp(big.NewInt(1)) != 0 {
+		t.Errorf("CRL number = %s, want 1", tCRLPtr.Number)
+	}
+}
+
+// TestCRLHandler - both files are served with their content types, and read for each request, so a CRL written after the
+// handler was made is served at once.
+func TestCRLHandler(t *testing.T) {
+
+	var (
+		tAuthorityPtr = newTestAuthority(t, "CRL Handler Test")
+		tServerPtr    = httptest.NewServer(crlHandler(tAuthorityPtr.Directory))
+	)
+
+	defer tServerPtr.Close()
+
+	tGet := func(path string) (statusCode int, contentType string, body []byte) {
+		tResponsePtr, tErr := http.Get(tServerPtr.URL + path)
+		if tErr != nil {
+			t.Fatal(tErr)
+		}
+		defer tResponsePtr.Body.Close()
+		if body, tErr = io.ReadAll(tResponsePtr.Body); tErr != nil {
+			t.Fatal(tErr)
+		}
+		return tResponsePtr.StatusCode, tResponsePtr.Header.Get("Content-Type"), body
+	}
+
+	if tStatusCode, _, _ := tGet("/" + FILE_CRL_DER); tStatusCode != http.StatusServiceUnavailable {
+		t.Errorf("GET before a CRL was generated = %d, want %d", tStatusCode, http.StatusServiceUnavailable)
+	}
+
+	if tErrorInfo := generateCRL(tAuthorityPtr.Directory, TEST_CRL_VALIDITY); tErrorInfo.Error != nil {
+		t.Fatalf("generateCRL: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+	for tFileName, tContentType := range map[string]string{FILE_CRL_DER: CONTENT_TYPE_CRL, FILE_CRL_PEM: CONTENT_TYPE_PEM} {
+		tWant, tErr := os.ReadFile(filepath.Join(tAuthorityPtr.Directory, tFileName))
+		if tErr != nil {
+			t.Fatal(tErr)
+		}
+		tStatusCode, tGotContentType, tBody := tGet("/" + tFileName)
+		if tStatusCode != http.StatusOK || tGotContentType != tContentType || bytes.Equal(tBody, tWant) == false {
+			t.Errorf("GET /%s = %d %s with %d bytes, want %d %s with the file", tFileName, tStatusCode, tGotContentType, len(tBody), http.StatusOK, tContentType)
+		}
+	}
+
+	if tStatusCode, _, _ := tGet("/" + FILE_CRL_NUMBER); tStatusCode != http.StatusNotFound {
+		t.Errorf("GET /%s = %d, want %d", FILE_CRL_NUMBER, tStatusCode, http.StatusNotFound)
+	}
+	tResponsePtr, tErr := http.Post(tServerPtr.URL+"/"+FILE_CRL_DER, CONTENT_TYPE_CRL, nil)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	tResponsePtr.Body.Close()
+	if tResponsePtr.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST /%s = %d, want %d", FILE_CRL_DER, tResponsePtr.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+var (
+	// revocationReasons - the RFC 5280 section 5.3.1 reason codes a certificate can be revoked with, by the names OpenSSL uses.
+	// removeFromCRL (8) is left out, because it is only for delta CRLs.
+	revocationReasons = map[int]string{
+		0:  "unspecified",
+		1:  "keyCompromise",
+		2:  "CACompromise",
+		3:  "affiliationChanged",
+		4:  "superseded",
+		5:  "cessationOfOperation",
+		6:  "certificateHold",
+		9:  "privilegeWithdrawn",
+		10: "AACompromise",
+	}
+	// subjectShortNames - the attribute names OpenSSL uses for a subject in the index.
+	subjectShortNames = map[string]string{
+		"2.5.4.3":              "CN",
+		"2.5.4.5":              "serialNumber",
+		"2.5.4.6":              "C",
+		"2.5.4.7":              "L",
+		"2.5.4.8":              "ST",
+		"2.5.4.9":              "street",
+		"2.5.4.10":             "O",
+		"2.5.4.11":             "OU",
+		"2.5.4.17":             "postalCode",
+		"1.2.840.113549.1.9.1": "emailAddress",
+	}
+)
+
+// database - the certificates the intermediate CA has issued, read from the index file in the CA directory.
+type database struct {
+	Directory string
+	Records   []record
+}
+
+// record - one issued certificate. It is one line of the index, with the six tab separated columns of an OpenSSL CA index
+// (status, expiry, revocation, serial, file name and subject) followed by the not before time, the profile and the subject
+// alternative names.
+type record struct {
+	FileName  string // The certificate file, relative to the CA directory.
+	NotAfter  time.Time
+	NotBefore time.Time
+	Profile   string
+	Reason    int       // A key of revocationReasons. Only set when revoked.
+	RevokedAt time.Time // Only set when revoked.
+	SANs      []string  // DNS:, IP:, email: and URI: names.
+	Serial    *big.Int
+	Status    string // STATUS_VALID or STATUS_REVOKED. STATUS_EXPIRED is worked out from NotAfter.
+	Subject   string // In the OpenSSL form, such as /C=US/O=STY Holdings Inc/CN=nats.example.com.
+}
+
+// lockDatabase - takes an exclusive flock on the lock file in the CA directory, so only one process changes the index at a
+// time. The kernel drops the lock when the holder exits, so a process that is killed never leaves the index locked. The
+// holder's pid is written to the file to show who has it. The lock is released by calling unlock. The file is left in
+// place, because removing it would let a second process lock a new file while a third still waits on the old one.
+//
+//	Customer Messages: None
+//	Errors: ErrDatabaseLocked, errors returned by os and syscall
+//	Verifications: None
+func lockDatabase(caDirectory string) (unlock func(), errorInfo errs.ErrorInfo) {
+
+	var (
+		tDeadline = time.Now().Add(DATABASE_LOCK_TIMEOUT)
+		tFilePtr  *os.File
+		tLockFQN  = filepath.Join(caDirectory, FILE_INDEX_LOCK)
+	)
+
+	if tFilePtr, errorInfo.Error = os.OpenFile(tLockFQN, os.O_CREATE|os.O_RDWR, PRIVATE_FILE_PERMISSIONS); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Lock File: %s", tLockFQN))
+		return
+	}
+
+	for {
+		if errorInfo.Error = syscall.Flock(int(tFilePtr.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); errorInfo.Error == nil {
+			break
+		}
+		if errors.Is(errorInfo.Error, syscall.EWOULDBLOCK) == false && errors.Is(errorInfo.Error, syscall.EINTR) == false {
+			_ = tFilePtr.Close()
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Lock File: %s", tLockFQN))
+			return
+		}
+		if time.Now().After(tDeadline) {
+			_ = tFilePtr.Close()
+			errorInfo = errs.NewErrorInfo(ErrDatabaseLocked, fmt.Sprintf("Lock File: %s Holder: %s", tLockFQN, lockHolder(tLockFQN)))
+			return
+		}
+		time.Sleep(DATABASE_LOCK_RETRY)
+	}
+
+	if errorInfo.Error = tFilePtr.Truncate(0); errorInfo.Error == nil {
+		_, errorInfo.Error = tFilePtr.WriteAt([]byte(fmt.Sprintf("%d\n", os.Getpid())), 0)
+	}
+	if errorInfo.Error != nil {
+		_ = tFilePtr.Close()
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Lock File: %s", tLockFQN))
+		return
+	}
+
+	return func() {
+		_ = syscall.Flock(int(tFilePtr.Fd()), syscall.LOCK_UN)
+		_ = tFilePtr.Close()
+	}, errorInfo
+}
+
+// lockHolder - the pid written to the lock file, for the error when the lock is not released in time.
+func lockHolder(lockFQN string) string {
+
+	tData, _ := os.ReadFile(lockFQN)
+	if tPID := strings.TrimSpace(string(tData)); tPID != ctv.VAL_EMPTY {
+		return "pid " + tPID
+	}
+
+	return "unknown"
+}
+
+// readDatabase - reads the index in the CA directory. A missing index is an empty database.
+//
+//	Customer Messages: None
+//	Errors: ErrDatabaseInvalid, errors returned by os
+//	Verifications: None
+func readDatabase(caDirectory string) (databasePtr *database, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData     []byte
+		tIndexFQN = filepath.Join(caDirectory, FILE_INDEX)
+		tRecord   record
+	)
+
+	databasePtr = &database{Directory: caDirectory}
+	if tData, errorInfo.Error = os.ReadFile(tIndexFQN); errors.Is(errorInfo.Error, os.ErrNotExist) {
+		errorInfo.Error = nil
+		return
+	}
+	if errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Index File: %s", tIndexFQN))
+		return
+	}
+
+	for tLineNumber, tLine := range strings.Split(strings.TrimRight(string(tData), "\n"), "\n") {
+		if tLine == ctv.VAL_EMPTY {
+			continue
+		}
+		if tRecord, errorInfo.Error = parseRecord(tLine); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(ErrDatabaseInvalid, fmt.Sprintf("Index File: %s Line: %d Error: %s", tIndexFQN, tLineNumber+1, errorInfo.Error))
+			return
+		}
+		databasePtr.Records = append(databasePtr.Records, tRecord)
+	}
+
+	return
+}
+
+// add - records a newly issued certificate. A serial number that is already in the database is refused.
+//
+//	Customer Messages: None
+//	Errors: ErrSerialDuplicate
+//	Verifications: None
+func (d *database) add(certificatePtr *x509.Certificate, fileName string, profileName string) (errorInfo errs.ErrorInfo) {
+
+	if d.find(certificatePtr.SerialNumber) >= 0 {
+		errorInfo = errs.NewErrorInfo(ErrSerialDuplicate, fmt.Sprintf("Serial Number: %s", serialHex(certificatePtr.SerialNumber)))
+		return
+	}
+
+	d.Records = append(d.Records, record{
+		FileName:  fileName,
+		NotAfter:  certificatePtr.NotAfter,
+		NotBefore: certificatePtr.NotBefore,
+		Profile:   profileName,
+		SANs:      certificateSANs(certificatePtr),
+		Serial:    certificatePtr.SerialNumber,
+		Status:    STATUS_VALID,
+		Subject:   opensslName(certificatePtr.Subject),
+	})
+
+	return
+}
+
+// find - the index of the record with the serial number, or -1.
+func (d *database) find(serialNumber *big.Int) int {
+
+	for tIndex, tRecord := range d.Records {
+		if tRecord.Serial.Cmp(serialNumber) == 0 {
+			return tIndex
+		}
+	}
+
+	return -1
+}
+
+// revoke - marks the certificate revoked at the time, for the reason.
+//
+//	Customer Messages: None
+//	Errors: ErrAlreadyRevoked, ErrSerialNotFound
+//	Verifications: None
+func (d *database) revoke(serialNumber *big.Int, reason int, revokedAt time.Time) (errorInfo errs.ErrorInfo) {
+
+	tIndex := d.find(serialNumber)
+	switch {
+	case tIndex < 0:
+		errorInfo = errs.NewErrorInfo(ErrSerialNotFound, fmt.Sprintf("Serial Number: %s", serialHex(serialNumber)))
+		return
+	case d.Records[tIndex].Status == STATUS_REVOKED:
+		errorInfo = errs.NewErrorInfo(ErrAlreadyRevoked, fmt.Sprintf("Serial Number: %s Revoked: %s", serialHex(serialNumber), d.Records[tIndex].RevokedAt.Format(time.RFC3339)))
+		return
+	}
+
+	d.Records[tIndex].Status = STATUS_REVOKED
+	d.Records[tIndex].RevokedAt = revokedAt.UTC().Truncate(time.Second)
+	d.Records[tIndex].Reason = reason
+
+	return
+}
+
+// write - replaces the index with the records. The caller must hold the lock.
+//
+//	Customer Messages: None
+//	Errors: errors returned by certs.WriteOutFile
+//	Verifications: None
+func (d *database) write() (errorInfo errs.ErrorInfo) {
+
+	var (
+		tBuffer bytes.Buffer
+	)
+
+	for _, tRecord := range d.Records {
+		tBuffer.WriteString(tRecord.line())
+		tBuffer.WriteByte('\n')
+	}
+
+	return certs.WriteOutFile(filepath.Join(d.Directory, FILE_INDEX), tBuffer.Bytes(), PUBLIC_FILE_PERMISSIONS)
+}
+
+// line - the record as a line of the index, without the newline.
+func (r record) line() string {
+
+	var (
+		tRevocation string
+	)
+
+	if r.Status == STATUS_REVOKED {
+		tRevocation = formatIndexTime(r.RevokedAt) + "," + revocationReasons[r.Reason]
+	}
+
+	return strings.Join([]string{
+		r.Status,
+		formatIndexTime(r.NotAfter),
+		tRevocation,
+		serialHex(r.Serial),
+		r.FileName,
+		indexField(r.Subject),
+		formatIndexTime(r.NotBefore),
+		indexField(r.Profile),
+		indexField(joinSANs(r.SANs)),
+	}, "\t")
+}
+
+// status - STATUS_EXPIRED for a valid certificate that has expired, otherwise the recorded status.
+func (r record) status(now time.Time) string {
+
+	if r.Status == STATUS_VALID && now.After(r.NotAfter) {
+		return STATUS_EXPIRED
+	}
+
+	return r.Status
+}
+
+// parseRecord - a line of the index.
+func parseRecord(line string) (record record, err error) {
+
+	var (
+		ok bool
+	)
+
+	tFields := strings.Split(line, "\t")
+	if len(tFields) != INDEX_COLUMNS {
+		return record, fmt.Errorf("%d columns, expected %d", len(tFields), INDEX_COLUMNS)
+	}
+
+	record.Status, record.FileName, record.Subject, record.Profile = tFields[0], tFields[4], tFields[5], tFields[7]
+	if record.Status != STATUS_VALID && record.Status != STATUS_REVOKED && record.Status != STATUS_EXPIRED {
+		return record, fmt.Errorf("status %q", record.Status)
+	}
+	// OpenSSL marks expired certificates E. Expiry is worked out from the date here, so it is read as valid.
+	if record.Status == STATUS_EXPIRED {
+		record.Status = STATUS_VALID
+	}
+	if record.NotAfter, err = parseIndexTime(tFields[1]); err != nil {
+		return
+	}
+	if record.Status == STATUS_REVOKED {
+		tRevokedAt, tReason, _ := strings.Cut(tFields[2], ",")
+		if record.RevokedAt, err = parseIndexTime(tRevokedAt); err != nil {
+			return
+		}
+		if record.Reason, ok = parseReason(tReason); ok == false {
+			return record, fmt.Errorf("revocation reason %q", tReason)
+		}
+	}
+	if record.Serial, ok = parseSerial(tFields[3]); ok == false {
+		return record, fmt.Errorf("serial number %q", tFields[3])
+	}
+	if record.NotBefore, err = parseIndexTime(tFields[6]); err != nil {
+		return
+	}
+	if tFields[8] != ctv.VAL_EMPTY {
+		record.SANs = splitSANs(tFields[8])
+	}
+
+	return
+}
+
+// parseReason - a reason name, in any case, or code. An empty reason is unspecified.
+func parseReason(value string) (reason int, ok bool) {
+
+	if value == ctv.VAL_EMPTY {
+		return 0, true
+	}
+	for tCode, tName := range revocationReasons {
+		if strings.EqualFold(tName, value) || fmt.Sprint(tCode) == value {
+			return tCode, true
+		}
+	}
+
+	return
+}
+
+// parseSerial - a serial number in hex, with or without colons.
+func parseSerial(value string) (serialNumber *big.Int, ok bool) {
+
+	serialNumber, ok = new(big.Int).SetString(strings.ReplaceAll(value, ":", ""), 16)
+	if ok && serialNumber.Sign() <= 0 {
+		ok = false
+	}
+
+	return
+}
+
+// serialHex - the serial number in upper case hex with an even number of digits, as OpenSSL writes it.
+func serialHex(serialNumber *big.Int) (value string) {
+
+	value = strings.ToUpper(serialNumber.Text(16))
+	if len(value)%2 == 1 {
+		value = "0" + value
+	}
+
+	return
+}
+
+// formatIndexTime - UTCTime (YYMMDDHHMMSSZ) before 2050 and GeneralizedTime (YYYYMMDDHHMMSSZ) from then, as in a certificate.
+func formatIndexTime(value time.Time) string {
+
+	value = value.UTC()
+	if value.Year() < 2050 {
+		return value.Format("060102150405Z")
+	}
+
+	return value.Format("20060102150405Z")
+}
+
+// parseIndexTime - the reverse of formatIndexTime.
+func parseIndexTime(value string) (time.Time, error) {
+
+	if len(value) == len("060102150405Z") {
+		return time.Parse("060102150405Z", value)
+	}
+
+	return time.Parse("20060102150405Z", value)
+}
+
+// indexField - a value with the tabs and newlines that would break the index replaced by spaces.
+func indexField(value string) string {
+
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(value)
+}
+
+// joinSANs - the names separated by commas. A comma or backslash in a name, which a URI can hold, is escaped with a backslash.
+func joinSANs(sans []string) string {
+
+	var (
+		tEscaped = make([]string, len(sans))
+		tEscaper = strings.NewReplacer("\\", "\\\\", ",", "\\,")
+	)
+
+	for tIndex, tSAN := range sans {
+		tEscaped[tIndex] = tEscaper.Replace(tSAN)
+	}
+
+	return strings.Join(tEscaped, ",")
+}
+
+// splitSANs - the reverse of joinSANs.
+func splitSANs(value string) (sans []string) {
+
+	var (
+		tBuilder strings.Builder
+		tEscaped bool
+	)
+
+	for _, tRune := range value {
+		switch {
+		case tEscaped:
+			tBuilder.WriteRune(tRune)
+			tEscaped = false
+		case tRune == '\\':
+			tEscaped = true
+		case tRune == ',':
+			sans = append(sans, tBuilder.String())
+			tBuilder.Reset()
+		default:
+			tBuilder.WriteRune(tRune)
+		}
+	}
+
+	return append(sans, tBuilder.String())
+}
+
+// certificateSANs - the subject alternative names in the DNS:, IP:, email: and URI: form.
+func certificateSANs(certificatePtr *x509.Certificate) (sans []string) {
+
+	for _, tName := range certificatePtr.DNSNames {
+		sans = append(sans, "DNS:"+tName)
+	}
+	for _, tIP := range certificatePtr.IPAddresses {
+		sans = append(sans, "IP:"+tIP.String())
+	}
+	for _, tEmail := range certificatePtr.EmailAddresses {
+		sans = append(sans, "email:"+tEmail)
+	}
+	for _, tURLPtr := range certificatePtr.URIs {
+		sans = append(sans, "URI:"+tURLPtr.String())
+	}
+
+	return
+}
+
+// opensslName - the name in the /type=value form OpenSSL writes to its index, in the order it is encoded.
+func opensslName(name pkix.Name) string {
+
+	var (
+		tBuilder strings.Builder
+	)
+
+	for _, tRDN := range name.ToRDNSequence() {
+		for _, tAttribute := range tRDN {
+			tType, ok := subjectShortNames[tAttribute.Type.String()]
+			if ok == false {
+				tType = tAttribute.Type.String()
+			}
+			tBuilder.WriteString("/" + tType + "=" + strings.ReplaceAll(fmt.Sprint(tAttribute.Value), "/", "\\/"))
+		}
+	}
+
+	return tBuilder.String()
+}
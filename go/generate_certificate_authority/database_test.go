@@ -0,0 +1,271 @@
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	TEST_WAIT = 5 * time.Second
+)
+
+func TestRecordRoundTrip(t *testing.T) {
+
+	var (
+		tNotBefore = time.Date(2025, 1, 31, 12, 0, 0, 0, time.UTC)
+	)
+
+	for _, tCase := range []struct {
+		name   string
+		record record
+	}{
+		{
+			name: "valid with names",
+			record: record{
+				FileName:  "certs/0A1B2C.pem",
+				NotAfter:  tNotBefore.AddDate(0, 0, 90),
+				NotBefore: tNotBefore,
+				Profile:   PROFILE_SERVER,
+				SANs:      []string{"DNS:nats.example.com", "IP:10.0.0.5", "email:ops@example.com", "URI:spiffe://example.com/nats"},
+				Serial:    big.NewInt(0x0A1B2C),
+				Status:    STATUS_VALID,
+				Subject:   "/C=US/O=STY Holdings Inc/CN=nats.example.com",
+			},
+		},
+		{
+			name: "revoked for key compromise",
+			record: record{
+				FileName:  "certs/01.pem",
+				NotAfter:  tNotBefore.AddDate(1, 0, 0),
+				NotBefore: tNotBefore,
+				Profile:   PROFILE_CLIENT,
+				Reason:    1,
+				RevokedAt: tNotBefore.Add(36 * time.Hour),
+				SANs:      []string{"email:client@example.com"},
+				Serial:    big.NewInt(1),
+				Status:    STATUS_REVOKED,
+				Subject:   "/CN=client",
+			},
+		},
+		{
+			name: "revoked unspecified without names",
+			record: record{
+				FileName:  "certs/FF00.pem",
+				NotAfter:  tNotBefore.AddDate(0, 1, 0),
+				NotBefore: tNotBefore,
+				Profile:   PROFILE_PEER,
+				RevokedAt: tNotBefore.Add(time.Hour),
+				Serial:    big.NewInt(0xFF00),
+				Status:    STATUS_REVOKED,
+				Subject:   "/O=Example\\/Sub/CN=peer",
+			},
+		},
+		{
+			name: "names with a comma and a backslash",
+			record: record{
+				FileName:  "certs/0B.pem",
+				NotAfter:  tNotBefore.AddDate(0, 0, 30),
+				NotBefore: tNotBefore,
+				Profile:   PROFILE_CLIENT,
+				SANs:      []string{"URI:https://example.com/a,b", "URI:https://example.com/c\\d,", "DNS:client.example.com"},
+				Serial:    big.NewInt(0x0B),
+				Status:    STATUS_VALID,
+				Subject:   "/CN=client.example.com",
+			},
+		},
+		{
+			name: "not after from 2050 in GeneralizedTime",
+			record: record{
+				FileName:  "certs/7FFFFFFFFFFFFFFF.pem",
+				NotAfter:  time.Date(2060, 6, 1, 0, 0, 0, 0, time.UTC),
+				NotBefore: tNotBefore,
+				Profile:   PROFILE_SERVER,
+				SANs:      []string{"DNS:long.example.com"},
+				Serial:    new(big.Int).SetUint64(0x7FFFFFFFFFFFFFFF),
+				Status:    STATUS_VALID,
+				Subject:   "/CN=long.example.com",
+			},
+		},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			tLine := tCase.record.line()
+			if strings.Count(tLine, "\t") != INDEX_COLUMNS-1 || strings.Contains(tLine, "\n") {
+				t.Fatalf("line() = %q, want %d tab separated columns on one line", tLine, INDEX_COLUMNS)
+			}
+			tParsed, tErr := parseRecord(tLine)
+			if tErr != nil {
+				t.Fatalf("parseRecord(%q): %s", tLine, tErr)
+			}
+			if reflect.DeepEqual(tParsed, tCase.record) == false {
+				t.Errorf("parseRecord(%q)\n = %+v\nwant %+v", tLine, tParsed, tCase.record)
+			}
+			if tAgain := tParsed.line(); tAgain != tLine {
+				t.Errorf("line() after parseRecord = %q, want %q", tAgain, tLine)
+			}
+		})
+	}
+}
+
+func TestParseRecordOpenSSLLines(t *testing.T) {
+
+	for _, tCase := range []struct {
+		name       string
+		line       string
+		wantStatus string
+		wantReason int
+		wantErr    bool
+	}{
+		{"expired is read as valid", "E\t240101000000Z\t\t0A\tcerts/0A.pem\t/CN=old\t230101000000Z\tserver\t", STATUS_VALID, 0, false},
+		{"reason by code", "R\t300101000000Z\t250101000000Z,4\t0B\tcerts/0B.pem\t/CN=x\t240101000000Z\tserver\t", STATUS_REVOKED, 4, false},
+		{"reason in another case", "R\t300101000000Z\t250101000000Z,KEYCOMPROMISE\t0C\tcerts/0C.pem\t/CN=x\t240101000000Z\tserver\t", STATUS_REVOKED, 1, false},
+		{"no reason", "R\t300101000000Z\t250101000000Z\t0D\tcerts/0D.pem\t/CN=x\t240101000000Z\tserver\t", STATUS_REVOKED, 0, false},
+		{"serial with colons", "V\t300101000000Z\t\t0A:1B\tcerts/0A1B.pem\t/CN=x\t240101000000Z\tserver\t", STATUS_VALID, 0, false},
+		{"six OpenSSL columns", "V\t300101000000Z\t\t0A\tunknown\t/CN=x", "", 0, true},
+		{"unknown status", "X\t300101000000Z\t\t0A\tcerts/0A.pem\t/CN=x\t240101000000Z\tserver\t", "", 0, true},
+		{"bad expiry", "V\t2030-01-01\t\t0A\tcerts/0A.pem\t/CN=x\t240101000000Z\tserver\t", "", 0, true},
+		{"bad revocation time", "R\t300101000000Z\tyesterday,superseded\t0A\tcerts/0A.pem\t/CN=x\t240101000000Z\tserver\t", "", 0, true},
+		{"removeFromCRL reason", "R\t300101000000Z\t250101000000Z,removeFromCRL\t0A\tcerts/0A.pem\t/CN=x\t240101000000Z\tserver\t", "", 0, true},
+		{"zero serial", "V\t300101000000Z\t\t00\tcerts/00.pem\t/CN=x\t240101000000Z\tserver\t", "", 0, true},
+		{"serial not hex", "V\t300101000000Z\t\tXYZ\tcerts/XYZ.pem\t/CN=x\t240101000000Z\tserver\t", "", 0, true},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			tRecord, tErr := parseRecord(tCase.line)
+			if tCase.wantErr {
+				if tErr == nil {
+					t.Fatalf("parseRecord(%q) = %+v, want an error", tCase.line, tRecord)
+				}
+				return
+			}
+			if tErr != nil {
+				t.Fatalf("parseRecord(%q): %s", tCase.line, tErr)
+			}
+			if tRecord.Status != tCase.wantStatus || tRecord.Reason != tCase.wantReason {
+				t.Errorf("parseRecord(%q) status %s reason %d, want %s %d", tCase.line, tRecord.Status, tRecord.Reason, tCase.wantStatus, tCase.wantReason)
+			}
+		})
+	}
+}
+
+func TestDatabaseAddRefusesDuplicateSerial(t *testing.T) {
+
+	var (
+		tDatabase = database{Directory: t.TempDir()}
+		tNow      = time.Now().UTC().Truncate(time.Second)
+	)
+
+	tCertificatePtr := &x509.Certificate{
+		DNSNames:     []string{"nats.example.com"},
+		IPAddresses:  []net.IP{net.ParseIP("10.0.0.5")},
+		NotAfter:     tNow.AddDate(0, 0, 90),
+		NotBefore:    tNow,
+		SerialNumber: big.NewInt(0x1234),
+		Subject:      pkix.Name{Organization: []string{"STY Holdings Inc"}, CommonName: "nats.example.com"},
+	}
+	if tErrorInfo := tDatabase.add(tCertificatePtr, "certs/1234.pem", PROFILE_SERVER); tErrorInfo.Error != nil {
+		t.Fatalf("add: %s", tErrorInfo.Error)
+	}
+
+	tDuplicatePtr := &x509.Certificate{NotAfter: tNow.AddDate(1, 0, 0), NotBefore: tNow, SerialNumber: big.NewInt(0x1234), Subject: pkix.Name{CommonName: "other"}}
+	if tErrorInfo := tDatabase.add(tDuplicatePtr, "certs/1234.pem", PROFILE_CLIENT); errors.Is(tErrorInfo.Error, ErrSerialDuplicate) == false {
+		t.Fatalf("add with a serial already in the database = %v, want %s", tErrorInfo.Error, ErrSerialDuplicate)
+	}
+	if len(tDatabase.Records) != 1 || tDatabase.Records[0].Subject != "/O=STY Holdings Inc/CN=nats.example.com" {
+		t.Fatalf("records after the refused add = %+v", tDatabase.Records)
+	}
+
+	// The duplicate is still refused once the database has been written and read back.
+	if tErrorInfo := tDatabase.write(); tErrorInfo.Error != nil {
+		t.Fatalf("write: %s", tErrorInfo.Error)
+	}
+	tReadPtr, tErrorInfo := readDatabase(tDatabase.Directory)
+	if tErrorInfo.Error != nil {
+		t.Fatalf("readDatabase: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+	if reflect.DeepEqual(tReadPtr.Records, tDatabase.Records) == false {
+		t.Errorf("records read back\n = %+v\nwant %+v", tReadPtr.Records, tDatabase.Records)
+	}
+	if tErrorInfo = tReadPtr.add(tDuplicatePtr, "certs/1234.pem", PROFILE_CLIENT); errors.Is(tErrorInfo.Error, ErrSerialDuplicate) == false {
+		t.Errorf("add after reading back = %v, want %s", tErrorInfo.Error, ErrSerialDuplicate)
+	}
+}
+
+func TestReadDatabaseInvalidLine(t *testing.T) {
+
+	tDirectory := t.TempDir()
+	if tErr := os.WriteFile(filepath.Join(tDirectory, FILE_INDEX), []byte("V\t300101000000Z\t\t0A\tunknown\t/CN=x\n"), PUBLIC_FILE_PERMISSIONS); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	if _, tErrorInfo := readDatabase(tDirectory); errors.Is(tErrorInfo.Error, ErrDatabaseInvalid) == false {
+		t.Errorf("readDatabase = %v, want %s", tErrorInfo.Error, ErrDatabaseInvalid)
+	}
+}
+
+// TestLockDatabaseLeftBehind - a lock file left by a process that was killed, holding a pid that is not running, does not
+// stop the next process.
+func TestLockDatabaseLeftBehind(t *testing.T) {
+
+	tDirectory := t.TempDir()
+	if tErr := os.WriteFile(filepath.Join(tDirectory, FILE_INDEX_LOCK), []byte("999999999\n"), PRIVATE_FILE_PERMISSIONS); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	tStart := time.Now()
+	tUnlock, tErrorInfo := lockDatabase(tDirectory)
+	if tErrorInfo.Error != nil {
+		t.Fatalf("lockDatabase: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+	defer tUnlock()
+	if tElapsed := time.Since(tStart); tElapsed > DATABASE_LOCK_RETRY {
+		t.Errorf("lockDatabase waited %s on a lock nobody holds", tElapsed)
+	}
+	if tData, _ := os.ReadFile(filepath.Join(tDirectory, FILE_INDEX_LOCK)); strings.TrimSpace(string(tData)) != strconv.Itoa(os.Getpid()) {
+		t.Errorf("lock file holds %q, want this process's pid", tData)
+	}
+}
+
+// TestLockDatabaseWaits - a second lock waits until the first is released.
+func TestLockDatabaseWaits(t *testing.T) {
+
+	var (
+		tAcquired = make(chan time.Time, 1)
+		tHold     = 4 * DATABASE_LOCK_RETRY
+	)
+
+	tDirectory := t.TempDir()
+	tUnlock, tErrorInfo := lockDatabase(tDirectory)
+	if tErrorInfo.Error != nil {
+		t.Fatalf("lockDatabase: %s", tErrorInfo.Error)
+	}
+
+	tStart := time.Now()
+	go func() {
+		tSecondUnlock, tErrorInfo := lockDatabase(tDirectory)
+		if tErrorInfo.Error == nil {
+			tSecondUnlock()
+		}
+		tAcquired <- time.Now()
+	}()
+
+	time.Sleep(tHold)
+	tUnlock()
+
+	select {
+	case tAt := <-tAcquired:
+		if tAt.Sub(tStart) < tHold {
+			t.Errorf("the second lock was taken after %s, while the first was still held", tAt.Sub(tStart))
+		}
+	case <-time.After(TEST_WAIT):
+		t.Fatal("the second lock was not taken after the first was released")
+	}
+}
@@ -0,0 +1,14 @@
+module generate_certificate_authority
+
+go 1.22.3
+
+require (
+	certificate_services v0.0.0-00010101000000-000000000000
+	github.com/integrii/flaggy v1.5.2
+	github.com/sty-holdings/sharedServices/v2024 v2024.37.0
+	github.com/youmark/pkcs8 v0.0.0-20240726163527-a2c0da244d78
+	golang.org/x/crypto v0.28.0
+	golang.org/x/net v0.30.0
+)
+
+replace certificate_services => ../certificate_services
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// issueRequest - the certificate signing request the issue command signs with the intermediate CA.
+type issueRequest struct {
+	CADirectory    string
+	CertificateFQN string // Without an extension. The certificate is written to .pem and with the intermediate to .fullchain.pem.
+	CSRFQN         string // The PEM certificate signing request, with its extension.
+	Profile        string // A key of profiles.
+	ValidDays      int
+}
+
+// issueCertificate - issues a certificate for the request's public key, subject and subject alternative names, with the key
+// usages of the profile, and records it in the database. The certificate is written with and without the intermediate, which
+// is the chain a TLS server sends, like authority.chain. The root is left out.
+//
+//	Customer Messages: None
+//	Errors: ErrProfileInvalid, ErrValidDaysInvalid, errors returned by readCSR, loadAuthority, authority.issue and
+//	writeCertificatesFile
+//	Verifications: None
+func issueCertificate(request issueRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tAuthorityPtr   *authority
+		tCertificatePtr *x509.Certificate
+		tCSRPtr         *x509.CertificateRequest
+		tNow            = time.Now()
+	)
+
+	tExtKeyUsage, ok := profiles[request.Profile]
+	switch {
+	case ok == false:
+		errorInfo = errs.NewErrorInfo(ErrProfileInvalid, fmt.Sprintf("Profile: %s", request.Profile))
+		return
+	case request.ValidDays < 1:
+		errorInfo = errs.NewErrorInfo(ErrValidDaysInvalid, fmt.Sprintf("Valid Days: %d", request.ValidDays))
+		return
+	}
+	if tCSRPtr, errorInfo = readCSR(request.CSRFQN); errorInfo.Error != nil {
+		return
+	}
+	if tAuthorityPtr, errorInfo = loadAuthority(request.CADirectory); errorInfo.Error != nil {
+		return
+	}
+
+	tTemplate := x509.Certificate{
+		RawSubject:     tCSRPtr.RawSubject,
+		DNSNames:       tCSRPtr.DNSNames,
+		EmailAddresses: tCSRPtr.EmailAddresses,
+		IPAddresses:    tCSRPtr.IPAddresses,
+		URIs:           tCSRPtr.URIs,
+		NotBefore:      tNow.Add(-BACKDATE),
+		NotAfter:       tNow.AddDate(0, 0, request.ValidDays),
+		KeyUsage:       certs.KeyUsageForKey(tCSRPtr.PublicKey),
+		ExtKeyUsage:    tExtKeyUsage,
+	}
+	if tCertificatePtr, errorInfo = tAuthorityPtr.issue(&tTemplate, tCSRPtr.PublicKey, request.Profile); errorInfo.Error != nil {
+		return
+	}
+
+	if errorInfo = writeCertificatesFile(request.CertificateFQN+EXTENSION_CERTIFICATE, []*x509.Certificate{tCertificatePtr}); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writeCertificatesFile(request.CertificateFQN+EXTENSION_FULL_CHAIN, []*x509.Certificate{tCertificatePtr, tAuthorityPtr.Intermediate}); errorInfo.Error != nil {
+		return
+	}
+
+	fmt.Println("The certificate has been issued successfully.")
+	fmt.Printf("%sSubject: %s\n", ctv.SPACES_FOUR, tCertificatePtr.Subject)
+	fmt.Printf("%sSerial Number: %s\n", ctv.SPACES_FOUR, serialHex(tCertificatePtr.SerialNumber))
+	fmt.Printf("%sProfile: %s\n", ctv.SPACES_FOUR, request.Profile)
+	fmt.Printf("%sNot After: %s\n", ctv.SPACES_FOUR, tCertificatePtr.NotAfter.UTC().Format(time.RFC3339))
+	fmt.Printf("%sCertificate File: %s\n", ctv.SPACES_FOUR, request.CertificateFQN+EXTENSION_CERTIFICATE)
+
+	return
+}
+
+// readCSR - reads a PEM certificate signing request and checks its signature.
+//
+//	Customer Messages: None
+//	Errors: ErrPEMInvalid, errors returned by os and x509
+//	Verifications: None
+func readCSR(fqn string) (csrPtr *x509.CertificateRequest, errorInfo errs.ErrorInfo) {
+
+	var (
+		tBlockPtr *pem.Block
+		tData     []byte
+	)
+
+	if tData, errorInfo.Error = os.ReadFile(fqn); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+	if tBlockPtr, _ = pem.Decode(tData); tBlockPtr == nil || tBlockPtr.Type != PEM_CERTIFICATE_REQUEST {
+		errorInfo = errs.NewErrorInfo(ErrPEMInvalid, fmt.Sprintf("File: %s Expected: %s", fqn, PEM_CERTIFICATE_REQUEST))
+		return
+	}
+	if csrPtr, errorInfo.Error = x509.ParseCertificateRequest(tBlockPtr.Bytes); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+	if errorInfo.Error = csrPtr.CheckSignature(); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+	}
+
+	return
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"path/filepath"
+	"testing"
+
+	certs "certificate_services"
+)
+
+// TestIssueCertificateFullChain - the full chain is the certificate and the intermediate, the chain authority.chain gives and
+// a TLS server sends. The root is left out.
+func TestIssueCertificateFullChain(t *testing.T) {
+
+	var (
+		tAuthorityPtr = newTestAuthority(t, "Issue Test")
+		tCSRFQN       = filepath.Join(t.TempDir(), "www.csr")
+		tCertFQN      = filepath.Join(filepath.Dir(tCSRFQN), "www")
+	)
+
+	tPrivateKey, tErrorInfo := certs.GenerateKey(KEY_TYPE_ECDSA_P256, 0, MIN_RSA_BITS)
+	if tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+	tDER, tErr := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "www.example.com"}, DNSNames: []string{"www.example.com"}}, tPrivateKey)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	if tErrorInfo = writeOutPEMFile(tCSRFQN, tDER, PEM_CERTIFICATE_REQUEST, PUBLIC_FILE_PERMISSIONS); tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+
+	if tErrorInfo = issueCertificate(issueRequest{
+		CADirectory:    tAuthorityPtr.Directory,
+		CertificateFQN: tCertFQN,
+		CSRFQN:         tCSRFQN,
+		Profile:        PROFILE_SERVER,
+		ValidDays:      30,
+	}); tErrorInfo.Error != nil {
+		t.Fatalf("issueCertificate: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	tChain, tErrorInfo := readCertificates(tCertFQN + EXTENSION_FULL_CHAIN)
+	if tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+	tWant := tAuthorityPtr.chain(tChain[0])
+	if len(tChain) != len(tWant) {
+		t.Fatalf("the full chain holds %d certificates, want %d", len(tChain), len(tWant))
+	}
+	for tIndex, tCertificatePtr := range tChain {
+		if string(tCertificatePtr.Raw) != string(tWant[tIndex]) {
+			t.Errorf("certificate %d of the full chain is %s, want the one authority.chain gives", tIndex, tCertificatePtr.Subject)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/youmark/pkcs8"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// readPassphrase - the first line of the passphrase file or, without one, the PASSPHRASE_ENVIRONMENT_VARIABLE. It is empty when
+// neither is set.
+//
+//	Customer Messages: None
+//	Errors: errors returned by os
+//	Verifications: None
+func readPassphrase(passphraseFQN string) (passphrase string, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData []byte
+	)
+
+	if passphraseFQN == ctv.VAL_EMPTY {
+		return os.Getenv(PASSPHRASE_ENVIRONMENT_VARIABLE), errorInfo
+	}
+
+	if tData, errorInfo.Error = os.ReadFile(passphraseFQN); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Passphrase File: %s", passphraseFQN))
+		return
+	}
+	// Only the first line, so a trailing newline from an editor or echo is not part of the passphrase.
+	passphrase, _, _ = strings.Cut(string(tData), "\n")
+	passphrase = strings.TrimSuffix(passphrase, "\r")
+
+	return
+}
+
+// writePrivateKey - PKCS#8, PEM encoded. With a passphrase, the key is encrypted (PBES2, AES-256-CBC).
+//
+//	Customer Messages: None
+//	Errors: errors returned by x509, pkcs8 and writeOutPEMFile
+//	Verifications: None
+func writePrivateKey(privateKeyFQN string, privateKey crypto.Signer, passphrase string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tMarshalledPrivateKey []byte
+		tPEMType              = PEM_PRIVATE_KEY
+	)
+
+	if passphrase == ctv.VAL_EMPTY {
+		tMarshalledPrivateKey, errorInfo.Error = x509.MarshalPKCS8PrivateKey(privateKey)
+	} else {
+		tMarshalledPrivateKey, errorInfo.Error = pkcs8.MarshalPrivateKey(privateKey, []byte(passphrase), nil)
+		tPEMType = PEM_ENCRYPTED_PRIVATE_KEY
+	}
+	if errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Private Key File: %s", privateKeyFQN))
+		return
+	}
+
+	return writeOutPEMFile(privateKeyFQN, tMarshalledPrivateKey, tPEMType, PRIVATE_FILE_PERMISSIONS)
+}
@@ -1,163 +1,415 @@
+// Package main.go
+/*
+This utility creates a two-tier certificate authority on disk: a self-signed root CA and an intermediate CA signed by it. The
+intermediate is the CA that issues certificates, so the root key can be encrypted and kept offline.
+
+RESTRICTIONS:
+    * There is no log for this utility. All messages are output to the console.
+    * init will not overwrite an existing certificate authority in the ca_dir.
+    * The intermediate cannot outlive the root, and its path length must be less than the root's.
+
+NOTES:
+    The ca_dir holds root.pem and root.key, intermediate.pem and intermediate.key, and intermediate.fullchain.pem, which is
+    the intermediate followed by the root. Keys are PKCS#8 PEM and readable only by the owner (0600).
+    The root key is encrypted (PBES2, AES-256-CBC) with --encrypt_root_key, using the passphrase in --passphrase_file or the
+    GENERATE_CERTIFICATE_AUTHORITY_PASSPHRASE environment variable. The intermediate key is not, because it is used to issue.
+    Both CAs have random 128-bit serial numbers and Subject Key Identifiers, and the intermediate an Authority Key Identifier.
+    The name constraints (--permitted_dns, --excluded_ip and the others) are put on the intermediate and marked critical.
+    After init, and with the selftest subcommand, a server certificate is issued from the intermediate in memory, served from
+    an httptest server and fetched by a client that trusts only the root.
+    The issue subcommand signs a certificate signing request with the intermediate, using the server, client or peer profile.
+    Every certificate the intermediate issues is recorded in index.txt, and a copy kept in certs/<serial>.pem. index.txt has
+    the six columns of an OpenSSL CA index (status, expiry, revocation, serial, file and subject), then the not before time,
+    the profile and the subject alternative names. The list, search and revoke subcommands read and change it. Revocation
+    takes an RFC 5280 reason. A serial number is never issued twice.
+    The crl subcommand signs a version 2 CRL with the intermediate, with a CRL number and the reason for each revoked
+    certificate, and writes crl.der and crl.pem. With --every it generates a new one on a schedule, and with --serve it
+    serves them over HTTP. The CRL URL in settings.json, set with init or the settings subcommand, is put in issued
+    certificates as their CRL Distribution Point.
+    The ocsp responder subcommand issues a short-lived delegated OCSP responder certificate, ocsp.pem and ocsp.key, from the
+    intermediate. ocsp serve answers RFC 6960 OCSP requests over HTTP GET and POST from index.txt, signed by the responder
+    and echoing any nonce, and ocsp staple pre-generates a response per certificate in ocsp/<serial>.der for stapling. The
+    OCSP URL in settings.json is put in issued certificates' Authority Information Access.
+    acme serve runs an RFC 8555 ACME server over HTTPS in front of the intermediate, so a service can get its certificates
+    the way it would from Let's Encrypt. Accounts, orders and authorizations are kept in acme/state.json, and the server's
+    own certificate in acme/server.pem. http-01 and dns-01 challenges are validated with the system resolver, or with
+    --resolver and --http01_port against acme standin, which answers DNS and HTTP on localhost from files a client writes.
+
+COPYRIGHT:
+	Copyright 2022
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
 package main
 
 import (
-	"bytes"
-	"crypto/rand"
-	"crypto/rsa"
-	"crypto/tls"
-	"crypto/x509"
-	"crypto/x509/pkix"
-	"encoding/pem"
 	"fmt"
-	"io/ioutil"
-	"math/big"
-	"net"
-	"net/http"
-	"net/http/httptest"
+	"os"
 	"strings"
 	"time"
+
+	"github.com/integrii/flaggy"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
 )
 
-func main() {
-	// get our ca and server certificate
-	serverTLSConf, clientTLSConf, err := certsetup()
-	if err != nil {
-		panic(err)
-	}
+var (
+	acmeCmdPtr     *flaggy.Subcommand
+	crlCmdPtr      *flaggy.Subcommand
+	initCmdPtr     *flaggy.Subcommand
+	issueCmdPtr    *flaggy.Subcommand
+	listCmdPtr     *flaggy.Subcommand
+	ocspCmdPtr     *flaggy.Subcommand
+	revokeCmdPtr   *flaggy.Subcommand
+	searchCmdPtr   *flaggy.Subcommand
+	selfTestCmdPtr *flaggy.Subcommand
+	settingsCmdPtr *flaggy.Subcommand
+	//
+	acmeServeCmdPtr     *flaggy.Subcommand
+	acmeStandinCmdPtr   *flaggy.Subcommand
+	ocspResponderCmdPtr *flaggy.Subcommand
+	ocspServeCmdPtr     *flaggy.Subcommand
+	ocspStapleCmdPtr    *flaggy.Subcommand
+)
 
-	// set up the httptest.Server using our certificate signed by our CA
-	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Fprintln(w, "success!")
-	}))
-	server.TLS = serverTLSConf
-	server.StartTLS()
-	defer server.Close()
-
-	// communicate with the server using an http.Client configured to trust our CA
-	transport := &http.Transport{
-		TLSClientConfig: clientTLSConf,
-	}
-	http := http.Client{
-		Transport: transport,
-	}
-	resp, err := http.Get(server.URL)
-	if err != nil {
-		panic(err)
-	}
+var (
+	acmeHost                = DEFAULT_ACME_HOST
+	acmeHTTP01Port          = DEFAULT_ACME_HTTP01_PORT
+	acmeListenAddress       = DEFAULT_ACME_LISTEN_ADDRESS
+	acmeResolver            string
+	caDirectory             string
+	certFileName            string
+	country                 = DEFAULT_SUBJECT_COUNTRY
+	crlEvery                time.Duration
+	crlServeAddress         string
+	crlURL                  string
+	crlValidity             = DEFAULT_CRL_VALIDITY
+	csrFileName             string
+	encryptRootKey          bool
+	excludedDNSDomains      []string
+	excludedEmailAddresses  []string
+	excludedIPRanges        []string
+	excludedURIDomains      []string
+	intermediateName        string
+	intermediatePathLength  = DEFAULT_INTERMEDIATE_PATH_LENGTH
+	intermediateValidYears  = DEFAULT_INTERMEDIATE_VALID_YEARS
+	keyType                 = DEFAULT_KEY_TYPE
+	listStatus              string
+	ocspListenAddress       = DEFAULT_OCSP_LISTEN_ADDRESS
+	ocspOutDirectory        string
+	ocspURL                 string
+	ocspValidity            = DEFAULT_OCSP_VALIDITY
+	organization            = DEFAULT_SUBJECT_ORGANIZATION
+	passphraseFileName      string
+	permittedDNSDomains     []string
+	permittedEmailAddresses []string
+	permittedIPRanges       []string
+	permittedURIDomains     []string
+	profileName             = DEFAULT_PROFILE
+	query                   string
+	reason                  string
+	responderKeyType        = DEFAULT_OCSP_RESPONDER_KEY_TYPE
+	responderValidDays      = DEFAULT_OCSP_RESPONDER_VALID_DAYS
+	rootName                string
+	rootPathLength          = DEFAULT_ROOT_PATH_LENGTH
+	rootValidYears          = DEFAULT_ROOT_VALID_YEARS
+	rsaBits                 = DEFAULT_RSA_BITS
+	serial                  string
+	standinAddress          = DEFAULT_STANDIN_ADDRESS
+	standinDirectory        string
+	standinDNSAddress       = DEFAULT_STANDIN_DNS_LISTEN_ADDRESS
+	standinHTTPAddress      = DEFAULT_STANDIN_HTTP_LISTEN_ADDRESS
+	validDays               = DEFAULT_VALID_DAYS
+)
 
-	// verify the response
-	respBodyBytes, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		panic(err)
-	}
-	body := strings.TrimSpace(string(respBodyBytes[:]))
-	if body == "success!" {
-		fmt.Println(body)
-	} else {
-		panic("not successful!")
-	}
-}
+func init() {
 
-func certsetup() (serverTLSConf *tls.Config, clientTLSConf *tls.Config, err error) {
-	// set up our CA certificate
-	ca := &x509.Certificate{
-		SerialNumber: big.NewInt(2019),
-		Subject: pkix.Name{
-			Organization:  []string{"Company, INC."},
-			Country:       []string{"US"},
-			Province:      []string{""},
-			Locality:      []string{"San Francisco"},
-			StreetAddress: []string{"Golden Gate Bridge"},
-			PostalCode:    []string{"94016"},
-		},
-		NotBefore:             time.Now(),
-		NotAfter:              time.Now().AddDate(10, 0, 0),
-		IsCA:                  true,
-		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
-		BasicConstraintsValid: true,
-	}
+	appDescription := "Generate certificate authority will create a root CA and an intermediate CA that it signs.\n" +
+		"\nVersion: \n" +
+		ctv.SPACES_FOUR + "- " + VERSION + "\n" +
+		"\nConstraints: \n" +
+		ctv.SPACES_FOUR + "- There is no log for this utility. All messages are output to the console.\n" +
+		ctv.SPACES_FOUR + "- init will not overwrite an existing certificate authority.\n" +
+		"\nNotes:\n" +
+		ctv.SPACES_FOUR + "The init subcommand writes root.pem, root.key, intermediate.pem, intermediate.key and intermediate.fullchain.pem\n" +
+		ctv.SPACES_FOUR + "to the ca_dir and then runs the self-test. The selftest subcommand serves HTTPS with a certificate from the\n" +
+		ctv.SPACES_FOUR + "intermediate and connects with a client that trusts only the root.\n" +
+		ctv.SPACES_FOUR + "The issue subcommand signs a certificate signing request. Issued certificates are recorded in index.txt,\n" +
+		ctv.SPACES_FOUR + "which the list, search and revoke subcommands use.\n" +
+		ctv.SPACES_FOUR + "The crl subcommand generates the CRL once, on a schedule with every, and serves it with serve.\n" +
+		ctv.SPACES_FOUR + "The ocsp subcommand issues the OCSP responder certificate, answers OCSP requests and pre-generates responses.\n" +
+		ctv.SPACES_FOUR + "The acme subcommand runs an ACME server that issues from the intermediate, and stand-ins to validate against.\n" +
+		ctv.SPACES_FOUR + "Keys are set to 0600 and certificates to 0644.\n" +
+		"\nFor more info, see link below:\n"
 
-	// create our private and public key
-	caPrivKey, err := rsa.GenerateKey(rand.Reader, 4096)
-	if err != nil {
-		return nil, nil, err
-	}
+	// Set your program's name and description.  These appear in help output.
+	flaggy.SetName("\n" + APPLICATION_NAME) // "\n" is added to the start of the name to make the output easier to read.
+	flaggy.SetDescription(appDescription)
 
-	// create the CA
-	caBytes, err := x509.CreateCertificate(rand.Reader, ca, ca, &caPrivKey.PublicKey, caPrivKey)
-	if err != nil {
-		return nil, nil, err
-	}
+	// You can disable various things by changing bool on the default parser
+	// (or your own parser if you have created one).
+	flaggy.DefaultParser.ShowHelpOnUnexpected = true
 
-	// pem encode
-	caPEM := new(bytes.Buffer)
-	pem.Encode(caPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: caBytes,
-	})
-
-	caPrivKeyPEM := new(bytes.Buffer)
-	pem.Encode(caPrivKeyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(caPrivKey),
-	})
-
-	// set up our server certificate
-	cert := &x509.Certificate{
-		SerialNumber: big.NewInt(2019),
-		Subject: pkix.Name{
-			Organization:  []string{"Company, INC."},
-			Country:       []string{"US"},
-			Province:      []string{""},
-			Locality:      []string{"San Francisco"},
-			StreetAddress: []string{"Golden Gate Bridge"},
-			PostalCode:    []string{"94016"},
-		},
-		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		NotBefore:    time.Now(),
-		NotAfter:     time.Now().AddDate(10, 0, 0),
-		SubjectKeyId: []byte{1, 2, 3, 4, 6},
-		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:     x509.KeyUsageDigitalSignature,
-	}
+	// You can set a help prepend or append on the default parser.
+	flaggy.DefaultParser.AdditionalHelpPrepend = "https://github.com/sty-holdings/utilities"
 
-	certPrivKey, err := rsa.GenerateKey(rand.Reader, 4096)
-	if err != nil {
-		return nil, nil, err
-	}
+	// Add a flag to the main program (this will be available in all subcommands as well).
+	flaggy.String(&caDirectory, "d", "ca_dir", "REQUIRED: The directory that holds the certificate authority.")
 
-	certBytes, err := x509.CreateCertificate(rand.Reader, cert, ca, &certPrivKey.PublicKey, caPrivKey)
-	if err != nil {
-		return nil, nil, err
-	}
+	initCmdPtr = flaggy.NewSubcommand("init")
+	initCmdPtr.Description = "Create the root CA and the intermediate CA in the ca_dir, then run the self-test."
+	initCmdPtr.String(&keyType, "t", "key_type", "The key algorithm of both CAs: rsa | ecdsa-p256 | ecdsa-p384 | ed25519. The default is ecdsa-p384.")
+	initCmdPtr.Int(&rsaBits, "r", "rsa_bits", "Size of RSA key to generate. The value must be 2048 or higher. The default is 4096. Only valid for the 'rsa' key_type.")
+	initCmdPtr.String(&organization, "", "organization", "The subject organization of both CAs. The default is "+DEFAULT_SUBJECT_ORGANIZATION+".")
+	initCmdPtr.String(&country, "", "country", "The subject two letter country code of both CAs. The default is "+DEFAULT_SUBJECT_COUNTRY+".")
+	initCmdPtr.String(&rootName, "", "root_name", "The root CA common name. The default is the organization followed by Root CA.")
+	initCmdPtr.String(&intermediateName, "", "intermediate_name", "The intermediate CA common name. The default is the organization followed by Intermediate CA.")
+	initCmdPtr.Int(&rootValidYears, "", "root_valid_years", "The years the root CA is valid. The default is 20.")
+	initCmdPtr.Int(&intermediateValidYears, "", "intermediate_valid_years", "The years the intermediate CA is valid. It cannot be more than the root's. The default is 5.")
+	initCmdPtr.Int(&rootPathLength, "", "root_path_length", "The most CA certificates allowed below the root. The default is 1.")
+	initCmdPtr.Int(&intermediatePathLength, "", "intermediate_path_length", "The most CA certificates allowed below the intermediate. It must be less than the root's. The default is 0.")
+	initCmdPtr.String(&crlURL, "", "crl_url", "The URL the CRL is published at, which is put in issued certificates, such as http://ca.example.com/crl.der.")
+	initCmdPtr.String(&ocspURL, "", "ocsp_url", "The URL the OCSP responder answers at, which is put in issued certificates, such as http://ocsp.example.com:8081.")
+	initCmdPtr.Bool(&encryptRootKey, "", "encrypt_root_key", "Encrypt the root key with the passphrase. The default is false.")
+	initCmdPtr.String(&passphraseFileName, "", "passphrase_file", "The file whose first line is the root key passphrase. The default is the "+PASSPHRASE_ENVIRONMENT_VARIABLE+" environment variable.")
+	initCmdPtr.StringSlice(&permittedDNSDomains, "", "permitted_dns", "A DNS domain the intermediate may issue for. A leading dot permits only subdomains. Repeat the flag or separate with commas.")
+	initCmdPtr.StringSlice(&excludedDNSDomains, "", "excluded_dns", "A DNS domain the intermediate may not issue for. Repeat the flag or separate with commas.")
+	initCmdPtr.StringSlice(&permittedIPRanges, "", "permitted_ip", "A CIDR the intermediate may issue for, such as 10.0.0.0/8. Repeat the flag or separate with commas.")
+	initCmdPtr.StringSlice(&excludedIPRanges, "", "excluded_ip", "A CIDR the intermediate may not issue for. Repeat the flag or separate with commas.")
+	initCmdPtr.StringSlice(&permittedEmailAddresses, "", "permitted_email", "An email address or domain the intermediate may issue for. Repeat the flag or separate with commas.")
+	initCmdPtr.StringSlice(&excludedEmailAddresses, "", "excluded_email", "An email address or domain the intermediate may not issue for. Repeat the flag or separate with commas.")
+	initCmdPtr.StringSlice(&permittedURIDomains, "", "permitted_uri", "A URI host domain the intermediate may issue for. Repeat the flag or separate with commas.")
+	initCmdPtr.StringSlice(&excludedURIDomains, "", "excluded_uri", "A URI host domain the intermediate may not issue for. Repeat the flag or separate with commas.")
+	flaggy.AttachSubcommand(initCmdPtr, 1)
 
-	certPEM := new(bytes.Buffer)
-	pem.Encode(certPEM, &pem.Block{
-		Type:  "CERTIFICATE",
-		Bytes: certBytes,
-	})
-
-	certPrivKeyPEM := new(bytes.Buffer)
-	pem.Encode(certPrivKeyPEM, &pem.Block{
-		Type:  "RSA PRIVATE KEY",
-		Bytes: x509.MarshalPKCS1PrivateKey(certPrivKey),
-	})
-
-	serverCert, err := tls.X509KeyPair(certPEM.Bytes(), certPrivKeyPEM.Bytes())
-	if err != nil {
-		return nil, nil, err
-	}
+	issueCmdPtr = flaggy.NewSubcommand("issue")
+	issueCmdPtr.Description = "Issue a certificate for a certificate signing request with the intermediate CA and record it."
+	issueCmdPtr.String(&csrFileName, "i", "csr", "REQUIRED: The certificate signing request file, with its extension.")
+	issueCmdPtr.String(&certFileName, "c", "cert_name", "REQUIRED: The directory and filename of the out certificate file. DO NOT provide an extension to the name.")
+	issueCmdPtr.String(&profileName, "p", "profile", "The use of the certificate: server | client | peer. The default is server.")
+	issueCmdPtr.Int(&validDays, "v", "valid_days", "The days the certificate is valid. It cannot outlive the intermediate. The default is 90.")
+	flaggy.AttachSubcommand(issueCmdPtr, 1)
+
+	listCmdPtr = flaggy.NewSubcommand("list")
+	listCmdPtr.Description = "List the issued certificates."
+	listCmdPtr.String(&listStatus, "", "status", "Only list the certificates with the status: V (valid) | R (revoked) | E (expired).")
+	flaggy.AttachSubcommand(listCmdPtr, 1)
+
+	searchCmdPtr = flaggy.NewSubcommand("search")
+	searchCmdPtr.Description = "List the issued certificates whose serial, subject, names or profile contain the query, ignoring case."
+	searchCmdPtr.String(&query, "q", "query", "REQUIRED: The text to search for.")
+	flaggy.AttachSubcommand(searchCmdPtr, 1)
+
+	revokeCmdPtr = flaggy.NewSubcommand("revoke")
+	revokeCmdPtr.Description = "Revoke an issued certificate by its serial number."
+	revokeCmdPtr.String(&serial, "x", "serial", "REQUIRED: The serial number in hex, with or without colons.")
+	revokeCmdPtr.String(&reason, "", "reason", "The RFC 5280 reason: unspecified | keyCompromise | CACompromise | affiliationChanged | superseded |"+
+		"\n\t\t\tcessationOfOperation | certificateHold | privilegeWithdrawn | AACompromise. The default is unspecified.")
+	flaggy.AttachSubcommand(revokeCmdPtr, 1)
+
+	crlCmdPtr = flaggy.NewSubcommand("crl")
+	crlCmdPtr.Description = "Generate the CRL from the revoked certificates, once or on a schedule, and optionally serve it over HTTP."
+	crlCmdPtr.Duration(&crlValidity, "", "crl_validity", "The time until the CRL's next update. The default is 168h (7 days).")
+	crlCmdPtr.Duration(&crlEvery, "", "every", "Generate a new CRL this often, such as 24h, until interrupted. It must be less than the crl_validity.")
+	crlCmdPtr.String(&crlServeAddress, "", "serve", "Serve crl.der and crl.pem over HTTP on this address, such as :8080, until interrupted.")
+	flaggy.AttachSubcommand(crlCmdPtr, 1)
+
+	ocspCmdPtr = flaggy.NewSubcommand("ocsp")
+	ocspCmdPtr.Description = "Issue the OCSP responder certificate, answer OCSP requests, or pre-generate responses for stapling."
+	flaggy.AttachSubcommand(ocspCmdPtr, 1)
+
+	ocspResponderCmdPtr = flaggy.NewSubcommand("responder")
+	ocspResponderCmdPtr.Description = "Issue the delegated OCSP responder certificate from the intermediate CA, replacing the one before."
+	ocspResponderCmdPtr.String(&responderKeyType, "t", "key_type", "The key algorithm of the responder: rsa | ecdsa-p256 | ecdsa-p384. The default is ecdsa-p256.")
+	ocspResponderCmdPtr.Int(&rsaBits, "r", "rsa_bits", "Size of RSA key to generate. The value must be 2048 or higher. The default is 4096. Only valid for the 'rsa' key_type.")
+	ocspResponderCmdPtr.Int(&responderValidDays, "v", "valid_days", "The days the responder certificate is valid. Clients do not check its status, so keep it short. The default is 30.")
+	ocspCmdPtr.AttachSubcommand(ocspResponderCmdPtr, 1)
+
+	ocspServeCmdPtr = flaggy.NewSubcommand("serve")
+	ocspServeCmdPtr.Description = "Answer OCSP requests over HTTP from the issuance database until interrupted."
+	ocspServeCmdPtr.String(&ocspListenAddress, "l", "listen", "The address to answer on. The default is "+DEFAULT_OCSP_LISTEN_ADDRESS+".")
+	ocspServeCmdPtr.Duration(&ocspValidity, "", "response_validity", "The time from a response's this update to its next update. The default is 24h.")
+	ocspCmdPtr.AttachSubcommand(ocspServeCmdPtr, 1)
+
+	ocspStapleCmdPtr = flaggy.NewSubcommand("staple")
+	ocspStapleCmdPtr.Description = "Write a signed OCSP response for each certificate that has not expired, for servers to staple."
+	ocspStapleCmdPtr.String(&ocspOutDirectory, "o", "out_dir", "The directory the <serial>.der responses are written to. The default is the ocsp directory in the ca_dir.")
+	ocspStapleCmdPtr.String(&serial, "x", "serial", "Only write the response for this serial number in hex, with or without colons.")
+	ocspStapleCmdPtr.Duration(&ocspValidity, "", "response_validity", "The time from a response's this update to its next update. Run staple again well before it. The default is 24h.")
+	ocspCmdPtr.AttachSubcommand(ocspStapleCmdPtr, 1)
+
+	acmeCmdPtr = flaggy.NewSubcommand("acme")
+	acmeCmdPtr.Description = "Run an ACME server that issues certificates from the intermediate CA, or the stand-ins that its challenges are validated against."
+	flaggy.AttachSubcommand(acmeCmdPtr, 1)
 
-	serverTLSConf = &tls.Config{
-		Certificates: []tls.Certificate{serverCert},
+	acmeServeCmdPtr = flaggy.NewSubcommand("serve")
+	acmeServeCmdPtr.Description = "Answer ACME (RFC 8555) requests over HTTPS until interrupted."
+	acmeServeCmdPtr.String(&acmeListenAddress, "l", "listen", "The address to answer on. The default is "+DEFAULT_ACME_LISTEN_ADDRESS+".")
+	acmeServeCmdPtr.String(&acmeHost, "", "host", "The name or IP address clients reach the server by, which its certificate is issued for. The default is "+DEFAULT_ACME_HOST+".")
+	acmeServeCmdPtr.Int(&validDays, "v", "valid_days", "The days issued certificates are valid. The default is 90.")
+	acmeServeCmdPtr.String(&acmeResolver, "", "resolver", "Look up names on this DNS server, such as the standin at 127.0.0.1:8053, instead of the system's.")
+	acmeServeCmdPtr.Int(&acmeHTTP01Port, "", "http01_port", "The port http-01 challenges are fetched from, such as the standin's 5002. The default is 80.")
+	acmeCmdPtr.AttachSubcommand(acmeServeCmdPtr, 1)
+
+	acmeStandinCmdPtr = flaggy.NewSubcommand("standin")
+	acmeStandinCmdPtr.Description = "Answer http-01 and dns-01 challenges on localhost from files, in place of real web servers and DNS, until interrupted."
+	acmeStandinCmdPtr.String(&standinAddress, "", "address", "The address every name resolves to. The default is "+DEFAULT_STANDIN_ADDRESS+".")
+	acmeStandinCmdPtr.String(&standinDNSAddress, "", "dns_listen", "The UDP address to answer DNS on. The default is "+DEFAULT_STANDIN_DNS_LISTEN_ADDRESS+".")
+	acmeStandinCmdPtr.String(&standinHTTPAddress, "", "http_listen", "The address to answer http-01 on. The default is "+DEFAULT_STANDIN_HTTP_LISTEN_ADDRESS+".")
+	acmeStandinCmdPtr.String(&standinDirectory, "", "standin_dir", "The directory of the http-01/<token> and dns-01/<name> files. The default is the standin directory in the ca_dir.")
+	acmeCmdPtr.AttachSubcommand(acmeStandinCmdPtr, 1)
+
+	settingsCmdPtr = flaggy.NewSubcommand("settings")
+	settingsCmdPtr.Description = "Show or change the URLs that are put in issued certificates."
+	settingsCmdPtr.String(&crlURL, "", "crl_url", "The URL the CRL is published at, or none to remove it.")
+	settingsCmdPtr.String(&ocspURL, "", "ocsp_url", "The URL the OCSP responder answers at, or none to remove it.")
+	flaggy.AttachSubcommand(settingsCmdPtr, 1)
+
+	selfTestCmdPtr = flaggy.NewSubcommand("selftest")
+	selfTestCmdPtr.Description = "Serve HTTPS with a certificate from the intermediate and connect with a client that trusts only the root."
+	flaggy.AttachSubcommand(selfTestCmdPtr, 1)
+
+	// Set the version and parse all inputs into variables.
+	flaggy.SetVersion(VERSION)
+	flaggy.Parse()
+}
+
+func main() {
+
+	var (
+		errorInfo errs.ErrorInfo
+	)
+
+	fmt.Println()
+
+	if caDirectory == ctv.VAL_EMPTY {
+		flaggy.ShowHelpAndExit("ERROR: Please review the usage and supplied all required arguments.")
 	}
 
-	certpool := x509.NewCertPool()
-	certpool.AppendCertsFromPEM(caPEM.Bytes())
-	clientTLSConf = &tls.Config{
-		RootCAs: certpool,
+	switch {
+	case initCmdPtr.Used:
+		errorInfo = initAuthority(initRequest{
+			CADirectory:            caDirectory,
+			Country:                country,
+			CRLURL:                 crlURL,
+			EncryptRootKey:         encryptRootKey,
+			IntermediateName:       intermediateName,
+			IntermediatePathLength: intermediatePathLength,
+			IntermediateValidYears: intermediateValidYears,
+			KeyType:                strings.ToLower(keyType),
+			NameConstraints: nameConstraintsRequest{
+				ExcludedDNSDomains:      excludedDNSDomains,
+				ExcludedEmailAddresses:  excludedEmailAddresses,
+				ExcludedIPRanges:        excludedIPRanges,
+				ExcludedURIDomains:      excludedURIDomains,
+				PermittedDNSDomains:     permittedDNSDomains,
+				PermittedEmailAddresses: permittedEmailAddresses,
+				PermittedIPRanges:       permittedIPRanges,
+				PermittedURIDomains:     permittedURIDomains,
+			},
+			OCSPURL:        ocspURL,
+			Organization:   organization,
+			PassphraseFQN:  passphraseFileName,
+			RootName:       rootName,
+			RootPathLength: rootPathLength,
+			RootValidYears: rootValidYears,
+			RSABits:        rsaBits,
+		})
+		if errorInfo.Error == nil {
+			fmt.Println()
+			errorInfo = selfTest(caDirectory)
+		}
+	case issueCmdPtr.Used:
+		if csrFileName == ctv.VAL_EMPTY || certFileName == ctv.VAL_EMPTY {
+			flaggy.ShowHelpAndExit("ERROR: Please review the usage and supplied all required arguments.")
+		}
+		errorInfo = issueCertificate(issueRequest{
+			CADirectory:    caDirectory,
+			CertificateFQN: certFileName,
+			CSRFQN:         csrFileName,
+			Profile:        strings.ToLower(profileName),
+			ValidDays:      validDays,
+		})
+	case listCmdPtr.Used:
+		errorInfo = listRecords(caDirectory, listStatus)
+	case searchCmdPtr.Used:
+		if query == ctv.VAL_EMPTY {
+			flaggy.ShowHelpAndExit("ERROR: Please review the usage and supplied all required arguments.")
+		}
+		errorInfo = searchRecords(caDirectory, query)
+	case revokeCmdPtr.Used:
+		if serial == ctv.VAL_EMPTY {
+			flaggy.ShowHelpAndExit("ERROR: Please review the usage and supplied all required arguments.")
+		}
+		errorInfo = revokeCertificate(caDirectory, serial, reason)
+	case crlCmdPtr.Used:
+		errorInfo = runCRL(crlRequest{
+			CADirectory:  caDirectory,
+			Every:        crlEvery,
+			ServeAddress: crlServeAddress,
+			Validity:     crlValidity,
+		})
+	case ocspResponderCmdPtr.Used:
+		errorInfo = createResponder(ocspResponderRequest{
+			CADirectory: caDirectory,
+			KeyType:     strings.ToLower(responderKeyType),
+			RSABits:     rsaBits,
+			ValidDays:   responderValidDays,
+		})
+	case ocspServeCmdPtr.Used:
+		errorInfo = serveOCSP(ocspServeRequest{
+			CADirectory:   caDirectory,
+			ListenAddress: ocspListenAddress,
+			Validity:      ocspValidity,
+		})
+	case ocspStapleCmdPtr.Used:
+		errorInfo = stapleOCSP(ocspStapleRequest{
+			CADirectory:  caDirectory,
+			OutDirectory: ocspOutDirectory,
+			Serial:       serial,
+			Validity:     ocspValidity,
+		})
+	case ocspCmdPtr.Used:
+		flaggy.ShowHelpAndExit("ERROR: Please choose an ocsp subcommand: responder, serve or staple.")
+	case acmeServeCmdPtr.Used:
+		errorInfo = runACME(acmeServeRequest{
+			CADirectory:   caDirectory,
+			HTTP01Port:    acmeHTTP01Port,
+			Host:          strings.ToLower(acmeHost),
+			ListenAddress: acmeListenAddress,
+			Resolver:      acmeResolver,
+			ValidDays:     validDays,
+		})
+	case acmeStandinCmdPtr.Used:
+		errorInfo = runStandin(standinRequest{
+			Address:           standinAddress,
+			CADirectory:       caDirectory,
+			Directory:         standinDirectory,
+			DNSListenAddress:  standinDNSAddress,
+			HTTPListenAddress: standinHTTPAddress,
+		})
+	case acmeCmdPtr.Used:
+		flaggy.ShowHelpAndExit("ERROR: Please choose an acme subcommand: serve or standin.")
+	case settingsCmdPtr.Used:
+		errorInfo = updateSettings(caDirectory, crlURL, ocspURL)
+	case selfTestCmdPtr.Used:
+		errorInfo = selfTest(caDirectory)
+	default:
+		flaggy.ShowHelpAndExit("ERROR: Please choose a subcommand.")
 	}
 
-	return
+	if errorInfo.Error != nil {
+		errs.PrintErrorInfo(errorInfo)
+		os.Exit(1)
+	}
 }
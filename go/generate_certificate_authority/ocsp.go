@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// ocspResponder - the delegated responder that signs OCSP responses for the intermediate CA. Only the intermediate's
+// certificate is needed, not its key, so the responder can run where the intermediate key is not.
+type ocspResponder struct {
+	Certificate  *x509.Certificate
+	Directory    string
+	Intermediate *x509.Certificate
+	Key          crypto.Signer
+}
+
+// ocspResponderRequest - the delegated responder certificate that ocsp responder issues.
+type ocspResponderRequest struct {
+	CADirectory string
+	KeyType     string // KEY_TYPE_RSA, KEY_TYPE_ECDSA_P256 or KEY_TYPE_ECDSA_P384.
+	RSABits     int    // Only used when KeyType is KEY_TYPE_RSA.
+	ValidDays   int
+}
+
+// ocspServeRequest - where ocsp serve answers OCSP requests.
+type ocspServeRequest struct {
+	CADirectory   string
+	ListenAddress string // Such as :8081.
+	Validity      time.Duration
+}
+
+// ocspStapleRequest - the responses ocsp staple pre-generates.
+type ocspStapleRequest struct {
+	CADirectory  string
+	OutDirectory string // Empty is the ocsp directory in the CA directory.
+	Serial       string // In hex. Empty is every certificate that has not expired.
+	Validity     time.Duration
+}
+
+// createResponder - issues the delegated OCSP responder certificate from the intermediate CA and writes it, with its key, to
+// the CA directory, replacing the one before. It has the OCSP Signing extended key usage and the OCSP No Check extension, so
+// clients do not check its own status (RFC 6960 section 4.2.2.2.1), which is why it should be short-lived. Before it is
+// written, a response signed with it must verify to the intermediate with golang.org/x/crypto/ocsp.
+//
+//	Customer Messages: None
+//	Errors: ErrResponderKeyTypeInvalid, ErrValidDaysInvalid, errors returned by loadAuthority, certs.GenerateKey, authority.issue,
+//	ocspResponder.certID, ocspResponder.sign, ocsp, writePrivateKey and writeCertificatesFile
+//	Verifications: None
+func createResponder(request ocspResponderRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tAuthorityPtr   *authority
+		tCertificatePtr *x509.Certificate
+		tCertID         ocspCertID
+		tNow            = time.Now()
+		tPrivateKey     crypto.Signer
+		tResponseDER    []byte
+		tResponsePtr    *ocsp.Response
+	)
+
+	switch {
+	case request.KeyType != KEY_TYPE_RSA && request.KeyType != KEY_TYPE_ECDSA_P256 && request.KeyType != KEY_TYPE_ECDSA_P384:
+		errorInfo = errs.NewErrorInfo(ErrResponderKeyTypeInvalid, fmt.Sprintf("Key Type: %s", request.KeyType))
+		return
+	case request.ValidDays < 1:
+		errorInfo = errs.NewErrorInfo(ErrValidDaysInvalid, fmt.Sprintf("Valid Days: %d", request.ValidDays))
+		return
+	}
+	if tAuthorityPtr, errorInfo = loadAuthority(request.CADirectory); errorInfo.Error != nil {
+		return
+	}
+	if tPrivateKey, errorInfo = certs.GenerateKey(request.KeyType, request.RSABits, MIN_RSA_BITS); errorInfo.Error != nil {
+		return
+	}
+
+	tTemplate := x509.Certificate{
+		Subject: pkix.Name{
+			CommonName:   tAuthorityPtr.Intermediate.Subject.CommonName + " OCSP Responder",
+			Organization: tAuthorityPtr.Intermediate.Subject.Organization,
+			Country:      tAuthorityPtr.Intermediate.Subject.Country,
+		},
+		NotBefore:       tNow.Add(-BACKDATE),
+		NotAfter:        tNow.AddDate(0, 0, request.ValidDays),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		ExtraExtensions: []pkix.Extension{{Id: oidOCSPNoCheck, Value: asn1.NullBytes}},
+	}
+	if tCertificatePtr, errorInfo = tAuthorityPtr.issue(&tTemplate, tPrivateKey.Public(), PROFILE_OCSP); errorInfo.Error != nil {
+		return
+	}
+
+	tResponderPtr := &ocspResponder{Certificate: tCertificatePtr, Directory: request.CADirectory, Intermediate: tAuthorityPtr.Intermediate, Key: tPrivateKey}
+	if tCertID, errorInfo = tResponderPtr.certID(tCertificatePtr.SerialNumber); errorInfo.Error != nil {
+		return
+	}
+	tThisUpdate := tNow.UTC().Truncate(time.Second)
+	if tResponseDER, errorInfo = tResponderPtr.sign([]ocspSingleResponse{{CertID: tCertID, Good: true, ThisUpdate: tThisUpdate}}, nil, tThisUpdate); errorInfo.Error != nil {
+		return
+	}
+	if tResponsePtr, errorInfo.Error = ocsp.ParseResponse(tResponseDER, tAuthorityPtr.Intermediate); errorInfo.Error == nil && tResponsePtr.Status != ocsp.Good {
+		errorInfo.Error = ErrResponderInvalid
+	}
+	if errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Responder: %s", tCertificatePtr.Subject))
+		return
+	}
+
+	if errorInfo = writePrivateKey(filepath.Join(request.CADirectory, FILE_OCSP_KEY), tPrivateKey, ctv.VAL_EMPTY); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = writeCertificatesFile(filepath.Join(request.CADirectory, FILE_OCSP_CERTIFICATE), []*x509.Certificate{tCertificatePtr}); errorInfo.Error != nil {
+		return
+	}
+
+	fmt.Printf("The OCSP responder certificate has been written to %s.\n", filepath.Join(request.CADirectory, FILE_OCSP_CERTIFICATE))
+	printCertificate("OCSP Responder", tCertificatePtr)
+	if tAuthorityPtr.Settings.OCSPURL == ctv.VAL_EMPTY {
+		fmt.Printf("%sThere is no OCSP URL in the settings, so issued certificates do not point to the responder.\n", ctv.SPACES_FOUR)
+	}
+
+	return
+}
+
+// loadResponder - reads the intermediate CA certificate and the responder certificate and key from the CA directory. The
+// responder must be signed by the intermediate, have the OCSP Signing extended key usage and be in date.
+//
+//	Customer Messages: None
+//	Errors: ErrCertificateKeyMismatch, ErrResponderInvalid, errors returned by readCertificates, certs.ReadPrivateKey and x509
+//	Verifications: None
+func loadResponder(caDirectory string) (responderPtr *ocspResponder, errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertificates  []*x509.Certificate
+		tIntermediates []*x509.Certificate
+		tNow           = time.Now()
+		tResponderFQN  = filepath.Join(caDirectory, FILE_OCSP_CERTIFICATE)
+	)
+
+	responderPtr = &ocspResponder{Directory: caDirectory}
+	if tIntermediates, errorInfo = readCertificates(filepath.Join(caDirectory, FILE_INTERMEDIATE_CERTIFICATE)); errorInfo.Error != nil {
+		return
+	}
+	if tCertificates, errorInfo = readCertificates(tResponderFQN); errorInfo.Error != nil {
+		return
+	}
+	responderPtr.Intermediate, responderPtr.Certificate = tIntermediates[0], tCertificates[0]
+	if responderPtr.Key, errorInfo = certs.ReadPrivateKey(filepath.Join(caDirectory, FILE_OCSP_KEY), ctv.VAL_EMPTY); errorInfo.Error != nil {
+		return
+	}
+	if certs.SamePublicKey(responderPtr.Certificate.PublicKey, responderPtr.Key.Public()) == false {
+		errorInfo = errs.NewErrorInfo(ErrCertificateKeyMismatch, fmt.Sprintf("File: %s", filepath.Join(caDirectory, FILE_OCSP_KEY)))
+		return
+	}
+	if errorInfo.Error = responderPtr.Certificate.CheckSignatureFrom(responderPtr.Intermediate); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", tResponderFQN))
+		return
+	}
+	if slices.Contains(responderPtr.Certificate.ExtKeyUsage, x509.ExtKeyUsageOCSPSigning) == false ||
+		tNow.Before(responderPtr.Certificate.NotBefore) || tNow.After(responderPtr.Certificate.NotAfter) {
+		errorInfo = errs.NewErrorInfo(ErrResponderInvalid, fmt.Sprintf("File: %s Not After: %s", tResponderFQN, responderPtr.Certificate.NotAfter.UTC().Format(time.RFC3339)))
+	}
+
+	return
+}
+
+// serveOCSP - answers OCSP requests over HTTP until interrupted, at the path of the OCSP URL in the settings. The responder is
+// checked before the listener is opened.
+//
+//	Customer Messages: None
+//	Errors: ErrOCSPValidityInvalid, errors returned by loadResponder, readSettings, ocspPathPrefix and net
+//	Verifications: None
+func serveOCSP(request ocspServeRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tListener     net.Listener
+		tPathPrefix   string
+		tResponderPtr *ocspResponder
+		tSettings     settings
+	)
+
+	if request.Validity <= 0 {
+		errorInfo = errs.NewErrorInfo(ErrOCSPValidityInvalid, fmt.Sprintf("Response Validity: %s", request.Validity))
+		return
+	}
+	if tResponderPtr, errorInfo = loadResponder(request.CADirectory); errorInfo.Error != nil {
+		return
+	}
+	if tSettings, errorInfo = readSettings(request.CADirectory); errorInfo.Error != nil {
+		return
+	}
+	if tPathPrefix, errorInfo = ocspPathPrefix(tSettings.OCSPURL); errorInfo.Error != nil {
+		return
+	}
+	if tListener, errorInfo.Error = net.Listen("tcp", request.ListenAddress); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Listen Address: %s", request.ListenAddress))
+		return
+	}
+
+	tContext, tStop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer tStop()
+
+	tServerPtr := &http.Server{Handler: ocspHandler(request.CADirectory, tPathPrefix, request.Validity), ReadHeaderTimeout: HTTP_READ_HEADER_TIMEOUT}
+	go func() {
+		if tErr := tServerPtr.Serve(tListener); tErr != nil && errors.Is(tErr, http.ErrServerClosed) == false {
+			errs.PrintErrorInfo(errs.NewErrorInfo(tErr, fmt.Sprintf("Listen Address: %s", request.ListenAddress)))
+			tStop()
+		}
+	}()
+	fmt.Printf("Answering OCSP requests at http://%s%s/ for %s\n", tListener.Addr(), tPathPrefix, tResponderPtr.Intermediate.Subject)
+	printCertificate("OCSP Responder", tResponderPtr.Certificate)
+
+	<-tContext.Done()
+
+	tShutdownContext, tCancel := context.WithTimeout(context.Background(), HTTP_SHUTDOWN_TIMEOUT)
+	defer tCancel()
+	_ = tServerPtr.Shutdown(tShutdownContext)
+
+	return
+}
+
+// ocspPathPrefix - the path of the OCSP URL without the trailing slash, such as /ocsp for https://host/ocsp. It is empty for a
+// URL at the root, or no URL.
+//
+//	Customer Messages: None
+//	Errors: ErrURLInvalid
+//	Verifications: None
+func ocspPathPrefix(ocspURL string) (pathPrefix string, errorInfo errs.ErrorInfo) {
+
+	var (
+		tURLPtr *url.URL
+	)
+
+	if tURLPtr, errorInfo.Error = url.Parse(ocspURL); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(ErrURLInvalid, fmt.Sprintf("URL: %s", ocspURL))
+		return
+	}
+
+	return strings.TrimSuffix(tURLPtr.Path, "/"), errorInfo
+}
+
+// ocspHandler - answers OCSP requests sent with POST, or with GET and the base64 request as the path after pathPrefix (RFC
+// 6960 appendix A). The responder and the database are read for each request, so a revocation or a new responder certificate
+// takes effect at once. Responses without a nonce can be cached until their next update.
+func ocspHandler(caDirectory string, pathPrefix string, validity time.Duration) http.Handler {
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		var (
+			tErr         error
+			tNextUpdate  time.Time
+			tRequestDER  []byte
+			tResponseDER []byte
+		)
+
+		switch r.Method {
+		case http.MethodGet:
+			if tEncoded, ok := strings.CutPrefix(r.URL.Path, pathPrefix+"/"); ok {
+				tRequestDER, tErr = base64.StdEncoding.DecodeString(tEncoded)
+			} else {
+				tErr = ErrOCSPPathInvalid
+			}
+		case http.MethodPost:
+			tRequestDER, tErr = io.ReadAll(http.MaxBytesReader(w, r.Body, OCSP_MAX_REQUEST_BYTES))
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			http.Error(w, "OCSP requests are sent with GET or POST.", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if tErr != nil {
+			tResponseDER = ocsp.MalformedRequestErrorResponse
+		} else if tResponderPtr, tErrorInfo := loadResponder(caDirectory); tErrorInfo.Error != nil {
+			errs.PrintErrorInfo(tErrorInfo)
+			tResponseDER = ocsp.InternalErrorErrorResponse
+		} else if tResponseDER, tNextUpdate, tErrorInfo = tResponderPtr.respond(tRequestDER, validity); tErrorInfo.Error != nil {
+			errs.PrintErrorInfo(tErrorInfo)
+			tResponseDER = ocsp.InternalErrorErrorResponse
+		}
+
+		w.Header().Set("Content-Type", CONTENT_TYPE_OCSP_RESPONSE)
+		if tNextUpdate.IsZero() {
+			w.Header().Set("Cache-Control", "no-store")
+		} else {
+			// The caching headers of RFC 5019 section 6.2.
+			tNow := time.Now()
+			w.Header().Set("Last-Modified", tNow.UTC().Format(http.TimeFormat))
+			w.Header().Set("Expires", tNextUpdate.UTC().Format(http.TimeFormat))
+			w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public, no-transform, must-revalidate", int(tNextUpdate.Sub(tNow).Seconds())))
+		}
+		_, _ = w.Write(tResponseDER)
+	})
+}
+
+// respond - the signed response to an OCSP request, with the status of each certificate it asks about. A request that cannot
+// be parsed gets a malformedRequest response, and one about certificates another CA issued gets unauthorized. The nonce is
+// echoed in the response extensions. nextUpdate is zero when the response must not be cached.
+//
+//	Customer Messages: None
+//	Errors: errors returned by readDatabase and ocspResponder.sign
+//	Verifications: None
+func (r *ocspResponder) respond(requestDER []byte, validity time.Duration) (responseDER []byte, nextUpdate time.Time, errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertIDs     []ocspCertID
+		tDatabasePtr *database
+		tErr         error
+		tExtensions  []pkix.Extension
+		tNoncePtr    *pkix.Extension
+		tNow         = time.Now().UTC().Truncate(time.Second)
+		tResponses   []ocspSingleResponse
+	)
+
+	if tCertIDs, tNoncePtr, tErr = parseOCSPRequest(requestDER); tErr != nil {
+		return ocsp.MalformedRequestErrorResponse, nextUpdate, errorInfo
+	}
+	for _, tCertID := range tCertIDs {
+		if r.issuerMatches(tCertID) == false {
+			return ocsp.UnauthorizedErrorResponse, nextUpdate, errorInfo
+		}
+	}
+	if tDatabasePtr, errorInfo = readDatabase(r.Directory); errorInfo.Error != nil {
+		return
+	}
+
+	for _, tCertID := range tCertIDs {
+		tResponses = append(tResponses, singleResponse(tDatabasePtr, tCertID, tNow, validity))
+	}
+	if tNoncePtr == nil {
+		nextUpdate = tNow.Add(validity)
+	} else {
+		tExtensions = []pkix.Extension{*tNoncePtr}
+	}
+	if responseDER, errorInfo = r.sign(tResponses, tExtensions, tNow); errorInfo.Error != nil {
+		return nil, time.Time{}, errorInfo
+	}
+
+	return
+}
+
+// stapleOCSP - pre-generates a signed response for each certificate that has not expired, or only for the serial, and writes
+// it as DER to <serial>.der for servers to staple. Each response is checked with golang.org/x/crypto/ocsp before it is
+// written. Run it again well before the responses' next update.
+//
+//	Customer Messages: None
+//	Errors: ErrOCSPValidityInvalid, ErrSerialInvalid, ErrSerialNotFound, errors returned by loadResponder, readDatabase,
+//	ocspResponder.certID, ocspResponder.sign, ocsp, os and certs.WriteOutFile
+//	Verifications: None
+func stapleOCSP(request ocspStapleRequest) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCertID       ocspCertID
+		tCount        int
+		tDatabasePtr  *database
+		tNow          = time.Now().UTC().Truncate(time.Second)
+		tResponderPtr *ocspResponder
+		tResponseDER  []byte
+		tResponsePtr  *ocsp.Response
+		tSerialPtr    *big.Int
+		ok            bool
+	)
+
+	if request.Validity <= 0 {
+		errorInfo = errs.NewErrorInfo(ErrOCSPValidityInvalid, fmt.Sprintf("Response Validity: %s", request.Validity))
+		return
+	}
+	if request.Serial != ctv.VAL_EMPTY {
+		if tSerialPtr, ok = parseSerial(request.Serial); ok == false {
+			errorInfo = errs.NewErrorInfo(ErrSerialInvalid, fmt.Sprintf("Serial: %s", request.Serial))
+			return
+		}
+	}
+	if request.OutDirectory == ctv.VAL_EMPTY {
+		request.OutDirectory = filepath.Join(request.CADirectory, DIRECTORY_OCSP_RESPONSES)
+	}
+	if tResponderPtr, errorInfo = loadResponder(request.CADirectory); errorInfo.Error != nil {
+		return
+	}
+	if tDatabasePtr, errorInfo = readDatabase(request.CADirectory); errorInfo.Error != nil {
+		return
+	}
+	if tSerialPtr != nil && tDatabasePtr.find(tSerialPtr) < 0 {
+		errorInfo = errs.NewErrorInfo(ErrSerialNotFound, fmt.Sprintf("Serial Number: %s", serialHex(tSerialPtr)))
+		return
+	}
+	if errorInfo.Error = os.MkdirAll(request.OutDirectory, DIRECTORY_PERMISSIONS); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Directory: %s", request.OutDirectory))
+		return
+	}
+
+	for _, tRecord := range tDatabasePtr.Records {
+		if (tSerialPtr != nil && tRecord.Serial.Cmp(tSerialPtr) != 0) || (tSerialPtr == nil && tRecord.status(tNow) == STATUS_EXPIRED) {
+			continue
+		}
+		if tCertID, errorInfo = tResponderPtr.certID(tRecord.Serial); errorInfo.Error != nil {
+			return
+		}
+		if tResponseDER, errorInfo = tResponderPtr.sign([]ocspSingleResponse{singleResponse(tDatabasePtr, tCertID, tNow, request.Validity)}, nil, tNow); errorInfo.Error != nil {
+			return
+		}
+		if tResponsePtr, errorInfo.Error = ocsp.ParseResponse(tResponseDER, tResponderPtr.Intermediate); errorInfo.Error == nil && tResponsePtr.SerialNumber.Cmp(tRecord.Serial) != 0 {
+			errorInfo.Error = ErrSerialNotFound
+		}
+		if errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Serial Number: %s", serialHex(tRecord.Serial)))
+			return
+		}
+		if errorInfo = certs.WriteOutFile(filepath.Join(request.OutDirectory, serialHex(tRecord.Serial)+EXTENSION_OCSP_RESPONSE), tResponseDER, PUBLIC_FILE_PERMISSIONS); errorInfo.Error != nil {
+			return
+		}
+		tCount++
+	}
+
+	fmt.Printf("%s %d OCSP response(s) written to %s. Next Update: %s\n", tNow.Format(time.RFC3339), tCount, request.OutDirectory,
+		tNow.Add(request.Validity).Format(time.RFC3339))
+
+	return
+}
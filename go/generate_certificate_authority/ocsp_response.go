@@ -0,0 +1,326 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// The ASN.1 structures of RFC 6960 section 4. golang.org/x/crypto/ocsp cannot put a nonce in the response extensions, where
+// RFC 8954 and OpenSSL expect it, so responses are built here.
+
+// ocspRequestASN1 - an OCSPRequest. The optional signature that follows the TBSRequest is not checked, because the responder
+// answers anyone.
+type ocspRequestASN1 struct {
+	TBSRequest ocspTBSRequest
+}
+
+type ocspTBSRequest struct {
+	Version       int           `asn1:"optional,default:0,explicit,tag:0"`
+	RequestorName asn1.RawValue `asn1:"optional,explicit,tag:1"`
+	RequestList   []ocspSingleRequest
+	Extensions    []pkix.Extension `asn1:"optional,explicit,tag:2"`
+}
+
+type ocspSingleRequest struct {
+	CertID     ocspCertID
+	Extensions []pkix.Extension `asn1:"optional,explicit,tag:0"`
+}
+
+type ocspCertID struct {
+	HashAlgorithm pkix.AlgorithmIdentifier
+	NameHash      []byte
+	IssuerKeyHash []byte
+	SerialNumber  *big.Int
+}
+
+// ocspResponseASN1 - an OCSPResponse. Only a successful response has ResponseBytes.
+type ocspResponseASN1 struct {
+	Status        asn1.Enumerated
+	ResponseBytes ocspResponseBytes `asn1:"optional,explicit,tag:0"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"optional,explicit,tag:0"`
+}
+
+type ocspResponseData struct {
+	Version            int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID        asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []ocspSingleResponse
+	ResponseExtensions []pkix.Extension `asn1:"optional,explicit,tag:1"`
+}
+
+// ocspSingleResponse - the status of one certificate. Exactly one of Good, Revoked and Unknown is set.
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag       `asn1:"optional,tag:0"`
+	Revoked    ocspRevokedInfo `asn1:"optional,tag:1"`
+	Unknown    asn1.Flag       `asn1:"optional,tag:2"`
+	ThisUpdate time.Time       `asn1:"generalized"`
+	NextUpdate time.Time       `asn1:"optional,generalized,explicit,tag:0"`
+}
+
+// ocspRevokedInfo - a Reason of unspecified (0) is left out, as RFC 5280 section 5.3.1 asks.
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"optional,explicit,tag:0"`
+}
+
+// subjectPublicKeyInfo - used to get the key bits that RFC 6960 hashes for the issuer key hash and the responder key hash.
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+var (
+	oidOCSPBasic   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+	oidOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+	oidOCSPNonce   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+	oidSHA1        = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	//
+	oidSignatureECDSAWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidSignatureECDSAWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidSignatureSHA256WithRSA   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	// ocspHashes - the hashes a request can identify the issuer with, by OID.
+	ocspHashes = map[string]crypto.Hash{
+		"1.3.14.3.2.26":          crypto.SHA1,
+		"2.16.840.1.101.3.4.2.1": crypto.SHA256,
+		"2.16.840.1.101.3.4.2.2": crypto.SHA384,
+		"2.16.840.1.101.3.4.2.3": crypto.SHA512,
+	}
+)
+
+// parseOCSPRequest - the certificates the request asks about, and the nonce extension when the request has one of 1 to
+// OCSP_MAX_NONCE_BYTES bytes. A nonce of another length is left out of the response, as RFC 8954 section 2.1 allows.
+func parseOCSPRequest(requestDER []byte) (certIDs []ocspCertID, noncePtr *pkix.Extension, err error) {
+
+	var (
+		tRequest ocspRequestASN1
+		tRest    []byte
+	)
+
+	if tRest, err = asn1.Unmarshal(requestDER, &tRequest); err != nil {
+		return
+	}
+	if len(tRest) > 0 || len(tRequest.TBSRequest.RequestList) == 0 {
+		err = errors.New("the OCSP request has trailing data or asks about no certificates")
+		return
+	}
+
+	for _, tSingleRequest := range tRequest.TBSRequest.RequestList {
+		certIDs = append(certIDs, tSingleRequest.CertID)
+	}
+	for _, tExtension := range tRequest.TBSRequest.Extensions {
+		if tExtension.Id.Equal(oidOCSPNonce) == false {
+			continue
+		}
+		// RFC 8954 makes the nonce a DER OCTET STRING, but older clients send the bytes alone.
+		tNonce := tExtension.Value
+		var tInner []byte
+		if tRest, tErr := asn1.Unmarshal(tExtension.Value, &tInner); tErr == nil && len(tRest) == 0 {
+			tNonce = tInner
+		}
+		if len(tNonce) >= 1 && len(tNonce) <= OCSP_MAX_NONCE_BYTES {
+			noncePtr = &pkix.Extension{Id: oidOCSPNonce, Value: tExtension.Value}
+		}
+	}
+
+	return
+}
+
+// issuerMatches - true when the certificate ID names the intermediate CA, using the hash the request chose.
+func (r *ocspResponder) issuerMatches(certID ocspCertID) bool {
+
+	tHash, ok := ocspHashes[certID.HashAlgorithm.Algorithm.String()]
+	if ok == false || tHash.Available() == false {
+		return false
+	}
+	tKeyBits, tErr := publicKeyBits(r.Intermediate)
+	if tErr != nil {
+		return false
+	}
+
+	tNameHash := tHash.New()
+	tNameHash.Write(r.Intermediate.RawSubject)
+	tKeyHash := tHash.New()
+	tKeyHash.Write(tKeyBits)
+
+	return string(tNameHash.Sum(nil)) == string(certID.NameHash) && string(tKeyHash.Sum(nil)) == string(certID.IssuerKeyHash)
+}
+
+// certID - the SHA-1 certificate ID of a certificate issued by the intermediate CA, which every OCSP client understands. It is
+// used for the pre-generated responses.
+//
+//	Customer Messages: None
+//	Errors: errors returned by publicKeyBits
+//	Verifications: None
+func (r *ocspResponder) certID(serialNumber *big.Int) (certID ocspCertID, errorInfo errs.ErrorInfo) {
+
+	var (
+		tKeyBits []byte
+	)
+
+	if tKeyBits, errorInfo.Error = publicKeyBits(r.Intermediate); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Intermediate: %s", r.Intermediate.Subject))
+		return
+	}
+	tNameHash := sha1.Sum(r.Intermediate.RawSubject)
+	tKeyHash := sha1.Sum(tKeyBits)
+
+	return ocspCertID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA1, Parameters: asn1.NullRawValue},
+		NameHash:      tNameHash[:],
+		IssuerKeyHash: tKeyHash[:],
+		SerialNumber:  serialNumber,
+	}, errorInfo
+}
+
+// singleResponse - the status of the certificate in the database: revoked with its time and reason, good when it was issued
+// and not revoked, and unknown when the intermediate never issued it.
+func singleResponse(databasePtr *database, certID ocspCertID, thisUpdate time.Time, validity time.Duration) (response ocspSingleResponse) {
+
+	response = ocspSingleResponse{CertID: certID, ThisUpdate: thisUpdate, NextUpdate: thisUpdate.Add(validity)}
+
+	tIndex := databasePtr.find(certID.SerialNumber)
+	switch {
+	case tIndex < 0:
+		response.Unknown = true
+	case databasePtr.Records[tIndex].Status == STATUS_REVOKED:
+		response.Revoked = ocspRevokedInfo{
+			RevocationTime: databasePtr.Records[tIndex].RevokedAt,
+			Reason:         asn1.Enumerated(databasePtr.Records[tIndex].Reason),
+		}
+	default:
+		response.Good = true
+	}
+
+	return
+}
+
+// sign - a successful OCSP response with the single responses and the extensions, signed by the responder, whose certificate
+// is included so clients can check it against the intermediate CA. The responder is identified by its key hash.
+//
+//	Customer Messages: None
+//	Errors: ErrResponderKeyTypeInvalid, errors returned by publicKeyBits, asn1 and the responder key
+//	Verifications: None
+func (r *ocspResponder) sign(responses []ocspSingleResponse, extensions []pkix.Extension, producedAt time.Time) (responseDER []byte, errorInfo errs.ErrorInfo) {
+
+	var (
+		tAlgorithm      pkix.AlgorithmIdentifier
+		tBasicResponse  []byte
+		tHash           crypto.Hash
+		tKeyBits        []byte
+		tKeyHashDER     []byte
+		tResponseData   []byte
+		tSignature      []byte
+		tResponderLabel = fmt.Sprintf("Responder: %s", r.Certificate.Subject)
+	)
+
+	if tHash, tAlgorithm, errorInfo = ocspSignatureAlgorithm(r.Key.Public()); errorInfo.Error != nil {
+		return
+	}
+	if tKeyBits, errorInfo.Error = publicKeyBits(r.Certificate); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, tResponderLabel)
+		return
+	}
+	tKeyHash := sha1.Sum(tKeyBits)
+	if tKeyHashDER, errorInfo.Error = asn1.Marshal(tKeyHash[:]); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, tResponderLabel)
+		return
+	}
+
+	if tResponseData, errorInfo.Error = asn1.Marshal(ocspResponseData{
+		ResponderID:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 2, IsCompound: true, Bytes: tKeyHashDER},
+		ProducedAt:         producedAt,
+		Responses:          responses,
+		ResponseExtensions: extensions,
+	}); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, tResponderLabel)
+		return
+	}
+
+	tDigest := tHash.New()
+	tDigest.Write(tResponseData)
+	if tSignature, errorInfo.Error = r.Key.Sign(rand.Reader, tDigest.Sum(nil), tHash); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, tResponderLabel)
+		return
+	}
+
+	if tBasicResponse, errorInfo.Error = asn1.Marshal(ocspBasicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tResponseData},
+		SignatureAlgorithm: tAlgorithm,
+		Signature:          asn1.BitString{Bytes: tSignature, BitLength: 8 * len(tSignature)},
+		Certificates:       []asn1.RawValue{{FullBytes: r.Certificate.Raw}},
+	}); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, tResponderLabel)
+		return
+	}
+	if responseDER, errorInfo.Error = asn1.Marshal(ocspResponseASN1{
+		ResponseBytes: ocspResponseBytes{ResponseType: oidOCSPBasic, Response: tBasicResponse},
+	}); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, tResponderLabel)
+	}
+
+	return
+}
+
+// ocspSignatureAlgorithm - the hash and signature algorithm for the responder key. Ed25519 is refused, because
+// golang.org/x/crypto/ocsp and many other clients cannot verify it.
+//
+//	Customer Messages: None
+//	Errors: ErrResponderKeyTypeInvalid
+//	Verifications: None
+func ocspSignatureAlgorithm(publicKey crypto.PublicKey) (hash crypto.Hash, algorithm pkix.AlgorithmIdentifier, errorInfo errs.ErrorInfo) {
+
+	switch tPublicKey := publicKey.(type) {
+	case *rsa.PublicKey:
+		return crypto.SHA256, pkix.AlgorithmIdentifier{Algorithm: oidSignatureSHA256WithRSA, Parameters: asn1.NullRawValue}, errorInfo
+	case *ecdsa.PublicKey:
+		switch tPublicKey.Curve {
+		case elliptic.P256():
+			return crypto.SHA256, pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA256}, errorInfo
+		case elliptic.P384():
+			return crypto.SHA384, pkix.AlgorithmIdentifier{Algorithm: oidSignatureECDSAWithSHA384}, errorInfo
+		}
+	}
+
+	errorInfo = errs.NewErrorInfo(ErrResponderKeyTypeInvalid, fmt.Sprintf("Public Key: %T", publicKey))
+
+	return
+}
+
+// publicKeyBits - the subjectPublicKey bits of the certificate, without the algorithm, as RFC 6960 hashes them.
+func publicKeyBits(certificatePtr *x509.Certificate) (keyBits []byte, err error) {
+
+	var (
+		tPublicKeyInfo subjectPublicKeyInfo
+	)
+
+	if _, err = asn1.Unmarshal(certificatePtr.RawSubjectPublicKeyInfo, &tPublicKeyInfo); err != nil {
+		return
+	}
+
+	return tPublicKeyInfo.PublicKey.RightAlign(), nil
+}
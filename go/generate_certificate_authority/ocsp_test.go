@@ -0,0 +1,391 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+)
+
+const (
+	TEST_OCSP_VALIDITY = time.Hour
+)
+
+// testResponseData - the ResponseData of a signed response, read with the revocation reason and the response extensions
+// left raw, so a test can tell a reason that is left out from unspecified (0).
+type testResponseData struct {
+	Version            int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID        asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []testSingleResponse
+	ResponseExtensions []pkix.Extension `asn1:"optional,explicit,tag:1"`
+}
+
+type testSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag        `asn1:"optional,tag:0"`
+	Revoked    testRevokedInfo  `asn1:"optional,tag:1"`
+	Unknown    asn1.Flag        `asn1:"optional,tag:2"`
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate asn1.RawValue    `asn1:"optional,explicit,tag:0"`
+	Extensions []pkix.Extension `asn1:"optional,explicit,tag:1"`
+}
+
+type testRevokedInfo struct {
+	RevocationTime time.Time     `asn1:"generalized"`
+	Reason         asn1.RawValue `asn1:"optional,explicit,tag:0"`
+}
+
+// newTestAuthority - an ECDSA P-256 root and intermediate CA in a temporary directory.
+func newTestAuthority(t *testing.T, organization string) (authorityPtr *authority) {
+
+	var (
+		tDirectory = t.TempDir()
+		tErrorInfo = initAuthority(initRequest{
+			CADirectory:            tDirectory,
+			IntermediatePathLength: 0,
+			IntermediateValidYears: 1,
+			KeyType:                KEY_TYPE_ECDSA_P256,
+			Organization:           organization,
+			RootPathLength:         1,
+			RootValidYears:         2,
+		})
+	)
+
+	if tErrorInfo.Error != nil {
+		t.Fatalf("initAuthority: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+	if authorityPtr, tErrorInfo = loadAuthority(tDirectory); tErrorInfo.Error != nil {
+		t.Fatalf("loadAuthority: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	return
+}
+
+// issueTestCertificate - a server certificate for the name, issued by the intermediate and recorded in the database.
+func issueTestCertificate(t *testing.T, authorityPtr *authority, name string) (certificatePtr *x509.Certificate) {
+
+	var (
+		tNow = time.Now()
+	)
+
+	tPrivateKey, tErrorInfo := certs.GenerateKey(KEY_TYPE_ECDSA_P256, 0, MIN_RSA_BITS)
+	if tErrorInfo.Error != nil {
+		t.Fatal(tErrorInfo.Error)
+	}
+	tTemplate := x509.Certificate{
+		Subject:     pkix.Name{CommonName: name},
+		DNSNames:    []string{name},
+		NotBefore:   tNow.Add(-time.Minute),
+		NotAfter:    tNow.AddDate(0, 0, 30),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: profiles[PROFILE_SERVER],
+	}
+	if certificatePtr, tErrorInfo = authorityPtr.issue(&tTemplate, tPrivateKey.Public(), PROFILE_SERVER); tErrorInfo.Error != nil {
+		t.Fatalf("issue %s: %s %s", name, tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	return
+}
+
+// postOCSP - sends the request to the responder with POST, or with GET and the base64 request in the path.
+func postOCSP(t *testing.T, serverPtr *httptest.Server, method string, requestDER []byte) (responseDER []byte, header http.Header) {
+
+	var (
+		tErr         error
+		tResponsePtr *http.Response
+	)
+
+	switch method {
+	case http.MethodGet:
+		tResponsePtr, tErr = http.Get(serverPtr.URL + "/" + url.PathEscape(base64.StdEncoding.EncodeToString(requestDER)))
+	default:
+		tResponsePtr, tErr = http.Post(serverPtr.URL, "application/ocsp-request", bytes.NewReader(requestDER))
+	}
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	defer tResponsePtr.Body.Close()
+	if tResponsePtr.StatusCode != http.StatusOK || tResponsePtr.Header.Get("Content-Type") != CONTENT_TYPE_OCSP_RESPONSE {
+		t.Fatalf("%s status %s Content-Type %q, want 200 and %s", method, tResponsePtr.Status, tResponsePtr.Header.Get("Content-Type"), CONTENT_TYPE_OCSP_RESPONSE)
+	}
+	if responseDER, tErr = io.ReadAll(tResponsePtr.Body); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	return responseDER, tResponsePtr.Header
+}
+
+// addNonce - the request with an RFC 8954 nonce extension, which golang.org/x/crypto/ocsp cannot add.
+func addNonce(t *testing.T, requestDER []byte, nonce []byte) []byte {
+
+	var (
+		tRequest ocspRequestASN1
+	)
+
+	if _, tErr := asn1.Unmarshal(requestDER, &tRequest); tErr != nil {
+		t.Fatal(tErr)
+	}
+	tNonceDER, tErr := asn1.Marshal(nonce)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	tRequest.TBSRequest.Extensions = append(tRequest.TBSRequest.Extensions, pkix.Extension{Id: oidOCSPNonce, Value: tNonceDER})
+	if requestDER, tErr = asn1.Marshal(tRequest); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	return requestDER
+}
+
+func parseResponseData(t *testing.T, responsePtr *ocsp.Response) (data testResponseData) {
+
+	if _, tErr := asn1.Unmarshal(responsePtr.TBSResponseData, &data); tErr != nil {
+		t.Fatalf("reading the response data: %s", tErr)
+	}
+	if len(data.Responses) != 1 {
+		t.Fatalf("the response has %d single responses, want 1", len(data.Responses))
+	}
+
+	return
+}
+
+func TestOCSPHandler(t *testing.T) {
+
+	tAuthorityPtr := newTestAuthority(t, "OCSP Test")
+	if tErrorInfo := createResponder(ocspResponderRequest{CADirectory: tAuthorityPtr.Directory, KeyType: KEY_TYPE_ECDSA_P256, ValidDays: 1}); tErrorInfo.Error != nil {
+		t.Fatalf("createResponder: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	tGoodPtr := issueTestCertificate(t, tAuthorityPtr, "good.example.com")
+	tCompromisedPtr := issueTestCertificate(t, tAuthorityPtr, "compromised.example.com")
+	tUnspecifiedPtr := issueTestCertificate(t, tAuthorityPtr, "unspecified.example.com")
+	for _, tRevoke := range []struct {
+		certificatePtr *x509.Certificate
+		reason         string
+	}{
+		{tCompromisedPtr, "keyCompromise"},
+		{tUnspecifiedPtr, "unspecified"},
+	} {
+		if tErrorInfo := revokeCertificate(tAuthorityPtr.Directory, serialHex(tRevoke.certificatePtr.SerialNumber), tRevoke.reason); tErrorInfo.Error != nil {
+			t.Fatalf("revokeCertificate: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+		}
+	}
+	// Never issued, so it is not in the database. CreateRequest only reads the serial number of the certificate.
+	tUnknownPtr := &x509.Certificate{SerialNumber: new(big.Int).Add(tGoodPtr.SerialNumber, big.NewInt(1))}
+
+	tServerPtr := httptest.NewServer(ocspHandler(tAuthorityPtr.Directory, ctv.VAL_EMPTY, TEST_OCSP_VALIDITY))
+	defer tServerPtr.Close()
+
+	for _, tCase := range []struct {
+		name           string
+		certificatePtr *x509.Certificate
+		wantStatus     int
+		wantReason     int
+		wantReasonOut  bool // The reason is left out of the response.
+	}{
+		{"good", tGoodPtr, ocsp.Good, 0, true},
+		{"revoked keyCompromise", tCompromisedPtr, ocsp.Revoked, ocsp.KeyCompromise, false},
+		{"revoked unspecified", tUnspecifiedPtr, ocsp.Revoked, ocsp.Unspecified, true},
+		{"unknown", tUnknownPtr, ocsp.Unknown, 0, true},
+	} {
+		for _, tMethod := range []string{http.MethodPost, http.MethodGet} {
+			t.Run(tCase.name+" "+tMethod, func(t *testing.T) {
+				tRequestDER, tErr := ocsp.CreateRequest(tCase.certificatePtr, tAuthorityPtr.Intermediate, nil)
+				if tErr != nil {
+					t.Fatal(tErr)
+				}
+				tResponseDER, tHeader := postOCSP(t, tServerPtr, tMethod, tRequestDER)
+
+				tResponsePtr, tErr := ocsp.ParseResponseForCert(tResponseDER, tCase.certificatePtr, tAuthorityPtr.Intermediate)
+				if tErr != nil {
+					t.Fatalf("ParseResponseForCert: %s", tErr)
+				}
+				if tResponsePtr.Status != tCase.wantStatus || tResponsePtr.SerialNumber.Cmp(tCase.certificatePtr.SerialNumber) != 0 {
+					t.Errorf("status %d serial %s, want %d %s", tResponsePtr.Status, serialHex(tResponsePtr.SerialNumber), tCase.wantStatus, serialHex(tCase.certificatePtr.SerialNumber))
+				}
+				if tResponsePtr.Status == ocsp.Revoked && tResponsePtr.RevocationReason != tCase.wantReason {
+					t.Errorf("revocation reason %d, want %d", tResponsePtr.RevocationReason, tCase.wantReason)
+				}
+				if tResponsePtr.NextUpdate.Sub(tResponsePtr.ThisUpdate) != TEST_OCSP_VALIDITY {
+					t.Errorf("this update %s next update %s, want %s apart", tResponsePtr.ThisUpdate, tResponsePtr.NextUpdate, TEST_OCSP_VALIDITY)
+				}
+				if tResponsePtr.Certificate == nil || tResponsePtr.Certificate.Equal(tAuthorityPtr.Intermediate) {
+					t.Error("the response is not signed by the delegated responder")
+				}
+
+				tData := parseResponseData(t, tResponsePtr)
+				if tReasonOut := tData.Responses[0].Revoked.Reason.FullBytes == nil; tReasonOut != tCase.wantReasonOut {
+					t.Errorf("reason left out = %t, want %t", tReasonOut, tCase.wantReasonOut)
+				}
+				if len(tData.ResponseExtensions) != 0 {
+					t.Errorf("a request without a nonce got response extensions %v", tData.ResponseExtensions)
+				}
+				if strings.Contains(tHeader.Get("Cache-Control"), "max-age=") == false {
+					t.Errorf("Cache-Control %q, want a max-age for a response without a nonce", tHeader.Get("Cache-Control"))
+				}
+			})
+		}
+	}
+}
+
+func TestOCSPHandlerNonce(t *testing.T) {
+
+	var (
+		tNonce = make([]byte, 16)
+	)
+
+	tAuthorityPtr := newTestAuthority(t, "OCSP Test")
+	if tErrorInfo := createResponder(ocspResponderRequest{CADirectory: tAuthorityPtr.Directory, KeyType: KEY_TYPE_ECDSA_P256, ValidDays: 1}); tErrorInfo.Error != nil {
+		t.Fatalf("createResponder: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+	tCertificatePtr := issueTestCertificate(t, tAuthorityPtr, "nonce.example.com")
+
+	tServerPtr := httptest.NewServer(ocspHandler(tAuthorityPtr.Directory, ctv.VAL_EMPTY, TEST_OCSP_VALIDITY))
+	defer tServerPtr.Close()
+
+	_, _ = rand.Read(tNonce)
+	tRequestDER, tErr := ocsp.CreateRequest(tCertificatePtr, tAuthorityPtr.Intermediate, nil)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	tRequestDER = addNonce(t, tRequestDER, tNonce)
+
+	for _, tMethod := range []string{http.MethodPost, http.MethodGet} {
+		tResponseDER, tHeader := postOCSP(t, tServerPtr, tMethod, tRequestDER)
+		tResponsePtr, tErr := ocsp.ParseResponseForCert(tResponseDER, tCertificatePtr, tAuthorityPtr.Intermediate)
+		if tErr != nil {
+			t.Fatalf("%s ParseResponseForCert: %s", tMethod, tErr)
+		}
+		if tResponsePtr.Status != ocsp.Good {
+			t.Errorf("%s status %d, want good", tMethod, tResponsePtr.Status)
+		}
+
+		tData := parseResponseData(t, tResponsePtr)
+		var tEchoed []byte
+		if len(tData.ResponseExtensions) != 1 || tData.ResponseExtensions[0].Id.Equal(oidOCSPNonce) == false {
+			t.Fatalf("%s response extensions %v, want only the nonce", tMethod, tData.ResponseExtensions)
+		}
+		if _, tErr = asn1.Unmarshal(tData.ResponseExtensions[0].Value, &tEchoed); tErr != nil || bytes.Equal(tEchoed, tNonce) == false {
+			t.Errorf("%s nonce %x, %v, want %x", tMethod, tEchoed, tErr, tNonce)
+		}
+		if tHeader.Get("Cache-Control") != "no-store" {
+			t.Errorf("%s Cache-Control %q, want no-store for a response with a nonce", tMethod, tHeader.Get("Cache-Control"))
+		}
+	}
+}
+
+func TestOCSPHandlerErrors(t *testing.T) {
+
+	tAuthorityPtr := newTestAuthority(t, "OCSP Test")
+	if tErrorInfo := createResponder(ocspResponderRequest{CADirectory: tAuthorityPtr.Directory, KeyType: KEY_TYPE_ECDSA_P256, ValidDays: 1}); tErrorInfo.Error != nil {
+		t.Fatalf("createResponder: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+	tForeignPtr := newTestAuthority(t, "Foreign")
+	tForeignCertificatePtr := issueTestCertificate(t, tForeignPtr, "foreign.example.com")
+
+	tServerPtr := httptest.NewServer(ocspHandler(tAuthorityPtr.Directory, ctv.VAL_EMPTY, TEST_OCSP_VALIDITY))
+	defer tServerPtr.Close()
+
+	tForeignRequestDER, tErr := ocsp.CreateRequest(tForeignCertificatePtr, tForeignPtr.Intermediate, nil)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	for _, tCase := range []struct {
+		name       string
+		requestDER []byte
+		want       ocsp.ResponseStatus
+	}{
+		{"another CA's certificate", tForeignRequestDER, ocsp.Unauthorized},
+		{"not an OCSP request", []byte("not an OCSP request"), ocsp.Malformed},
+	} {
+		for _, tMethod := range []string{http.MethodPost, http.MethodGet} {
+			tResponseDER, _ := postOCSP(t, tServerPtr, tMethod, tCase.requestDER)
+			_, tErr := ocsp.ParseResponse(tResponseDER, nil)
+			tResponseError, ok := tErr.(ocsp.ResponseError)
+			if ok == false || tResponseError.Status != tCase.want {
+				t.Errorf("%s %s: %v, want %s", tCase.name, tMethod, tErr, tCase.want)
+			}
+		}
+	}
+}
+
+// TestOCSPHandlerPathPrefix - with an OCSP URL that is not at the root, a GET request is the base64 request after the URL's
+// path. One at the root is malformed.
+func TestOCSPHandlerPathPrefix(t *testing.T) {
+
+	for _, tCase := range []struct {
+		ocspURL string
+		want    string
+	}{
+		{ocspURL: ctv.VAL_EMPTY, want: ctv.VAL_EMPTY},
+		{ocspURL: "http://ocsp.example.com:8081", want: ctv.VAL_EMPTY},
+		{ocspURL: "http://ocsp.example.com/", want: ctv.VAL_EMPTY},
+		{ocspURL: "https://ca.example.com/ocsp", want: "/ocsp"},
+		{ocspURL: "https://ca.example.com/pki/ocsp/", want: "/pki/ocsp"},
+	} {
+		if tPathPrefix, tErrorInfo := ocspPathPrefix(tCase.ocspURL); tErrorInfo.Error != nil || tPathPrefix != tCase.want {
+			t.Errorf("ocspPathPrefix(%q) = %q, %v, want %q", tCase.ocspURL, tPathPrefix, tErrorInfo.Error, tCase.want)
+		}
+	}
+
+	tAuthorityPtr := newTestAuthority(t, "OCSP Test")
+	if tErrorInfo := createResponder(ocspResponderRequest{CADirectory: tAuthorityPtr.Directory, KeyType: KEY_TYPE_ECDSA_P256, ValidDays: 1}); tErrorInfo.Error != nil {
+		t.Fatalf("createResponder: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+	tGoodPtr := issueTestCertificate(t, tAuthorityPtr, "good.example.com")
+	tRequestDER, tErr := ocsp.CreateRequest(tGoodPtr, tAuthorityPtr.Intermediate, nil)
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	tServerPtr := httptest.NewServer(ocspHandler(tAuthorityPtr.Directory, "/ocsp", TEST_OCSP_VALIDITY))
+	defer tServerPtr.Close()
+
+	for _, tCase := range []struct {
+		name     string
+		path     string
+		wantGood bool
+	}{
+		{name: "under the prefix", path: "/ocsp/", wantGood: true},
+		{name: "at the root", path: "/", wantGood: false},
+		{name: "another path", path: "/other/", wantGood: false},
+	} {
+		tResponsePtr, tErr := http.Get(tServerPtr.URL + tCase.path + url.PathEscape(base64.StdEncoding.EncodeToString(tRequestDER)))
+		if tErr != nil {
+			t.Fatal(tErr)
+		}
+		tResponseDER, tErr := io.ReadAll(tResponsePtr.Body)
+		tResponsePtr.Body.Close()
+		if tErr != nil {
+			t.Fatal(tErr)
+		}
+
+		tOCSPResponsePtr, tErr := ocsp.ParseResponseForCert(tResponseDER, tGoodPtr, tAuthorityPtr.Intermediate)
+		if tCase.wantGood {
+			if tErr != nil || tOCSPResponsePtr.Status != ocsp.Good {
+				t.Errorf("%s: %v, want a good response", tCase.name, tErr)
+			}
+			continue
+		}
+		if tResponseError, ok := tErr.(ocsp.ResponseError); ok == false || tResponseError.Status != ocsp.Malformed {
+			t.Errorf("%s: %v, want %s", tCase.name, tErr, ocsp.Malformed)
+		}
+	}
+}
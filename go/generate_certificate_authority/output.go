@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+
+	certs "certificate_services"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// readCertificates - every CERTIFICATE block in a PEM file, in order. There must be at least one.
+//
+//	Customer Messages: None
+//	Errors: ErrPEMInvalid, errors returned by os and x509
+//	Verifications: None
+func readCertificates(fqn string) (certificates []*x509.Certificate, errorInfo errs.ErrorInfo) {
+
+	var (
+		tBlockPtr       *pem.Block
+		tCertificatePtr *x509.Certificate
+		tData           []byte
+	)
+
+	if tData, errorInfo.Error = os.ReadFile(fqn); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+		return
+	}
+
+	for {
+		if tBlockPtr, tData = pem.Decode(tData); tBlockPtr == nil {
+			break
+		}
+		if tBlockPtr.Type != PEM_CERTIFICATE {
+			continue
+		}
+		if tCertificatePtr, errorInfo.Error = x509.ParseCertificate(tBlockPtr.Bytes); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", fqn))
+			return
+		}
+		certificates = append(certificates, tCertificatePtr)
+	}
+	if len(certificates) == 0 {
+		errorInfo = errs.NewErrorInfo(ErrPEMInvalid, fmt.Sprintf("File: %s Expected: %s", fqn, PEM_CERTIFICATE))
+	}
+
+	return
+}
+
+// writeCertificatesFile - the certificates as consecutive PEM blocks, in the order given.
+//
+//	Customer Messages: None
+//	Errors: errors returned by certs.WriteOutFile
+//	Verifications: None
+func writeCertificatesFile(fqn string, certificates []*x509.Certificate) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tBuffer bytes.Buffer
+	)
+
+	for _, tCertificatePtr := range certificates {
+		tBuffer.Write(pem.EncodeToMemory(&pem.Block{Type: PEM_CERTIFICATE, Bytes: tCertificatePtr.Raw}))
+	}
+
+	return certs.WriteOutFile(fqn, tBuffer.Bytes(), PUBLIC_FILE_PERMISSIONS)
+}
+
+// writeOutPEMFile - one PEM block of the type.
+//
+//	Customer Messages: None
+//	Errors: errors returned by certs.WriteOutFile
+//	Verifications: None
+func writeOutPEMFile(fqn string, der []byte, pemType string, permissions os.FileMode) (errorInfo errs.ErrorInfo) {
+
+	return certs.WriteOutFile(fqn, pem.EncodeToMemory(&pem.Block{Type: pemType, Bytes: der}), permissions)
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"crypto/x509"
+)
+
+var (
+	// profiles - the extended key usages of the certificates the intermediate issues, by profile name.
+	profiles = map[string][]x509.ExtKeyUsage{
+		PROFILE_CLIENT: {x509.ExtKeyUsageClientAuth},
+		PROFILE_PEER:   {x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		PROFILE_SERVER: {x509.ExtKeyUsageServerAuth},
+	}
+)
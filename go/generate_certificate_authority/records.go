@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// listRecords - prints the issued certificates, optionally only those with the status.
+//
+//	Customer Messages: None
+//	Errors: ErrStatusInvalid, errors returned by readDatabase
+//	Verifications: None
+func listRecords(caDirectory string, status string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tDatabasePtr *database
+		tNow         = time.Now()
+		tRecords     []record
+	)
+
+	status = strings.ToUpper(status)
+	if status != ctv.VAL_EMPTY && status != STATUS_VALID && status != STATUS_REVOKED && status != STATUS_EXPIRED {
+		errorInfo = errs.NewErrorInfo(ErrStatusInvalid, fmt.Sprintf("Status: %s", status))
+		return
+	}
+	if tDatabasePtr, errorInfo = readDatabase(caDirectory); errorInfo.Error != nil {
+		return
+	}
+
+	for _, tRecord := range tDatabasePtr.Records {
+		if status == ctv.VAL_EMPTY || tRecord.status(tNow) == status {
+			tRecords = append(tRecords, tRecord)
+		}
+	}
+	printRecords(tRecords, tNow)
+
+	return
+}
+
+// searchRecords - prints the issued certificates whose serial number, subject, subject alternative names or profile contain
+// the query, ignoring case.
+//
+//	Customer Messages: None
+//	Errors: errors returned by readDatabase
+//	Verifications: None
+func searchRecords(caDirectory string, query string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tDatabasePtr *database
+		tRecords     []record
+	)
+
+	if tDatabasePtr, errorInfo = readDatabase(caDirectory); errorInfo.Error != nil {
+		return
+	}
+
+	query = strings.ToLower(strings.ReplaceAll(query, ":", ""))
+	for _, tRecord := range tDatabasePtr.Records {
+		tText := strings.ToLower(strings.Join([]string{serialHex(tRecord.Serial), tRecord.Subject, strings.Join(tRecord.SANs, ","), tRecord.Profile}, "\t"))
+		// Colons are dropped from both, so a serial number copied from openssl, with colons, still matches.
+		if strings.Contains(strings.ReplaceAll(tText, ":", ""), query) {
+			tRecords = append(tRecords, tRecord)
+		}
+	}
+	printRecords(tRecords, time.Now())
+
+	return
+}
+
+// revokeCertificate - marks the certificate with the serial number revoked, for the reason.
+//
+//	Customer Messages: None
+//	Errors: ErrReasonInvalid, ErrSerialInvalid, errors returned by lockDatabase, readDatabase, database.revoke and database.write
+//	Verifications: None
+func revokeCertificate(caDirectory string, serial string, reasonName string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tDatabasePtr *database
+		tNow         = time.Now()
+		tUnlock      func()
+	)
+
+	tSerialNumber, ok := parseSerial(serial)
+	if ok == false {
+		errorInfo = errs.NewErrorInfo(ErrSerialInvalid, fmt.Sprintf("Serial: %s", serial))
+		return
+	}
+	tReason, ok := parseReason(reasonName)
+	if ok == false {
+		errorInfo = errs.NewErrorInfo(ErrReasonInvalid, fmt.Sprintf("Reason: %s", reasonName))
+		return
+	}
+
+	if tUnlock, errorInfo = lockDatabase(caDirectory); errorInfo.Error != nil {
+		return
+	}
+	defer tUnlock()
+	if tDatabasePtr, errorInfo = readDatabase(caDirectory); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = tDatabasePtr.revoke(tSerialNumber, tReason, tNow); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = tDatabasePtr.write(); errorInfo.Error != nil {
+		return
+	}
+
+	tRecord := tDatabasePtr.Records[tDatabasePtr.find(tSerialNumber)]
+	fmt.Println("The certificate has been revoked.")
+	fmt.Printf("%sSerial Number: %s\n", ctv.SPACES_FOUR, serialHex(tSerialNumber))
+	fmt.Printf("%sSubject: %s\n", ctv.SPACES_FOUR, tRecord.Subject)
+	fmt.Printf("%sReason: %s (%d)\n", ctv.SPACES_FOUR, revocationReasons[tReason], tReason)
+	fmt.Printf("%sRevoked: %s\n", ctv.SPACES_FOUR, tRecord.RevokedAt.Format(time.RFC3339))
+
+	return
+}
+
+// printRecords - the records as a table.
+func printRecords(records []record, now time.Time) {
+
+	tWriterPtr := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tWriterPtr, "STATUS\tSERIAL\tNOT AFTER\tPROFILE\tSUBJECT\tNAMES\tREVOKED")
+	for _, tRecord := range records {
+		tRevoked := ctv.VAL_EMPTY
+		if tRecord.Status == STATUS_REVOKED {
+			tRevoked = tRecord.RevokedAt.Format(time.RFC3339) + " " + revocationReasons[tRecord.Reason]
+		}
+		_, _ = fmt.Fprintf(tWriterPtr, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", tRecord.status(now), serialHex(tRecord.Serial), tRecord.NotAfter.UTC().Format(time.RFC3339),
+			tRecord.Profile, tRecord.Subject, strings.Join(tRecord.SANs, ","), tRevoked)
+	}
+	_ = tWriterPtr.Flush()
+	fmt.Printf("%d certificate(s)\n", len(records))
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// selfTest - issues a short-lived server certificate from the intermediate CA, serves HTTPS with it from an httptest server,
+// and connects with a client that trusts only the root. It proves the chain, key usages and name constraints work together
+// for a TLS client. The certificate is recorded in the database like any other, but its key is never written to disk.
+//
+//	Customer Messages: None
+//	Errors: ErrSelfTestFailed, errors returned by loadAuthority, ecdsa, authority.issue, http and io
+//	Verifications: None
+func selfTest(caDirectory string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tAuthorityPtr   *authority
+		tBody           []byte
+		tCertificatePtr *x509.Certificate
+		tHost           = SELF_TEST_HOST
+		tNow            = time.Now()
+		tPrivateKey     crypto.Signer
+		tResponsePtr    *http.Response
+	)
+
+	if tAuthorityPtr, errorInfo = loadAuthority(caDirectory); errorInfo.Error != nil {
+		return
+	}
+	// With permitted DNS domains, localhost would be outside the constraints, so use a name inside the first one.
+	if len(tAuthorityPtr.Intermediate.PermittedDNSDomains) > 0 {
+		tHost = SELF_TEST_SUBDOMAIN + "." + strings.TrimPrefix(tAuthorityPtr.Intermediate.PermittedDNSDomains[0], ".")
+	}
+
+	if tPrivateKey, errorInfo.Error = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, "Self-Test Key")
+		return
+	}
+	tTemplate := x509.Certificate{
+		Subject:     pkix.Name{CommonName: tHost},
+		DNSNames:    []string{tHost},
+		NotBefore:   tNow.Add(-BACKDATE),
+		NotAfter:    tNow.Add(SELF_TEST_VALIDITY),
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if tCertificatePtr, errorInfo = tAuthorityPtr.issue(&tTemplate, tPrivateKey.Public(), PROFILE_SERVER); errorInfo.Error != nil {
+		return
+	}
+
+	// set up the httptest.Server using the certificate signed by the intermediate CA
+	tServerPtr := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintln(w, SELF_TEST_RESPONSE)
+	}))
+	tServerPtr.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: tAuthorityPtr.chain(tCertificatePtr), PrivateKey: tPrivateKey, Leaf: tCertificatePtr}},
+	}
+	tServerPtr.StartTLS()
+	defer tServerPtr.Close()
+
+	// communicate with the server using an http.Client that trusts only the root CA
+	tRoots := x509.NewCertPool()
+	tRoots.AddCert(tAuthorityPtr.Root)
+	tClient := http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: tRoots, ServerName: tHost}},
+		Timeout:   10 * time.Second,
+	}
+	if tResponsePtr, errorInfo.Error = tClient.Get(tServerPtr.URL); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Self-Test Host: %s", tHost))
+		return
+	}
+	defer tResponsePtr.Body.Close()
+
+	// verify the response
+	if tBody, errorInfo.Error = io.ReadAll(tResponsePtr.Body); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Self-Test Host: %s", tHost))
+		return
+	}
+	if strings.TrimSpace(string(tBody)) != SELF_TEST_RESPONSE {
+		errorInfo = errs.NewErrorInfo(ErrSelfTestFailed, fmt.Sprintf("Self-Test Host: %s Response: %s", tHost, tBody))
+		return
+	}
+
+	fmt.Printf("Self-test passed: a TLS client trusting only the root connected to %s.\n", tHost)
+
+	return
+}
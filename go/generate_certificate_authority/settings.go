@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	certs "certificate_services"
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// settings - what the intermediate CA puts in the certificates it issues, kept in the CA directory.
+type settings struct {
+	CRLURL  string `json:"crl_url,omitempty"`  // The CRL Distribution Point of issued certificates.
+	OCSPURL string `json:"ocsp_url,omitempty"` // The OCSP responder in the Authority Information Access of issued certificates.
+}
+
+// readSettings - reads the settings file in the CA directory. A missing file is empty settings.
+//
+//	Customer Messages: None
+//	Errors: errors returned by os and json
+//	Verifications: None
+func readSettings(caDirectory string) (caSettings settings, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData        []byte
+		tSettingsFQN = filepath.Join(caDirectory, FILE_SETTINGS)
+	)
+
+	if tData, errorInfo.Error = os.ReadFile(tSettingsFQN); errors.Is(errorInfo.Error, os.ErrNotExist) {
+		errorInfo.Error = nil
+		return
+	}
+	if errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Settings File: %s", tSettingsFQN))
+		return
+	}
+	if errorInfo.Error = json.Unmarshal(tData, &caSettings); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Settings File: %s", tSettingsFQN))
+	}
+
+	return
+}
+
+// write - replaces the settings file in the CA directory.
+//
+//	Customer Messages: None
+//	Errors: errors returned by json and certs.WriteOutFile
+//	Verifications: None
+func (s settings) write(caDirectory string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tData []byte
+	)
+
+	if tData, errorInfo.Error = json.MarshalIndent(s, ctv.VAL_EMPTY, "  "); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Settings File: %s", filepath.Join(caDirectory, FILE_SETTINGS)))
+		return
+	}
+
+	return certs.WriteOutFile(filepath.Join(caDirectory, FILE_SETTINGS), append(tData, '\n'), PUBLIC_FILE_PERMISSIONS)
+}
+
+// updateSettings - sets the URLs that are given and prints the settings. An empty URL leaves the setting as it is, and "none"
+// removes it.
+//
+//	Customer Messages: None
+//	Errors: ErrURLInvalid, errors returned by readSettings and settings.write
+//	Verifications: None
+func updateSettings(caDirectory string, crlURL string, ocspURL string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tSettings settings
+	)
+
+	if tSettings, errorInfo = readSettings(caDirectory); errorInfo.Error != nil {
+		return
+	}
+	if tSettings.CRLURL, errorInfo = updateURL(tSettings.CRLURL, crlURL); errorInfo.Error != nil {
+		return
+	}
+	if tSettings.OCSPURL, errorInfo = updateURL(tSettings.OCSPURL, ocspURL); errorInfo.Error != nil {
+		return
+	}
+	if errorInfo = tSettings.write(caDirectory); errorInfo.Error != nil {
+		return
+	}
+
+	fmt.Printf("The settings in %s are:\n", filepath.Join(caDirectory, FILE_SETTINGS))
+	fmt.Printf("%sCRL URL: %s\n", ctv.SPACES_FOUR, tSettings.CRLURL)
+	fmt.Printf("%sOCSP URL: %s\n", ctv.SPACES_FOUR, tSettings.OCSPURL)
+
+	return
+}
+
+// updateURL - the new value of a URL setting. An empty value keeps the current one and SETTING_NONE clears it.
+//
+//	Customer Messages: None
+//	Errors: ErrURLInvalid
+//	Verifications: None
+func updateURL(current string, value string) (updated string, errorInfo errs.ErrorInfo) {
+
+	switch value {
+	case ctv.VAL_EMPTY:
+		return current, errorInfo
+	case SETTING_NONE:
+		return ctv.VAL_EMPTY, errorInfo
+	}
+
+	if tURLPtr, tErr := url.Parse(value); tErr != nil || (tURLPtr.Scheme != "http" && tURLPtr.Scheme != "https") || tURLPtr.Host == ctv.VAL_EMPTY {
+		errorInfo = errs.NewErrorInfo(ErrURLInvalid, fmt.Sprintf("URL: %s", value))
+		return
+	}
+
+	return value, errorInfo
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	firebase "firebase.google.com/go"
+	"firebase.google.com/go/auth"
+	"google.golang.org/api/option"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+	fbs "github.com/sty-holdings/sharedServices/v2024/firebaseServices"
+)
+
+// emulatorTransport rewrites Google Identity Toolkit requests so they are served by the Firebase Auth Emulator.
+type emulatorTransport struct {
+	host string
+}
+
+// RoundTrip - sends https://identitytoolkit.googleapis.com/... to http://{emulator host}/identitytoolkit.googleapis.com/...
+// using the emulator's owner credentials.
+func (t emulatorTransport) RoundTrip(request *http.Request) (response *http.Response, err error) {
+
+	tRequest := request.Clone(request.Context())
+	tRequest.URL.Scheme = "http"
+	tRequest.URL.Path = "/" + request.URL.Host + request.URL.Path
+	tRequest.URL.Host = t.host
+	tRequest.Host = t.host
+	tRequest.Header.Set("Authorization", "Bearer "+EMULATOR_BEARER_TOKEN)
+
+	return http.DefaultTransport.RoundTrip(tRequest)
+}
+
+// getAuthConnection - returns a Firebase Auth client. When FIREBASE_AUTH_EMULATOR_HOST is set, the client talks to the emulator,
+// otherwise the sharedServices Firebase connection is used with the configured credentials.
+//
+//	Customer Messages: None
+//	Errors: ErrProjectIdMissing, errors returned by Firebase
+//	Verifications: None
+func getAuthConnection(config Config) (authPtr *auth.Client, errorInfo errs.ErrorInfo) {
+
+	var (
+		tAppPtr *firebase.App
+	)
+
+	if isEmulator() == false {
+		_, authPtr, errorInfo = fbs.GetFirebaseAppAuthConnection(config.FirebaseCredentials)
+		return
+	}
+
+	if config.ProjectId == ctv.VAL_EMPTY {
+		errorInfo = errs.NewErrorInfo(ErrProjectIdMissing, fmt.Sprintf("Emulator: %s", getEmulatorHost()))
+		return
+	}
+
+	if tAppPtr, errorInfo.Error = firebase.NewApp(
+		context.Background(),
+		&firebase.Config{ProjectID: config.ProjectId},
+		option.WithHTTPClient(&http.Client{Transport: emulatorTransport{host: getEmulatorHost()}}),
+	); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Emulator: %s", getEmulatorHost()))
+		return
+	}
+
+	if authPtr, errorInfo.Error = tAppPtr.Auth(context.Background()); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Emulator: %s", getEmulatorHost()))
+	}
+
+	return
+}
+
+func getEmulatorHost() string {
+	return os.Getenv(ENV_AUTH_EMULATOR_HOST)
+}
+
+func isEmulator() bool {
+	return getEmulatorHost() != ctv.VAL_EMPTY
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"firebase.google.com/go/auth"
+	"gopkg.in/yaml.v3"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// ClaimsFile is the declarative mapping of users to roles used by the reconcile_claims action.
+// Each role is a set of claims. A user's claims are the claims of its roles, in order, followed by its own claims.
+type ClaimsFile struct {
+	Roles map[string]map[string]interface{} `yaml:"roles"`
+	Users []ClaimsFileUser                  `yaml:"users"`
+}
+
+type ClaimsFileUser struct {
+	Claims map[string]interface{} `yaml:"claims"` // Optional claims applied after the roles.
+	Email  string                 `yaml:"email"`  // Used when uid is empty.
+	Roles  []string               `yaml:"roles"`
+	UID    string                 `yaml:"uid"`
+}
+
+// showClaims - outputs the custom claims of a user, found by UID or email.
+//
+//	Customer Messages: None
+//	Errors: ErrUserIdentifierEmpty, errors returned by Firebase
+//	Verifications: None
+func showClaims(authPtr *auth.Client, userId string, email string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tData          []byte
+		tUserRecordPtr *auth.UserRecord
+	)
+
+	if tUserRecordPtr, errorInfo = findUser(authPtr, userId, email); errorInfo.Error != nil {
+		return
+	}
+
+	if tUserRecordPtr.CustomClaims == nil {
+		tUserRecordPtr.CustomClaims = map[string]interface{}{}
+	}
+	tData, _ = json.MarshalIndent(tUserRecordPtr.CustomClaims, ctv.VAL_EMPTY, ctv.SPACES_FOUR)
+	fmt.Printf("UID: %s\nCustom Claims:\n%s\n", tUserRecordPtr.UID, string(tData))
+
+	return
+}
+
+// updateClaims - sets, merges or removes the custom claims of a user, found by UID or email.
+// set replaces every claim, merge adds or overwrites the given claims, and remove deletes the named claims.
+//
+//	Customer Messages: None
+//	Errors: ErrClaimsTooLarge, ErrUserIdentifierEmpty, errors returned by Firebase
+//	Verifications: None
+func updateClaims(authPtr *auth.Client, userId string, email string, operation string, claims map[string]interface{}, claimNames []string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tAfter         = make(map[string]interface{})
+		tUserRecordPtr *auth.UserRecord
+	)
+
+	if tUserRecordPtr, errorInfo = findUser(authPtr, userId, email); errorInfo.Error != nil {
+		return
+	}
+
+	if operation != ACTION_SET_CLAIMS {
+		for tName, tValue := range tUserRecordPtr.CustomClaims {
+			tAfter[tName] = tValue
+		}
+	}
+	switch operation {
+	case ACTION_SET_CLAIMS, ACTION_MERGE_CLAIMS:
+		for tName, tValue := range claims {
+			tAfter[tName] = tValue
+		}
+	case ACTION_REMOVE_CLAIMS:
+		for _, tName := range claimNames {
+			delete(tAfter, tName)
+		}
+	}
+
+	errorInfo = applyClaims(authPtr, tUserRecordPtr, tAfter, false)
+
+	return
+}
+
+// reconcileClaims - makes the custom claims of every user in the claims file match the file.
+// Users that are not in the file are not changed. With dryRun, the diffs are output and nothing is written.
+//
+//	Customer Messages: None
+//	Errors: ErrClaimsReconcileFailed, ErrRoleUndefined, errors returned by os and yaml
+//	Verifications: None
+func reconcileClaims(authPtr *auth.Client, filename string, dryRun bool) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tClaimsFile    ClaimsFile
+		tData          []byte
+		tFailures      int
+		tUserRecordPtr *auth.UserRecord
+	)
+
+	if tData, errorInfo.Error = os.ReadFile(filename); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", filename))
+		return
+	}
+	if errorInfo.Error = yaml.Unmarshal(tData, &tClaimsFile); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", filename))
+		return
+	}
+
+	// Every role is checked before any user is changed, so a typo does not leave the project half reconciled.
+	for tIndex, tUser := range tClaimsFile.Users {
+		for _, tRole := range tUser.Roles {
+			if _, ok := tClaimsFile.Roles[tRole]; ok == false {
+				errorInfo = errs.NewErrorInfo(ErrRoleUndefined, fmt.Sprintf("User: %d Role: %s", tIndex+1, tRole))
+				return
+			}
+		}
+	}
+
+	for _, tUser := range tClaimsFile.Users {
+		tDesired := make(map[string]interface{})
+		for _, tRole := range tUser.Roles {
+			for tName, tValue := range tClaimsFile.Roles[tRole] {
+				tDesired[tName] = tValue
+			}
+		}
+		for tName, tValue := range tUser.Claims {
+			tDesired[tName] = tValue
+		}
+
+		if tUserRecordPtr, errorInfo = findUser(authPtr, tUser.UID, tUser.Email); errorInfo.Error == nil {
+			errorInfo = applyClaims(authPtr, tUserRecordPtr, tDesired, dryRun)
+		}
+		if errorInfo.Error != nil {
+			errs.PrintErrorInfo(errorInfo)
+			tFailures++
+		}
+	}
+
+	errorInfo = errs.ErrorInfo{}
+	if tFailures > 0 {
+		errorInfo = errs.NewErrorInfo(ErrClaimsReconcileFailed, fmt.Sprintf("Failed: %d", tFailures))
+	}
+
+	return
+}
+
+// applyClaims - outputs the diff between the current and new claims and, unless dryRun is set, writes the new claims.
+// The size limit is checked before Firebase is called.
+//
+//	Customer Messages: None
+//	Errors: ErrClaimsTooLarge, errors returned by Firebase
+//	Verifications: None
+func applyClaims(authPtr *auth.Client, userRecordPtr *auth.UserRecord, after map[string]interface{}, dryRun bool) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tData []byte
+		tDiff []string
+	)
+
+	tDiff = diffClaims(userRecordPtr.CustomClaims, after)
+	if len(tDiff) == 0 {
+		fmt.Printf("UID: %s claims are unchanged.\n", userRecordPtr.UID)
+		return
+	}
+
+	if tData, errorInfo.Error = json.Marshal(after); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(ErrClaimsInvalid, fmt.Sprintf("UID: %s %s", userRecordPtr.UID, errorInfo.Error.Error()))
+		return
+	}
+	if len(tData) > MAX_CLAIMS_BYTES {
+		errorInfo = errs.NewErrorInfo(ErrClaimsTooLarge, fmt.Sprintf("UID: %s Bytes: %d", userRecordPtr.UID, len(tData)))
+		return
+	}
+
+	fmt.Printf("UID: %s\n", userRecordPtr.UID)
+	for _, tLine := range tDiff {
+		fmt.Printf("%s%s\n", ctv.SPACES_FOUR, tLine)
+	}
+	if dryRun {
+		fmt.Println("    (dry run, not written)")
+		return
+	}
+
+	if len(after) == 0 {
+		after = nil
+	}
+	if errorInfo.Error = authPtr.SetCustomUserClaims(context.Background(), userRecordPtr.UID, after); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("UID: %s", userRecordPtr.UID))
+	}
+
+	return
+}
+
+// diffClaims - returns one line per claim that is added (+), removed (-) or changed (~), sorted by claim name.
+// Values are compared as JSON, so 1 from a file matches 1 returned by Firebase as a float.
+func diffClaims(before map[string]interface{}, after map[string]interface{}) (diff []string) {
+
+	var (
+		tNames = make(map[string]bool)
+		tOrder []string
+	)
+
+	for tName := range before {
+		tNames[tName] = true
+	}
+	for tName := range after {
+		tNames[tName] = true
+	}
+	for tName := range tNames {
+		tOrder = append(tOrder, tName)
+	}
+	sort.Strings(tOrder)
+
+	for _, tName := range tOrder {
+		tBefore, tInBefore := before[tName]
+		tAfter, tInAfter := after[tName]
+		switch {
+		case tInBefore == false:
+			diff = append(diff, fmt.Sprintf("+ %s: %s", tName, claimJSON(tAfter)))
+		case tInAfter == false:
+			diff = append(diff, fmt.Sprintf("- %s: %s", tName, claimJSON(tBefore)))
+		case claimJSON(tBefore) != claimJSON(tAfter):
+			diff = append(diff, fmt.Sprintf("~ %s: %s -> %s", tName, claimJSON(tBefore), claimJSON(tAfter)))
+		}
+	}
+
+	return
+}
+
+// parseClaimNames - splits a comma separated list of claim names.
+func parseClaimNames(claimNames string) (names []string) {
+
+	for _, tName := range strings.Split(claimNames, ",") {
+		if tName = strings.TrimSpace(tName); tName != ctv.VAL_EMPTY {
+			names = append(names, tName)
+		}
+	}
+
+	return
+}
+
+func claimJSON(value interface{}) string {
+
+	tData, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(tData)
+}
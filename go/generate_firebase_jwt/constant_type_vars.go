@@ -0,0 +1,110 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+//goland:noinspection ALL
+const (
+	ACTION_CREATE  = "create"
+	ACTION_DECODE  = "decode"
+	ACTION_DELETE  = "delete"
+	ACTION_DISABLE = "disable"
+	ACTION_ENABLE  = "enable"
+	ACTION_EXPORT  = "export"
+	ACTION_IMPORT  = "import"
+	ACTION_LIST    = "list"
+	ACTION_SERVE   = "serve"
+	ACTION_TOKEN   = "token"
+	ACTION_VERIFY  = "verify"
+	//
+	ACTION_MERGE_CLAIMS     = "merge_claims"
+	ACTION_RECONCILE_CLAIMS = "reconcile_claims"
+	ACTION_REMOVE_CLAIMS    = "remove_claims"
+	ACTION_SET_CLAIMS       = "set_claims"
+	ACTION_SHOW_CLAIMS      = "show_claims"
+)
+
+//goland:noinspection ALL
+const (
+	CLAIM_AUDIENCE   = "aud"
+	CLAIM_AUTH_TIME  = "auth_time"
+	CLAIM_EXPIRES    = "exp"
+	CLAIM_ISSUED_AT  = "iat"
+	CLAIM_ISSUER     = "iss"
+	CLAIM_NOT_BEFORE = "nbf"
+	CLAIM_SUBJECT    = "sub"
+	//
+	CHECK_SIGNATURE  = "signature"
+	HEADER_ALGORITHM = "alg"
+	HEADER_KEY_ID    = "kid"
+	PEM_CERTIFICATE  = "CERTIFICATE"
+	//
+	FIREBASE_ISSUER_PREFIX = "https://securetoken.google.com/"
+)
+
+//goland:noinspection ALL
+const (
+	ENV_AUTH_EMULATOR_HOST = "FIREBASE_AUTH_EMULATOR_HOST"
+	//
+	EMULATOR_BEARER_TOKEN     = "owner"
+	EMULATOR_SERVICE_ACCOUNT  = "firebase-auth-emulator@example.com"
+	FIREBASE_CUSTOM_TOKEN_AUD = "https://identitytoolkit.googleapis.com/google.identity.identitytoolkit.v1.IdentityToolkit"
+	SIGN_IN_CUSTOM_TOKEN_URL  = "http://%s/identitytoolkit.googleapis.com/v1/accounts:signInWithCustomToken?key=%s"
+	//
+	CUSTOM_TOKEN_LIFETIME_SECONDS = 3600
+	MAX_CLAIMS_BYTES              = 1000
+)
+
+//goland:noinspection ALL
+const (
+	ISSUER_PATH_JWKS            = "/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
+	ISSUER_PATH_JWKS_WELL_KNOWN = "/.well-known/jwks.json"
+	ISSUER_PATH_TOKEN           = "/token"
+	ISSUER_PATH_X509            = "/robot/v1/metadata/x509/securetoken@system.gserviceaccount.com"
+	//
+	DEFAULT_ISSUER_ADDRESS      = "127.0.0.1:9190"
+	ISSUER_CACHE_CONTROL        = "public, max-age=3600"
+	ISSUER_CERTIFICATE_LIFETIME = 365 * 24 * time.Hour
+	ISSUER_RSA_BITS             = 2048
+	ID_TOKEN_LIFETIME_SECONDS   = 3600
+)
+
+//goland:noinspection ALL
+const (
+	FORMAT_CSV  = "csv"
+	FORMAT_JSON = "json"
+	//
+	HASH_BCRYPT          = "BCRYPT"
+	HASH_SCRYPT          = "SCRYPT"
+	HASH_STANDARD_SCRYPT = "STANDARD_SCRYPT"
+	//
+	IMPORT_BATCH_SIZE = 1000
+	//
+	EXPORT_FILE_PERMISSIONS = 0600
+)
+
+var (
+	csvHeader  = []string{"uid", "email", "email_verified", "password_hash", "password_salt", "display_name", "photo_url", "phone_number", "disabled", "custom_claims", "provider_data", "created_at", "last_sign_in_at"}
+	timeClaims = []string{CLAIM_AUTH_TIME, CLAIM_EXPIRES, CLAIM_ISSUED_AT, CLAIM_NOT_BEFORE}
+)
+
+var (
+	ErrClaimsInvalid         = errors.New("the claims must be a JSON object")
+	ErrClaimsReconcileFailed = errors.New("one or more users could not be reconciled")
+	ErrClaimsTooLarge        = errors.New("the serialized custom claims must not exceed 1000 bytes")
+	ErrEmulatorNotSet        = errors.New("the " + ENV_AUTH_EMULATOR_HOST + " environment variable must be set to exchange custom tokens")
+	ErrFileFormatInvalid     = errors.New("the file format must be " + FORMAT_JSON + " or " + FORMAT_CSV)
+	ErrHashAlgorithmInvalid  = errors.New("the password_hash algorithm must be " + HASH_SCRYPT + ", " + HASH_STANDARD_SCRYPT + " or " + HASH_BCRYPT)
+	ErrHashConfigMissing     = errors.New("the password_hash section of the configuration file is required to import password hashes")
+	ErrImportFailed          = errors.New("one or more users failed to import")
+	ErrNoVerificationKeys    = errors.New("a certificate bundle, JWKS or HMAC key must be provided to verify a token")
+	ErrProjectIdMissing      = errors.New("the project_id must be set in the configuration file when using the emulator")
+	ErrSigningKeyInvalid     = errors.New("the signing key must be a PEM encoded RSA private key (PKCS#8 or PKCS#1) and the certificate must match it")
+	ErrRoleUndefined         = errors.New("the role is not defined in the roles section of the claims file")
+	ErrTokenExchangeFailed   = errors.New("the emulator rejected the custom token exchange")
+	ErrTokenInvalid          = errors.New("the token failed verification")
+	ErrTokenMalformed        = errors.New("the token is not a compact JWS (header.claims.signature)")
+	ErrUserIdentifierEmpty   = errors.New("either a userid or an email must be provided")
+)
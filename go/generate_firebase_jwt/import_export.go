@@ -0,0 +1,592 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"firebase.google.com/go/auth"
+	"firebase.google.com/go/auth/hash"
+	"google.golang.org/api/iterator"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// PasswordHashConfig holds the hash parameters of the project the users were exported from.
+// For Firebase scrypt, they are shown in the console under Authentication > Users > Password hash parameters.
+type PasswordHashConfig struct {
+	Algorithm        string `yaml:"algorithm"`          // SCRYPT | STANDARD_SCRYPT | BCRYPT
+	BlockSize        int    `yaml:"block_size"`         // STANDARD_SCRYPT only.
+	DerivedKeyLength int    `yaml:"derived_key_length"` // STANDARD_SCRYPT only.
+	Key              string `yaml:"key"`                // SCRYPT only. Base64 signer key.
+	MemoryCost       int    `yaml:"memory_cost"`        // SCRYPT and STANDARD_SCRYPT.
+	Parallelization  int    `yaml:"parallelization"`    // STANDARD_SCRYPT only.
+	Rounds           int    `yaml:"rounds"`             // SCRYPT only.
+	SaltSeparator    string `yaml:"salt_separator"`     // SCRYPT only. Base64.
+}
+
+// exportedUser follows the user layout of 'firebase auth:export' so files can be shared with the Firebase CLI.
+type exportedUser struct {
+	LocalId          string           `json:"localId"`
+	Email            string           `json:"email,omitempty"`
+	EmailVerified    bool             `json:"emailVerified"`
+	PasswordHash     string           `json:"passwordHash,omitempty"`
+	Salt             string           `json:"salt,omitempty"`
+	DisplayName      string           `json:"displayName,omitempty"`
+	PhotoUrl         string           `json:"photoUrl,omitempty"`
+	PhoneNumber      string           `json:"phoneNumber,omitempty"`
+	Disabled         bool             `json:"disabled"`
+	CustomAttributes string           `json:"customAttributes,omitempty"`
+	CreatedAt        string           `json:"createdAt,omitempty"`
+	LastSignedInAt   string           `json:"lastSignedInAt,omitempty"`
+	ProviderUserInfo []*auth.UserInfo `json:"providerUserInfo,omitempty"`
+}
+
+type userExportFile struct {
+	Users []exportedUser `json:"users"`
+}
+
+// exportUsers - writes every user in Firebase Auth, with password hashes, custom claims and provider data, to a JSON or CSV file.
+//
+//	Customer Messages: None
+//	Errors: ErrFileFormatInvalid, errors returned by Firebase, errors returned by os and encoding
+//	Verifications: None
+func exportUsers(authPtr *auth.Client, filename string, format string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tExportedUserPtr *auth.ExportedUserRecord
+		tFormat          string
+		tUserIteratorPtr *auth.UserIterator
+		tUsers           []exportedUser
+	)
+
+	if tFormat, errorInfo = resolveFileFormat(filename, format); errorInfo.Error != nil {
+		return
+	}
+
+	tUserIteratorPtr = authPtr.Users(context.Background(), ctv.VAL_EMPTY)
+	for {
+		if tExportedUserPtr, errorInfo.Error = tUserIteratorPtr.Next(); errorInfo.Error == iterator.Done {
+			errorInfo.Error = nil
+			break
+		}
+		if errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, ctv.VAL_EMPTY)
+			return
+		}
+		tUsers = append(tUsers, newExportedUser(tExportedUserPtr))
+	}
+
+	if tFormat == FORMAT_CSV {
+		errorInfo = writeUsersCSV(filename, tUsers)
+	} else {
+		errorInfo = writeUsersJSON(filename, tUsers)
+	}
+	if errorInfo.Error != nil {
+		return
+	}
+
+	fmt.Printf("Exported %d users to %s (%s).\n", len(tUsers), filename, tFormat)
+
+	return
+}
+
+// importUsers - loads users from a JSON or CSV file and imports them in batches of IMPORT_BATCH_SIZE.
+// Every record that fails, either locally or in Firebase, is reported by its position in the file and its UID.
+//
+//	Customer Messages: None
+//	Errors: ErrFileFormatInvalid, ErrHashAlgorithmInvalid, ErrHashConfigMissing, ErrImportFailed, errors returned by os and encoding
+//	Verifications: None
+func importUsers(authPtr *auth.Client, filename string, format string, hashConfig PasswordHashConfig) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tFailures    int
+		tFormat      string
+		tImported    int
+		tOptions     []auth.UserImportOption
+		tRecordCount int
+		tUsers       []exportedUser
+	)
+
+	if tFormat, errorInfo = resolveFileFormat(filename, format); errorInfo.Error != nil {
+		return
+	}
+	if tFormat == FORMAT_CSV {
+		tUsers, errorInfo = readUsersCSV(filename)
+	} else {
+		tUsers, errorInfo = readUsersJSON(filename)
+	}
+	if errorInfo.Error != nil {
+		return
+	}
+
+	for _, tUser := range tUsers {
+		if tUser.PasswordHash != ctv.VAL_EMPTY {
+			if tOptions, errorInfo = buildImportOptions(hashConfig); errorInfo.Error != nil {
+				return
+			}
+			break
+		}
+	}
+
+	tRecordCount = len(tUsers)
+	for tStart := 0; tStart < tRecordCount; tStart += IMPORT_BATCH_SIZE {
+		tEnd := tStart + IMPORT_BATCH_SIZE
+		if tEnd > tRecordCount {
+			tEnd = tRecordCount
+		}
+		tSucceeded, tFailed := importBatch(authPtr, tUsers[tStart:tEnd], tStart, tOptions)
+		tImported += tSucceeded
+		tFailures += tFailed
+	}
+
+	fmt.Printf("Imported %d of %d users from %s (%s). Failed: %d\n", tImported, tRecordCount, filename, tFormat, tFailures)
+
+	if tFailures > 0 {
+		errorInfo = errs.NewErrorInfo(ErrImportFailed, fmt.Sprintf("Failed: %d", tFailures))
+	}
+
+	return
+}
+
+// importBatch - imports up to IMPORT_BATCH_SIZE users. When Firebase rejects the whole batch, such as for an
+// invalid email, each record is imported on its own so the bad ones can be named.
+func importBatch(authPtr *auth.Client, users []exportedUser, offset int, options []auth.UserImportOption) (succeeded int, failed int) {
+
+	var (
+		tErr       error
+		tIndexes   []int
+		tResultPtr *auth.UserImportResult
+		tToImport  []*auth.UserToImport
+		tUserPtr   *auth.UserToImport
+	)
+
+	for tIndex, tUser := range users {
+		if tUserPtr, tErr = newUserToImport(tUser); tErr != nil {
+			reportImportFailure(offset+tIndex, tUser.LocalId, tErr.Error())
+			failed++
+			continue
+		}
+		tToImport = append(tToImport, tUserPtr)
+		tIndexes = append(tIndexes, offset+tIndex)
+	}
+	if len(tToImport) == 0 {
+		return
+	}
+
+	if tResultPtr, tErr = authPtr.ImportUsers(context.Background(), tToImport, options...); tErr != nil {
+		if len(tToImport) == 1 {
+			reportImportFailure(tIndexes[0], users[tIndexes[0]-offset].LocalId, tErr.Error())
+			failed++
+			return
+		}
+		for _, tIndex := range tIndexes {
+			tSucceeded, tFailed := importBatch(authPtr, users[tIndex-offset:tIndex-offset+1], tIndex, options)
+			succeeded += tSucceeded
+			failed += tFailed
+		}
+		return
+	}
+
+	for _, tErrorInfoPtr := range tResultPtr.Errors {
+		tIndex := tIndexes[tErrorInfoPtr.Index]
+		reportImportFailure(tIndex, users[tIndex-offset].LocalId, tErrorInfoPtr.Reason)
+	}
+	succeeded += tResultPtr.SuccessCount
+	failed += tResultPtr.FailureCount
+
+	return
+}
+
+// buildImportOptions - maps the password_hash configuration to the Firebase hash option.
+//
+//	Customer Messages: None
+//	Errors: ErrHashAlgorithmInvalid, ErrHashConfigMissing, errors returned by base64
+//	Verifications: None
+func buildImportOptions(hashConfig PasswordHashConfig) (options []auth.UserImportOption, errorInfo errs.ErrorInfo) {
+
+	var (
+		tKey           []byte
+		tSaltSeparator []byte
+	)
+
+	switch strings.ToUpper(hashConfig.Algorithm) {
+	case ctv.VAL_EMPTY:
+		errorInfo = errs.NewErrorInfo(ErrHashConfigMissing, ctv.VAL_EMPTY)
+	case HASH_BCRYPT:
+		options = append(options, auth.WithHash(hash.Bcrypt{}))
+	case HASH_SCRYPT:
+		if tKey, errorInfo.Error = decodeBase64(hashConfig.Key); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, "password_hash key")
+			return
+		}
+		if tSaltSeparator, errorInfo.Error = decodeBase64(hashConfig.SaltSeparator); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, "password_hash salt_separator")
+			return
+		}
+		options = append(options, auth.WithHash(hash.Scrypt{
+			Key:           tKey,
+			SaltSeparator: tSaltSeparator,
+			Rounds:        hashConfig.Rounds,
+			MemoryCost:    hashConfig.MemoryCost,
+		}))
+	case HASH_STANDARD_SCRYPT:
+		options = append(options, auth.WithHash(hash.StandardScrypt{
+			BlockSize:        hashConfig.BlockSize,
+			DerivedKeyLength: hashConfig.DerivedKeyLength,
+			MemoryCost:       hashConfig.MemoryCost,
+			Parallelization:  hashConfig.Parallelization,
+		}))
+	default:
+		errorInfo = errs.NewErrorInfo(ErrHashAlgorithmInvalid, fmt.Sprintf("Algorithm: %s", hashConfig.Algorithm))
+	}
+
+	return
+}
+
+// newExportedUser - converts a Firebase record into the export layout. Hashes and salts are written as standard base64,
+// which is what the Firebase CLI uses.
+func newExportedUser(exportedUserPtr *auth.ExportedUserRecord) (user exportedUser) {
+
+	var (
+		tClaims []byte
+	)
+
+	user = exportedUser{
+		LocalId:          exportedUserPtr.UID,
+		Email:            exportedUserPtr.Email,
+		EmailVerified:    exportedUserPtr.EmailVerified,
+		PasswordHash:     toStandardBase64(exportedUserPtr.PasswordHash),
+		Salt:             toStandardBase64(exportedUserPtr.PasswordSalt),
+		DisplayName:      exportedUserPtr.DisplayName,
+		PhotoUrl:         exportedUserPtr.PhotoURL,
+		PhoneNumber:      exportedUserPtr.PhoneNumber,
+		Disabled:         exportedUserPtr.Disabled,
+		ProviderUserInfo: exportedUserPtr.ProviderUserInfo,
+	}
+	if len(exportedUserPtr.CustomClaims) > 0 {
+		tClaims, _ = json.Marshal(exportedUserPtr.CustomClaims)
+		user.CustomAttributes = string(tClaims)
+	}
+	if exportedUserPtr.UserMetadata != nil {
+		user.CreatedAt = formatMillis(exportedUserPtr.UserMetadata.CreationTimestamp)
+		user.LastSignedInAt = formatMillis(exportedUserPtr.UserMetadata.LastLogInTimestamp)
+	}
+
+	return
+}
+
+// newUserToImport - converts an exported user into a Firebase import record.
+func newUserToImport(user exportedUser) (userToImportPtr *auth.UserToImport, err error) {
+
+	var (
+		tClaims    map[string]interface{}
+		tHash      []byte
+		tMetadata  auth.UserMetadata
+		tProviders []*auth.UserProvider
+		tSalt      []byte
+	)
+
+	userToImportPtr = (&auth.UserToImport{}).
+		UID(user.LocalId).
+		EmailVerified(user.EmailVerified).
+		Disabled(user.Disabled)
+	if user.Email != ctv.VAL_EMPTY {
+		userToImportPtr.Email(user.Email)
+	}
+	if user.DisplayName != ctv.VAL_EMPTY {
+		userToImportPtr.DisplayName(user.DisplayName)
+	}
+	if user.PhotoUrl != ctv.VAL_EMPTY {
+		userToImportPtr.PhotoURL(user.PhotoUrl)
+	}
+	if user.PhoneNumber != ctv.VAL_EMPTY {
+		userToImportPtr.PhoneNumber(user.PhoneNumber)
+	}
+
+	if user.CustomAttributes != ctv.VAL_EMPTY {
+		if err = json.Unmarshal([]byte(user.CustomAttributes), &tClaims); err != nil {
+			err = fmt.Errorf("customAttributes: %w", err)
+			return
+		}
+		userToImportPtr.CustomClaims(tClaims)
+	}
+
+	if user.PasswordHash != ctv.VAL_EMPTY {
+		if tHash, err = decodeBase64(user.PasswordHash); err != nil {
+			err = fmt.Errorf("passwordHash: %w", err)
+			return
+		}
+		userToImportPtr.PasswordHash(tHash)
+	}
+	if user.Salt != ctv.VAL_EMPTY {
+		if tSalt, err = decodeBase64(user.Salt); err != nil {
+			err = fmt.Errorf("salt: %w", err)
+			return
+		}
+		userToImportPtr.PasswordSalt(tSalt)
+	}
+
+	if tMetadata.CreationTimestamp, err = parseMillis(user.CreatedAt); err != nil {
+		err = fmt.Errorf("createdAt: %w", err)
+		return
+	}
+	if tMetadata.LastLogInTimestamp, err = parseMillis(user.LastSignedInAt); err != nil {
+		err = fmt.Errorf("lastSignedInAt: %w", err)
+		return
+	}
+	if tMetadata.CreationTimestamp > 0 || tMetadata.LastLogInTimestamp > 0 {
+		userToImportPtr.Metadata(&tMetadata)
+	}
+
+	for _, tInfoPtr := range user.ProviderUserInfo {
+		// The password provider is rebuilt by Firebase from the email and hash.
+		if tInfoPtr == nil || tInfoPtr.ProviderID == "password" {
+			continue
+		}
+		tProviders = append(tProviders, &auth.UserProvider{
+			UID:         tInfoPtr.UID,
+			ProviderID:  tInfoPtr.ProviderID,
+			Email:       tInfoPtr.Email,
+			DisplayName: tInfoPtr.DisplayName,
+			PhotoURL:    tInfoPtr.PhotoURL,
+		})
+	}
+	if len(tProviders) > 0 {
+		userToImportPtr.ProviderData(tProviders)
+	}
+
+	return
+}
+
+func readUsersJSON(filename string) (users []exportedUser, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData []byte
+		tFile userExportFile
+	)
+
+	if tData, errorInfo.Error = os.ReadFile(filename); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", filename))
+		return
+	}
+	if errorInfo.Error = json.Unmarshal(tData, &tFile); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", filename))
+		return
+	}
+	users = tFile.Users
+
+	return
+}
+
+// readUsersCSV - reads the layout written by writeUsersCSV. The header row is matched by name, so columns may be reordered.
+func readUsersCSV(filename string) (users []exportedUser, errorInfo errs.ErrorInfo) {
+
+	var (
+		tColumns = make(map[string]int)
+		tFilePtr *os.File
+		tReader  *csv.Reader
+		tRecord  []string
+		tRow     int
+	)
+
+	if tFilePtr, errorInfo.Error = os.Open(filename); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", filename))
+		return
+	}
+	defer func(tFilePtr *os.File) {
+		if err := tFilePtr.Close(); err != nil {
+			errs.PrintError(err, fmt.Sprintf("File: %s", filename))
+		}
+	}(tFilePtr)
+
+	tReader = csv.NewReader(tFilePtr)
+	if tRecord, errorInfo.Error = tReader.Read(); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s Header", filename))
+		return
+	}
+	for tIndex, tName := range tRecord {
+		tColumns[strings.TrimSpace(tName)] = tIndex
+	}
+
+	for {
+		tRow++
+		if tRecord, errorInfo.Error = tReader.Read(); errorInfo.Error == io.EOF {
+			errorInfo.Error = nil
+			break
+		}
+		if errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s Row: %d", filename, tRow))
+			return
+		}
+		field := func(name string) string {
+			if tIndex, ok := tColumns[name]; ok && tIndex < len(tRecord) {
+				return tRecord[tIndex]
+			}
+			return ctv.VAL_EMPTY
+		}
+		tUser := exportedUser{
+			LocalId:          field("uid"),
+			Email:            field("email"),
+			EmailVerified:    field("email_verified") == "true",
+			PasswordHash:     field("password_hash"),
+			Salt:             field("password_salt"),
+			DisplayName:      field("display_name"),
+			PhotoUrl:         field("photo_url"),
+			PhoneNumber:      field("phone_number"),
+			Disabled:         field("disabled") == "true",
+			CustomAttributes: field("custom_claims"),
+			CreatedAt:        field("created_at"),
+			LastSignedInAt:   field("last_sign_in_at"),
+		}
+		if tProviders := field("provider_data"); tProviders != ctv.VAL_EMPTY {
+			if errorInfo.Error = json.Unmarshal([]byte(tProviders), &tUser.ProviderUserInfo); errorInfo.Error != nil {
+				errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s Row: %d provider_data", filename, tRow))
+				return
+			}
+		}
+		users = append(users, tUser)
+	}
+
+	return
+}
+
+func writeUsersJSON(filename string, users []exportedUser) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tData []byte
+	)
+
+	if users == nil {
+		users = []exportedUser{}
+	}
+	if tData, errorInfo.Error = json.MarshalIndent(userExportFile{Users: users}, ctv.VAL_EMPTY, ctv.SPACES_FOUR); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", filename))
+		return
+	}
+	if errorInfo.Error = os.WriteFile(filename, tData, EXPORT_FILE_PERMISSIONS); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", filename))
+	}
+
+	return
+}
+
+// writeUsersCSV - one row per user. custom_claims and provider_data hold JSON so nothing is lost on the way back in.
+func writeUsersCSV(filename string, users []exportedUser) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tFilePtr   *os.File
+		tProviders []byte
+		tWriter    *csv.Writer
+	)
+
+	if tFilePtr, errorInfo.Error = os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, EXPORT_FILE_PERMISSIONS); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", filename))
+		return
+	}
+	defer func(tFilePtr *os.File) {
+		if err := tFilePtr.Close(); err != nil {
+			errs.PrintError(err, fmt.Sprintf("File: %s", filename))
+		}
+	}(tFilePtr)
+
+	tWriter = csv.NewWriter(tFilePtr)
+	_ = tWriter.Write(csvHeader)
+	for _, tUser := range users {
+		tProviders = nil
+		if len(tUser.ProviderUserInfo) > 0 {
+			tProviders, _ = json.Marshal(tUser.ProviderUserInfo)
+		}
+		_ = tWriter.Write([]string{
+			tUser.LocalId,
+			tUser.Email,
+			strconv.FormatBool(tUser.EmailVerified),
+			tUser.PasswordHash,
+			tUser.Salt,
+			tUser.DisplayName,
+			tUser.PhotoUrl,
+			tUser.PhoneNumber,
+			strconv.FormatBool(tUser.Disabled),
+			tUser.CustomAttributes,
+			string(tProviders),
+			tUser.CreatedAt,
+			tUser.LastSignedInAt,
+		})
+	}
+	tWriter.Flush()
+	if errorInfo.Error = tWriter.Error(); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("File: %s", filename))
+	}
+
+	return
+}
+
+// resolveFileFormat - the format flag wins. Otherwise, a .csv file is CSV and everything else is JSON.
+func resolveFileFormat(filename string, format string) (fileFormat string, errorInfo errs.ErrorInfo) {
+
+	fileFormat = strings.ToLower(format)
+	if fileFormat == ctv.VAL_EMPTY {
+		fileFormat = FORMAT_JSON
+		if strings.ToLower(filepath.Ext(filename)) == "."+FORMAT_CSV {
+			fileFormat = FORMAT_CSV
+		}
+	}
+	if fileFormat != FORMAT_JSON && fileFormat != FORMAT_CSV {
+		errorInfo = errs.NewErrorInfo(ErrFileFormatInvalid, fmt.Sprintf("Format: %s", format))
+	}
+
+	return
+}
+
+func reportImportFailure(index int, userId string, reason string) {
+	fmt.Printf("Record %d (UID: %s) failed: %s\n", index+1, userId, reason)
+}
+
+// decodeBase64 - accepts standard and URL-safe base64, padded or not. Firebase uses both.
+func decodeBase64(value string) (data []byte, err error) {
+
+	for _, tEncodingPtr := range []*base64.Encoding{base64.StdEncoding, base64.URLEncoding, base64.RawStdEncoding, base64.RawURLEncoding} {
+		if data, err = tEncodingPtr.DecodeString(value); err == nil {
+			return
+		}
+	}
+
+	return
+}
+
+// toStandardBase64 - re-encodes a URL-safe value from the API. Values that are not base64, such as the
+// emulator's placeholder hashes, are returned unchanged.
+func toStandardBase64(value string) string {
+
+	if tData, err := decodeBase64(value); err == nil {
+		return base64.StdEncoding.EncodeToString(tData)
+	}
+
+	return value
+}
+
+func formatMillis(millis int64) string {
+
+	if millis == 0 {
+		return ctv.VAL_EMPTY
+	}
+
+	return strconv.FormatInt(millis, 10)
+}
+
+func parseMillis(value string) (millis int64, err error) {
+
+	if value == ctv.VAL_EMPTY {
+		return
+	}
+
+	return strconv.ParseInt(value, 10, 64)
+}
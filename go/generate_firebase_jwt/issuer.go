@@ -0,0 +1,349 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// localIssuer signs Firebase-style ID tokens and publishes its certificate the way securetoken.google.com does.
+type localIssuer struct {
+	Certificate []byte // PEM
+	KeyId       string
+	PrivateKey  *rsa.PrivateKey
+	ProjectId   string
+}
+
+type idTokenRequest struct {
+	Claims    map[string]interface{} `json:"claims"`
+	Email     string                 `json:"email"`
+	ExpiresIn int64                  `json:"expires_in"` // Seconds. The default is ID_TOKEN_LIFETIME_SECONDS.
+	UID       string                 `json:"uid"`
+}
+
+type idTokenReply struct {
+	ExpiresIn int64  `json:"expires_in"`
+	IdToken   string `json:"id_token"`
+}
+
+// newLocalIssuer - loads the RSA signing key, and optionally its certificate, or generates both when no key file is given.
+// Keys written by generate_certificate (PKCS#8) and PKCS#1 keys are accepted.
+//
+//	Customer Messages: None
+//	Errors: ErrProjectIdMissing, ErrSigningKeyInvalid, errors returned by os and x509
+//	Verifications: None
+func newLocalIssuer(projectId string, signingKeyFQN string, signingCertFQN string) (issuer localIssuer, errorInfo errs.ErrorInfo) {
+
+	var (
+		tBlockPtr       *pem.Block
+		tCertificatePtr *x509.Certificate
+		tData           []byte
+		tKey            interface{}
+		ok              bool
+	)
+
+	if projectId == ctv.VAL_EMPTY {
+		errorInfo = errs.NewErrorInfo(ErrProjectIdMissing, "Provide the project with -r or project_id in the configuration file.")
+		return
+	}
+	issuer.ProjectId = projectId
+
+	if signingKeyFQN == ctv.VAL_EMPTY {
+		if issuer.PrivateKey, errorInfo.Error = rsa.GenerateKey(rand.Reader, ISSUER_RSA_BITS); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, ctv.VAL_EMPTY)
+			return
+		}
+	} else {
+		if tData, errorInfo.Error = os.ReadFile(signingKeyFQN); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Signing Key: %s", signingKeyFQN))
+			return
+		}
+		if tBlockPtr, _ = pem.Decode(tData); tBlockPtr == nil {
+			errorInfo = errs.NewErrorInfo(ErrSigningKeyInvalid, fmt.Sprintf("Signing Key: %s", signingKeyFQN))
+			return
+		}
+		if tKey, errorInfo.Error = x509.ParsePKCS8PrivateKey(tBlockPtr.Bytes); errorInfo.Error != nil {
+			tKey, errorInfo.Error = x509.ParsePKCS1PrivateKey(tBlockPtr.Bytes)
+		}
+		if issuer.PrivateKey, ok = tKey.(*rsa.PrivateKey); errorInfo.Error != nil || ok == false {
+			errorInfo = errs.NewErrorInfo(ErrSigningKeyInvalid, fmt.Sprintf("Signing Key: %s", signingKeyFQN))
+			return
+		}
+	}
+
+	if signingCertFQN == ctv.VAL_EMPTY {
+		if issuer.Certificate, errorInfo = selfSignIssuerCertificate(issuer.PrivateKey); errorInfo.Error != nil {
+			return
+		}
+	} else {
+		if tData, errorInfo.Error = os.ReadFile(signingCertFQN); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Signing Certificate: %s", signingCertFQN))
+			return
+		}
+		if tBlockPtr, _ = pem.Decode(tData); tBlockPtr == nil || tBlockPtr.Type != PEM_CERTIFICATE {
+			errorInfo = errs.NewErrorInfo(ErrSigningKeyInvalid, fmt.Sprintf("Signing Certificate: %s", signingCertFQN))
+			return
+		}
+		if tCertificatePtr, errorInfo.Error = x509.ParseCertificate(tBlockPtr.Bytes); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Signing Certificate: %s", signingCertFQN))
+			return
+		}
+		if issuer.PrivateKey.PublicKey.Equal(tCertificatePtr.PublicKey) == false {
+			errorInfo = errs.NewErrorInfo(ErrSigningKeyInvalid, "The signing certificate does not match the signing key.")
+			return
+		}
+		issuer.Certificate = pem.EncodeToMemory(tBlockPtr)
+	}
+
+	issuer.KeyId = keyIdForPublicKey(&issuer.PrivateKey.PublicKey)
+
+	return
+}
+
+// serveIssuer - runs the local issuer until SIGINT or SIGTERM is received.
+//
+//	Customer Messages: None
+//	Errors: errors returned by http.Server
+//	Verifications: None
+func serveIssuer(issuer localIssuer, address string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tServerPtr *http.Server
+		tSignals   = make(chan os.Signal, 1)
+		tStopped   = make(chan error, 1)
+	)
+
+	tServerPtr = &http.Server{
+		Addr:              address,
+		Handler:           issuer.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		tStopped <- tServerPtr.ListenAndServe()
+	}()
+
+	fmt.Printf("Local issuer for project %s is listening on http://%s\n", issuer.ProjectId, address)
+	fmt.Printf("%sIssuer:  %s%s\n", ctv.SPACES_FOUR, FIREBASE_ISSUER_PREFIX, issuer.ProjectId)
+	fmt.Printf("%sKey Id:  %s\n", ctv.SPACES_FOUR, issuer.KeyId)
+	fmt.Printf("%sJWKS:    http://%s%s\n", ctv.SPACES_FOUR, address, ISSUER_PATH_JWKS)
+	fmt.Printf("%sx509:    http://%s%s\n", ctv.SPACES_FOUR, address, ISSUER_PATH_X509)
+	fmt.Printf("%sTokens:  http://%s%s?uid=<uid>&claims=<json>\n", ctv.SPACES_FOUR, address, ISSUER_PATH_TOKEN)
+
+	signal.Notify(tSignals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(tSignals)
+
+	select {
+	case errorInfo.Error = <-tStopped:
+		if errors.Is(errorInfo.Error, http.ErrServerClosed) == false {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Address: %s", address))
+			return
+		}
+		errorInfo.Error = nil
+	case <-tSignals:
+		tContext, tCancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer tCancel()
+		if errorInfo.Error = tServerPtr.Shutdown(tContext); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Address: %s", address))
+			return
+		}
+		fmt.Println("Local issuer stopped.")
+	}
+
+	return
+}
+
+func (issuer localIssuer) handler() http.Handler {
+
+	tMux := http.NewServeMux()
+	tMux.HandleFunc(ISSUER_PATH_JWKS, issuer.handleJWKS)
+	tMux.HandleFunc(ISSUER_PATH_JWKS_WELL_KNOWN, issuer.handleJWKS)
+	tMux.HandleFunc(ISSUER_PATH_X509, issuer.handleX509)
+	tMux.HandleFunc(ISSUER_PATH_TOKEN, issuer.handleToken)
+
+	return tMux
+}
+
+func (issuer localIssuer) handleJWKS(writer http.ResponseWriter, _ *http.Request) {
+
+	writer.Header().Set("Cache-Control", ISSUER_CACHE_CONTROL)
+
+	tKey := jsonWebKey{
+		Alg: "RS256",
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(issuer.PrivateKey.PublicKey.E)).Bytes()),
+		Kid: issuer.KeyId,
+		Kty: "RSA",
+		N:   base64.RawURLEncoding.EncodeToString(issuer.PrivateKey.PublicKey.N.Bytes()),
+		Use: "sig",
+	}
+
+	writeIssuerJSON(writer, http.StatusOK, map[string][]jsonWebKey{"keys": {tKey}})
+}
+
+func (issuer localIssuer) handleX509(writer http.ResponseWriter, _ *http.Request) {
+
+	writer.Header().Set("Cache-Control", ISSUER_CACHE_CONTROL)
+	writeIssuerJSON(writer, http.StatusOK, map[string]string{issuer.KeyId: string(issuer.Certificate)})
+}
+
+// handleToken - GET takes uid, email, claims (JSON) and expires_in from the query. POST takes an idTokenRequest body.
+func (issuer localIssuer) handleToken(writer http.ResponseWriter, request *http.Request) {
+
+	var (
+		err      error
+		tReply   idTokenReply
+		tRequest idTokenRequest
+	)
+
+	switch request.Method {
+	case http.MethodGet:
+		tQuery := request.URL.Query()
+		tRequest.UID = tQuery.Get("uid")
+		tRequest.Email = tQuery.Get("email")
+		if tClaims := tQuery.Get("claims"); tClaims != ctv.VAL_EMPTY {
+			err = json.Unmarshal([]byte(tClaims), &tRequest.Claims)
+		}
+		if tExpiresIn := tQuery.Get("expires_in"); err == nil && tExpiresIn != ctv.VAL_EMPTY {
+			tRequest.ExpiresIn, err = strconv.ParseInt(tExpiresIn, 10, 64)
+		}
+	case http.MethodPost:
+		err = json.NewDecoder(request.Body).Decode(&tRequest)
+	default:
+		writeIssuerJSON(writer, http.StatusMethodNotAllowed, map[string]string{"error": "use GET or POST"})
+		return
+	}
+	if err != nil {
+		writeIssuerJSON(writer, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	if tRequest.UID == ctv.VAL_EMPTY {
+		writeIssuerJSON(writer, http.StatusBadRequest, map[string]string{"error": "uid is required"})
+		return
+	}
+	if tRequest.ExpiresIn <= 0 {
+		tRequest.ExpiresIn = ID_TOKEN_LIFETIME_SECONDS
+	}
+
+	if tReply.IdToken, err = issuer.signIdToken(tRequest, time.Now()); err != nil {
+		writeIssuerJSON(writer, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+	tReply.ExpiresIn = tRequest.ExpiresIn
+
+	writeIssuerJSON(writer, http.StatusOK, tReply)
+}
+
+// signIdToken - builds the claims Firebase puts in an ID token, adds the custom claims and signs them with RS256.
+// Custom claims may not replace the registered or Firebase claims.
+func (issuer localIssuer) signIdToken(request idTokenRequest, now time.Time) (idToken string, err error) {
+
+	var (
+		tClaims    = make(map[string]interface{})
+		tHeader    []byte
+		tPayload   []byte
+		tSignature []byte
+	)
+
+	for tName, tValue := range request.Claims {
+		tClaims[tName] = tValue
+	}
+
+	tIdentities := map[string]interface{}{}
+	if request.Email != ctv.VAL_EMPTY {
+		tClaims["email"] = request.Email
+		tClaims["email_verified"] = true
+		tIdentities["email"] = []string{request.Email}
+	}
+	tClaims[CLAIM_ISSUER] = FIREBASE_ISSUER_PREFIX + issuer.ProjectId
+	tClaims[CLAIM_AUDIENCE] = issuer.ProjectId
+	tClaims[CLAIM_AUTH_TIME] = now.Unix()
+	tClaims[CLAIM_ISSUED_AT] = now.Unix()
+	tClaims[CLAIM_EXPIRES] = now.Unix() + request.ExpiresIn
+	tClaims[CLAIM_SUBJECT] = request.UID
+	tClaims["user_id"] = request.UID
+	tClaims["firebase"] = map[string]interface{}{
+		"identities":       tIdentities,
+		"sign_in_provider": "custom",
+	}
+
+	if tHeader, err = json.Marshal(map[string]string{HEADER_ALGORITHM: "RS256", HEADER_KEY_ID: issuer.KeyId, "typ": "JWT"}); err != nil {
+		return
+	}
+	if tPayload, err = json.Marshal(tClaims); err != nil {
+		return
+	}
+
+	tSigningInput := base64.RawURLEncoding.EncodeToString(tHeader) + "." + base64.RawURLEncoding.EncodeToString(tPayload)
+	tDigest := sha256.Sum256([]byte(tSigningInput))
+	if tSignature, err = rsa.SignPKCS1v15(rand.Reader, issuer.PrivateKey, crypto.SHA256, tDigest[:]); err != nil {
+		return
+	}
+	idToken = tSigningInput + "." + base64.RawURLEncoding.EncodeToString(tSignature)
+
+	return
+}
+
+// selfSignIssuerCertificate - wraps the public key in a certificate so it can be published on the x509 endpoint.
+func selfSignIssuerCertificate(privateKey *rsa.PrivateKey) (certificate []byte, errorInfo errs.ErrorInfo) {
+
+	var (
+		tDER    []byte
+		tSerial *big.Int
+	)
+
+	if tSerial, errorInfo.Error = rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128)); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, ctv.VAL_EMPTY)
+		return
+	}
+
+	tTemplate := &x509.Certificate{
+		SerialNumber: tSerial,
+		Subject:      pkix.Name{CommonName: "securetoken.system.local"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(ISSUER_CERTIFICATE_LIFETIME),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if tDER, errorInfo.Error = x509.CreateCertificate(rand.Reader, tTemplate, tTemplate, &privateKey.PublicKey, privateKey); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, ctv.VAL_EMPTY)
+		return
+	}
+	certificate = pem.EncodeToMemory(&pem.Block{Type: PEM_CERTIFICATE, Bytes: tDER})
+
+	return
+}
+
+// keyIdForPublicKey - the key id is stable for a key, so restarting the issuer with the same key keeps cached JWKS valid.
+func keyIdForPublicKey(publicKey *rsa.PublicKey) string {
+
+	tDER, _ := x509.MarshalPKIXPublicKey(publicKey)
+	tDigest := sha256.Sum256(tDER)
+
+	return hex.EncodeToString(tDigest[:20])
+}
+
+func writeIssuerJSON(writer http.ResponseWriter, status int, body interface{}) {
+
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(body)
+}
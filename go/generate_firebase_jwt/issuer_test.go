@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const (
+	TEST_PROJECT_ID = "demo-project"
+	TEST_UID        = "user-1"
+)
+
+// newTestIssuer - a local issuer with a generated key and certificate.
+func newTestIssuer(t *testing.T) (issuer localIssuer) {
+
+	t.Helper()
+
+	tIssuer, tErrorInfo := newLocalIssuer(TEST_PROJECT_ID, "", "")
+	if tErrorInfo.Error != nil {
+		t.Fatalf("newLocalIssuer: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	return tIssuer
+}
+
+// signTestToken - signs an ID token for TEST_UID issued at now.
+func signTestToken(t *testing.T, issuer localIssuer, request idTokenRequest, now time.Time) (idToken string) {
+
+	t.Helper()
+
+	if request.UID == "" {
+		request.UID = TEST_UID
+	}
+	if request.ExpiresIn == 0 {
+		request.ExpiresIn = ID_TOKEN_LIFETIME_SECONDS
+	}
+
+	tIdToken, err := issuer.signIdToken(request, now)
+	if err != nil {
+		t.Fatalf("signIdToken: %s", err)
+	}
+
+	return tIdToken
+}
+
+func TestSignIdTokenClaims(t *testing.T) {
+
+	var (
+		tIssuer = newTestIssuer(t)
+		tNow    = time.Unix(1700000000, 0)
+	)
+
+	tIdToken := signTestToken(t, tIssuer, idTokenRequest{
+		Claims: map[string]interface{}{
+			"role":         "admin",
+			"tier":         3,
+			CLAIM_SUBJECT:  "someone-else",
+			CLAIM_AUDIENCE: "another-project",
+		},
+		Email:     "user@example.com",
+		ExpiresIn: 600,
+	}, tNow)
+
+	tParts, tErrorInfo := parseJWT(tIdToken)
+	if tErrorInfo.Error != nil {
+		t.Fatalf("parseJWT: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	if tAlgorithm, _ := tParts.Header[HEADER_ALGORITHM].(string); tAlgorithm != "RS256" {
+		t.Errorf("alg = %q, want RS256", tAlgorithm)
+	}
+	if tKeyId, _ := tParts.Header[HEADER_KEY_ID].(string); tKeyId != tIssuer.KeyId {
+		t.Errorf("kid = %q, want %q", tKeyId, tIssuer.KeyId)
+	}
+
+	for _, tCase := range []struct {
+		name string
+		want string
+	}{
+		{name: CLAIM_ISSUER, want: FIREBASE_ISSUER_PREFIX + TEST_PROJECT_ID},
+		{name: CLAIM_AUDIENCE, want: TEST_PROJECT_ID},
+		{name: CLAIM_SUBJECT, want: TEST_UID},
+		{name: "user_id", want: TEST_UID},
+		{name: "email", want: "user@example.com"},
+		{name: "role", want: "admin"},
+	} {
+		if tValue, _ := tParts.Claims[tCase.name].(string); tValue != tCase.want {
+			t.Errorf("claim %s = %q, want %q", tCase.name, tValue, tCase.want)
+		}
+	}
+
+	for _, tCase := range []struct {
+		name string
+		want int64
+	}{
+		{name: CLAIM_ISSUED_AT, want: tNow.Unix()},
+		{name: CLAIM_AUTH_TIME, want: tNow.Unix()},
+		{name: CLAIM_EXPIRES, want: tNow.Unix() + 600},
+		{name: "tier", want: 3},
+	} {
+		if tValue, ok := numericClaim(tParts.Claims, tCase.name); ok == false || tValue != tCase.want {
+			t.Errorf("claim %s = %d (found: %t), want %d", tCase.name, tValue, ok, tCase.want)
+		}
+	}
+
+	if tFailures := checkSignature(tParts, verificationKeys{ByKeyId: map[string]crypto.PublicKey{tIssuer.KeyId: &tIssuer.PrivateKey.PublicKey}}); len(tFailures) > 0 {
+		t.Errorf("checkSignature = %+v, want no failures", tFailures)
+	}
+}
+
+func TestIssuerPublishedKeys(t *testing.T) {
+
+	var (
+		tIssuer    = newTestIssuer(t)
+		tServerPtr = httptest.NewServer(tIssuer.handler())
+	)
+	defer tServerPtr.Close()
+
+	tIdToken := signTestToken(t, tIssuer, idTokenRequest{}, time.Now())
+	tParts, tErrorInfo := parseJWT(tIdToken)
+	if tErrorInfo.Error != nil {
+		t.Fatalf("parseJWT: %s %s", tErrorInfo.Error, tErrorInfo.AdditionalInfo)
+	}
+
+	for _, tCase := range []struct {
+		path string
+		add  func(keysPtr *verificationKeys, data []byte) error
+	}{
+		{path: ISSUER_PATH_JWKS, add: (*verificationKeys).addJWKS},
+		{path: ISSUER_PATH_X509, add: (*verificationKeys).addCertificateBundle},
+	} {
+		t.Run(tCase.path, func(t *testing.T) {
+			tResponsePtr, err := http.Get(tServerPtr.URL + tCase.path)
+			if err != nil {
+				t.Fatalf("GET %s: %s", tCase.path, err)
+			}
+			defer tResponsePtr.Body.Close()
+			tData, err := io.ReadAll(tResponsePtr.Body)
+			if err != nil || tResponsePtr.StatusCode != http.StatusOK {
+				t.Fatalf("GET %s = %d, %v", tCase.path, tResponsePtr.StatusCode, err)
+			}
+
+			tKeys := verificationKeys{ByKeyId: make(map[string]crypto.PublicKey)}
+			if err = tCase.add(&tKeys, tData); err != nil {
+				t.Fatalf("adding the keys from %s: %s", tCase.path, err)
+			}
+			if _, ok := tKeys.ByKeyId[tIssuer.KeyId]; ok == false {
+				t.Fatalf("%s has no key for kid %s", tCase.path, tIssuer.KeyId)
+			}
+			if tFailures := checkSignature(tParts, tKeys); len(tFailures) > 0 {
+				t.Errorf("checkSignature = %+v, want no failures", tFailures)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+type jwtParts struct {
+	Claims       map[string]interface{}
+	Header       map[string]interface{}
+	Signature    []byte
+	SigningInput []byte
+}
+
+// decodeToken - outputs the header and claims of a JWT without checking the signature.
+//
+//	Customer Messages: None
+//	Errors: ErrTokenMalformed
+//	Verifications: None
+func decodeToken(token string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tParts jwtParts
+	)
+
+	if tParts, errorInfo = parseJWT(token); errorInfo.Error != nil {
+		return
+	}
+
+	printJWT(tParts)
+
+	return
+}
+
+// parseJWT - splits a compact JWS into its header, claims and signature.
+//
+//	Customer Messages: None
+//	Errors: ErrTokenMalformed
+//	Verifications: None
+func parseJWT(token string) (parts jwtParts, errorInfo errs.ErrorInfo) {
+
+	var (
+		tHeader   []byte
+		tPayload  []byte
+		tSegments []string
+	)
+
+	tSegments = strings.Split(strings.TrimSpace(token), ".")
+	if len(tSegments) != 3 {
+		errorInfo = errs.NewErrorInfo(ErrTokenMalformed, fmt.Sprintf("Segments: %d", len(tSegments)))
+		return
+	}
+
+	if tHeader, errorInfo.Error = base64.RawURLEncoding.DecodeString(tSegments[0]); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(ErrTokenMalformed, fmt.Sprintf("Header: %s", errorInfo.Error.Error()))
+		return
+	}
+	if tPayload, errorInfo.Error = base64.RawURLEncoding.DecodeString(tSegments[1]); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(ErrTokenMalformed, fmt.Sprintf("Claims: %s", errorInfo.Error.Error()))
+		return
+	}
+	if parts.Signature, errorInfo.Error = base64.RawURLEncoding.DecodeString(tSegments[2]); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(ErrTokenMalformed, fmt.Sprintf("Signature: %s", errorInfo.Error.Error()))
+		return
+	}
+
+	if errorInfo.Error = json.Unmarshal(tHeader, &parts.Header); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(ErrTokenMalformed, fmt.Sprintf("Header: %s", errorInfo.Error.Error()))
+		return
+	}
+	if errorInfo.Error = unmarshalClaims(tPayload, &parts.Claims); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(ErrTokenMalformed, fmt.Sprintf("Claims: %s", errorInfo.Error.Error()))
+		return
+	}
+
+	parts.SigningInput = []byte(tSegments[0] + "." + tSegments[1])
+
+	return
+}
+
+// readToken - returns the token flag value. A value of '-' reads the token from stdin.
+//
+//	Customer Messages: None
+//	Errors: errors returned by io.ReadAll
+//	Verifications: None
+func readToken(tokenFlag string) (token string, errorInfo errs.ErrorInfo) {
+
+	var (
+		tInput []byte
+	)
+
+	if tokenFlag != "-" {
+		token = tokenFlag
+		return
+	}
+
+	if tInput, errorInfo.Error = io.ReadAll(os.Stdin); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, "stdin")
+		return
+	}
+	token = strings.TrimSpace(string(tInput))
+
+	return
+}
+
+func printJWT(parts jwtParts) {
+
+	var (
+		tData  []byte
+		tNames []string
+	)
+
+	tData, _ = json.MarshalIndent(parts.Header, ctv.VAL_EMPTY, ctv.SPACES_FOUR)
+	fmt.Printf("Header:\n%s\n", string(tData))
+	tData, _ = json.MarshalIndent(parts.Claims, ctv.VAL_EMPTY, ctv.SPACES_FOUR)
+	fmt.Printf("Claims:\n%s\n", string(tData))
+
+	for _, tName := range timeClaims {
+		if _, ok := parts.Claims[tName]; ok {
+			tNames = append(tNames, tName)
+		}
+	}
+	sort.Strings(tNames)
+	if len(tNames) > 0 {
+		fmt.Println("Times (UTC):")
+	}
+	for _, tName := range tNames {
+		if tSeconds, ok := numericClaim(parts.Claims, tName); ok {
+			fmt.Printf("%s%-9s %s\n", ctv.SPACES_FOUR, tName+":", time.Unix(tSeconds, 0).UTC().Format(time.RFC3339))
+		}
+	}
+}
+
+// numericClaim - returns a NumericDate claim as seconds since the epoch.
+func numericClaim(claims map[string]interface{}, name string) (seconds int64, ok bool) {
+
+	var (
+		tNumber json.Number
+		tValue  interface{}
+	)
+
+	if tValue, ok = claims[name]; ok == false {
+		return
+	}
+	if tNumber, ok = tValue.(json.Number); ok == false {
+		return
+	}
+	if tFloat, err := tNumber.Float64(); err == nil {
+		seconds = int64(tFloat)
+		return
+	}
+
+	ok = false
+
+	return
+}
+
+// unmarshalClaims - keeps numbers as json.Number so NumericDate values are not rounded.
+func unmarshalClaims(payload []byte, claims *map[string]interface{}) error {
+
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.UseNumber()
+
+	return decoder.Decode(claims)
+}
@@ -1,18 +1,20 @@
 // Package main.go
 /*
-General description of the purpose of the go file.
+This utility manages Firebase Auth users and creates tokens for testing services, such as submit-questions.
 
 RESTRICTIONS:
-    AWS functions:
-    * Program must have access to a .aws/credentials file in the default location.
-    * This will only access system parameters that start with '/sote' (ROOTPATH).
-    * {Enter other restrictions here for AWS
+    Firebase Auth Emulator:
+    * Set FIREBASE_AUTH_EMULATOR_HOST (host:port) to send every request to the emulator instead of production.
+    * Custom tokens are only exchanged for ID tokens when the emulator is used.
 
-    {Other catagories of restrictions}
-    * {List of restrictions for the catagory
+    Production:
+    * The configuration file must point to a service account key that can sign custom tokens.
+
+    Decode and Verify:
+    * Work offline. No configuration file is needed unless the project_id is used for the iss and aud checks.
 
 NOTES:
-    {Enter any additional notes that you believe will help the next developer.}
+    Actions are selected with -a. Run with -h to see the flags that each action uses.
 
 COPYRIGHT:
 	Copyright 2022
@@ -30,52 +32,277 @@ COPYRIGHT:
 */
 package main
 
-// import (
-// 	"log"
-//
-// 	"albert/constants"
-// 	"albert/core"
-// 	"albert/core/coreHelpers"
-// 	"firebase.google.com/go/auth"
-// )
-//
-// const (
-// // Add Constants to the constants.go file
-// )
-//
-// // Add types to the types.go file
-//
-// var (
-// // Add Variables here for the file (Remember, they are global)
-// )
-//
-// func init() {
-// 	// Set up goes here
-// }
-//
-// func main() {
-//
-// 	var (
-// 		err       error
-// 		tFirebase coreHelpers.FirebaseFirestoreHelper
-// 		tUser     *auth.UserRecord
-// 	)
-//
-// 	tFirebase.AppPtr, tFirebase.AuthPtr, tFirebase.FirestoreClientPtr, err = core.GetFirebaseFirestoreConnection(constants.TEST_FIREBASE_CREDENTIALS)
-//
-// 	params := (&auth.UserToCreate{}).
-// 		Email("user@example.com").
-// 		EmailVerified(false).
-// 		PhoneNumber("+16504830648").
-// 		Password("secretPassword").
-// 		DisplayName("Donald Drump").
-// 		PhotoURL("http://www.example.com/12345678/photo.png").
-// 		Disabled(false)
-// 	tUser, err = tFirebase.AuthPtr.CreateUser(core.CTXBackground, params)
-// 	if err != nil {
-// 		log.Fatalf("error creating user: %v\n", err)
-// 	}
-// 	log.Printf("Successfully created user: %v\n", tUser)
-//
-// 	tFirebase.AuthPtr.DeleteUser(core.CTXBackground, tUser.UID)
-// }
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/integrii/flaggy"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/language"
+	"gopkg.in/yaml.v3"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+type Config struct {
+	APIKey              string             `yaml:"api_key"`              // The Web API key used to exchange custom tokens. Any value is accepted by the emulator.
+	FirebaseCredentials string             `yaml:"firebase_credentials"` // The filename of your firebase credentials. Not used with the emulator.
+	PasswordHash        PasswordHashConfig `yaml:"password_hash"`        // The hash parameters used when importing users with password hashes.
+	ProjectId           string             `yaml:"project_id"`           // The Firebase project id. Required with the emulator.
+}
+
+var (
+	action         string
+	audience       string
+	certBundle     string
+	claimNames     string
+	claims         string
+	clockSkew      time.Duration
+	configFilename string
+	displayName    string
+	dryRun         bool
+	email          string
+	exchange       bool
+	fileFormat     string
+	filename       string
+	hmacKey        string
+	issuer         string
+	jwks           string
+	listenAddress  string
+	password       string
+	projectId      string
+	signingCert    string
+	signingKey     string
+	token          string
+	userId         string
+	utilityName    = "Generate Firebase JWT"
+	//
+)
+
+func init() {
+
+	appDescription := cases.Title(language.English).String(utilityName) + " creates, lists, disables, deletes, exports and imports Firebase Auth users, manages their custom claims, and mints custom tokens.\n" +
+		" Set " + ENV_AUTH_EMULATOR_HOST + " to work against the Firebase Auth Emulator and to exchange custom tokens for ID tokens.\n" +
+		" Tokens can be decoded and verified offline against an x509 certificate bundle, a JWKS file or an HMAC key.\n" +
+		" The serve action runs a local issuer that signs Firebase-style ID tokens and publishes its JWKS and x509 certificates."
+	// Set your program's name and description.  These appear in help output.
+	flaggy.SetName("\n" + utilityName) // "\n" is added to the start of the name to make the output easier to read.
+	flaggy.SetDescription(appDescription)
+
+	// You can disable various things by changing bool on the default parser
+	// (or your own parser if you have created one).
+	flaggy.DefaultParser.ShowHelpOnUnexpected = true
+
+	// You can set a help prepend or append on the default parser.
+	flaggy.DefaultParser.AdditionalHelpPrepend = "https://github.com/sty-holdings/utilities"
+
+	// Add a flag to the main program (this will be available in all subcommands as well).
+	flaggy.String(&action, "a", "action", "create | list | disable | enable | delete | token | decode | verify | export | import | show_claims | set_claims | merge_claims | remove_claims | reconcile_claims | serve")
+	flaggy.String(&audience, "", "audience", "The expected aud claim. The default is the project id. Only valid for the 'verify' action.")
+	flaggy.String(&certBundle, "b", "cert_bundle", "An x509 PEM bundle or securetoken JSON (kid to certificate) file. Only valid for the 'verify' action.")
+	flaggy.String(&claimNames, "", "claim_names", "A comma separated list of claim names. Only valid for the 'remove_claims' action.")
+	flaggy.String(&claims, "l", "claims", "Custom claims as a JSON object. Only valid for the 'token', 'set_claims' and 'merge_claims' actions.")
+	flaggy.String(&configFilename, "c", "config", "The directory and filename of the configuration file.")
+	flaggy.String(&displayName, "n", "name", "The display name of the user. Only valid for the 'create' action.")
+	flaggy.Bool(&dryRun, "d", "dry_run", "Output the claim diffs without changing any user. Only valid for the 'reconcile_claims' action.")
+	flaggy.String(&email, "e", "email", "The email of the user.")
+	flaggy.Bool(&exchange, "x", "exchange", "Exchange the custom token for an ID token using the emulator. Only valid for the 'token' action.")
+	flaggy.String(&filename, "f", "file", "The JSON or CSV file for the 'export' and 'import' actions, or the YAML claims file for the 'reconcile_claims' action.")
+	flaggy.String(&fileFormat, "", "format", "json | csv. The default is taken from the file extension. Only valid for the 'export' and 'import' actions.")
+	flaggy.String(&hmacKey, "k", "hmac_key", "A file holding the HMAC secret for HS256/384/512 tokens. Only valid for the 'verify' action.")
+	flaggy.String(&issuer, "", "issuer", "The expected iss claim. The default is "+FIREBASE_ISSUER_PREFIX+"<project id>. Only valid for the 'verify' action.")
+	flaggy.String(&jwks, "j", "jwks", "A JSON Web Key Set file. Only valid for the 'verify' action.")
+	flaggy.String(&listenAddress, "", "listen", "The host:port of the local issuer. The default is "+DEFAULT_ISSUER_ADDRESS+". Only valid for the 'serve' action.")
+	flaggy.String(&password, "p", "password", "The password of the user. Only valid for the 'create' action.")
+	flaggy.Duration(&clockSkew, "s", "skew", "The allowed clock skew for exp, nbf, iat and auth_time, such as 30s or 5m. Only valid for the 'verify' action.")
+	flaggy.String(&projectId, "r", "project", "The Firebase project id used for the iss and aud checks. The default is the project_id in the configuration file.")
+	flaggy.String(&signingCert, "", "signing_cert", "The PEM certificate of the signing key. One is generated when it is not provided. Only valid for the 'serve' action.")
+	flaggy.String(&signingKey, "", "signing_key", "A PEM RSA private key, such as one from generate_certificate. One is generated when it is not provided. Only valid for the 'serve' action.")
+	flaggy.String(&token, "t", "token", "The JWT to decode or verify. Use '-' to read it from stdin.")
+	flaggy.String(&userId, "u", "userid", "The userid (UID) of the user.")
+
+	// Set the version and parse all inputs into variables.
+	flaggy.Parse()
+}
+
+//goland:noinspection GoBoolExpressions
+func main() {
+
+	var (
+		errorInfo    errs.ErrorInfo
+		tAuthPtr     *auth.Client
+		tClaims      map[string]interface{}
+		tConfig      Config
+		tCustomToken string
+		tIssuer      localIssuer
+		tKeys        verificationKeys
+		tToken       string
+	)
+
+	fmt.Println()
+	action = strings.ToLower(action)
+
+	checkNotEmpty(action, "You must provide an action.")
+
+	switch action {
+	case ACTION_SERVE:
+		if configFilename != ctv.VAL_EMPTY {
+			if tConfig, errorInfo = loadConfig(configFilename); errorInfo.Error != nil {
+				errs.PrintErrorInfo(errorInfo)
+				os.Exit(1)
+			}
+		}
+	case ACTION_DECODE, ACTION_VERIFY:
+		checkNotEmpty(token, "You must provide a token.")
+		if configFilename != ctv.VAL_EMPTY {
+			if tConfig, errorInfo = loadConfig(configFilename); errorInfo.Error != nil {
+				errs.PrintErrorInfo(errorInfo)
+				os.Exit(1)
+			}
+		}
+		if tToken, errorInfo = readToken(token); errorInfo.Error != nil {
+			errs.PrintErrorInfo(errorInfo)
+			os.Exit(1)
+		}
+	default:
+		checkNotEmpty(configFilename, "You must provide a configuration filename.")
+		if tConfig, errorInfo = loadConfig(configFilename); errorInfo.Error != nil {
+			errs.PrintErrorInfo(errorInfo)
+			os.Exit(1)
+		}
+		if tAuthPtr, errorInfo = getAuthConnection(tConfig); errorInfo.Error != nil {
+			errs.PrintErrorInfo(errorInfo)
+			os.Exit(1)
+		}
+	}
+
+	switch action {
+	case ACTION_SERVE:
+		if projectId == ctv.VAL_EMPTY {
+			projectId = tConfig.ProjectId
+		}
+		if listenAddress == ctv.VAL_EMPTY {
+			listenAddress = DEFAULT_ISSUER_ADDRESS
+		}
+		if tIssuer, errorInfo = newLocalIssuer(projectId, signingKey, signingCert); errorInfo.Error != nil {
+			break
+		}
+		errorInfo = serveIssuer(tIssuer, listenAddress)
+	case ACTION_DECODE:
+		errorInfo = decodeToken(tToken)
+	case ACTION_VERIFY:
+		if tKeys, errorInfo = loadVerificationKeys(certBundle, jwks, hmacKey); errorInfo.Error != nil {
+			break
+		}
+		_, errorInfo = verifyToken(tToken, tKeys, buildVerificationOptions(tConfig))
+	case ACTION_CREATE:
+		checkNotEmpty(email, "You must provide an email.")
+		checkNotEmpty(password, "You must provide a password.")
+		errorInfo = createUser(tAuthPtr, userId, email, password, displayName)
+	case ACTION_LIST:
+		errorInfo = listUsers(tAuthPtr)
+	case ACTION_DISABLE, ACTION_ENABLE:
+		errorInfo = setUserDisabled(tAuthPtr, userId, email, action == ACTION_DISABLE)
+	case ACTION_DELETE:
+		errorInfo = deleteUser(tAuthPtr, userId, email)
+	case ACTION_EXPORT:
+		checkNotEmpty(filename, "You must provide a file.")
+		errorInfo = exportUsers(tAuthPtr, filename, fileFormat)
+	case ACTION_IMPORT:
+		checkNotEmpty(filename, "You must provide a file.")
+		errorInfo = importUsers(tAuthPtr, filename, fileFormat, tConfig.PasswordHash)
+	case ACTION_SHOW_CLAIMS:
+		errorInfo = showClaims(tAuthPtr, userId, email)
+	case ACTION_SET_CLAIMS, ACTION_MERGE_CLAIMS:
+		checkNotEmpty(claims, "You must provide claims.")
+		if tClaims, errorInfo = parseClaims(claims); errorInfo.Error != nil {
+			break
+		}
+		errorInfo = updateClaims(tAuthPtr, userId, email, action, tClaims, nil)
+	case ACTION_REMOVE_CLAIMS:
+		checkNotEmpty(claimNames, "You must provide claim names.")
+		errorInfo = updateClaims(tAuthPtr, userId, email, action, nil, parseClaimNames(claimNames))
+	case ACTION_RECONCILE_CLAIMS:
+		checkNotEmpty(filename, "You must provide a file.")
+		errorInfo = reconcileClaims(tAuthPtr, filename, dryRun)
+	case ACTION_TOKEN:
+		checkNotEmpty(userId, "You must provide a userid.")
+		if tClaims, errorInfo = parseClaims(claims); errorInfo.Error != nil {
+			break
+		}
+		if tCustomToken, errorInfo = mintCustomToken(tAuthPtr, userId, tClaims); errorInfo.Error != nil {
+			break
+		}
+		fmt.Printf("Custom Token: %s\n", tCustomToken)
+		if exchange {
+			errorInfo = exchangeCustomToken(tConfig.APIKey, tCustomToken)
+		}
+	default:
+		flaggy.ShowHelpAndExit("You have selected an invalid action.")
+	}
+
+	if errorInfo.Error != nil {
+		errs.PrintErrorInfo(errorInfo)
+		os.Exit(1)
+	}
+}
+
+// buildVerificationOptions - the flags win over the project id. Firebase ID tokens use
+// https://securetoken.google.com/<project id> as the issuer and the project id as the audience.
+func buildVerificationOptions(config Config) (options verificationOptions) {
+
+	options = verificationOptions{
+		Audience:  audience,
+		ClockSkew: clockSkew,
+		Issuer:    issuer,
+		Now:       time.Now(),
+	}
+
+	if projectId == ctv.VAL_EMPTY {
+		projectId = config.ProjectId
+	}
+	if projectId != ctv.VAL_EMPTY {
+		if options.Audience == ctv.VAL_EMPTY {
+			options.Audience = projectId
+		}
+		if options.Issuer == ctv.VAL_EMPTY {
+			options.Issuer = FIREBASE_ISSUER_PREFIX + projectId
+		}
+	}
+
+	return
+}
+
+func checkNotEmpty(value string, message string) {
+	if value == ctv.VAL_EMPTY {
+		flaggy.ShowHelpAndExit(message)
+	}
+}
+
+func loadConfig(configFilename string) (config Config, errorInfo errs.ErrorInfo) {
+
+	var (
+		tConfigFile *os.File
+	)
+
+	if tConfigFile, errorInfo.Error = os.Open(configFilename); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Config File: %s", configFilename))
+		return
+	}
+	defer func(tConfigFile *os.File) {
+		if err := tConfigFile.Close(); err != nil {
+			errs.PrintError(err, fmt.Sprintf("Config File: %s", configFilename))
+		}
+	}(tConfigFile)
+
+	decoder := yaml.NewDecoder(tConfigFile)
+	if errorInfo.Error = decoder.Decode(&config); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Config File: %s", configFilename))
+	}
+
+	return
+}
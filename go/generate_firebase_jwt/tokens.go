@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"firebase.google.com/go/auth"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+type signInWithCustomTokenReply struct {
+	ExpiresIn    string `json:"expiresIn"`
+	IdToken      string `json:"idToken"`
+	RefreshToken string `json:"refreshToken"`
+	Error        *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// exchangeCustomToken - signs in to the Firebase Auth Emulator with a custom token and outputs the ID token.
+// Production is never called, so the test JWTs can only come from the emulator.
+//
+//	Customer Messages: None
+//	Errors: ErrEmulatorNotSet, ErrTokenExchangeFailed, errors returned by the HTTP client
+//	Verifications: None
+func exchangeCustomToken(apiKey string, customToken string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tReply       signInWithCustomTokenReply
+		tRequestBody []byte
+		tResponsePtr *http.Response
+	)
+
+	if isEmulator() == false {
+		errorInfo = errs.NewErrorInfo(ErrEmulatorNotSet, ctv.VAL_EMPTY)
+		return
+	}
+
+	tRequestBody, _ = json.Marshal(map[string]interface{}{"token": customToken, "returnSecureToken": true})
+	if tResponsePtr, errorInfo.Error = http.Post(
+		fmt.Sprintf(SIGN_IN_CUSTOM_TOKEN_URL, getEmulatorHost(), apiKey),
+		"application/json",
+		bytes.NewReader(tRequestBody),
+	); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Emulator: %s", getEmulatorHost()))
+		return
+	}
+	defer tResponsePtr.Body.Close()
+
+	if errorInfo.Error = json.NewDecoder(tResponsePtr.Body).Decode(&tReply); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("HTTP Status: %s", tResponsePtr.Status))
+		return
+	}
+	if tReply.Error != nil || tReply.IdToken == ctv.VAL_EMPTY {
+		errorInfo = errs.NewErrorInfo(ErrTokenExchangeFailed, fmt.Sprintf("HTTP Status: %s", tResponsePtr.Status))
+		if tReply.Error != nil {
+			errorInfo.AdditionalInfo = fmt.Sprintf("%s Message: %s", errorInfo.AdditionalInfo, tReply.Error.Message)
+		}
+		return
+	}
+
+	fmt.Printf("ID Token: %s\n", tReply.IdToken)
+	fmt.Printf("Refresh Token: %s\n", tReply.RefreshToken)
+	fmt.Printf("Expires In (seconds): %s\n", tReply.ExpiresIn)
+
+	return
+}
+
+// mintCustomToken - creates a custom token with custom claims for the user. The emulator accepts unsigned tokens, so
+// no service account is needed when FIREBASE_AUTH_EMULATOR_HOST is set.
+//
+//	Customer Messages: None
+//	Errors: errors returned by Firebase
+//	Verifications: None
+func mintCustomToken(authPtr *auth.Client, userId string, claims map[string]interface{}) (customToken string, errorInfo errs.ErrorInfo) {
+
+	if isEmulator() {
+		customToken, errorInfo = mintUnsignedCustomToken(userId, claims)
+		return
+	}
+
+	if customToken, errorInfo.Error = authPtr.CustomTokenWithClaims(context.Background(), userId, claims); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("UID: %s", userId))
+	}
+
+	return
+}
+
+// mintUnsignedCustomToken - builds a custom token with the 'none' algorithm, which is only accepted by the emulator.
+//
+//	Customer Messages: None
+//	Errors: errors returned by json.Marshal
+//	Verifications: None
+func mintUnsignedCustomToken(userId string, claims map[string]interface{}) (customToken string, errorInfo errs.ErrorInfo) {
+
+	var (
+		tHeader  []byte
+		tNow     = time.Now().Unix()
+		tPayload []byte
+	)
+
+	tHeader, _ = json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	tBody := map[string]interface{}{
+		"aud": FIREBASE_CUSTOM_TOKEN_AUD,
+		"exp": tNow + CUSTOM_TOKEN_LIFETIME_SECONDS,
+		"iat": tNow,
+		"iss": EMULATOR_SERVICE_ACCOUNT,
+		"sub": EMULATOR_SERVICE_ACCOUNT,
+		"uid": userId,
+	}
+	if len(claims) > 0 {
+		tBody["claims"] = claims
+	}
+	if tPayload, errorInfo.Error = json.Marshal(tBody); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("UID: %s", userId))
+		return
+	}
+
+	customToken = base64.RawURLEncoding.EncodeToString(tHeader) + "." + base64.RawURLEncoding.EncodeToString(tPayload) + "."
+
+	return
+}
+
+// parseClaims - converts the claims flag into a map. An empty value returns no claims.
+//
+//	Customer Messages: None
+//	Errors: ErrClaimsInvalid
+//	Verifications: None
+func parseClaims(claimsJSON string) (claims map[string]interface{}, errorInfo errs.ErrorInfo) {
+
+	if claimsJSON == ctv.VAL_EMPTY {
+		return
+	}
+
+	if err := json.Unmarshal([]byte(claimsJSON), &claims); err != nil {
+		errorInfo = errs.NewErrorInfo(ErrClaimsInvalid, err.Error())
+	}
+
+	return
+}
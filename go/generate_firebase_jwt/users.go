@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"firebase.google.com/go/auth"
+	"google.golang.org/api/iterator"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// createUser - adds a user to Firebase Auth. When userId is empty, Firebase assigns the UID.
+//
+//	Customer Messages: None
+//	Errors: errors returned by Firebase
+//	Verifications: None
+func createUser(authPtr *auth.Client, userId string, email string, password string, displayName string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tUserRecordPtr *auth.UserRecord
+	)
+
+	tUserToCreatePtr := (&auth.UserToCreate{}).
+		Email(email).
+		EmailVerified(true).
+		Password(password).
+		Disabled(false)
+	if userId != ctv.VAL_EMPTY {
+		tUserToCreatePtr.UID(userId)
+	}
+	if displayName != ctv.VAL_EMPTY {
+		tUserToCreatePtr.DisplayName(displayName)
+	}
+
+	if tUserRecordPtr, errorInfo.Error = authPtr.CreateUser(context.Background(), tUserToCreatePtr); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Email: %s", email))
+		return
+	}
+
+	fmt.Println("The user has been created.")
+	printUserRecord(tUserRecordPtr)
+
+	return
+}
+
+// deleteUser - removes a user, found by UID or email, from Firebase Auth.
+//
+//	Customer Messages: None
+//	Errors: ErrUserIdentifierEmpty, errors returned by Firebase
+//	Verifications: None
+func deleteUser(authPtr *auth.Client, userId string, email string) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tUserRecordPtr *auth.UserRecord
+	)
+
+	if tUserRecordPtr, errorInfo = findUser(authPtr, userId, email); errorInfo.Error != nil {
+		return
+	}
+
+	if errorInfo.Error = authPtr.DeleteUser(context.Background(), tUserRecordPtr.UID); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("UID: %s", tUserRecordPtr.UID))
+		return
+	}
+
+	fmt.Printf("The user (%s) has been deleted.\n", tUserRecordPtr.UID)
+
+	return
+}
+
+// findUser - looks up a user by UID, or by email when no UID is provided.
+//
+//	Customer Messages: None
+//	Errors: ErrUserIdentifierEmpty, errors returned by Firebase
+//	Verifications: None
+func findUser(authPtr *auth.Client, userId string, email string) (userRecordPtr *auth.UserRecord, errorInfo errs.ErrorInfo) {
+
+	switch {
+	case userId != ctv.VAL_EMPTY:
+		if userRecordPtr, errorInfo.Error = authPtr.GetUser(context.Background(), userId); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("UID: %s", userId))
+		}
+	case email != ctv.VAL_EMPTY:
+		if userRecordPtr, errorInfo.Error = authPtr.GetUserByEmail(context.Background(), email); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Email: %s", email))
+		}
+	default:
+		errorInfo = errs.NewErrorInfo(ErrUserIdentifierEmpty, ctv.VAL_EMPTY)
+	}
+
+	return
+}
+
+// listUsers - outputs every user in Firebase Auth.
+//
+//	Customer Messages: None
+//	Errors: errors returned by Firebase
+//	Verifications: None
+func listUsers(authPtr *auth.Client) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tCounter         int
+		tExportedUserPtr *auth.ExportedUserRecord
+		tUserIteratorPtr *auth.UserIterator
+	)
+
+	tUserIteratorPtr = authPtr.Users(context.Background(), ctv.VAL_EMPTY)
+	for {
+		if tExportedUserPtr, errorInfo.Error = tUserIteratorPtr.Next(); errorInfo.Error == iterator.Done {
+			errorInfo.Error = nil
+			break
+		}
+		if errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, ctv.VAL_EMPTY)
+			return
+		}
+		tCounter++
+		fmt.Println("----------------------------")
+		printUserRecord(tExportedUserPtr.UserRecord)
+	}
+
+	fmt.Println("----------------------------")
+	fmt.Printf("Total Users: %d\n", tCounter)
+
+	return
+}
+
+// setUserDisabled - disables or enables a user, found by UID or email.
+//
+//	Customer Messages: None
+//	Errors: ErrUserIdentifierEmpty, errors returned by Firebase
+//	Verifications: None
+func setUserDisabled(authPtr *auth.Client, userId string, email string, disabled bool) (errorInfo errs.ErrorInfo) {
+
+	var (
+		tUpdatedPtr    *auth.UserRecord
+		tUserRecordPtr *auth.UserRecord
+	)
+
+	if tUserRecordPtr, errorInfo = findUser(authPtr, userId, email); errorInfo.Error != nil {
+		return
+	}
+
+	if tUpdatedPtr, errorInfo.Error = authPtr.UpdateUser(
+		context.Background(),
+		tUserRecordPtr.UID,
+		(&auth.UserToUpdate{}).Disabled(disabled),
+	); errorInfo.Error != nil {
+		errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("UID: %s", tUserRecordPtr.UID))
+		return
+	}
+
+	fmt.Println("The user has been updated.")
+	printUserRecord(tUpdatedPtr)
+
+	return
+}
+
+func printUserRecord(userRecordPtr *auth.UserRecord) {
+
+	var (
+		tClaims []byte
+	)
+
+	fmt.Printf("UID: %s\n", userRecordPtr.UID)
+	fmt.Printf("Email: %s (verified: %t)\n", userRecordPtr.Email, userRecordPtr.EmailVerified)
+	fmt.Printf("Display Name: %s\n", userRecordPtr.DisplayName)
+	fmt.Printf("Disabled: %t\n", userRecordPtr.Disabled)
+	if len(userRecordPtr.CustomClaims) > 0 {
+		tClaims, _ = json.Marshal(userRecordPtr.CustomClaims)
+		fmt.Printf("Custom Claims: %s\n", string(tClaims))
+	}
+}
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"time"
+
+	ctv "github.com/sty-holdings/sharedServices/v2024/constantsTypesVars"
+	errs "github.com/sty-holdings/sharedServices/v2024/errorServices"
+)
+
+// verificationFailure is one reason a token did not pass verification.
+type verificationFailure struct {
+	Check  string `json:"check"`
+	Reason string `json:"reason"`
+}
+
+// verificationKeys holds the public keys by key id (kid), the keys without a kid, and an optional HMAC secret.
+type verificationKeys struct {
+	ByKeyId map[string]crypto.PublicKey
+	HMACKey []byte
+	Unnamed []crypto.PublicKey
+}
+
+type verificationOptions struct {
+	Audience  string
+	ClockSkew time.Duration
+	Issuer    string
+	Now       time.Time
+}
+
+type jsonWebKey struct {
+	Alg string `json:"alg,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n,omitempty"`
+	Use string `json:"use,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// checkClaims - validates iss, aud, sub, exp, nbf, iat and auth_time. Every time check allows for the clock skew.
+//
+//	Customer Messages: None
+//	Errors: None
+//	Verifications: Expected issuer and audience, when provided, and the time claims.
+func checkClaims(claims map[string]interface{}, options verificationOptions) (failures []verificationFailure) {
+
+	var (
+		tExpires  int64
+		tFound    bool
+		tNow      = options.Now.Unix()
+		tSkew     = int64(options.ClockSkew.Seconds())
+		tSubject  string
+		tTimeName string
+	)
+
+	if options.Issuer != ctv.VAL_EMPTY {
+		if tIssuer, _ := claims[CLAIM_ISSUER].(string); tIssuer != options.Issuer {
+			failures = append(failures, verificationFailure{Check: CLAIM_ISSUER, Reason: fmt.Sprintf("expected '%s' but got '%s'", options.Issuer, tIssuer)})
+		}
+	}
+
+	if options.Audience != ctv.VAL_EMPTY && hasAudience(claims[CLAIM_AUDIENCE], options.Audience) == false {
+		failures = append(failures, verificationFailure{Check: CLAIM_AUDIENCE, Reason: fmt.Sprintf("expected '%s' but got '%v'", options.Audience, claims[CLAIM_AUDIENCE])})
+	}
+
+	if tSubject, _ = claims[CLAIM_SUBJECT].(string); tSubject == ctv.VAL_EMPTY {
+		failures = append(failures, verificationFailure{Check: CLAIM_SUBJECT, Reason: "missing or empty"})
+	}
+
+	if tExpires, tFound = numericClaim(claims, CLAIM_EXPIRES); tFound == false {
+		failures = append(failures, verificationFailure{Check: CLAIM_EXPIRES, Reason: "missing or not a number"})
+	} else if tNow > tExpires+tSkew {
+		failures = append(failures, verificationFailure{Check: CLAIM_EXPIRES, Reason: fmt.Sprintf("expired at %s", formatUnix(tExpires))})
+	}
+
+	if _, tFound = claims[CLAIM_ISSUED_AT]; tFound == false {
+		failures = append(failures, verificationFailure{Check: CLAIM_ISSUED_AT, Reason: "missing"})
+	}
+
+	// nbf, iat and auth_time must not be in the future. nbf and auth_time are optional.
+	for _, tTimeName = range []string{CLAIM_NOT_BEFORE, CLAIM_ISSUED_AT, CLAIM_AUTH_TIME} {
+		if _, tFound = claims[tTimeName]; tFound == false {
+			continue
+		}
+		if tSeconds, ok := numericClaim(claims, tTimeName); ok == false {
+			failures = append(failures, verificationFailure{Check: tTimeName, Reason: "not a number"})
+		} else if tSeconds > tNow+tSkew {
+			failures = append(failures, verificationFailure{Check: tTimeName, Reason: fmt.Sprintf("in the future (%s)", formatUnix(tSeconds))})
+		}
+	}
+
+	return
+}
+
+// checkSignature - verifies the JWS signature with the key named by the header kid. When there is no kid, or the kid
+// is not in the key set, every key is tried.
+//
+//	Customer Messages: None
+//	Errors: None
+//	Verifications: Signature and algorithm.
+func checkSignature(parts jwtParts, keys verificationKeys) (failures []verificationFailure) {
+
+	var (
+		tAlgorithm, _ = parts.Header[HEADER_ALGORITHM].(string)
+		tCandidates   []crypto.PublicKey
+		tKeyId, _     = parts.Header[HEADER_KEY_ID].(string)
+	)
+
+	if strings.HasPrefix(tAlgorithm, "HS") {
+		if len(keys.HMACKey) == 0 {
+			failures = append(failures, verificationFailure{Check: CHECK_SIGNATURE, Reason: fmt.Sprintf("the token uses %s but no HMAC key was provided", tAlgorithm)})
+		} else if verifySignature(tAlgorithm, keys.HMACKey, parts.SigningInput, parts.Signature) == false {
+			failures = append(failures, verificationFailure{Check: CHECK_SIGNATURE, Reason: "the HMAC signature does not match"})
+		}
+		return
+	}
+
+	if tKey, ok := keys.ByKeyId[tKeyId]; ok && tKeyId != ctv.VAL_EMPTY {
+		tCandidates = append(tCandidates, tKey)
+	} else {
+		for _, tKey = range keys.ByKeyId {
+			tCandidates = append(tCandidates, tKey)
+		}
+		tCandidates = append(tCandidates, keys.Unnamed...)
+	}
+
+	if len(tCandidates) == 0 {
+		failures = append(failures, verificationFailure{Check: CHECK_SIGNATURE, Reason: "no public keys were provided"})
+		return
+	}
+
+	for _, tKey := range tCandidates {
+		if verifySignature(tAlgorithm, tKey, parts.SigningInput, parts.Signature) {
+			return
+		}
+	}
+
+	failures = append(failures, verificationFailure{Check: CHECK_SIGNATURE, Reason: fmt.Sprintf("no key verified the %s signature (kid: '%s')", tAlgorithm, tKeyId)})
+
+	return
+}
+
+// loadVerificationKeys - reads the keys from an x509 certificate bundle, a JWKS file and an HMAC key file. Any of them may be empty.
+// The certificate bundle is either PEM certificates or the securetoken JSON document that maps each kid to a PEM certificate.
+//
+//	Customer Messages: None
+//	Errors: ErrNoVerificationKeys, errors returned while reading or parsing the files
+//	Verifications: None
+func loadVerificationKeys(certBundleFQN string, jwksFQN string, hmacKeyFQN string) (keys verificationKeys, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData []byte
+	)
+
+	keys.ByKeyId = make(map[string]crypto.PublicKey)
+
+	if certBundleFQN != ctv.VAL_EMPTY {
+		if tData, errorInfo.Error = os.ReadFile(certBundleFQN); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Certificate Bundle: %s", certBundleFQN))
+			return
+		}
+		if errorInfo.Error = keys.addCertificateBundle(tData); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("Certificate Bundle: %s", certBundleFQN))
+			return
+		}
+	}
+
+	if jwksFQN != ctv.VAL_EMPTY {
+		if tData, errorInfo.Error = os.ReadFile(jwksFQN); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("JWKS: %s", jwksFQN))
+			return
+		}
+		if errorInfo.Error = keys.addJWKS(tData); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("JWKS: %s", jwksFQN))
+			return
+		}
+	}
+
+	if hmacKeyFQN != ctv.VAL_EMPTY {
+		if keys.HMACKey, errorInfo.Error = os.ReadFile(hmacKeyFQN); errorInfo.Error != nil {
+			errorInfo = errs.NewErrorInfo(errorInfo.Error, fmt.Sprintf("HMAC Key: %s", hmacKeyFQN))
+			return
+		}
+		keys.HMACKey = []byte(strings.TrimRight(string(keys.HMACKey), "\r\n"))
+	}
+
+	if len(keys.ByKeyId) == 0 && len(keys.Unnamed) == 0 && len(keys.HMACKey) == 0 {
+		errorInfo = errs.NewErrorInfo(ErrNoVerificationKeys, ctv.VAL_EMPTY)
+	}
+
+	return
+}
+
+// verifyToken - checks the signature and claims of a JWT and outputs every failure found.
+//
+//	Customer Messages: None
+//	Errors: ErrTokenMalformed, ErrTokenInvalid, errors returned while loading the keys
+//	Verifications: checkSignature, checkClaims
+func verifyToken(token string, keys verificationKeys, options verificationOptions) (failures []verificationFailure, errorInfo errs.ErrorInfo) {
+
+	var (
+		tData  []byte
+		tParts jwtParts
+	)
+
+	if tParts, errorInfo = parseJWT(token); errorInfo.Error != nil {
+		return
+	}
+
+	printJWT(tParts)
+
+	failures = append(checkSignature(tParts, keys), checkClaims(tParts.Claims, options)...)
+	if len(failures) == 0 {
+		if tSkipped := skippedChecks(options); len(tSkipped) > 0 {
+			fmt.Printf("The token is valid, but these claims were not checked: %s. Provide the project_id, issuer or audience to check them.\n", strings.Join(tSkipped, ", "))
+			return
+		}
+		fmt.Println("The token is valid.")
+		return
+	}
+
+	tData, _ = json.MarshalIndent(failures, ctv.VAL_EMPTY, ctv.SPACES_FOUR)
+	fmt.Printf("Verification Failures:\n%s\n", string(tData))
+	errorInfo = errs.NewErrorInfo(ErrTokenInvalid, fmt.Sprintf("Failures: %d", len(failures)))
+
+	return
+}
+
+// skippedChecks - the claims checkClaims does not check, because there is no expected value for them.
+func skippedChecks(options verificationOptions) (skipped []string) {
+
+	if options.Issuer == ctv.VAL_EMPTY {
+		skipped = append(skipped, CLAIM_ISSUER)
+	}
+	if options.Audience == ctv.VAL_EMPTY {
+		skipped = append(skipped, CLAIM_AUDIENCE)
+	}
+
+	return
+}
+
+// addCertificateBundle - adds the certificates found in a PEM bundle or a securetoken JSON document.
+func (keys *verificationKeys) addCertificateBundle(data []byte) (err error) {
+
+	var (
+		tBlockPtr        *pem.Block
+		tCertificatePtr  *x509.Certificate
+		tCertificatesMap map[string]string
+	)
+
+	if json.Unmarshal(data, &tCertificatesMap) == nil {
+		for tKeyId, tPEM := range tCertificatesMap {
+			if tBlockPtr, _ = pem.Decode([]byte(tPEM)); tBlockPtr == nil {
+				return fmt.Errorf("kid %s does not hold a PEM certificate", tKeyId)
+			}
+			if tCertificatePtr, err = x509.ParseCertificate(tBlockPtr.Bytes); err != nil {
+				return
+			}
+			keys.ByKeyId[tKeyId] = tCertificatePtr.PublicKey
+		}
+		return
+	}
+
+	for {
+		if tBlockPtr, data = pem.Decode(data); tBlockPtr == nil {
+			break
+		}
+		if tBlockPtr.Type != PEM_CERTIFICATE {
+			continue
+		}
+		if tCertificatePtr, err = x509.ParseCertificate(tBlockPtr.Bytes); err != nil {
+			return
+		}
+		keys.Unnamed = append(keys.Unnamed, tCertificatePtr.PublicKey)
+	}
+
+	return
+}
+
+// addJWKS - adds the RSA and EC keys found in a JSON Web Key Set.
+func (keys *verificationKeys) addJWKS(data []byte) (err error) {
+
+	var (
+		tJWKS struct {
+			Keys []jsonWebKey `json:"keys"`
+		}
+		tPublicKey crypto.PublicKey
+	)
+
+	if err = json.Unmarshal(data, &tJWKS); err != nil {
+		return
+	}
+
+	for _, tJWK := range tJWKS.Keys {
+		if tPublicKey, err = tJWK.publicKey(); err != nil {
+			return
+		}
+		if tJWK.Kid == ctv.VAL_EMPTY {
+			keys.Unnamed = append(keys.Unnamed, tPublicKey)
+		} else {
+			keys.ByKeyId[tJWK.Kid] = tPublicKey
+		}
+	}
+
+	return
+}
+
+// publicKey - converts the JWK into an RSA or ECDSA public key.
+func (jwk jsonWebKey) publicKey() (publicKey crypto.PublicKey, err error) {
+
+	var (
+		tCurve elliptic.Curve
+		tE     []byte
+		tN     []byte
+		tX     []byte
+		tY     []byte
+	)
+
+	switch jwk.Kty {
+	case "RSA":
+		if tN, err = base64.RawURLEncoding.DecodeString(jwk.N); err != nil {
+			return
+		}
+		if tE, err = base64.RawURLEncoding.DecodeString(jwk.E); err != nil {
+			return
+		}
+		publicKey = &rsa.PublicKey{N: new(big.Int).SetBytes(tN), E: int(new(big.Int).SetBytes(tE).Int64())}
+	case "EC":
+		switch jwk.Crv {
+		case "P-256":
+			tCurve = elliptic.P256()
+		case "P-384":
+			tCurve = elliptic.P384()
+		case "P-521":
+			tCurve = elliptic.P521()
+		default:
+			err = fmt.Errorf("kid %s uses an unsupported curve '%s'", jwk.Kid, jwk.Crv)
+			return
+		}
+		if tX, err = base64.RawURLEncoding.DecodeString(jwk.X); err != nil {
+			return
+		}
+		if tY, err = base64.RawURLEncoding.DecodeString(jwk.Y); err != nil {
+			return
+		}
+		publicKey = &ecdsa.PublicKey{Curve: tCurve, X: new(big.Int).SetBytes(tX), Y: new(big.Int).SetBytes(tY)}
+	default:
+		err = fmt.Errorf("kid %s uses an unsupported key type '%s'", jwk.Kid, jwk.Kty)
+	}
+
+	return
+}
+
+// verifySignature - returns true when the signature matches the signing input for the algorithm and key.
+// A key that does not match the algorithm family never verifies.
+func verifySignature(algorithm string, key interface{}, signingInput []byte, signature []byte) bool {
+
+	var (
+		tHash crypto.Hash
+	)
+
+	if tHash = algorithmHash(algorithm); tHash == 0 {
+		return false
+	}
+	tHasher := tHash.New()
+	tHasher.Write(signingInput)
+	tDigest := tHasher.Sum(nil)
+
+	switch algorithm[:2] {
+	case "RS":
+		if tKeyPtr, ok := key.(*rsa.PublicKey); ok {
+			return rsa.VerifyPKCS1v15(tKeyPtr, tHash, tDigest, signature) == nil
+		}
+	case "PS":
+		if tKeyPtr, ok := key.(*rsa.PublicKey); ok {
+			return rsa.VerifyPSS(tKeyPtr, tHash, tDigest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case "ES":
+		// ES256 is only for P-256, ES384 for P-384 and ES512 for P-521 (RFC 7518 section 3.4).
+		if tKeyPtr, ok := key.(*ecdsa.PublicKey); ok && tKeyPtr.Curve == algorithmCurve(algorithm) {
+			tSize := (tKeyPtr.Curve.Params().BitSize + 7) / 8
+			if len(signature) != 2*tSize {
+				return false
+			}
+			return ecdsa.Verify(tKeyPtr, tDigest, new(big.Int).SetBytes(signature[:tSize]), new(big.Int).SetBytes(signature[tSize:]))
+		}
+	case "HS":
+		if tSecret, ok := key.([]byte); ok {
+			tMAC := hmac.New(tHash.New, tSecret)
+			tMAC.Write(signingInput)
+			return hmac.Equal(tMAC.Sum(nil), signature)
+		}
+	}
+
+	return false
+}
+
+// algorithmHash - returns the hash used by a JWS algorithm, or zero when the algorithm is not supported.
+func algorithmHash(algorithm string) crypto.Hash {
+
+	if len(algorithm) != 5 {
+		return 0
+	}
+
+	switch algorithm[2:] {
+	case "256":
+		return crypto.SHA256
+	case "384":
+		return crypto.SHA384
+	case "512":
+		return crypto.SHA512
+	}
+
+	return 0
+}
+
+// algorithmCurve - returns the curve an ES algorithm signs with, or nil when it is not one.
+func algorithmCurve(algorithm string) elliptic.Curve {
+
+	switch algorithm {
+	case "ES256":
+		return elliptic.P256()
+	case "ES384":
+		return elliptic.P384()
+	case "ES512":
+		return elliptic.P521()
+	}
+
+	return nil
+}
+
+func formatUnix(seconds int64) string {
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
+
+// hasAudience - the aud claim may be a string or an array of strings.
+func hasAudience(audience interface{}, expected string) bool {
+
+	switch tAudience := audience.(type) {
+	case string:
+		return tAudience == expected
+	case []interface{}:
+		for _, tValue := range tAudience {
+			if tValue == expected {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"crypto"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestVerifyToken(t *testing.T) {
+
+	var (
+		tIssuer = newTestIssuer(t)
+		tNow    = time.Now()
+		tOther  = newTestIssuer(t)
+	)
+
+	tKeys := verificationKeys{ByKeyId: map[string]crypto.PublicKey{tIssuer.KeyId: &tIssuer.PrivateKey.PublicKey}}
+	tOptions := verificationOptions{
+		Audience:  TEST_PROJECT_ID,
+		ClockSkew: 30 * time.Second,
+		Issuer:    FIREBASE_ISSUER_PREFIX + TEST_PROJECT_ID,
+		Now:       tNow,
+	}
+
+	for _, tCase := range []struct {
+		name     string
+		token    string
+		keys     verificationKeys
+		options  func(options verificationOptions) verificationOptions
+		wantFail []string
+	}{
+		{
+			name:  "valid",
+			token: signTestToken(t, tIssuer, idTokenRequest{}, tNow),
+			keys:  tKeys,
+		},
+		{
+			name:  "inside clock skew",
+			token: signTestToken(t, tIssuer, idTokenRequest{ExpiresIn: 60}, tNow.Add(-80*time.Second)),
+			keys:  tKeys,
+		},
+		{
+			name:     "expired",
+			token:    signTestToken(t, tIssuer, idTokenRequest{ExpiresIn: 60}, tNow.Add(-2*time.Hour)),
+			keys:     tKeys,
+			wantFail: []string{CLAIM_EXPIRES},
+		},
+		{
+			name:     "issued in the future",
+			token:    signTestToken(t, tIssuer, idTokenRequest{}, tNow.Add(time.Hour)),
+			keys:     tKeys,
+			wantFail: []string{CLAIM_ISSUED_AT, CLAIM_AUTH_TIME},
+		},
+		{
+			name:  "wrong audience",
+			token: signTestToken(t, tIssuer, idTokenRequest{}, tNow),
+			keys:  tKeys,
+			options: func(options verificationOptions) verificationOptions {
+				options.Audience = "another-project"
+				return options
+			},
+			wantFail: []string{CLAIM_AUDIENCE},
+		},
+		{
+			name:  "wrong issuer",
+			token: signTestToken(t, tIssuer, idTokenRequest{}, tNow),
+			keys:  tKeys,
+			options: func(options verificationOptions) verificationOptions {
+				options.Issuer = FIREBASE_ISSUER_PREFIX + "another-project"
+				return options
+			},
+			wantFail: []string{CLAIM_ISSUER},
+		},
+		{
+			name:     "wrong key",
+			token:    signTestToken(t, tIssuer, idTokenRequest{}, tNow),
+			keys:     verificationKeys{Unnamed: []crypto.PublicKey{&tOther.PrivateKey.PublicKey}},
+			wantFail: []string{CHECK_SIGNATURE},
+		},
+		{
+			name:     "wrong key with the same kid",
+			token:    signTestToken(t, tIssuer, idTokenRequest{}, tNow),
+			keys:     verificationKeys{ByKeyId: map[string]crypto.PublicKey{tIssuer.KeyId: &tOther.PrivateKey.PublicKey}},
+			wantFail: []string{CHECK_SIGNATURE},
+		},
+		{
+			name:     "HMAC key for an RS256 token",
+			token:    signTestToken(t, tIssuer, idTokenRequest{}, tNow),
+			keys:     verificationKeys{HMACKey: []byte("secret")},
+			wantFail: []string{CHECK_SIGNATURE},
+		},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			tCaseOptions := tOptions
+			if tCase.options != nil {
+				tCaseOptions = tCase.options(tOptions)
+			}
+
+			tFailures, tErrorInfo := verifyToken(tCase.token, tCase.keys, tCaseOptions)
+			if len(tCase.wantFail) == 0 {
+				if tErrorInfo.Error != nil {
+					t.Fatalf("verifyToken: %s %s %+v", tErrorInfo.Error, tErrorInfo.AdditionalInfo, tFailures)
+				}
+				return
+			}
+			if errors.Is(tErrorInfo.Error, ErrTokenInvalid) == false {
+				t.Fatalf("verifyToken error = %v, want %s", tErrorInfo.Error, ErrTokenInvalid)
+			}
+			if len(tFailures) != len(tCase.wantFail) {
+				t.Fatalf("verifyToken failures = %+v, want checks %v", tFailures, tCase.wantFail)
+			}
+			for tIndex, tCheck := range tCase.wantFail {
+				if tFailures[tIndex].Check != tCheck {
+					t.Errorf("failure %d = %+v, want check %s", tIndex, tFailures[tIndex], tCheck)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyTokenMalformed(t *testing.T) {
+
+	tIdToken := signTestToken(t, newTestIssuer(t), idTokenRequest{}, time.Now())
+
+	for _, tToken := range []string{
+		"",
+		"not-a-token",
+		tIdToken + ".extra",
+		"!!!." + tIdToken,
+	} {
+		if _, tErrorInfo := verifyToken(tToken, verificationKeys{}, verificationOptions{Now: time.Now()}); errors.Is(tErrorInfo.Error, ErrTokenMalformed) == false {
+			t.Errorf("verifyToken(%q) error = %v, want %s", tToken, tErrorInfo.Error, ErrTokenMalformed)
+		}
+	}
+}
+
+func TestDiffClaims(t *testing.T) {
+
+	tDiff := diffClaims(
+		map[string]interface{}{"admin": true, "level": float64(1), "team": "a"},
+		map[string]interface{}{"level": 1, "team": "b", "tier": "gold"},
+	)
+	tWant := []string{
+		"- admin: true",
+		"~ team: \"a\" -> \"b\"",
+		"+ tier: \"gold\"",
+	}
+
+	if len(tDiff) != len(tWant) {
+		t.Fatalf("diffClaims = %q, want %q", tDiff, tWant)
+	}
+	for tIndex := range tWant {
+		if tDiff[tIndex] != tWant[tIndex] {
+			t.Errorf("diffClaims line %d = %q, want %q", tIndex, tDiff[tIndex], tWant[tIndex])
+		}
+	}
+}
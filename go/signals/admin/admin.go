@@ -0,0 +1,364 @@
+// Package admin
+/*
+This package serves the operational endpoints of a long-running daemon on their own listener:
+    /healthz       200 while every health check passes. systemd, Kubernetes or a load balancer restarts the process on 503.
+    /readyz        200 once SetReady(true) has been called and every readiness check passes, 503 otherwise.
+    /metrics       Go runtime, process and registered metrics in the Prometheus text format.
+    /debug/pprof/  the net/http/pprof handlers, when Config.Pprof is set.
+
+RESTRICTIONS:
+    * Checks run on every request, at the same time, and are cancelled after Config.CheckTimeout. They must be cheap.
+    * Metrics have no labels. Register one metric per series.
+    * Bind the address to localhost or a private network. pprof exposes the process's memory and the endpoints have no authentication.
+
+NOTES:
+    /readyz returns 503 as soon as the context passed to Start is cancelled, which should be the lifecycle context, so load balancers
+    stop sending traffic while the shutdown hooks drain. The server itself keeps answering until Shutdown is called, so register
+    Shutdown as a late hook.
+
+    Both endpoints return a JSON body naming each check, for example:
+        {"status":"fail","checks":{"database":"dial tcp 10.0.0.5:5432: connection refused","queue":"ok"}}
+
+COPYRIGHT:
+	Copyright 2022
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Check - returns nil when the component is healthy or ready. ctx is cancelled after Config.CheckTimeout.
+type Check func(ctx context.Context) error
+
+type Config struct {
+	Address      string        // The listen address, such as 127.0.0.1:9100. Ignored when Listener is set.
+	CheckTimeout time.Duration // The default is DEFAULT_CHECK_TIMEOUT.
+	Listener     net.Listener  // Optional. A listener passed by socket activation.
+	Logger       *log.Logger   // The default is log.Default().
+	Pprof        bool          // Serve /debug/pprof/.
+}
+
+type Server struct {
+	config       Config
+	health       map[string]Check
+	httpServer   *http.Server
+	mu           sync.Mutex // Guards health and readiness.
+	readiness    map[string]Check
+	ready        atomic.Bool
+	registry     registry
+	shuttingDown atomic.Bool
+}
+
+type checkReply struct {
+	Checks map[string]string `json:"checks,omitempty"`
+	Status string            `json:"status"`
+}
+
+// New - builds the server and registers the runtime metrics. Call Start to begin serving.
+//
+//	Errors: ErrAddressEmpty
+func New(config Config) (serverPtr *Server, err error) {
+
+	if config.Address == "" && config.Listener == nil {
+		return nil, ErrAddressEmpty
+	}
+	if config.CheckTimeout <= 0 {
+		config.CheckTimeout = DEFAULT_CHECK_TIMEOUT
+	}
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+
+	serverPtr = &Server{
+		config:    config,
+		health:    make(map[string]Check),
+		readiness: make(map[string]Check),
+		registry:  registry{metrics: make(map[string]metric)},
+	}
+	serverPtr.registry.addRuntimeMetrics(time.Now())
+	_ = serverPtr.registry.add("daemon_ready", "1 while SetReady(true) is in effect and the shutdown has not started.", TYPE_GAUGE, func() float64 {
+		return boolToFloat(serverPtr.ready.Load() && serverPtr.shuttingDown.Load() == false)
+	})
+	_ = serverPtr.registry.add("daemon_shutting_down", "1 once the shutdown has started.", TYPE_GAUGE, func() float64 {
+		return boolToFloat(serverPtr.shuttingDown.Load())
+	})
+
+	return
+}
+
+// AddHealthCheck - adds a check to /healthz. A failing health check means the process should be restarted.
+//
+//	Errors: ErrCheckNameEmpty, ErrCheckNameInUse
+func (serverPtr *Server) AddHealthCheck(name string, check Check) error {
+	return serverPtr.addCheck(serverPtr.health, name, check)
+}
+
+// AddReadinessCheck - adds a check to /readyz. A failing readiness check means the process should not be sent work.
+//
+//	Errors: ErrCheckNameEmpty, ErrCheckNameInUse
+func (serverPtr *Server) AddReadinessCheck(name string, check Check) error {
+	return serverPtr.addCheck(serverPtr.readiness, name, check)
+}
+
+// Counter - registers and returns a counter.
+//
+//	Errors: ErrMetricNameInUse, ErrMetricNameInvalid
+func (serverPtr *Server) Counter(name string, help string) (counterPtr *Counter, err error) {
+
+	counterPtr = &Counter{}
+	if err = serverPtr.registry.add(name, help, TYPE_COUNTER, counterPtr.Value); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// Gauge - registers and returns a gauge.
+//
+//	Errors: ErrMetricNameInUse, ErrMetricNameInvalid
+func (serverPtr *Server) Gauge(name string, help string) (gaugePtr *Gauge, err error) {
+
+	gaugePtr = &Gauge{}
+	if err = serverPtr.registry.add(name, help, TYPE_GAUGE, gaugePtr.Value); err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// GaugeFunc - registers a gauge whose value is read by calling value on every scrape.
+//
+//	Errors: ErrMetricNameInUse, ErrMetricNameInvalid
+func (serverPtr *Server) GaugeFunc(name string, help string, value func() float64) error {
+	return serverPtr.registry.add(name, help, TYPE_GAUGE, value)
+}
+
+// SetReady - /readyz returns 503 until this is called with true, usually once start-up has finished.
+func (serverPtr *Server) SetReady(ready bool) {
+	serverPtr.ready.Store(ready)
+}
+
+// Start - listens and serves in the background. When ctx is cancelled /readyz starts returning 503, but the server keeps
+// answering until Shutdown is called.
+//
+//	Errors: errors returned by net.Listen
+func (serverPtr *Server) Start(ctx context.Context) (err error) {
+
+	var (
+		tListener = serverPtr.config.Listener
+	)
+
+	if tListener == nil {
+		if tListener, err = net.Listen("tcp", serverPtr.config.Address); err != nil {
+			return
+		}
+	}
+
+	serverPtr.httpServer = &http.Server{
+		Handler:           serverPtr.Handler(),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		serverPtr.shuttingDown.Store(true)
+	}()
+	go func() {
+		if tErr := serverPtr.httpServer.Serve(tListener); tErr != nil && errors.Is(tErr, http.ErrServerClosed) == false {
+			serverPtr.config.Logger.Printf("Admin server on %s stopped: %s", tListener.Addr(), tErr)
+		}
+	}()
+	serverPtr.config.Logger.Printf("Admin server listening on %s", tListener.Addr())
+
+	return
+}
+
+// Shutdown - stops the server, waiting for in-flight requests until ctx is cancelled.
+func (serverPtr *Server) Shutdown(ctx context.Context) error {
+
+	serverPtr.shuttingDown.Store(true)
+	if serverPtr.httpServer == nil {
+		return nil
+	}
+
+	return serverPtr.httpServer.Shutdown(ctx)
+}
+
+// Handler - returns the endpoints, for a daemon that serves them on a listener of its own.
+func (serverPtr *Server) Handler() http.Handler {
+
+	var (
+		tMux = http.NewServeMux()
+	)
+
+	tMux.HandleFunc(PATH_HEALTHZ, serverPtr.handleHealthz)
+	tMux.HandleFunc(PATH_READYZ, serverPtr.handleReadyz)
+	tMux.HandleFunc(PATH_METRICS, serverPtr.handleMetrics)
+	if serverPtr.config.Pprof {
+		tMux.HandleFunc(PATH_PPROF, pprof.Index)
+		tMux.HandleFunc(PATH_PPROF+"cmdline", pprof.Cmdline)
+		tMux.HandleFunc(PATH_PPROF+"profile", pprof.Profile)
+		tMux.HandleFunc(PATH_PPROF+"symbol", pprof.Symbol)
+		tMux.HandleFunc(PATH_PPROF+"trace", pprof.Trace)
+	}
+
+	return tMux
+}
+
+func (serverPtr *Server) addCheck(checks map[string]Check, name string, check Check) (err error) {
+
+	if name == "" || check == nil {
+		return ErrCheckNameEmpty
+	}
+
+	serverPtr.mu.Lock()
+	defer serverPtr.mu.Unlock()
+
+	if _, ok := checks[name]; ok {
+		return fmt.Errorf("%w: %s", ErrCheckNameInUse, name)
+	}
+	checks[name] = check
+
+	return
+}
+
+func (serverPtr *Server) handleHealthz(responseWriter http.ResponseWriter, request *http.Request) {
+	writeCheckReply(responseWriter, serverPtr.runChecks(request.Context(), serverPtr.health, nil))
+}
+
+func (serverPtr *Server) handleReadyz(responseWriter http.ResponseWriter, request *http.Request) {
+
+	var (
+		tBlocked error
+	)
+
+	switch {
+	case serverPtr.shuttingDown.Load():
+		tBlocked = ErrShuttingDown
+	case serverPtr.ready.Load() == false:
+		tBlocked = ErrNotReady
+	}
+
+	writeCheckReply(responseWriter, serverPtr.runChecks(request.Context(), serverPtr.readiness, tBlocked))
+}
+
+func (serverPtr *Server) handleMetrics(responseWriter http.ResponseWriter, _ *http.Request) {
+
+	responseWriter.Header().Set("Content-Type", CONTENT_TYPE_METRICS)
+	if err := serverPtr.registry.write(responseWriter); err != nil {
+		serverPtr.config.Logger.Printf("Writing metrics failed: %s", err)
+	}
+}
+
+// runChecks - runs every check at the same time. blocked, when set, fails the reply without running the checks.
+func (serverPtr *Server) runChecks(ctx context.Context, checks map[string]Check, blocked error) (reply checkReply) {
+
+	var (
+		tMu        sync.Mutex
+		tWaitGroup sync.WaitGroup
+	)
+
+	reply.Status = STATUS_OK
+	if blocked != nil {
+		reply.Status = STATUS_FAIL
+		reply.Checks = map[string]string{"daemon": blocked.Error()}
+		return
+	}
+
+	serverPtr.mu.Lock()
+	tChecks := make(map[string]Check, len(checks))
+	for tName, tCheck := range checks {
+		tChecks[tName] = tCheck
+	}
+	serverPtr.mu.Unlock()
+
+	tContext, tCancel := context.WithTimeout(ctx, serverPtr.config.CheckTimeout)
+	defer tCancel()
+
+	reply.Checks = make(map[string]string, len(tChecks))
+	for tName, tCheck := range tChecks {
+		tWaitGroup.Add(1)
+		go func(name string, check Check) {
+			defer tWaitGroup.Done()
+			tResult := STATUS_OK
+			if tErr := runCheck(tContext, check); tErr != nil {
+				tResult = tErr.Error()
+			}
+			tMu.Lock()
+			reply.Checks[name] = tResult
+			if tResult != STATUS_OK {
+				reply.Status = STATUS_FAIL
+			}
+			tMu.Unlock()
+		}(tName, tCheck)
+	}
+	tWaitGroup.Wait()
+
+	return
+}
+
+// runCheck - a check that ignores ctx is reported as failed once ctx is done. A panic is reported as the check's error.
+func runCheck(ctx context.Context, check Check) (err error) {
+
+	var (
+		tFinished = make(chan error, 1)
+	)
+
+	go func() {
+		defer func() {
+			if tRecovered := recover(); tRecovered != nil {
+				tFinished <- fmt.Errorf("panic: %v", tRecovered)
+			}
+		}()
+		tFinished <- check(ctx)
+	}()
+
+	select {
+	case err = <-tFinished:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	return
+}
+
+func writeCheckReply(responseWriter http.ResponseWriter, reply checkReply) {
+
+	responseWriter.Header().Set("Content-Type", CONTENT_TYPE_JSON)
+	responseWriter.Header().Set("Cache-Control", "no-store")
+	if reply.Status != STATUS_OK {
+		responseWriter.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(responseWriter).Encode(reply)
+}
+
+func boolToFloat(value bool) float64 {
+
+	if value {
+		return 1
+	}
+
+	return 0
+}
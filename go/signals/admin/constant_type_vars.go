@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"errors"
+	"time"
+)
+
+//goland:noinspection ALL
+const (
+	PATH_HEALTHZ = "/healthz"
+	PATH_METRICS = "/metrics"
+	PATH_PPROF   = "/debug/pprof/"
+	PATH_READYZ  = "/readyz"
+	//
+	DEFAULT_CHECK_TIMEOUT = 5 * time.Second
+	//
+	CONTENT_TYPE_JSON    = "application/json"
+	CONTENT_TYPE_METRICS = "text/plain; version=0.0.4; charset=utf-8"
+	//
+	STATUS_FAIL = "fail"
+	STATUS_OK   = "ok"
+	//
+	TYPE_COUNTER = "counter"
+	TYPE_GAUGE   = "gauge"
+)
+
+var (
+	ErrAddressEmpty      = errors.New("either an address or a listener is required")
+	ErrCheckNameEmpty    = errors.New("the check name is empty")
+	ErrCheckNameInUse    = errors.New("a check with this name is already registered")
+	ErrMetricNameInUse   = errors.New("a metric with this name is already registered")
+	ErrMetricNameInvalid = errors.New("the metric name must match [a-zA-Z_:][a-zA-Z0-9_:]*")
+	ErrNotReady          = errors.New("not ready")
+	ErrShuttingDown      = errors.New("shutting down")
+)
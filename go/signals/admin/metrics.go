@@ -0,0 +1,165 @@
+package admin
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter - a value that only goes up, such as requests handled.
+type Counter struct {
+	bits atomic.Uint64
+}
+
+// Gauge - a value that goes up and down, such as items queued.
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+type metric struct {
+	help       string
+	name       string
+	metricType string
+	value      func() float64
+}
+
+type registry struct {
+	metrics map[string]metric
+	mu      sync.Mutex
+}
+
+var metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+func (counterPtr *Counter) Add(delta float64) {
+
+	if delta < 0 {
+		return
+	}
+	for {
+		tOld := counterPtr.bits.Load()
+		if counterPtr.bits.CompareAndSwap(tOld, math.Float64bits(math.Float64frombits(tOld)+delta)) {
+			return
+		}
+	}
+}
+
+func (counterPtr *Counter) Inc() {
+	counterPtr.Add(1)
+}
+
+func (counterPtr *Counter) Value() float64 {
+	return math.Float64frombits(counterPtr.bits.Load())
+}
+
+func (gaugePtr *Gauge) Add(delta float64) {
+
+	for {
+		tOld := gaugePtr.bits.Load()
+		if gaugePtr.bits.CompareAndSwap(tOld, math.Float64bits(math.Float64frombits(tOld)+delta)) {
+			return
+		}
+	}
+}
+
+func (gaugePtr *Gauge) Set(value float64) {
+	gaugePtr.bits.Store(math.Float64bits(value))
+}
+
+func (gaugePtr *Gauge) Value() float64 {
+	return math.Float64frombits(gaugePtr.bits.Load())
+}
+
+func (registryPtr *registry) add(name string, help string, metricType string, value func() float64) (err error) {
+
+	if metricNameRegex.MatchString(name) == false {
+		return fmt.Errorf("%w: %s", ErrMetricNameInvalid, name)
+	}
+
+	registryPtr.mu.Lock()
+	defer registryPtr.mu.Unlock()
+
+	if _, ok := registryPtr.metrics[name]; ok {
+		return fmt.Errorf("%w: %s", ErrMetricNameInUse, name)
+	}
+	registryPtr.metrics[name] = metric{help: help, name: name, metricType: metricType, value: value}
+
+	return
+}
+
+// write - outputs every metric, sorted by name, in the Prometheus text exposition format.
+func (registryPtr *registry) write(writer io.Writer) (err error) {
+
+	var (
+		tMetrics []metric
+	)
+
+	registryPtr.mu.Lock()
+	for _, tMetric := range registryPtr.metrics {
+		tMetrics = append(tMetrics, tMetric)
+	}
+	registryPtr.mu.Unlock()
+
+	sort.Slice(tMetrics, func(i, j int) bool { return tMetrics[i].name < tMetrics[j].name })
+
+	for _, tMetric := range tMetrics {
+		if _, err = fmt.Fprintf(writer, "# HELP %s %s\n# TYPE %s %s\n%s %s\n",
+			tMetric.name, escapeHelp(tMetric.help), tMetric.name, tMetric.metricType, tMetric.name, formatValue(tMetric.value())); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// addRuntimeMetrics - the process and Go runtime metrics every daemon exposes.
+func (registryPtr *registry) addRuntimeMetrics(startTime time.Time) {
+
+	var (
+		tMemStats   runtime.MemStats
+		tMemStatsAt time.Time
+		tMu         sync.Mutex
+	)
+
+	// ReadMemStats stops the world, so one read serves every memory metric in a scrape.
+	memStats := func() runtime.MemStats {
+		tMu.Lock()
+		defer tMu.Unlock()
+		if time.Since(tMemStatsAt) > time.Second {
+			runtime.ReadMemStats(&tMemStats)
+			tMemStatsAt = time.Now()
+		}
+		return tMemStats
+	}
+
+	_ = registryPtr.add("go_goroutines", "Number of goroutines that currently exist.", TYPE_GAUGE, func() float64 { return float64(runtime.NumGoroutine()) })
+	_ = registryPtr.add("go_memstats_heap_alloc_bytes", "Bytes of allocated heap objects.", TYPE_GAUGE, func() float64 { return float64(memStats().HeapAlloc) })
+	_ = registryPtr.add("go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", TYPE_GAUGE, func() float64 { return float64(memStats().Sys) })
+	_ = registryPtr.add("go_gc_cycles_total", "Number of completed GC cycles.", TYPE_COUNTER, func() float64 { return float64(memStats().NumGC) })
+	_ = registryPtr.add("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", TYPE_GAUGE, func() float64 { return float64(startTime.Unix()) })
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func formatValue(value float64) string {
+
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"time"
+)
+
+//goland:noinspection ALL
+const (
+	DEFAULT_GOARCH          = "amd64"
+	DEFAULT_GOOS            = "linux"
+	DEFAULT_HEALTH_INTERVAL = time.Second
+	DEFAULT_HEALTH_PATH     = "/readyz"
+	DEFAULT_HEALTH_TIMEOUT  = 30 * time.Second
+	DEFAULT_INSTALL_COMMAND = "sudo sh {{.InstallRootDirectory}}/scripts/{{.ServerName}}-install-daemon.sh"
+	DEFAULT_RESTART_COMMAND = "sudo systemctl restart {{.ServerName}}.service"
+	DEFAULT_SSH_TIMEOUT     = 15 * time.Second
+	DEFAULT_STOP_COMMAND    = "sudo systemctl disable --now {{.ServerName}}.service"
+	//
+	BINARY_PERMISSIONS      os.FileMode = 0755
+	CONFIG_PERMISSIONS      os.FileMode = 0600
+	SCRIPT_PERMISSIONS      os.FileMode = 0700
+	SERVICE_PERMISSIONS     os.FileMode = 0644
+	STAGED_FILE_PERMISSIONS os.FileMode = 0600
+	STAGING_PERMISSIONS     os.FileMode = 0700
+	//
+	NEW_SUFFIX      = ".new"
+	PREVIOUS_SUFFIX = ".previous"
+	SHA256_SUFFIX   = ".sha256"
+	//
+	INSTALL_TEMPLATE_SUFFIX = "-install-daemon.sh.template"
+	SERVICE_TEMPLATE_SUFFIX = ".servicefile.template"
+)
+
+var (
+	ErrChecksumMismatch    = errors.New("the checksum does not match")
+	ErrEnvironmentInvalid  = errors.New("the environment file is invalid")
+	ErrHealthCheckFailed   = errors.New("the health check did not pass")
+	ErrRemoteCommandFailed = errors.New("the remote command failed")
+	ErrRollbackFailed      = errors.New("the rollback failed, the target needs attention")
+)
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Environment - one deployment target. Relative paths are relative to the directory of the environment file.
+type Environment struct {
+	Build                BuildConfig    `yaml:"build"`
+	Commands             CommandsConfig `yaml:"commands"`
+	ConfigFile           string         `yaml:"config_file"` // The daemon's configuration, pushed to .config/<server_name>.yaml.
+	Description          string         `yaml:"description"` // The systemd unit Description.
+	Health               HealthConfig   `yaml:"health"`
+	InstallRootDirectory string         `yaml:"install_root_directory"` // The remote directory holding bin, .config and scripts.
+	RunAsUser            string         `yaml:"run_as_user"`            // The systemd unit User.
+	ServerName           string         `yaml:"server_name"`
+	SSH                  SSHConfig      `yaml:"ssh"`
+	StagingDirectory     string         `yaml:"staging_directory"`  // Where the rendered files and the binary are staged before the push.
+	TemplateDirectory    string         `yaml:"template_directory"` // Holds <server_name>.servicefile.template and <server_name>-install-daemon.sh.template.
+}
+
+type BuildConfig struct {
+	GOARCH  string `yaml:"goarch"`  // The default is DEFAULT_GOARCH.
+	GOOS    string `yaml:"goos"`    // The default is DEFAULT_GOOS.
+	Package string `yaml:"package"` // The directory of the main package.
+}
+
+// CommandsConfig - remote commands, rendered with text/template like the templates.
+type CommandsConfig struct {
+	Install string `yaml:"install"` // Installs the unit file. The default is DEFAULT_INSTALL_COMMAND.
+	Restart string `yaml:"restart"` // Restarts the daemon. The default is DEFAULT_RESTART_COMMAND.
+	Stop    string `yaml:"stop"`    // Stops and disables the daemon when its first release fails. The default is DEFAULT_STOP_COMMAND.
+}
+
+// HealthConfig - the address is dialed through the SSH connection, so it is usually on the remote loopback.
+type HealthConfig struct {
+	Address  string        `yaml:"address"`  // The admin server address on the target, such as 127.0.0.1:9100. Leave empty to skip the check.
+	Interval time.Duration `yaml:"interval"` // The default is DEFAULT_HEALTH_INTERVAL.
+	Path     string        `yaml:"path"`     // The default is DEFAULT_HEALTH_PATH.
+	Timeout  time.Duration `yaml:"timeout"`  // How long the daemon has to pass after a restart. The default is DEFAULT_HEALTH_TIMEOUT.
+}
+
+type SSHConfig struct {
+	Address        string `yaml:"address"`          // host:port
+	IdentityFile   string `yaml:"identity_file"`    // Optional when an ssh-agent is running. A leading ~/ is the home directory.
+	KnownHostsFile string `yaml:"known_hosts_file"` // The default is ~/.ssh/known_hosts. The host key must already be in it.
+	User           string `yaml:"user"`
+}
+
+// loadEnvironment - decodes the file, rejecting unknown fields, applies the defaults and resolves the paths.
+//
+//	Errors: ErrEnvironmentInvalid, errors returned by os and yaml
+func loadEnvironment(environmentFQN string) (environmentPtr *Environment, err error) {
+
+	var (
+		tData    []byte
+		tDecoder *yaml.Decoder
+		tMissing []string
+	)
+
+	if tData, err = os.ReadFile(environmentFQN); err != nil {
+		return
+	}
+
+	environmentPtr = &Environment{}
+	tDecoder = yaml.NewDecoder(bytes.NewReader(tData))
+	tDecoder.KnownFields(true)
+	if err = tDecoder.Decode(environmentPtr); err != nil {
+		return nil, fmt.Errorf("%s: %w", environmentFQN, err)
+	}
+
+	for tName, tValue := range map[string]string{
+		"build.package":          environmentPtr.Build.Package,
+		"install_root_directory": environmentPtr.InstallRootDirectory,
+		"server_name":            environmentPtr.ServerName,
+		"ssh.address":            environmentPtr.SSH.Address,
+		"ssh.user":               environmentPtr.SSH.User,
+		"staging_directory":      environmentPtr.StagingDirectory,
+		"template_directory":     environmentPtr.TemplateDirectory,
+	} {
+		if tValue == "" {
+			tMissing = append(tMissing, tName)
+		}
+	}
+	if len(tMissing) > 0 {
+		sort.Strings(tMissing)
+		return nil, fmt.Errorf("%w: %s is missing %s", ErrEnvironmentInvalid, environmentFQN, strings.Join(tMissing, ", "))
+	}
+	if strings.ContainsAny(environmentPtr.ServerName, "/ ") || filepath.IsAbs(environmentPtr.InstallRootDirectory) == false {
+		return nil, fmt.Errorf("%w: server_name must be a plain name and install_root_directory an absolute path", ErrEnvironmentInvalid)
+	}
+
+	if environmentPtr.Build.GOARCH == "" {
+		environmentPtr.Build.GOARCH = DEFAULT_GOARCH
+	}
+	if environmentPtr.Build.GOOS == "" {
+		environmentPtr.Build.GOOS = DEFAULT_GOOS
+	}
+	if environmentPtr.Commands.Install == "" {
+		environmentPtr.Commands.Install = DEFAULT_INSTALL_COMMAND
+	}
+	if environmentPtr.Commands.Restart == "" {
+		environmentPtr.Commands.Restart = DEFAULT_RESTART_COMMAND
+	}
+	if environmentPtr.Commands.Stop == "" {
+		environmentPtr.Commands.Stop = DEFAULT_STOP_COMMAND
+	}
+	if environmentPtr.Health.Interval <= 0 {
+		environmentPtr.Health.Interval = DEFAULT_HEALTH_INTERVAL
+	}
+	if environmentPtr.Health.Path == "" {
+		environmentPtr.Health.Path = DEFAULT_HEALTH_PATH
+	}
+	if environmentPtr.Health.Timeout <= 0 {
+		environmentPtr.Health.Timeout = DEFAULT_HEALTH_TIMEOUT
+	}
+	if environmentPtr.SSH.KnownHostsFile == "" {
+		environmentPtr.SSH.KnownHostsFile = "~/.ssh/known_hosts"
+	}
+
+	tBase := filepath.Dir(environmentFQN)
+	for _, tPathPtr := range []*string{
+		&environmentPtr.Build.Package,
+		&environmentPtr.ConfigFile,
+		&environmentPtr.SSH.IdentityFile,
+		&environmentPtr.SSH.KnownHostsFile,
+		&environmentPtr.StagingDirectory,
+		&environmentPtr.TemplateDirectory,
+	} {
+		if *tPathPtr, err = resolvePath(tBase, *tPathPtr); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// remotePaths - where each staged file is installed on the target.
+func (environmentPtr *Environment) remotePaths() (binary string, config string, installScript string, serviceFile string) {
+
+	tRoot := environmentPtr.InstallRootDirectory
+	tName := environmentPtr.ServerName
+
+	return tRoot + "/bin/" + tName, tRoot + "/.config/" + tName + ".yaml", tRoot + "/scripts/" + tName + "-install-daemon.sh", tRoot + "/.config/" + tName + ".servicefile"
+}
+
+// resolvePath - expands a leading ~/ and makes relative paths relative to base. An empty path stays empty.
+func resolvePath(base string, path string) (resolved string, err error) {
+
+	var (
+		tHome string
+	)
+
+	switch {
+	case path == "":
+		return
+	case strings.HasPrefix(path, "~/"):
+		if tHome, err = os.UserHomeDir(); err != nil {
+			return
+		}
+		return filepath.Join(tHome, path[2:]), nil
+	case filepath.IsAbs(path):
+		return path, nil
+	}
+
+	return filepath.Join(base, path), nil
+}
@@ -0,0 +1,113 @@
+// Package deploy
+/*
+This is the deploy tool for the signals daemon. It replaces Makefile_GCloud.mk, envsubst and gcloud compute scp/ssh.
+Each target has its own environment file under build_deploy/environments:
+    1. render      the .servicefile and install-daemon templates with text/template from the environment file
+    2. build       the binary for build.goos/build.goarch and write its .sha256
+    3. stage       the rendered files, the binary and the daemon configuration in staging_directory
+    4. push        each file over SSH/SFTP to <file>.new, verify its checksum, keep the current one as <file>.previous
+                   and rename the new one into place
+    5. install     run commands.install, then commands.restart
+    6. check       request health.address/health.path through the SSH connection until it returns 200
+    7. roll back   when the check fails, rename every <file>.previous back, remove new files, install and restart again
+
+RESTRICTIONS:
+    * The target's host key must already be in ssh.known_hosts_file. ssh-keyscan can add it after checking the fingerprint.
+    * The target's SFTP server must support the posix-rename and hardlink OpenSSH extensions. OpenSSH does.
+    * When the first release on a target fails, its files are removed and nothing is restarted.
+
+NOTES:
+    To try a deploy without a server, start the test target in one terminal and deploy to it from another:
+        go run ./build_deploy/deploy -e build_deploy/environments/local.yaml --test_target
+        go run ./build_deploy/deploy -e build_deploy/environments/local.yaml
+
+    Templates can use any environment field, such as {{.InstallRootDirectory}}, {{.ServerName}}, {{.RunAsUser}} and
+    {{.Description}}. A field that does not exist is an error.
+
+COPYRIGHT:
+	Copyright 2022
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+
+*/
+package main
+
+import (
+	"log"
+
+	"github.com/integrii/flaggy"
+)
+
+var (
+	environmentFilename string
+	skipBuild           bool
+	stageOnly           bool
+	testTarget          bool
+	utilityName         = "deploy"
+)
+
+func init() {
+
+	appDescription := "The " + utilityName + " tool renders, builds, stages and pushes the daemon to the target in an environment file, rolling back when the health check fails."
+	flaggy.SetName("\n" + utilityName) // "\n" is added to the start of the name to make the output easier to read.
+	flaggy.SetDescription(appDescription)
+
+	flaggy.DefaultParser.ShowHelpOnUnexpected = true
+	flaggy.DefaultParser.AdditionalHelpPrepend = "https://github.com/sty-holdings/utilities"
+
+	flaggy.String(&environmentFilename, "e", "environment", "The directory and filename of the environment file.")
+	flaggy.Bool(&skipBuild, "", "skip_build", "Push the binary already staged. Its .sha256 must still match.")
+	flaggy.Bool(&stageOnly, "", "stage_only", "Render, build and stage without connecting to the target.")
+	flaggy.Bool(&testTarget, "", "test_target", "Run an SSH server in this process that the environment can be deployed to.")
+
+	flaggy.Parse()
+}
+
+func main() {
+
+	var (
+		err             error
+		tEnvironmentPtr *Environment
+		tFiles          []stagedFile
+	)
+
+	if environmentFilename == "" {
+		flaggy.ShowHelpAndExit("You must provide an environment filename.")
+	}
+
+	if tEnvironmentPtr, err = loadEnvironment(environmentFilename); err != nil {
+		log.Fatalln(err)
+	}
+
+	if testTarget {
+		log.Fatalln(serveTestTarget(tEnvironmentPtr))
+	}
+
+	if tFiles, err = stage(tEnvironmentPtr, skipBuild); err != nil {
+		log.Fatalln(err)
+	}
+	log.Printf("Staged %d files in %s", len(tFiles), tEnvironmentPtr.StagingDirectory)
+	if stageOnly {
+		return
+	}
+
+	if err = push(tEnvironmentPtr, tFiles); err != nil {
+		log.Fatalln(err)
+	}
+
+	log.Printf("Deployed %s to %s", tEnvironmentPtr.ServerName, tEnvironmentPtr.SSH.Address)
+	log.Printf("Daemon Commands:")
+	for _, tCommand := range []string{"status", "start", "stop", "restart"} {
+		log.Printf("    sudo systemctl %s %s.service", tCommand, tEnvironmentPtr.ServerName)
+	}
+	log.Printf("    sudo journalctl -u %s.service -n 50", tEnvironmentPtr.ServerName)
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// pushedFile - what replaceRemoteFile did, so rollback can undo it.
+type pushedFile struct {
+	hadPrevious bool
+	remoteFQN   string
+}
+
+// dialTarget - connects with the identity file and any ssh-agent. The host key must be in the known hosts file.
+//
+//	Errors: errors returned by ssh, knownhosts and os
+func dialTarget(sshConfig SSHConfig) (clientPtr *ssh.Client, err error) {
+
+	var (
+		tAuthMethods    []ssh.AuthMethod
+		tHostKeyChecker ssh.HostKeyCallback
+		tKeyData        []byte
+		tSigner         ssh.Signer
+	)
+
+	if tHostKeyChecker, err = knownhosts.New(sshConfig.KnownHostsFile); err != nil {
+		return
+	}
+
+	if sshConfig.IdentityFile != "" {
+		if tKeyData, err = os.ReadFile(sshConfig.IdentityFile); err != nil {
+			return
+		}
+		if tSigner, err = ssh.ParsePrivateKey(tKeyData); err != nil {
+			return nil, fmt.Errorf("%s: %w (load a passphrase protected key into ssh-agent and leave identity_file empty)", sshConfig.IdentityFile, err)
+		}
+		tAuthMethods = append(tAuthMethods, ssh.PublicKeys(tSigner))
+	}
+	if tSocket := os.Getenv("SSH_AUTH_SOCK"); tSocket != "" {
+		if tConnection, tErr := net.Dial("unix", tSocket); tErr == nil {
+			tAuthMethods = append(tAuthMethods, ssh.PublicKeysCallback(agent.NewClient(tConnection).Signers))
+		}
+	}
+
+	return ssh.Dial("tcp", sshConfig.Address, &ssh.ClientConfig{
+		Auth:            tAuthMethods,
+		HostKeyCallback: tHostKeyChecker,
+		Timeout:         DEFAULT_SSH_TIMEOUT,
+		User:            sshConfig.User,
+	})
+}
+
+// push - installs the staged files, restarts the daemon and waits for the health check. When the check fails, the
+// previous files are put back, files that are new to the target are removed, and the daemon is restarted again.
+// When this was its first release, the daemon is stopped and disabled instead.
+//
+//	Errors: ErrHealthCheckFailed, ErrRemoteCommandFailed, ErrRollbackFailed, errors returned by ssh and sftp
+func push(environmentPtr *Environment, files []stagedFile) (err error) {
+
+	var (
+		tClientPtr       *ssh.Client
+		tInstall         string
+		tPushed          []pushedFile
+		tRestart         string
+		tRollbackCommand string
+		tSFTPClientPtr   *sftp.Client
+		tStop            string
+		tStopCommand     string
+	)
+
+	if tInstall, err = renderCommand(environmentPtr.Commands.Install, environmentPtr); err != nil {
+		return
+	}
+	if tRestart, err = renderCommand(environmentPtr.Commands.Restart, environmentPtr); err != nil {
+		return
+	}
+	if tStop, err = renderCommand(environmentPtr.Commands.Stop, environmentPtr); err != nil {
+		return
+	}
+
+	if tClientPtr, err = dialTarget(environmentPtr.SSH); err != nil {
+		return
+	}
+	defer tClientPtr.Close()
+	if tSFTPClientPtr, err = sftp.NewClient(tClientPtr); err != nil {
+		return
+	}
+	defer tSFTPClientPtr.Close()
+
+	for _, tFile := range files {
+		log.Printf("Pushing %s to %s", tFile.localFQN, tFile.remoteFQN)
+		tHadPrevious, tErr := replaceRemoteFile(tSFTPClientPtr, tFile)
+		if tErr != nil {
+			return errors.Join(tErr, rollback(tClientPtr, tSFTPClientPtr, tPushed, "", ""))
+		}
+		tPushed = append(tPushed, pushedFile{hadPrevious: tHadPrevious, remoteFQN: tFile.remoteFQN})
+	}
+
+	if err = runRemote(tClientPtr, tInstall); err == nil {
+		if err = runRemote(tClientPtr, tRestart); err == nil {
+			err = waitHealthy(tClientPtr, environmentPtr.Health)
+		}
+	}
+	if err == nil {
+		return
+	}
+
+	// A file that did not exist before is removed. Restarting only makes sense when there is a previous release to go back to,
+	// otherwise the daemon that was just started is stopped so it does not keep failing without its files.
+	for _, tFile := range tPushed {
+		if tFile.hadPrevious {
+			tRollbackCommand = tInstall + " && " + tRestart
+			break
+		}
+	}
+	if tRollbackCommand == "" && len(tPushed) > 0 {
+		tStopCommand = tStop
+	}
+	log.Printf("Deployment failed, rolling back: %s", err)
+	if tErr := rollback(tClientPtr, tSFTPClientPtr, tPushed, tStopCommand, tRollbackCommand); tErr != nil {
+		return errors.Join(err, tErr)
+	}
+	if tStopCommand != "" {
+		log.Println("This was the first release on the target, so the daemon was stopped and disabled and its files were removed.")
+	}
+	if tRollbackCommand == "" {
+		return
+	}
+	if tErr := waitHealthy(tClientPtr, environmentPtr.Health); tErr != nil {
+		return errors.Join(err, fmt.Errorf("%w: %s", ErrRollbackFailed, tErr))
+	}
+	log.Println("Rolled back to the previous release, which passed the health check.")
+
+	return
+}
+
+// replaceRemoteFile - uploads to <file>.new, verifies the upload by reading it back, hard links the current file to
+// <file>.previous and renames <file>.new over the current file, so the file is always complete.
+//
+//	Errors: ErrChecksumMismatch, errors returned by sftp and os
+func replaceRemoteFile(clientPtr *sftp.Client, file stagedFile) (hadPrevious bool, err error) {
+
+	var (
+		tLocalChecksum  string
+		tRemoteChecksum string
+		tNewFQN         = file.remoteFQN + NEW_SUFFIX
+		tPreviousFQN    = file.remoteFQN + PREVIOUS_SUFFIX
+	)
+
+	if err = clientPtr.MkdirAll(path.Dir(file.remoteFQN)); err != nil {
+		return
+	}
+	if tLocalChecksum, err = uploadFile(clientPtr, file.localFQN, tNewFQN); err != nil {
+		return
+	}
+	if err = clientPtr.Chmod(tNewFQN, file.mode); err != nil {
+		return
+	}
+	if tRemoteChecksum, err = checksumRemoteFile(clientPtr, tNewFQN); err != nil {
+		return
+	}
+	if tRemoteChecksum != tLocalChecksum {
+		_ = clientPtr.Remove(tNewFQN)
+		return false, fmt.Errorf("%w: %s was corrupted in transfer", ErrChecksumMismatch, tNewFQN)
+	}
+
+	if _, err = clientPtr.Stat(file.remoteFQN); err == nil {
+		_ = clientPtr.Remove(tPreviousFQN)
+		if err = clientPtr.Link(file.remoteFQN, tPreviousFQN); err != nil {
+			return
+		}
+		hadPrevious = true
+	} else if errors.Is(err, os.ErrNotExist) == false {
+		return
+	}
+
+	err = clientPtr.PosixRename(tNewFQN, file.remoteFQN)
+
+	return
+}
+
+// rollback - runs stopCommand when it is not empty, renames each <file>.previous back over the file, removes files
+// that did not exist before and runs restartCommand when it is not empty.
+//
+//	Errors: ErrRollbackFailed
+func rollback(clientPtr *ssh.Client, sftpClientPtr *sftp.Client, pushed []pushedFile, stopCommand string, restartCommand string) (err error) {
+
+	var (
+		tErrors []error
+	)
+
+	if stopCommand != "" {
+		tErrors = append(tErrors, runRemote(clientPtr, stopCommand))
+	}
+	for _, tFile := range pushed {
+		if tFile.hadPrevious {
+			tErrors = append(tErrors, sftpClientPtr.PosixRename(tFile.remoteFQN+PREVIOUS_SUFFIX, tFile.remoteFQN))
+		} else {
+			tErrors = append(tErrors, sftpClientPtr.Remove(tFile.remoteFQN))
+		}
+	}
+	if restartCommand != "" {
+		tErrors = append(tErrors, runRemote(clientPtr, restartCommand))
+	}
+
+	if err = errors.Join(tErrors...); err != nil {
+		return fmt.Errorf("%w: %s", ErrRollbackFailed, err)
+	}
+
+	return
+}
+
+// runRemote - runs the command in a new session, echoing its output.
+//
+//	Errors: ErrRemoteCommandFailed, errors returned by ssh
+func runRemote(clientPtr *ssh.Client, command string) (err error) {
+
+	var (
+		tSessionPtr *ssh.Session
+	)
+
+	if tSessionPtr, err = clientPtr.NewSession(); err != nil {
+		return
+	}
+	defer tSessionPtr.Close()
+
+	log.Printf("Running: %s", command)
+	tSessionPtr.Stdout = os.Stdout
+	tSessionPtr.Stderr = os.Stderr
+	if err = tSessionPtr.Run(command); err != nil {
+		return fmt.Errorf("%w: %s: %s", ErrRemoteCommandFailed, command, err)
+	}
+
+	return
+}
+
+// waitHealthy - requests the health path through the SSH connection until it returns 200 or the timeout expires.
+// An empty address skips the check.
+//
+//	Errors: ErrHealthCheckFailed
+func waitHealthy(clientPtr *ssh.Client, health HealthConfig) (err error) {
+
+	var (
+		tHTTPClient = &http.Client{
+			Timeout: health.Interval * 5,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network string, address string) (net.Conn, error) {
+					return clientPtr.Dial(network, address)
+				},
+				DisableKeepAlives: true,
+			},
+		}
+		tDeadline = time.Now().Add(health.Timeout)
+		tLast     error
+		tURL      = "http://" + health.Address + health.Path
+	)
+
+	if health.Address == "" {
+		log.Println("No health.address, skipping the health check.")
+		return
+	}
+
+	for time.Now().Before(tDeadline) {
+		tResponsePtr, tErr := tHTTPClient.Get(tURL)
+		if tErr == nil {
+			tBody, _ := io.ReadAll(io.LimitReader(tResponsePtr.Body, 1024))
+			_ = tResponsePtr.Body.Close()
+			if tResponsePtr.StatusCode == http.StatusOK {
+				log.Printf("Health check %s passed.", tURL)
+				return
+			}
+			tErr = fmt.Errorf("%s: %s", tResponsePtr.Status, strings.TrimSpace(string(tBody)))
+		}
+		tLast = tErr
+		time.Sleep(health.Interval)
+	}
+
+	return fmt.Errorf("%w: %s after %s: %s", ErrHealthCheckFailed, tURL, health.Timeout, tLast)
+}
+
+func checksumRemoteFile(clientPtr *sftp.Client, remoteFQN string) (checksum string, err error) {
+
+	var (
+		tFilePtr *sftp.File
+		tHash    = sha256.New()
+	)
+
+	if tFilePtr, err = clientPtr.Open(remoteFQN); err != nil {
+		return
+	}
+	defer tFilePtr.Close()
+
+	if _, err = io.Copy(tHash, tFilePtr); err != nil {
+		return
+	}
+
+	return hex.EncodeToString(tHash.Sum(nil)), nil
+}
+
+// uploadFile - returns the SHA-256 of what was sent.
+func uploadFile(clientPtr *sftp.Client, localFQN string, remoteFQN string) (checksum string, err error) {
+
+	var (
+		tHash          = sha256.New()
+		tLocalFilePtr  *os.File
+		tRemoteFilePtr *sftp.File
+	)
+
+	if tLocalFilePtr, err = os.Open(localFQN); err != nil {
+		return
+	}
+	defer tLocalFilePtr.Close()
+
+	if tRemoteFilePtr, err = clientPtr.OpenFile(remoteFQN, os.O_WRONLY|os.O_CREATE|os.O_TRUNC); err != nil {
+		return
+	}
+	if _, err = io.Copy(tRemoteFilePtr, io.TeeReader(tLocalFilePtr, tHash)); err != nil {
+		_ = tRemoteFilePtr.Close()
+		return
+	}
+	if err = tRemoteFilePtr.Close(); err != nil {
+		return
+	}
+
+	return hex.EncodeToString(tHash.Sum(nil)), nil
+}
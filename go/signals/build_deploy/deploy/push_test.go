@@ -0,0 +1,294 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	TEST_BINARY_BAD  = "bad build"
+	TEST_BINARY_GOOD = "good build"
+)
+
+// deployTarget - an environment whose target is an SSH server in the test process. Commands run in a shell on this
+// machine and InstallRootDirectory is a temporary directory. The health check passes while the installed binary
+// holds TEST_BINARY_GOOD.
+type deployTarget struct {
+	environmentPtr *Environment
+	stagingDir     string
+}
+
+func newDeployTarget(t *testing.T) (target deployTarget) {
+
+	var (
+		tDirectory  = t.TempDir()
+		tListener   net.Listener
+		tPrivateKey ed25519.PrivateKey
+		tPEMPtr     *pem.Block
+		tServer     *ssh.ServerConfig
+		tErr        error
+	)
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	if _, tPrivateKey, tErr = ed25519.GenerateKey(rand.Reader); tErr != nil {
+		t.Fatal(tErr)
+	}
+	if tPEMPtr, tErr = ssh.MarshalPrivateKey(tPrivateKey, ""); tErr != nil {
+		t.Fatal(tErr)
+	}
+	tIdentityFile := filepath.Join(tDirectory, "id_ed25519")
+	if tErr = os.WriteFile(tIdentityFile, pem.EncodeToMemory(tPEMPtr), STAGED_FILE_PERMISSIONS); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	target.stagingDir = filepath.Join(tDirectory, "stage")
+	if tErr = os.MkdirAll(target.stagingDir, STAGING_PERMISSIONS); tErr != nil {
+		t.Fatal(tErr)
+	}
+	target.environmentPtr = &Environment{
+		Commands: CommandsConfig{
+			Install: "test -f {{.InstallRootDirectory}}/scripts/{{.ServerName}}-install-daemon.sh",
+			Restart: "echo restarted >> {{.InstallRootDirectory}}/restarts",
+			Stop:    "echo stopped >> {{.InstallRootDirectory}}/stops",
+		},
+		InstallRootDirectory: filepath.Join(tDirectory, "target"),
+		ServerName:           "signals",
+		SSH: SSHConfig{
+			Address:        "127.0.0.1:0",
+			IdentityFile:   tIdentityFile,
+			KnownHostsFile: filepath.Join(tDirectory, "known_hosts"),
+			User:           "deploy",
+		},
+	}
+
+	if tListener, tServer, tErr = listenTestTarget(target.environmentPtr); tErr != nil {
+		t.Fatal(tErr)
+	}
+	t.Cleanup(func() { _ = tListener.Close() })
+	target.environmentPtr.SSH.Address = tListener.Addr().String()
+	go func() {
+		for {
+			tConnection, tErr := tListener.Accept()
+			if tErr != nil {
+				return
+			}
+			go serveTestConnection(tConnection, tServer)
+		}
+	}()
+
+	tHealthServerPtr := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		tBinary, _ := os.ReadFile(target.remoteBinary())
+		if request.URL.Path != DEFAULT_HEALTH_PATH || string(tBinary) != TEST_BINARY_GOOD {
+			http.Error(writer, "not ready", http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = writer.Write([]byte("ok"))
+	}))
+	t.Cleanup(tHealthServerPtr.Close)
+	target.environmentPtr.Health = HealthConfig{
+		Address:  tHealthServerPtr.Listener.Addr().String(),
+		Interval: 20 * time.Millisecond,
+		Path:     DEFAULT_HEALTH_PATH,
+		Timeout:  time.Second,
+	}
+
+	return
+}
+
+func (target deployTarget) remoteBinary() string {
+
+	tBinary, _, _, _ := target.environmentPtr.remotePaths()
+
+	return tBinary
+}
+
+func (target deployTarget) restarts(t *testing.T) int {
+	return target.countLines(t, "restarts")
+}
+
+func (target deployTarget) stops(t *testing.T) int {
+	return target.countLines(t, "stops")
+}
+
+// countLines - how many times a test command appended to its file in InstallRootDirectory.
+func (target deployTarget) countLines(t *testing.T, filename string) int {
+
+	tData, tErr := os.ReadFile(filepath.Join(target.environmentPtr.InstallRootDirectory, filename))
+	if errors.Is(tErr, os.ErrNotExist) {
+		return 0
+	}
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	return strings.Count(string(tData), "\n")
+}
+
+// stage - writes the binary, service file, install script and, when withConfig is set, the daemon configuration
+// to the staging directory, the way stage does after a build.
+func (target deployTarget) stage(t *testing.T, binary string, service string, withConfig bool) (files []stagedFile) {
+
+	tBinary, tConfig, tInstall, tService := target.environmentPtr.remotePaths()
+
+	for _, tFile := range []struct {
+		content   string
+		mode      os.FileMode
+		name      string
+		remoteFQN string
+	}{
+		{binary, BINARY_PERMISSIONS, "signals", tBinary},
+		{service, SERVICE_PERMISSIONS, "signals.servicefile", tService},
+		{"#!/bin/sh\n", SCRIPT_PERMISSIONS, "signals-install-daemon.sh", tInstall},
+		{"server_name: signals\n", CONFIG_PERMISSIONS, "signals.yaml", tConfig},
+	} {
+		if tFile.remoteFQN == tConfig && withConfig == false {
+			continue
+		}
+		tLocalFQN := filepath.Join(target.stagingDir, tFile.name)
+		if tErr := os.WriteFile(tLocalFQN, []byte(tFile.content), STAGED_FILE_PERMISSIONS); tErr != nil {
+			t.Fatal(tErr)
+		}
+		files = append(files, stagedFile{localFQN: tLocalFQN, mode: tFile.mode, remoteFQN: tFile.remoteFQN})
+	}
+
+	return
+}
+
+func assertRemoteFile(t *testing.T, fqn string, want string, mode os.FileMode) {
+
+	t.Helper()
+
+	tData, tErr := os.ReadFile(fqn)
+	if tErr != nil {
+		t.Errorf("%s: %s", fqn, tErr)
+		return
+	}
+	if string(tData) != want {
+		t.Errorf("%s = %q, want %q", fqn, tData, want)
+	}
+	if tInfoPtr, _ := os.Stat(fqn); mode != 0 && tInfoPtr.Mode().Perm() != mode {
+		t.Errorf("%s mode = %s, want %s", fqn, tInfoPtr.Mode().Perm(), mode)
+	}
+}
+
+func assertRemoteMissing(t *testing.T, fqn string) {
+
+	t.Helper()
+
+	if _, tErr := os.Stat(fqn); errors.Is(tErr, os.ErrNotExist) == false {
+		t.Errorf("%s should not exist: %v", fqn, tErr)
+	}
+}
+
+func TestPushReplacesPreviousRelease(t *testing.T) {
+
+	tTarget := newDeployTarget(t)
+	tBinary, tConfig, tInstall, tService := tTarget.environmentPtr.remotePaths()
+
+	if tErr := push(tTarget.environmentPtr, tTarget.stage(t, TEST_BINARY_GOOD, "[Unit]\n", false)); tErr != nil {
+		t.Fatalf("first release: %s", tErr)
+	}
+	assertRemoteFile(t, tBinary, TEST_BINARY_GOOD, BINARY_PERMISSIONS)
+	assertRemoteMissing(t, tBinary+PREVIOUS_SUFFIX)
+
+	if tErr := push(tTarget.environmentPtr, tTarget.stage(t, TEST_BINARY_GOOD, "[Unit]\nDescription=changed\n", true)); tErr != nil {
+		t.Fatalf("second release: %s", tErr)
+	}
+
+	assertRemoteFile(t, tService, "[Unit]\nDescription=changed\n", SERVICE_PERMISSIONS)
+	assertRemoteFile(t, tService+PREVIOUS_SUFFIX, "[Unit]\n", 0)
+	assertRemoteFile(t, tInstall, "#!/bin/sh\n", SCRIPT_PERMISSIONS)
+	assertRemoteFile(t, tConfig, "server_name: signals\n", CONFIG_PERMISSIONS)
+	assertRemoteMissing(t, tConfig+PREVIOUS_SUFFIX)
+	assertRemoteMissing(t, tBinary+NEW_SUFFIX)
+	if tRestarts := tTarget.restarts(t); tRestarts != 2 {
+		t.Errorf("the daemon was restarted %d times, want 2", tRestarts)
+	}
+}
+
+func TestPushRollsBackFailedHealthCheck(t *testing.T) {
+
+	tTarget := newDeployTarget(t)
+	tBinary, tConfig, tInstall, tService := tTarget.environmentPtr.remotePaths()
+
+	if tErr := push(tTarget.environmentPtr, tTarget.stage(t, TEST_BINARY_GOOD, "[Unit]\n", false)); tErr != nil {
+		t.Fatalf("first release: %s", tErr)
+	}
+
+	tErr := push(tTarget.environmentPtr, tTarget.stage(t, TEST_BINARY_BAD, "[Unit]\nDescription=bad\n", true))
+	if errors.Is(tErr, ErrHealthCheckFailed) == false {
+		t.Fatalf("push = %v, want %s", tErr, ErrHealthCheckFailed)
+	}
+	if errors.Is(tErr, ErrRollbackFailed) {
+		t.Fatalf("the rollback failed: %s", tErr)
+	}
+
+	assertRemoteFile(t, tBinary, TEST_BINARY_GOOD, BINARY_PERMISSIONS)
+	assertRemoteFile(t, tService, "[Unit]\n", SERVICE_PERMISSIONS)
+	assertRemoteFile(t, tInstall, "#!/bin/sh\n", SCRIPT_PERMISSIONS)
+	assertRemoteMissing(t, tBinary+PREVIOUS_SUFFIX)
+	assertRemoteMissing(t, tConfig) // New in the failed release, so it is removed rather than restored.
+	if tRestarts := tTarget.restarts(t); tRestarts != 3 {
+		t.Errorf("the daemon was restarted %d times, want 3 (first release, failed release, rollback)", tRestarts)
+	}
+	if tStops := tTarget.stops(t); tStops != 0 {
+		t.Errorf("the daemon was stopped %d times, want 0, the previous release was restarted", tStops)
+	}
+}
+
+func TestPushFirstReleaseFailure(t *testing.T) {
+
+	tTarget := newDeployTarget(t)
+
+	tFiles := tTarget.stage(t, TEST_BINARY_BAD, "[Unit]\n", true)
+	if tErr := push(tTarget.environmentPtr, tFiles); errors.Is(tErr, ErrHealthCheckFailed) == false || errors.Is(tErr, ErrRollbackFailed) {
+		t.Fatalf("push = %v, want only %s", tErr, ErrHealthCheckFailed)
+	}
+
+	for _, tFile := range tFiles {
+		assertRemoteMissing(t, tFile.remoteFQN)
+		assertRemoteMissing(t, tFile.remoteFQN+PREVIOUS_SUFFIX)
+	}
+	if tRestarts := tTarget.restarts(t); tRestarts != 1 {
+		t.Errorf("the daemon was restarted %d times, want 1, there is no previous release to restart", tRestarts)
+	}
+	if tStops := tTarget.stops(t); tStops != 1 {
+		t.Errorf("the daemon was stopped %d times, want 1", tStops)
+	}
+}
+
+func TestPushNoFiles(t *testing.T) {
+
+	tTarget := newDeployTarget(t)
+	tTarget.environmentPtr.Commands.Install = "false"
+
+	if tErr := push(tTarget.environmentPtr, nil); errors.Is(tErr, ErrRemoteCommandFailed) == false || errors.Is(tErr, ErrRollbackFailed) {
+		t.Fatalf("push = %v, want only %s", tErr, ErrRemoteCommandFailed)
+	}
+}
+
+func TestPushRejectsUnknownHostKey(t *testing.T) {
+
+	tTarget := newDeployTarget(t)
+
+	if tErr := os.WriteFile(tTarget.environmentPtr.SSH.KnownHostsFile, nil, STAGED_FILE_PERMISSIONS); tErr != nil {
+		t.Fatal(tErr)
+	}
+	if tErr := push(tTarget.environmentPtr, tTarget.stage(t, TEST_BINARY_GOOD, "[Unit]\n", false)); tErr == nil {
+		t.Fatal("push connected to a host that is not in the known hosts file")
+	}
+	assertRemoteMissing(t, tTarget.remoteBinary())
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// stagedFile - a file in the staging directory and where it is installed.
+type stagedFile struct {
+	localFQN  string
+	mode      os.FileMode
+	remoteFQN string
+}
+
+// stage - renders the templates, copies the daemon configuration and, unless skipBuild is set, builds the binary.
+// With skipBuild, the binary already staged must still match its .sha256 file.
+//
+//	Errors: ErrChecksumMismatch, errors returned by os, text/template and go build
+func stage(environmentPtr *Environment, skipBuild bool) (files []stagedFile, err error) {
+
+	var (
+		tBinaryFQN     = filepath.Join(environmentPtr.StagingDirectory, environmentPtr.ServerName)
+		tInstallFQN    = filepath.Join(environmentPtr.StagingDirectory, environmentPtr.ServerName+"-install-daemon.sh")
+		tServiceFQN    = filepath.Join(environmentPtr.StagingDirectory, environmentPtr.ServerName+".servicefile")
+		tTemplateFQN   string
+		tRemoteBinary  string
+		tRemoteConfig  string
+		tRemoteInstall string
+		tRemoteService string
+	)
+
+	tRemoteBinary, tRemoteConfig, tRemoteInstall, tRemoteService = environmentPtr.remotePaths()
+
+	if err = os.MkdirAll(environmentPtr.StagingDirectory, STAGING_PERMISSIONS); err != nil {
+		return
+	}
+
+	tTemplateFQN = filepath.Join(environmentPtr.TemplateDirectory, environmentPtr.ServerName+SERVICE_TEMPLATE_SUFFIX)
+	if err = renderFile(tTemplateFQN, tServiceFQN, environmentPtr); err != nil {
+		return
+	}
+	tTemplateFQN = filepath.Join(environmentPtr.TemplateDirectory, environmentPtr.ServerName+INSTALL_TEMPLATE_SUFFIX)
+	if err = renderFile(tTemplateFQN, tInstallFQN, environmentPtr); err != nil {
+		return
+	}
+
+	if skipBuild {
+		err = verifyChecksum(tBinaryFQN)
+	} else {
+		err = buildBinary(environmentPtr, tBinaryFQN)
+	}
+	if err != nil {
+		return
+	}
+
+	files = []stagedFile{
+		{localFQN: tBinaryFQN, mode: BINARY_PERMISSIONS, remoteFQN: tRemoteBinary},
+		{localFQN: tServiceFQN, mode: SERVICE_PERMISSIONS, remoteFQN: tRemoteService},
+		{localFQN: tInstallFQN, mode: SCRIPT_PERMISSIONS, remoteFQN: tRemoteInstall},
+	}
+	if environmentPtr.ConfigFile != "" {
+		tConfigFQN := filepath.Join(environmentPtr.StagingDirectory, environmentPtr.ServerName+".yaml")
+		if err = copyFile(environmentPtr.ConfigFile, tConfigFQN); err != nil {
+			return nil, err
+		}
+		files = append(files, stagedFile{localFQN: tConfigFQN, mode: CONFIG_PERMISSIONS, remoteFQN: tRemoteConfig})
+	}
+
+	return
+}
+
+// buildBinary - cross compiles the main package and writes <binary>.sha256 in the sha256sum format.
+func buildBinary(environmentPtr *Environment, binaryFQN string) (err error) {
+
+	var (
+		tChecksum string
+		tCommand  *exec.Cmd
+	)
+
+	tCommand = exec.Command("go", "build", "-trimpath", "-o", binaryFQN, ".")
+	tCommand.Dir = environmentPtr.Build.Package
+	tCommand.Env = append(os.Environ(), "CGO_ENABLED=0", "GOOS="+environmentPtr.Build.GOOS, "GOARCH="+environmentPtr.Build.GOARCH)
+	tCommand.Stdout = os.Stdout
+	tCommand.Stderr = os.Stderr
+	if err = tCommand.Run(); err != nil {
+		return fmt.Errorf("go build in %s: %w", environmentPtr.Build.Package, err)
+	}
+
+	if tChecksum, err = checksumFile(binaryFQN); err != nil {
+		return
+	}
+
+	return os.WriteFile(binaryFQN+SHA256_SUFFIX, []byte(fmt.Sprintf("%s  %s\n", tChecksum, filepath.Base(binaryFQN))), STAGED_FILE_PERMISSIONS)
+}
+
+func checksumFile(fqn string) (checksum string, err error) {
+
+	var (
+		tFilePtr *os.File
+		tHash    = sha256.New()
+	)
+
+	if tFilePtr, err = os.Open(fqn); err != nil {
+		return
+	}
+	defer tFilePtr.Close()
+
+	if _, err = io.Copy(tHash, tFilePtr); err != nil {
+		return
+	}
+
+	return hex.EncodeToString(tHash.Sum(nil)), nil
+}
+
+func copyFile(sourceFQN string, targetFQN string) (err error) {
+
+	var (
+		tData []byte
+	)
+
+	if tData, err = os.ReadFile(sourceFQN); err != nil {
+		return
+	}
+
+	return os.WriteFile(targetFQN, tData, CONFIG_PERMISSIONS)
+}
+
+// renderFile - a missing key is an error, so a typo in a template never reaches the target as an empty value.
+func renderFile(templateFQN string, targetFQN string, environmentPtr *Environment) (err error) {
+
+	var (
+		tTemplatePtr *template.Template
+		tRendered    strings.Builder
+	)
+
+	if tTemplatePtr, err = template.New(filepath.Base(templateFQN)).Option("missingkey=error").ParseFiles(templateFQN); err != nil {
+		return
+	}
+	if err = tTemplatePtr.Execute(&tRendered, environmentPtr); err != nil {
+		return
+	}
+
+	return os.WriteFile(targetFQN, []byte(tRendered.String()), STAGED_FILE_PERMISSIONS)
+}
+
+// renderCommand - renders a remote command from the environment.
+func renderCommand(command string, environmentPtr *Environment) (rendered string, err error) {
+
+	var (
+		tTemplatePtr *template.Template
+		tRendered    strings.Builder
+	)
+
+	if tTemplatePtr, err = template.New("command").Option("missingkey=error").Parse(command); err != nil {
+		return
+	}
+	if err = tTemplatePtr.Execute(&tRendered, environmentPtr); err != nil {
+		return
+	}
+
+	return tRendered.String(), nil
+}
+
+// verifyChecksum - compares the file with the first field of its .sha256 file.
+func verifyChecksum(fqn string) (err error) {
+
+	var (
+		tChecksum string
+		tFilePtr  *os.File
+		tScanner  *bufio.Scanner
+	)
+
+	if tFilePtr, err = os.Open(fqn + SHA256_SUFFIX); err != nil {
+		return
+	}
+	defer tFilePtr.Close()
+
+	tScanner = bufio.NewScanner(tFilePtr)
+	if tScanner.Scan() == false {
+		return fmt.Errorf("%w: %s is empty", ErrChecksumMismatch, fqn+SHA256_SUFFIX)
+	}
+	if tChecksum, err = checksumFile(fqn); err != nil {
+		return
+	}
+	if tFields := strings.Fields(tScanner.Text()); len(tFields) == 0 || tFields[0] != tChecksum {
+		return fmt.Errorf("%w: %s", ErrChecksumMismatch, fqn)
+	}
+
+	return
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// serveTestTarget - runs an SSH server in this process that a deploy can be pointed at. It listens on ssh.address,
+// accepts only ssh.user with the public key of ssh.identity_file, and writes its new host key to ssh.known_hosts_file.
+// It supports SFTP, exec and the port forwarding used by the health check. Commands run with sh as the current user.
+//
+//	Errors: ErrEnvironmentInvalid, errors returned by os, net and ssh
+func serveTestTarget(environmentPtr *Environment) (err error) {
+
+	var (
+		tListener     net.Listener
+		tServerConfig *ssh.ServerConfig
+	)
+
+	if tListener, tServerConfig, err = listenTestTarget(environmentPtr); err != nil {
+		return
+	}
+	defer tListener.Close()
+	log.Printf("Test target listening on %s for user %s. Host key written to %s", tListener.Addr(), environmentPtr.SSH.User, environmentPtr.SSH.KnownHostsFile)
+
+	for {
+		tConnection, tErr := tListener.Accept()
+		if tErr != nil {
+			return tErr
+		}
+		go serveTestConnection(tConnection, tServerConfig)
+	}
+}
+
+// listenTestTarget - listens on ssh.address and writes the new host key for the address it got to ssh.known_hosts_file.
+//
+//	Errors: ErrEnvironmentInvalid, errors returned by os, net and ssh
+func listenTestTarget(environmentPtr *Environment) (listener net.Listener, serverConfig *ssh.ServerConfig, err error) {
+
+	var (
+		tAuthorizedKey ssh.PublicKey
+		tHostKey       ed25519.PrivateKey
+		tHostSigner    ssh.Signer
+		tKeyData       []byte
+		tSigner        ssh.Signer
+	)
+
+	if environmentPtr.SSH.IdentityFile == "" {
+		return nil, nil, fmt.Errorf("%w: the test target needs ssh.identity_file", ErrEnvironmentInvalid)
+	}
+	if tKeyData, err = os.ReadFile(environmentPtr.SSH.IdentityFile); err != nil {
+		return
+	}
+	if tSigner, err = ssh.ParsePrivateKey(tKeyData); err != nil {
+		return
+	}
+	tAuthorizedKey = tSigner.PublicKey()
+
+	if _, tHostKey, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		return
+	}
+	if tHostSigner, err = ssh.NewSignerFromKey(tHostKey); err != nil {
+		return
+	}
+
+	serverConfig = &ssh.ServerConfig{
+		PublicKeyCallback: func(metadata ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if metadata.User() == environmentPtr.SSH.User && string(key.Marshal()) == string(tAuthorizedKey.Marshal()) {
+				return &ssh.Permissions{}, nil
+			}
+			return nil, errors.New("unknown user or key")
+		},
+	}
+	serverConfig.AddHostKey(tHostSigner)
+
+	if listener, err = net.Listen("tcp", environmentPtr.SSH.Address); err != nil {
+		return
+	}
+
+	tKnownHost := knownhosts.Line([]string{knownhosts.Normalize(listener.Addr().String())}, tHostSigner.PublicKey())
+	if err = os.WriteFile(environmentPtr.SSH.KnownHostsFile, []byte(tKnownHost+"\n"), STAGED_FILE_PERMISSIONS); err != nil {
+		_ = listener.Close()
+		return nil, nil, err
+	}
+
+	return
+}
+
+func serveTestConnection(connection net.Conn, serverConfig *ssh.ServerConfig) {
+
+	tServerConnectionPtr, tChannels, tRequests, err := ssh.NewServerConn(connection, serverConfig)
+	if err != nil {
+		log.Printf("Test target handshake from %s failed: %s", connection.RemoteAddr(), err)
+		return
+	}
+	defer tServerConnectionPtr.Close()
+	go ssh.DiscardRequests(tRequests)
+
+	for tNewChannel := range tChannels {
+		switch tNewChannel.ChannelType() {
+		case "session":
+			go serveTestSession(tNewChannel)
+		case "direct-tcpip":
+			go serveTestForward(tNewChannel)
+		default:
+			_ = tNewChannel.Reject(ssh.UnknownChannelType, tNewChannel.ChannelType())
+		}
+	}
+}
+
+// serveTestForward - dials the requested address, as sshd does for ssh -L.
+func serveTestForward(newChannel ssh.NewChannel) {
+
+	var (
+		tRequest struct {
+			Host       string
+			Port       uint32
+			OriginHost string
+			OriginPort uint32
+		}
+	)
+
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &tRequest); err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	tConnection, err := net.Dial("tcp", net.JoinHostPort(tRequest.Host, strconv.Itoa(int(tRequest.Port))))
+	if err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	tChannel, tRequests, err := newChannel.Accept()
+	if err != nil {
+		_ = tConnection.Close()
+		return
+	}
+	go ssh.DiscardRequests(tRequests)
+
+	var tWaitGroup sync.WaitGroup
+	tWaitGroup.Add(2)
+	go func() {
+		defer tWaitGroup.Done()
+		_, _ = io.Copy(tChannel, tConnection)
+		_ = tChannel.CloseWrite()
+	}()
+	go func() {
+		defer tWaitGroup.Done()
+		_, _ = io.Copy(tConnection, tChannel)
+		_ = tConnection.(*net.TCPConn).CloseWrite()
+	}()
+	tWaitGroup.Wait()
+	_ = tChannel.Close()
+	_ = tConnection.Close()
+}
+
+// serveTestSession - handles the sftp subsystem and exec. Shells and terminals are refused.
+func serveTestSession(newChannel ssh.NewChannel) {
+
+	tChannel, tRequests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer tChannel.Close()
+
+	for tRequestPtr := range tRequests {
+		var tPayload struct{ Value string } // Both subsystem and exec carry a single string.
+		_ = ssh.Unmarshal(tRequestPtr.Payload, &tPayload)
+		switch {
+		case tRequestPtr.Type == "subsystem" && tPayload.Value == "sftp":
+			_ = tRequestPtr.Reply(true, nil)
+			tServerPtr, tErr := sftp.NewServer(tChannel)
+			if tErr == nil {
+				_ = tServerPtr.Serve()
+			}
+			return
+		case tRequestPtr.Type == "exec":
+			_ = tRequestPtr.Reply(true, nil)
+			tCommand := exec.Command("sh", "-c", tPayload.Value)
+			tCommand.Stdout = tChannel
+			tCommand.Stderr = tChannel.Stderr()
+			tStatus := uint32(0)
+			if tErr := tCommand.Run(); tErr != nil {
+				tStatus = 1
+				var tExitErrPtr *exec.ExitError
+				if errors.As(tErr, &tExitErrPtr) {
+					tStatus = uint32(tExitErrPtr.ExitCode())
+				}
+			}
+			tExitStatus := make([]byte, 4)
+			binary.BigEndian.PutUint32(tExitStatus, tStatus)
+			_, _ = tChannel.SendRequest("exit-status", false, tExitStatus)
+			return
+		default:
+			_ = tRequestPtr.Reply(tRequestPtr.Type == "env", nil)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package diagnostics
+
+import (
+	"errors"
+	"time"
+)
+
+//goland:noinspection ALL
+const (
+	DEFAULT_CPU_PROFILE_DURATION = 10 * time.Second
+	DEFAULT_REPEAT_WINDOW        = 10 * time.Second
+	//
+	BUNDLE_DIRECTORY_PERMISSIONS = 0700
+	BUNDLE_FILE_PERMISSIONS      = 0600
+	BUNDLE_TIME_FORMAT           = "20060102T150405Z"
+	//
+	FILE_BUILD_INFO = "build_info.txt"
+	FILE_CPU        = "cpu.pprof"
+	FILE_FDS        = "open_files.txt"
+	FILE_GOROUTINES = "goroutines.txt"
+	FILE_HEAP       = "heap.pprof"
+	FILE_METRICS    = "runtime_metrics.txt"
+	FILE_SUMMARY    = "summary.txt"
+)
+
+var (
+	ErrBundleInProgress = errors.New("a diagnostic bundle is already being written")
+	ErrDirectoryEmpty   = errors.New("the diagnostics directory must be provided")
+)
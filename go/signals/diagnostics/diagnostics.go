@@ -0,0 +1,217 @@
+// Package diagnostics
+/*
+This package writes a diagnostic bundle for a running daemon without stopping it. SIGUSR1, and SIGQUIT when QuitSignal is set,
+write a timestamped directory holding:
+    goroutines.txt       every goroutine stack
+    heap.pprof           heap profile (go tool pprof)
+    cpu.pprof            CPU profile for CPUProfileDuration
+    runtime_metrics.txt  every runtime/metrics sample
+    build_info.txt       module versions and build settings
+    open_files.txt       open file descriptors and their targets
+    summary.txt          pid, Go version, GOMAXPROCS, goroutine count and memory totals
+
+RESTRICTIONS:
+    * Only one bundle is written at a time. A SIGUSR1 while one is being written is ignored.
+    * open_files.txt needs /proc, so it is only complete on Linux.
+    * Once Watch has started, SIGUSR1 no longer stops the process, even after Watch returns.
+
+NOTES:
+    SIGQUIT normally kills a Go program with a stack dump. With QuitSignal set, the first SIGQUIT writes a bundle and a second one,
+    while the bundle is being written or within RepeatWindow after it finished, calls OnRepeat, which should start the shutdown.
+    The lifecycle must not also listen for SIGQUIT.
+
+COPYRIGHT:
+	Copyright 2022
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var (
+	// dropped keeps SIGUSR1 registered once Watch has started, so a SIGUSR1 after Watch returns is dropped rather than
+	// left to the default disposition.
+	dropped = make(chan os.Signal, 1)
+)
+
+type Config struct {
+	CPUProfileDuration time.Duration       // How long the CPU profile runs. The default is DEFAULT_CPU_PROFILE_DURATION.
+	Directory          string              // The parent directory of the bundles.
+	Logger             *log.Logger         // The default is log.Default().
+	OnRepeat           func(reason string) // Called on a second QuitSignal. Usually lifecycle.Shutdown.
+	QuitSignal         bool                // Also write a bundle on SIGQUIT instead of letting it stop the process.
+	RepeatWindow       time.Duration       // How long after a bundle a second SIGQUIT still counts. The default is DEFAULT_REPEAT_WINDOW.
+}
+
+type Collector struct {
+	config   Config
+	lastQuit atomic.Int64 // Unix nanoseconds when the last SIGQUIT bundle finished. 0 while none has.
+	running  atomic.Bool
+}
+
+// New - checks the configuration. Call Watch to start listening for the signals.
+//
+//	Errors: ErrDirectoryEmpty
+func New(config Config) (collectorPtr *Collector, err error) {
+
+	if config.Directory == "" {
+		return nil, ErrDirectoryEmpty
+	}
+	if config.CPUProfileDuration <= 0 {
+		config.CPUProfileDuration = DEFAULT_CPU_PROFILE_DURATION
+	}
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+	if config.RepeatWindow <= 0 {
+		config.RepeatWindow = DEFAULT_REPEAT_WINDOW
+	}
+
+	return &Collector{config: config}, nil
+}
+
+// Watch - writes a bundle on each SIGUSR1, and SIGQUIT when configured, until ctx is cancelled.
+// A SIGUSR1 that arrives after ctx is cancelled is ignored, not acted on by the default handler.
+func (collectorPtr *Collector) Watch(ctx context.Context) {
+
+	var (
+		tSignals = make(chan os.Signal, 2)
+	)
+
+	signal.Notify(dropped, syscall.SIGUSR1)
+	signal.Notify(tSignals, syscall.SIGUSR1)
+	if collectorPtr.config.QuitSignal {
+		signal.Notify(tSignals, syscall.SIGQUIT)
+	}
+	defer signal.Stop(tSignals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tSignal := <-tSignals:
+			if tSignal == syscall.SIGQUIT && collectorPtr.isRepeat() {
+				collectorPtr.config.Logger.Printf("Caught a second %s, starting the shutdown.", tSignal)
+				if collectorPtr.config.OnRepeat != nil {
+					collectorPtr.config.OnRepeat(tSignal.String())
+				}
+				continue
+			}
+			if tSignal == syscall.SIGQUIT {
+				collectorPtr.lastQuit.Store(-1) // A bundle is being written, so the next SIGQUIT is a repeat.
+			}
+			go func(caught os.Signal) {
+				if tDirectory, err := collectorPtr.WriteBundle(ctx); err != nil {
+					collectorPtr.config.Logger.Printf("Diagnostic bundle for %s failed: %s", caught, err)
+				} else {
+					collectorPtr.config.Logger.Printf("Diagnostic bundle for %s written to %s", caught, tDirectory)
+				}
+				if caught == syscall.SIGQUIT {
+					collectorPtr.lastQuit.Store(time.Now().UnixNano())
+				}
+			}(tSignal)
+		}
+	}
+}
+
+// WriteBundle - writes every part of the bundle into a new timestamped directory. A part that fails is recorded in
+// errors.txt and the other parts are still written. The CPU profile stops early when ctx is cancelled.
+//
+//	Errors: ErrBundleInProgress, errors returned by os.MkdirAll
+func (collectorPtr *Collector) WriteBundle(ctx context.Context) (directory string, err error) {
+
+	var (
+		tErrors []string
+	)
+
+	if collectorPtr.running.CompareAndSwap(false, true) == false {
+		return "", ErrBundleInProgress
+	}
+	defer collectorPtr.running.Store(false)
+
+	directory = filepath.Join(collectorPtr.config.Directory, fmt.Sprintf("diagnostics-%d-%s", os.Getpid(), time.Now().UTC().Format(BUNDLE_TIME_FORMAT)))
+	if err = os.MkdirAll(directory, BUNDLE_DIRECTORY_PERMISSIONS); err != nil {
+		return
+	}
+
+	for _, tPart := range []struct {
+		filename string
+		write    func(file *os.File) error
+	}{
+		{FILE_SUMMARY, writeSummary},
+		{FILE_GOROUTINES, writeGoroutines},
+		{FILE_HEAP, writeHeap},
+		{FILE_METRICS, writeMetrics},
+		{FILE_BUILD_INFO, writeBuildInfo},
+		{FILE_FDS, writeOpenFiles},
+		{FILE_CPU, func(file *os.File) error { return writeCPU(ctx, file, collectorPtr.config.CPUProfileDuration) }},
+	} {
+		if tErr := writeFile(filepath.Join(directory, tPart.filename), tPart.write); tErr != nil {
+			tErrors = append(tErrors, fmt.Sprintf("%s: %s", tPart.filename, tErr))
+		}
+	}
+
+	if len(tErrors) > 0 {
+		_ = writeFile(filepath.Join(directory, "errors.txt"), func(file *os.File) error {
+			for _, tLine := range tErrors {
+				if _, tErr := fmt.Fprintln(file, tLine); tErr != nil {
+					return tErr
+				}
+			}
+			return nil
+		})
+	}
+
+	return
+}
+
+// isRepeat - a SIGQUIT is a repeat while a SIGQUIT bundle is being written or within RepeatWindow after it finished.
+func (collectorPtr *Collector) isRepeat() bool {
+
+	tLast := collectorPtr.lastQuit.Load()
+	switch {
+	case tLast == 0:
+		return false
+	case tLast < 0:
+		return true
+	}
+
+	return time.Since(time.Unix(0, tLast)) <= collectorPtr.config.RepeatWindow
+}
+
+func writeFile(fqn string, write func(file *os.File) error) (err error) {
+
+	var (
+		tFilePtr *os.File
+	)
+
+	if tFilePtr, err = os.OpenFile(fqn, os.O_CREATE|os.O_EXCL|os.O_WRONLY, BUNDLE_FILE_PERMISSIONS); err != nil {
+		return
+	}
+	if err = write(tFilePtr); err != nil {
+		_ = tFilePtr.Close()
+		return
+	}
+
+	return tFilePtr.Close()
+}
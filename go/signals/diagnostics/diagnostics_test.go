@@ -0,0 +1,205 @@
+package diagnostics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	TEST_WAIT = 5 * time.Second
+)
+
+// newTestCollector - a Collector writing into a temporary directory with a short CPU profile.
+func newTestCollector(t *testing.T, config Config) (collectorPtr *Collector) {
+
+	var (
+		err error
+	)
+
+	config.CPUProfileDuration = 10 * time.Millisecond
+	config.Directory = t.TempDir()
+	config.Logger = log.New(io.Discard, "", 0)
+	if collectorPtr, err = New(config); err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	return
+}
+
+// bundles - the bundle directories written so far.
+func bundles(t *testing.T, collectorPtr *Collector) (directories []string) {
+
+	var (
+		tErr error
+	)
+
+	if directories, tErr = filepath.Glob(filepath.Join(collectorPtr.config.Directory, "diagnostics-*")); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	return
+}
+
+// waitForBundles - waits until count bundles are complete. The CPU profile is the last part written.
+func waitForBundles(t *testing.T, collectorPtr *Collector, count int) {
+
+	tDeadline := time.Now().Add(TEST_WAIT)
+	for {
+		tComplete := 0
+		for _, tDirectory := range bundles(t, collectorPtr) {
+			if _, tErr := os.Stat(filepath.Join(tDirectory, FILE_CPU)); tErr == nil && collectorPtr.running.Load() == false {
+				tComplete++
+			}
+		}
+		if tComplete >= count {
+			return
+		}
+		if time.Now().After(tDeadline) {
+			t.Fatalf("%d bundles were written, want %d", tComplete, count)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func sendSignal(t *testing.T, signal syscall.Signal) {
+
+	if tErr := syscall.Kill(os.Getpid(), signal); tErr != nil {
+		t.Fatalf("sending %s: %s", signal, tErr)
+	}
+}
+
+func TestNew(t *testing.T) {
+
+	if _, tErr := New(Config{}); errors.Is(tErr, ErrDirectoryEmpty) == false {
+		t.Errorf("New without a directory = %v, want %s", tErr, ErrDirectoryEmpty)
+	}
+
+	tCollectorPtr, tErr := New(Config{Directory: t.TempDir()})
+	if tErr != nil {
+		t.Fatalf("New: %s", tErr)
+	}
+	if tCollectorPtr.config.CPUProfileDuration != DEFAULT_CPU_PROFILE_DURATION || tCollectorPtr.config.RepeatWindow != DEFAULT_REPEAT_WINDOW || tCollectorPtr.config.Logger == nil {
+		t.Errorf("New did not set the defaults: %+v", tCollectorPtr.config)
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+
+	tCollectorPtr := newTestCollector(t, Config{})
+
+	tDirectory, tErr := tCollectorPtr.WriteBundle(context.Background())
+	if tErr != nil {
+		t.Fatalf("WriteBundle: %s", tErr)
+	}
+
+	for _, tFilename := range []string{FILE_BUILD_INFO, FILE_CPU, FILE_FDS, FILE_GOROUTINES, FILE_HEAP, FILE_METRICS, FILE_SUMMARY} {
+		tInfo, tErr := os.Stat(filepath.Join(tDirectory, tFilename))
+		if tErr != nil {
+			t.Errorf("%s: %s", tFilename, tErr)
+			continue
+		}
+		if tInfo.Size() == 0 {
+			t.Errorf("%s is empty", tFilename)
+		}
+		if tInfo.Mode().Perm() != BUNDLE_FILE_PERMISSIONS {
+			t.Errorf("%s permissions = %o, want %o", tFilename, tInfo.Mode().Perm(), BUNDLE_FILE_PERMISSIONS)
+		}
+	}
+	if tData, tErr := os.ReadFile(filepath.Join(tDirectory, "errors.txt")); tErr == nil {
+		t.Errorf("errors.txt was written:\n%s", tData)
+	}
+
+	tCollectorPtr.running.Store(true)
+	if _, tErr = tCollectorPtr.WriteBundle(context.Background()); errors.Is(tErr, ErrBundleInProgress) == false {
+		t.Errorf("WriteBundle while one is running = %v, want %s", tErr, ErrBundleInProgress)
+	}
+}
+
+func TestIsRepeat(t *testing.T) {
+
+	tCollectorPtr := newTestCollector(t, Config{RepeatWindow: time.Minute})
+
+	for _, tCase := range []struct {
+		name     string
+		lastQuit int64
+		want     bool
+	}{
+		{name: "no bundle", lastQuit: 0, want: false},
+		{name: "being written", lastQuit: -1, want: true},
+		{name: "inside the window", lastQuit: time.Now().Add(-30 * time.Second).UnixNano(), want: true},
+		{name: "after the window", lastQuit: time.Now().Add(-2 * time.Minute).UnixNano(), want: false},
+	} {
+		tCollectorPtr.lastQuit.Store(tCase.lastQuit)
+		if tGot := tCollectorPtr.isRepeat(); tGot != tCase.want {
+			t.Errorf("%s: isRepeat() = %t, want %t", tCase.name, tGot, tCase.want)
+		}
+	}
+}
+
+// TestWatch - SIGUSR1 writes a bundle while Watch runs, a second SIGQUIT calls OnRepeat, and a SIGUSR1 once Watch
+// returns neither writes a bundle nor ends the test binary.
+func TestWatch(t *testing.T) {
+
+	var (
+		tRepeats = make(chan string, 1)
+	)
+
+	tCollectorPtr := newTestCollector(t, Config{
+		OnRepeat:     func(reason string) { tRepeats <- reason },
+		QuitSignal:   true,
+		RepeatWindow: time.Minute,
+	})
+
+	tContext, tCancel := context.WithCancel(context.Background())
+	tWatched := make(chan struct{})
+	go func() {
+		tCollectorPtr.Watch(tContext)
+		close(tWatched)
+	}()
+
+	// The watcher may not have registered yet, so SIGUSR1 is repeated until a bundle is started.
+	tDeadline := time.Now().Add(TEST_WAIT)
+	for len(bundles(t, tCollectorPtr)) == 0 {
+		if time.Now().After(tDeadline) {
+			t.Fatal("SIGUSR1 did not start a bundle")
+		}
+		sendSignal(t, syscall.SIGUSR1)
+		time.Sleep(20 * time.Millisecond)
+	}
+	waitForBundles(t, tCollectorPtr, 1)
+
+	// SIGQUIT was registered with SIGUSR1, so the first one writes a bundle and the second is a repeat.
+	time.Sleep(time.Second) // The bundle directories are named to the second.
+	sendSignal(t, syscall.SIGQUIT)
+	waitForBundles(t, tCollectorPtr, 2)
+	sendSignal(t, syscall.SIGQUIT)
+	select {
+	case tReason := <-tRepeats:
+		if tReason != syscall.SIGQUIT.String() {
+			t.Errorf("OnRepeat reason = %q, want %q", tReason, syscall.SIGQUIT.String())
+		}
+	case <-time.After(TEST_WAIT):
+		t.Fatal("a second SIGQUIT did not call OnRepeat")
+	}
+
+	tCancel()
+	select {
+	case <-tWatched:
+	case <-time.After(TEST_WAIT):
+		t.Fatal("Watch did not return after the context was cancelled")
+	}
+
+	tBundles := len(bundles(t, tCollectorPtr))
+	sendSignal(t, syscall.SIGUSR1)
+	time.Sleep(100 * time.Millisecond)
+	if tAfter := len(bundles(t, tCollectorPtr)); tAfter != tBundles {
+		t.Errorf("%d bundles after a SIGUSR1 once Watch returned, want %d", tAfter, tBundles)
+	}
+}
@@ -0,0 +1,144 @@
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/metrics"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"time"
+)
+
+func writeBuildInfo(file *os.File) (err error) {
+
+	tBuildInfoPtr, ok := debug.ReadBuildInfo()
+	if ok == false {
+		_, err = fmt.Fprintln(file, "Build information is not available. The binary was not built with module support.")
+		return
+	}
+	_, err = fmt.Fprintln(file, tBuildInfoPtr.String())
+
+	return
+}
+
+// writeCPU - profiles for duration, or until ctx is cancelled so a shutdown is not held up.
+func writeCPU(ctx context.Context, file *os.File, duration time.Duration) (err error) {
+
+	if err = pprof.StartCPUProfile(file); err != nil {
+		return
+	}
+
+	tTimer := time.NewTimer(duration)
+	defer tTimer.Stop()
+	select {
+	case <-tTimer.C:
+	case <-ctx.Done():
+	}
+	pprof.StopCPUProfile()
+
+	return
+}
+
+func writeGoroutines(file *os.File) error {
+	return pprof.Lookup("goroutine").WriteTo(file, 2)
+}
+
+func writeHeap(file *os.File) error {
+
+	runtime.GC() // Up to date statistics, as the heap profile is as of the last GC.
+
+	return pprof.Lookup("heap").WriteTo(file, 0)
+}
+
+func writeMetrics(file *os.File) (err error) {
+
+	var (
+		tDescriptions = metrics.All()
+		tSamples      = make([]metrics.Sample, len(tDescriptions))
+	)
+
+	for tIndex, tDescription := range tDescriptions {
+		tSamples[tIndex].Name = tDescription.Name
+	}
+	metrics.Read(tSamples)
+
+	for _, tSample := range tSamples {
+		var tValue string
+		switch tSample.Value.Kind() {
+		case metrics.KindUint64:
+			tValue = strconv.FormatUint(tSample.Value.Uint64(), 10)
+		case metrics.KindFloat64:
+			tValue = strconv.FormatFloat(tSample.Value.Float64(), 'g', -1, 64)
+		case metrics.KindFloat64Histogram:
+			tHistogramPtr := tSample.Value.Float64Histogram()
+			var tCount uint64
+			for _, tBucket := range tHistogramPtr.Counts {
+				tCount += tBucket
+			}
+			tValue = fmt.Sprintf("histogram count=%d buckets=%d", tCount, len(tHistogramPtr.Counts))
+		default:
+			tValue = "unsupported"
+		}
+		if _, err = fmt.Fprintf(file, "%s %s\n", tSample.Name, tValue); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// writeOpenFiles - lists /proc/self/fd. Sockets and pipes show as socket:[inode] and pipe:[inode].
+func writeOpenFiles(file *os.File) (err error) {
+
+	var (
+		tEntries []os.DirEntry
+		tFds     []int
+	)
+
+	if tEntries, err = os.ReadDir("/proc/self/fd"); err != nil {
+		return
+	}
+	for _, tEntry := range tEntries {
+		if tFd, tErr := strconv.Atoi(tEntry.Name()); tErr == nil {
+			tFds = append(tFds, tFd)
+		}
+	}
+	sort.Ints(tFds)
+
+	for _, tFd := range tFds {
+		tTarget, tErr := os.Readlink(filepath.Join("/proc/self/fd", strconv.Itoa(tFd)))
+		if tErr != nil {
+			tTarget = tErr.Error()
+		}
+		if _, err = fmt.Fprintf(file, "%d %s\n", tFd, tTarget); err != nil {
+			return
+		}
+	}
+	_, err = fmt.Fprintf(file, "Total: %d\n", len(tFds))
+
+	return
+}
+
+func writeSummary(file *os.File) (err error) {
+
+	var (
+		tMemStats runtime.MemStats
+	)
+
+	runtime.ReadMemStats(&tMemStats)
+	tExecutable, _ := os.Executable()
+
+	_, err = fmt.Fprintf(file,
+		"Time: %s\nPid: %d\nExecutable: %s\nGo Version: %s\nGOOS/GOARCH: %s/%s\nGOMAXPROCS: %d\nCPUs: %d\nGoroutines: %d\n"+
+			"Heap Alloc: %d\nHeap Objects: %d\nSys: %d\nGC Cycles: %d\nLast GC: %s\n",
+		time.Now().UTC().Format(time.RFC3339), os.Getpid(), tExecutable, runtime.Version(), runtime.GOOS, runtime.GOARCH,
+		runtime.GOMAXPROCS(0), runtime.NumCPU(), runtime.NumGoroutine(),
+		tMemStats.HeapAlloc, tMemStats.HeapObjects, tMemStats.Sys, tMemStats.NumGC, time.Unix(0, int64(tMemStats.LastGC)).UTC().Format(time.RFC3339))
+
+	return
+}
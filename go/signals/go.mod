@@ -0,0 +1,15 @@
+module signals
+
+go 1.22.3
+
+require (
+	github.com/integrii/flaggy v1.5.2
+	github.com/pkg/sftp v1.13.6
+	golang.org/x/crypto v0.28.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/kr/fs v0.1.0 // indirect
+	golang.org/x/sys v0.26.0 // indirect
+)
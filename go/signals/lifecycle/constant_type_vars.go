@@ -0,0 +1,27 @@
+package lifecycle
+
+import (
+	"errors"
+	"time"
+)
+
+//goland:noinspection ALL
+const (
+	EXIT_CODE_OK           = 0
+	EXIT_CODE_HOOK_FAILED  = 1 // At least one hook returned an error.
+	EXIT_CODE_HOOK_TIMEOUT = 2 // At least one hook did not return before its timeout. Wins over EXIT_CODE_HOOK_FAILED.
+	EXIT_CODE_FORCED       = 3 // A second shutdown signal arrived while the hooks were running.
+)
+
+//goland:noinspection ALL
+const (
+	DEFAULT_HOOK_TIMEOUT = 10 * time.Second
+)
+
+var (
+	ErrHookNameEmpty   = errors.New("the shutdown hook must have a name")
+	ErrHookNameInUse   = errors.New("a shutdown hook with this name is already registered")
+	ErrHookRunNil      = errors.New("the shutdown hook must have a Run function")
+	ErrHookTimeout     = errors.New("the shutdown hook did not finish before its timeout")
+	ErrShutdownStarted = errors.New("shutdown has started, hooks can no longer be registered")
+)
@@ -0,0 +1,318 @@
+// Package lifecycle
+/*
+This package gives a daemon an orderly shutdown. Components register named shutdown hooks and watch the lifecycle context.
+When a shutdown signal arrives, or Shutdown is called, the context is cancelled and the hooks run in priority order.
+
+RESTRICTIONS:
+    * Only one Lifecycle should exist per process, because it owns the shutdown signals.
+    * A hook that ignores its context and outlives its timeout keeps running in the background. It is reported as timed out.
+
+NOTES:
+    Hooks with the same priority run at the same time. Lower priorities run first, for example:
+        0   stop accepting work (listeners, subscriptions)
+        10  drain in-flight work
+        20  flush and close stores
+    A second shutdown signal while the hooks are running exits at once with EXIT_CODE_FORCED.
+
+COPYRIGHT:
+	Copyright 2022
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+type Config struct {
+	DefaultHookTimeout time.Duration  // Used by hooks without a Timeout. The default is DEFAULT_HOOK_TIMEOUT.
+	Exit               func(code int) // Called by WaitAndExit and on a forced shutdown. The default is os.Exit.
+	Logger             *log.Logger    // The default is log.Default().
+	Signals            []os.Signal    // The signals that start a shutdown. The default is SIGINT, SIGTERM and SIGQUIT.
+}
+
+type Hook struct {
+	Name     string
+	Priority int                             // Lower priorities run first. Hooks with the same priority run at the same time.
+	Run      func(ctx context.Context) error // ctx is cancelled when the Timeout expires.
+	Timeout  time.Duration                   // The default is Config.DefaultHookTimeout.
+}
+
+type HookResult struct {
+	Duration time.Duration
+	Err      error
+	Name     string
+	Priority int
+}
+
+type Lifecycle struct {
+	cancel   context.CancelFunc
+	config   Config
+	ctx      context.Context
+	done     chan struct{}
+	exitCode int
+	hooks    []Hook
+	mu       sync.Mutex
+	reason   string
+	results  []HookResult
+	signals  chan os.Signal
+	started  bool
+	trigger  chan string
+}
+
+// New - starts listening for the shutdown signals. Use Context to learn when shutdown has started and Wait to block until it has finished.
+func New(config Config) (lifecyclePtr *Lifecycle) {
+
+	if config.DefaultHookTimeout <= 0 {
+		config.DefaultHookTimeout = DEFAULT_HOOK_TIMEOUT
+	}
+	if config.Exit == nil {
+		config.Exit = os.Exit
+	}
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+	if len(config.Signals) == 0 {
+		config.Signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT}
+	}
+
+	lifecyclePtr = &Lifecycle{
+		config:  config,
+		done:    make(chan struct{}),
+		signals: make(chan os.Signal, 2),
+		trigger: make(chan string, 1),
+	}
+	lifecyclePtr.ctx, lifecyclePtr.cancel = context.WithCancel(context.Background())
+
+	signal.Notify(lifecyclePtr.signals, config.Signals...)
+	go lifecyclePtr.watch()
+
+	return
+}
+
+// Context - is cancelled as soon as shutdown starts, before any hook runs.
+func (lifecyclePtr *Lifecycle) Context() context.Context {
+	return lifecyclePtr.ctx
+}
+
+// Done - is closed when every hook has finished and the exit code is known.
+func (lifecyclePtr *Lifecycle) Done() <-chan struct{} {
+	return lifecyclePtr.done
+}
+
+// Reason - returns the signal or reason that started the shutdown, or an empty string when it has not started.
+func (lifecyclePtr *Lifecycle) Reason() string {
+
+	lifecyclePtr.mu.Lock()
+	defer lifecyclePtr.mu.Unlock()
+
+	return lifecyclePtr.reason
+}
+
+// Register - adds a shutdown hook.
+//
+//	Errors: ErrHookNameEmpty, ErrHookNameInUse, ErrHookRunNil, ErrShutdownStarted
+func (lifecyclePtr *Lifecycle) Register(hook Hook) (err error) {
+
+	lifecyclePtr.mu.Lock()
+	defer lifecyclePtr.mu.Unlock()
+
+	switch {
+	case lifecyclePtr.started:
+		return ErrShutdownStarted
+	case hook.Name == "":
+		return ErrHookNameEmpty
+	case hook.Run == nil:
+		return fmt.Errorf("%w: %s", ErrHookRunNil, hook.Name)
+	}
+	for _, tHook := range lifecyclePtr.hooks {
+		if tHook.Name == hook.Name {
+			return fmt.Errorf("%w: %s", ErrHookNameInUse, hook.Name)
+		}
+	}
+	if hook.Timeout <= 0 {
+		hook.Timeout = lifecyclePtr.config.DefaultHookTimeout
+	}
+	lifecyclePtr.hooks = append(lifecyclePtr.hooks, hook)
+
+	return
+}
+
+// Results - returns the outcome of every hook, in the order they finished. It is complete once Done is closed.
+func (lifecyclePtr *Lifecycle) Results() (results []HookResult) {
+
+	lifecyclePtr.mu.Lock()
+	defer lifecyclePtr.mu.Unlock()
+
+	return append(results, lifecyclePtr.results...)
+}
+
+// Shutdown - starts the shutdown without a signal, for example when a component fails. Later calls are ignored.
+func (lifecyclePtr *Lifecycle) Shutdown(reason string) {
+
+	select {
+	case lifecyclePtr.trigger <- reason:
+	default:
+	}
+}
+
+// Wait - blocks until every hook has finished and returns the exit code.
+func (lifecyclePtr *Lifecycle) Wait() (exitCode int) {
+
+	<-lifecyclePtr.done
+
+	lifecyclePtr.mu.Lock()
+	defer lifecyclePtr.mu.Unlock()
+
+	return lifecyclePtr.exitCode
+}
+
+// WaitAndExit - calls Wait and exits the process with the exit code.
+func (lifecyclePtr *Lifecycle) WaitAndExit() {
+	lifecyclePtr.config.Exit(lifecyclePtr.Wait())
+}
+
+func (lifecyclePtr *Lifecycle) watch() {
+
+	var (
+		tReason string
+	)
+
+	select {
+	case tSignal := <-lifecyclePtr.signals:
+		tReason = tSignal.String()
+	case tReason = <-lifecyclePtr.trigger:
+	}
+
+	lifecyclePtr.mu.Lock()
+	lifecyclePtr.started = true
+	lifecyclePtr.reason = tReason
+	lifecyclePtr.mu.Unlock()
+
+	lifecyclePtr.config.Logger.Printf("Shutdown started: %s", tReason)
+	lifecyclePtr.cancel()
+
+	go func() {
+		select {
+		case tSignal := <-lifecyclePtr.signals:
+			lifecyclePtr.config.Logger.Printf("Caught %s during shutdown, exiting now.", tSignal)
+			lifecyclePtr.config.Exit(EXIT_CODE_FORCED)
+		case <-lifecyclePtr.done:
+		}
+	}()
+
+	lifecyclePtr.runHooks()
+	signal.Stop(lifecyclePtr.signals)
+	close(lifecyclePtr.done)
+}
+
+// runHooks - runs each priority group in turn. Every hook in a group starts at the same time and the next group
+// starts once they have all returned or timed out.
+func (lifecyclePtr *Lifecycle) runHooks() {
+
+	var (
+		tExitCode = EXIT_CODE_OK
+		tHooks    []Hook
+	)
+
+	lifecyclePtr.mu.Lock()
+	tHooks = append(tHooks, lifecyclePtr.hooks...)
+	lifecyclePtr.mu.Unlock()
+
+	sort.SliceStable(tHooks, func(i, j int) bool { return tHooks[i].Priority < tHooks[j].Priority })
+
+	for tStart := 0; tStart < len(tHooks); {
+		tEnd := tStart
+		for tEnd < len(tHooks) && tHooks[tEnd].Priority == tHooks[tStart].Priority {
+			tEnd++
+		}
+
+		var tWaitGroup sync.WaitGroup
+		for _, tHook := range tHooks[tStart:tEnd] {
+			tWaitGroup.Add(1)
+			go func(hook Hook) {
+				defer tWaitGroup.Done()
+				tResult := runHook(hook)
+				lifecyclePtr.mu.Lock()
+				lifecyclePtr.results = append(lifecyclePtr.results, tResult)
+				lifecyclePtr.mu.Unlock()
+				switch {
+				case tResult.Err == nil:
+					lifecyclePtr.config.Logger.Printf("Shutdown hook %s (priority %d) finished in %s", hook.Name, hook.Priority, tResult.Duration)
+				default:
+					lifecyclePtr.config.Logger.Printf("Shutdown hook %s (priority %d) failed after %s: %s", hook.Name, hook.Priority, tResult.Duration, tResult.Err)
+				}
+			}(tHook)
+		}
+		tWaitGroup.Wait()
+
+		tStart = tEnd
+	}
+
+	for _, tResult := range lifecyclePtr.Results() {
+		switch {
+		case errors.Is(tResult.Err, ErrHookTimeout):
+			tExitCode = EXIT_CODE_HOOK_TIMEOUT
+		case tResult.Err != nil && tExitCode == EXIT_CODE_OK:
+			tExitCode = EXIT_CODE_HOOK_FAILED
+		}
+	}
+
+	lifecyclePtr.mu.Lock()
+	lifecyclePtr.exitCode = tExitCode
+	lifecyclePtr.mu.Unlock()
+
+	lifecyclePtr.config.Logger.Printf("Shutdown finished with exit code %d", tExitCode)
+}
+
+// runHook - a panic in a hook is reported as its error so the remaining hooks still run.
+func runHook(hook Hook) (result HookResult) {
+
+	var (
+		tFinished = make(chan error, 1)
+		tStart    = time.Now()
+	)
+
+	result.Name = hook.Name
+	result.Priority = hook.Priority
+
+	tContext, tCancel := context.WithTimeout(context.Background(), hook.Timeout)
+	defer tCancel()
+
+	go func() {
+		defer func() {
+			if tRecovered := recover(); tRecovered != nil {
+				tFinished <- fmt.Errorf("panic: %v", tRecovered)
+			}
+		}()
+		tFinished <- hook.Run(tContext)
+	}()
+
+	select {
+	case result.Err = <-tFinished:
+	case <-tContext.Done():
+		result.Err = fmt.Errorf("%w: %s", ErrHookTimeout, hook.Timeout)
+	}
+	result.Duration = time.Since(tStart)
+
+	return
+}
@@ -0,0 +1,187 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	TEST_WAIT = 5 * time.Second
+)
+
+// newTestLifecycle - a Lifecycle that reports exits on a channel instead of leaving the test process.
+func newTestLifecycle() (lifecyclePtr *Lifecycle, exits chan int) {
+
+	exits = make(chan int, 2)
+	lifecyclePtr = New(Config{
+		Exit:    func(code int) { exits <- code },
+		Logger:  log.New(io.Discard, "", 0),
+		Signals: []os.Signal{syscall.SIGTERM},
+	})
+
+	return
+}
+
+func sendSIGTERM(t *testing.T) {
+
+	if tErr := syscall.Kill(os.Getpid(), syscall.SIGTERM); tErr != nil {
+		t.Fatalf("sending SIGTERM: %s", tErr)
+	}
+}
+
+func waitDone(t *testing.T, lifecyclePtr *Lifecycle) (exitCode int) {
+
+	select {
+	case <-lifecyclePtr.Done():
+	case <-time.After(TEST_WAIT):
+		t.Fatal("shutdown did not finish")
+	}
+
+	return lifecyclePtr.Wait()
+}
+
+func TestSignalRunsHooksInPriorityOrder(t *testing.T) {
+
+	var (
+		tMutex sync.Mutex
+		tOrder []string
+	)
+
+	tLifecyclePtr, _ := newTestLifecycle()
+
+	tRecord := func(name string) func(ctx context.Context) error {
+		return func(ctx context.Context) error {
+			tMutex.Lock()
+			tOrder = append(tOrder, name)
+			tMutex.Unlock()
+			return nil
+		}
+	}
+	for _, tHook := range []Hook{
+		{Name: "flush", Priority: 20, Run: tRecord("flush")},
+		{Name: "listener", Priority: 0, Run: tRecord("listener")},
+		{Name: "drain", Priority: 10, Run: tRecord("drain")},
+	} {
+		if tErr := tLifecyclePtr.Register(tHook); tErr != nil {
+			t.Fatalf("Register(%s): %s", tHook.Name, tErr)
+		}
+	}
+
+	sendSIGTERM(t)
+
+	select {
+	case <-tLifecyclePtr.Context().Done():
+	case <-time.After(TEST_WAIT):
+		t.Fatal("the context was not cancelled by SIGTERM")
+	}
+	if tExitCode := waitDone(t, tLifecyclePtr); tExitCode != EXIT_CODE_OK {
+		t.Errorf("exit code = %d, want %d", tExitCode, EXIT_CODE_OK)
+	}
+	if tReason := tLifecyclePtr.Reason(); tReason != syscall.SIGTERM.String() {
+		t.Errorf("Reason() = %q, want %q", tReason, syscall.SIGTERM.String())
+	}
+
+	tWant := []string{"listener", "drain", "flush"}
+	if len(tOrder) != len(tWant) {
+		t.Fatalf("hooks ran %v, want %v", tOrder, tWant)
+	}
+	for i := range tWant {
+		if tOrder[i] != tWant[i] {
+			t.Fatalf("hooks ran %v, want %v", tOrder, tWant)
+		}
+	}
+
+	if tErr := tLifecyclePtr.Register(Hook{Name: "late", Run: tRecord("late")}); errors.Is(tErr, ErrShutdownStarted) == false {
+		t.Errorf("Register after shutdown = %v, want %s", tErr, ErrShutdownStarted)
+	}
+}
+
+func TestSignalHookTimeoutExitCode(t *testing.T) {
+
+	tLifecyclePtr, tExits := newTestLifecycle()
+
+	if tErr := tLifecyclePtr.Register(Hook{
+		Name: "failing",
+		Run:  func(ctx context.Context) error { return errors.New("close failed") },
+	}); tErr != nil {
+		t.Fatal(tErr)
+	}
+	if tErr := tLifecyclePtr.Register(Hook{
+		Name:     "stuck",
+		Priority: 1,
+		Run: func(ctx context.Context) error {
+			<-ctx.Done()
+			time.Sleep(50 * time.Millisecond)
+			return nil
+		},
+		Timeout: 50 * time.Millisecond,
+	}); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	sendSIGTERM(t)
+
+	if tExitCode := waitDone(t, tLifecyclePtr); tExitCode != EXIT_CODE_HOOK_TIMEOUT {
+		t.Errorf("exit code = %d, want %d", tExitCode, EXIT_CODE_HOOK_TIMEOUT)
+	}
+	for _, tResult := range tLifecyclePtr.Results() {
+		if tResult.Name == "stuck" && errors.Is(tResult.Err, ErrHookTimeout) == false {
+			t.Errorf("stuck hook error = %v, want %s", tResult.Err, ErrHookTimeout)
+		}
+	}
+
+	tLifecyclePtr.WaitAndExit()
+	if tExitCode := <-tExits; tExitCode != EXIT_CODE_HOOK_TIMEOUT {
+		t.Errorf("WaitAndExit exited with %d, want %d", tExitCode, EXIT_CODE_HOOK_TIMEOUT)
+	}
+}
+
+func TestSecondSignalForcesExit(t *testing.T) {
+
+	var (
+		tRelease = make(chan struct{})
+		tStarted = make(chan struct{})
+	)
+
+	tLifecyclePtr, tExits := newTestLifecycle()
+
+	if tErr := tLifecyclePtr.Register(Hook{
+		Name: "slow",
+		Run: func(ctx context.Context) error {
+			close(tStarted)
+			<-tRelease
+			return nil
+		},
+	}); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	sendSIGTERM(t)
+
+	select {
+	case <-tStarted:
+	case <-time.After(TEST_WAIT):
+		t.Fatal("the hook did not start")
+	}
+
+	sendSIGTERM(t)
+
+	select {
+	case tExitCode := <-tExits:
+		if tExitCode != EXIT_CODE_FORCED {
+			t.Errorf("exit code = %d, want %d", tExitCode, EXIT_CODE_FORCED)
+		}
+	case <-time.After(TEST_WAIT):
+		t.Fatal("the second SIGTERM did not force an exit")
+	}
+
+	close(tRelease)
+	waitDone(t, tLifecyclePtr)
+}
@@ -1,18 +1,34 @@
 // Package signals
 /*
-General description of the purpose of the go file.
+This is the template daemon for services that need an orderly shutdown and a configuration that can be reloaded.
+It shows how components use the lifecycle and reload packages.
 
 RESTRICTIONS:
-    AWS functions:
-    * Program must have access to a .aws/credentials file in the default location.
-    * This will only access system parameters that start with '/sote' (ROOTPATH).
-    * {Enter other restrictions here for AWS
+    Signals:
+    * SIGINT, SIGTERM and SIGQUIT start the shutdown. A second one while the hooks are running exits at once.
+    * SIGHUP reloads the configuration file. An invalid file is logged and the running configuration is kept.
+    * When diagnostics.directory is set, SIGUSR1 writes a diagnostic bundle. With diagnostics.on_sigquit, SIGQUIT does too,
+      and only a second SIGQUIT starts the shutdown.
 
-    {Other catagories of restrictions}
-    * {List of restrictions for the catagory
+    systemd:
+    * Run as Type=notify. READY=1 is sent once start-up has finished and STOPPING=1 as soon as the shutdown starts.
+    * When WatchdogSec is set, WATCHDOG=1 is sent at half of the interval while the supervisor's check passes.
+    * Sockets passed by socket activation (LISTEN_FDS) are picked up and logged.
+
+    Control Socket:
+    * When control_socket is set, 'reload' and 'status' can be sent with --send. Only the owner of the daemon can use it.
+
+    Admin Server:
+    * When admin.address is set, or systemd passes a socket named 'admin', /healthz, /readyz and /metrics are served, and
+      /debug/pprof/ when admin.pprof is set. /readyz returns 503 from the moment the shutdown starts.
+
+    Workers:
+    * The SIGHUP watcher, the control socket and the work loop are supervised workers. A worker that fails is restarted with
+      backoff, and more than 5 restarts in a minute starts the shutdown. On shutdown they stop in reverse dependency order.
 
 NOTES:
-    {Enter any additional notes that you believe will help the next developer.}
+    The daemon logs the total sleep time every log_interval until the lifecycle context is cancelled.
+    Replace the work loop and the example hooks with the service's own workers and hooks.
 
 COPYRIGHT:
 	Copyright 2022
@@ -32,57 +48,299 @@ COPYRIGHT:
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"os"
-	"os/signal"
 	"syscall"
 	"time"
+
+	"github.com/integrii/flaggy"
+
+	"signals/admin"
+	"signals/diagnostics"
+	"signals/lifecycle"
+	"signals/reload"
+	"signals/supervisor"
+	"signals/systemd"
 )
 
-func signalHandler(signal os.Signal) {
-	fmt.Printf("\nCaught signal: %+v", signal)
-	fmt.Println("\nWait for 1 second to finish processing")
-	time.Sleep(1 * time.Second)
+type Config struct {
+	Admin         AdminConfig       `yaml:"admin"`          // Read at start-up. A reload does not change it.
+	ControlSocket string            `yaml:"control_socket"` // The unix socket for 'reload' and 'status'. Leave empty to turn it off.
+	Diagnostics   DiagnosticsConfig `yaml:"diagnostics"`    // Read at start-up. A reload does not change it.
+	LogInterval   time.Duration     `yaml:"log_interval"`   // How often the work loop logs, such as 1m. The minimum is 1s.
+	ServerName    string            `yaml:"server_name"`    // The name used in the log.
+}
+
+type AdminConfig struct {
+	Address string `yaml:"address"` // The listen address, such as 127.0.0.1:9100. Leave empty to turn it off.
+	Pprof   bool   `yaml:"pprof"`   // Also serve /debug/pprof/.
+}
+
+type DiagnosticsConfig struct {
+	CPUProfile time.Duration `yaml:"cpu_profile"` // How long the CPU profile runs, such as 10s.
+	Directory  string        `yaml:"directory"`   // Where bundles are written. Leave empty to turn diagnostics off.
+	OnSIGQUIT  bool          `yaml:"on_sigquit"`  // SIGQUIT writes a bundle and a second SIGQUIT shuts down.
+}
 
-	switch signal {
-	case syscall.SIGHUP: // kill -SIGHUP XXXX
-		fmt.Println("- got hungup")
+const (
+	ADMIN_LISTENER_NAME = "admin" // The FileDescriptorName of the admin socket in a .socket unit.
+)
 
-	case syscall.SIGINT: // kill -SIGINT XXXX or Ctrl+c
-		fmt.Println("- got ctrl+c")
+var (
+	configFilename string
+	send           string
+	utilityName    = "signals"
+)
 
-	case syscall.SIGTERM: // kill -SIGTERM XXXX
-		fmt.Println("- got force stop")
+func init() {
 
-	case syscall.SIGQUIT: // kill -SIGQUIT XXXX
-		fmt.Println("- stop and core dump")
+	appDescription := "The " + utilityName + " daemon shuts down in order on SIGINT, SIGTERM or SIGQUIT and reloads its configuration on SIGHUP."
+	flaggy.SetName("\n" + utilityName) // "\n" is added to the start of the name to make the output easier to read.
+	flaggy.SetDescription(appDescription)
 
-	default:
-		fmt.Println("- unknown signal")
-	}
+	flaggy.DefaultParser.ShowHelpOnUnexpected = true
+	flaggy.DefaultParser.AdditionalHelpPrepend = "https://github.com/sty-holdings/utilities"
 
-	fmt.Println("\nFinished server cleanup")
-	os.Exit(0)
-}
+	flaggy.String(&configFilename, "c", "config", "The directory and filename of the configuration file.")
+	flaggy.String(&send, "s", "send", "Send a command (reload | status) to the running daemon's control socket and exit.")
 
-func initSignals() {
-	var captureSignal = make(chan os.Signal, 1)
-	signal.Notify(captureSignal, syscall.SIGINT, syscall.SIGTERM, syscall.SIGABRT)
-	signalHandler(<-captureSignal)
+	flaggy.Parse()
 }
 
 func main() {
 
 	var (
-		totalSleep = 0
+		err            error
+		tAdminPtr      *admin.Server
+		tCollectorPtr  *diagnostics.Collector
+		tLifecyclePtr  *lifecycle.Lifecycle
+		tListeners     map[string]net.Listener
+		tReloaderPtr   *reload.Reloader[Config]
+		tSupervisorPtr *supervisor.Supervisor
+		tTicksPtr      *admin.Counter
+		tIntervals     = make(chan time.Duration, 1)
 	)
 
-	go initSignals()
+	if configFilename == "" {
+		flaggy.ShowHelpAndExit("You must provide a configuration filename.")
+	}
+
+	// The daemon validates the file when it reloads, so --send only needs it to decode.
+	if send != "" {
+		if tReloaderPtr, err = reload.New(reload.Config[Config]{Filename: configFilename}); err != nil {
+			log.Fatalln(err)
+		}
+		sendCommand(tReloaderPtr.Current().ControlSocket, send)
+		return
+	}
+
+	if tReloaderPtr, err = reload.New(reload.Config[Config]{Filename: configFilename, Validate: validateConfig}); err != nil {
+		log.Fatalln(err)
+	}
+
+	tDiagnostics := tReloaderPtr.Current().Diagnostics
+	if tDiagnostics.OnSIGQUIT && tDiagnostics.Directory != "" {
+		tLifecyclePtr = lifecycle.New(lifecycle.Config{Signals: []os.Signal{syscall.SIGINT, syscall.SIGTERM}})
+	} else {
+		tLifecyclePtr = lifecycle.New(lifecycle.Config{})
+	}
+	if tDiagnostics.Directory != "" {
+		if tCollectorPtr, err = diagnostics.New(diagnostics.Config{
+			CPUProfileDuration: tDiagnostics.CPUProfile,
+			Directory:          tDiagnostics.Directory,
+			OnRepeat:           tLifecyclePtr.Shutdown,
+			QuitSignal:         tDiagnostics.OnSIGQUIT,
+		}); err != nil {
+			log.Fatalln(err)
+		}
+		go tCollectorPtr.Watch(tLifecyclePtr.Context())
+	}
+	mustRegister(tLifecyclePtr, lifecycle.Hook{
+		Name:     "systemd-stopping",
+		Priority: -100, // Before every other hook, so systemd knows the exit that follows is not a crash.
+		Run: func(ctx context.Context) error {
+			_, err := systemd.Stopping()
+			return err
+		},
+	})
+
+	tSupervisorPtr = supervisor.New(supervisor.Config{OnEscalate: tLifecyclePtr.Shutdown})
+
+	if tListeners, err = systemd.Listeners(); err != nil {
+		log.Fatalln(err)
+	}
+	for tName, tListener := range tListeners {
+		log.Printf("Socket activation passed %s (%s)", tName, tListener.Addr())
+	}
+
+	if tAdmin := tReloaderPtr.Current().Admin; tAdmin.Address != "" || tListeners[ADMIN_LISTENER_NAME] != nil {
+		if tAdminPtr, err = admin.New(admin.Config{Address: tAdmin.Address, Listener: tListeners[ADMIN_LISTENER_NAME], Pprof: tAdmin.Pprof}); err != nil {
+			log.Fatalln(err)
+		}
+		if tTicksPtr, err = tAdminPtr.Counter("signals_work_ticks_total", "Number of times the work loop has logged."); err != nil {
+			log.Fatalln(err)
+		}
+		if err = tAdminPtr.AddHealthCheck("workers", tSupervisorPtr.Check); err != nil {
+			log.Fatalln(err)
+		}
+		if err = tAdminPtr.Start(tLifecyclePtr.Context()); err != nil {
+			log.Fatalln(err)
+		}
+		mustRegister(tLifecyclePtr, lifecycle.Hook{
+			Name:     "admin",
+			Priority: 100, // After the other hooks, so /healthz answers and /readyz reports the shutdown while they drain.
+			Run:      tAdminPtr.Shutdown,
+		})
+	}
+
+	tReloaderPtr.Subscribe(func(previous *Config, current *Config) error {
+		if previous.ControlSocket != current.ControlSocket {
+			return errors.New("control_socket cannot be changed by a reload, restart the daemon")
+		}
+		if previous.Admin != current.Admin {
+			return errors.New("admin cannot be changed by a reload, restart the daemon")
+		}
+		notify(systemd.Status(fmt.Sprintf("Configuration reloaded at %s", time.Now().Format(time.RFC3339))))
+		if previous.LogInterval != current.LogInterval {
+			select { // Only the latest interval matters if the work loop has not read the last one.
+			case <-tIntervals:
+			default:
+			}
+			tIntervals <- current.LogInterval
+		}
+		return nil
+	})
+
+	// The workers stop in reverse order: work and the control socket first, then the SIGHUP watcher they depend on.
+	mustAdd(tSupervisorPtr, supervisor.Worker{
+		Name: "reload-signals",
+		Run: func(ctx context.Context) error {
+			tReloaderPtr.WatchSignals(ctx)
+			return nil
+		},
+	})
+	if tSocket := tReloaderPtr.Current().ControlSocket; tSocket != "" {
+		mustAdd(tSupervisorPtr, supervisor.Worker{
+			DependsOn: []string{"reload-signals"},
+			Name:      "control-socket",
+			Policy:    supervisor.RESTART_TRANSIENT,
+			Run: func(ctx context.Context) error {
+				return tReloaderPtr.ServeControlSocket(ctx, tSocket)
+			},
+		})
+	}
+	mustAdd(tSupervisorPtr, supervisor.Worker{
+		DependsOn: []string{"reload-signals"},
+		Name:      "work",
+		Run: func(ctx context.Context) error {
+			work(ctx, tReloaderPtr, tIntervals, tTicksPtr)
+			return nil
+		},
+	})
+	if err = tSupervisorPtr.Start(); err != nil {
+		log.Fatalln(err)
+	}
+
+	mustRegister(tLifecyclePtr, lifecycle.Hook{
+		Name:     "workers",
+		Priority: 0,
+		Timeout:  15 * time.Second,
+		Run:      tSupervisorPtr.Stop,
+	})
+	mustRegister(tLifecyclePtr, lifecycle.Hook{
+		Name:     "cleanup",
+		Priority: 10,
+		Run: func(ctx context.Context) error {
+			log.Println("Finished server cleanup")
+			return nil
+		},
+	})
+
+	go func() {
+		if err := systemd.RunWatchdog(tLifecyclePtr.Context(), func() error { return tSupervisorPtr.Check(context.Background()) }); err != nil {
+			log.Printf("Watchdog stopped: %s", err)
+		}
+	}()
+	if tAdminPtr != nil {
+		tAdminPtr.SetReady(true)
+	}
+	notify(systemd.Ready())
+	notify(systemd.Status("Running"))
+
+	tLifecyclePtr.WaitAndExit()
+}
+
+// notify - a failed notification is logged, not fatal. systemd will act on the missing state, such as a READY=1 timeout.
+func notify(_ bool, err error) {
+	if err != nil {
+		log.Printf("systemd notify failed: %s", err)
+	}
+}
+
+func mustAdd(supervisorPtr *supervisor.Supervisor, worker supervisor.Worker) {
+	if err := supervisorPtr.Add(worker); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func mustRegister(lifecyclePtr *lifecycle.Lifecycle, hook lifecycle.Hook) {
+	if err := lifecyclePtr.Register(hook); err != nil {
+		log.Fatalln(err)
+	}
+}
+
+func sendCommand(socketFQN string, command string) {
+
+	if socketFQN == "" {
+		log.Fatalln("The configuration file does not set a control_socket.")
+	}
+
+	tReply, err := reload.SendCommand(socketFQN, command)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println(tReply)
+}
+
+func validateConfig(configPtr *Config) error {
+
+	if configPtr.LogInterval < time.Second {
+		return fmt.Errorf("log_interval must be at least 1s, not %s", configPtr.LogInterval)
+	}
+	if configPtr.ServerName == "" {
+		return errors.New("server_name is required")
+	}
+
+	return nil
+}
+
+// work - stands in for the service. It reads the current configuration on every tick and stops as soon as the lifecycle context is cancelled.
+// ticksPtr is nil when the admin server is off.
+func work(ctx context.Context, reloaderPtr *reload.Reloader[Config], intervals <-chan time.Duration, ticksPtr *admin.Counter) {
+
+	var (
+		tTicker     = time.NewTicker(reloaderPtr.Current().LogInterval)
+		tTotalSleep = 0
+	)
+	defer tTicker.Stop()
 
-	for true {
-		time.Sleep(1 * time.Minute)
-		totalSleep++
-		log.Printf("Total Sleep time: %v\n", totalSleep)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case tInterval := <-intervals:
+			tTicker.Reset(tInterval)
+		case <-tTicker.C:
+			tTotalSleep++
+			if ticksPtr != nil {
+				ticksPtr.Inc()
+			}
+			log.Printf("%s: Total Sleep time: %v\n", reloaderPtr.Current().ServerName, tTotalSleep)
+		}
 	}
 }
@@ -0,0 +1,26 @@
+package reload
+
+import (
+	"errors"
+	"time"
+)
+
+//goland:noinspection ALL
+const (
+	COMMAND_RELOAD = "reload"
+	COMMAND_STATUS = "status"
+	//
+	REPLY_ERROR = "error"
+	REPLY_OK    = "ok"
+	//
+	CONTROL_SOCKET_PERMISSIONS = 0600
+	CONTROL_SOCKET_TIMEOUT     = 30 * time.Second
+)
+
+var (
+	ErrCommandUnknown    = errors.New("the control socket command must be " + COMMAND_RELOAD + " or " + COMMAND_STATUS)
+	ErrFilenameEmpty     = errors.New("the configuration filename must be provided")
+	ErrSocketInUse       = errors.New("another process is listening on the control socket")
+	ErrSubscriberRefused = errors.New("a subscriber refused the new configuration")
+	ErrValidationFailed  = errors.New("the configuration failed validation")
+)
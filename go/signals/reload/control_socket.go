@@ -0,0 +1,131 @@
+package reload
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// ServeControlSocket - accepts commands on a unix socket until ctx is cancelled. Each connection sends one line,
+// 'reload' or 'status', and gets one line back starting with 'ok' or 'error'. The socket is only usable by the owner.
+//
+//	Errors: ErrSocketInUse, errors returned by net and os
+func (reloaderPtr *Reloader[T]) ServeControlSocket(ctx context.Context, socketFQN string) (err error) {
+
+	var (
+		tConnection net.Conn
+		tListener   net.Listener
+	)
+
+	if tListener, err = listenControlSocket(socketFQN); err != nil {
+		return
+	}
+	reloaderPtr.config.Logger.Printf("Control socket listening on %s", socketFQN)
+
+	go func() {
+		<-ctx.Done()
+		_ = tListener.Close()
+	}()
+	defer func() {
+		_ = os.Remove(socketFQN)
+	}()
+
+	for {
+		if tConnection, err = tListener.Accept(); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return
+		}
+		go reloaderPtr.handleControlConnection(tConnection)
+	}
+}
+
+// SendCommand - sends one command to a control socket and returns the reply. A reply starting with 'error' is returned as an error.
+func SendCommand(socketFQN string, command string) (reply string, err error) {
+
+	var (
+		tConnection net.Conn
+	)
+
+	if tConnection, err = net.DialTimeout("unix", socketFQN, CONTROL_SOCKET_TIMEOUT); err != nil {
+		return
+	}
+	defer tConnection.Close()
+
+	_ = tConnection.SetDeadline(time.Now().Add(CONTROL_SOCKET_TIMEOUT))
+	if _, err = fmt.Fprintln(tConnection, command); err != nil {
+		return
+	}
+	if reply, err = bufio.NewReader(tConnection).ReadString('\n'); err != nil {
+		return
+	}
+	reply = strings.TrimSpace(reply)
+	if strings.HasPrefix(reply, REPLY_ERROR) {
+		err = errors.New(strings.TrimSpace(strings.TrimPrefix(reply, REPLY_ERROR+":")))
+	}
+
+	return
+}
+
+func (reloaderPtr *Reloader[T]) handleControlConnection(connection net.Conn) {
+
+	var (
+		err      error
+		tCommand string
+		tReply   string
+	)
+
+	defer connection.Close()
+	_ = connection.SetDeadline(time.Now().Add(CONTROL_SOCKET_TIMEOUT))
+
+	if tCommand, err = bufio.NewReader(connection).ReadString('\n'); err != nil {
+		return
+	}
+
+	switch tCommand = strings.TrimSpace(tCommand); tCommand {
+	case COMMAND_RELOAD:
+		reloaderPtr.config.Logger.Printf("Control socket: reloading %s", reloaderPtr.config.Filename)
+		if err = reloaderPtr.Reload(); err == nil {
+			tReply = REPLY_OK
+		}
+	case COMMAND_STATUS:
+		tReply = fmt.Sprintf("%s %s", REPLY_OK, reloaderPtr.status())
+	default:
+		err = fmt.Errorf("%w: %q", ErrCommandUnknown, tCommand)
+	}
+	if err != nil {
+		tReply = fmt.Sprintf("%s: %s", REPLY_ERROR, err)
+	}
+
+	_, _ = fmt.Fprintln(connection, tReply)
+}
+
+// listenControlSocket - removes a socket file left by a process that has exited, but not one that is still answering.
+func listenControlSocket(socketFQN string) (listener net.Listener, err error) {
+
+	if _, err = os.Stat(socketFQN); err == nil {
+		if tConnection, tErr := net.DialTimeout("unix", socketFQN, time.Second); tErr == nil {
+			_ = tConnection.Close()
+			return nil, fmt.Errorf("%w: %s", ErrSocketInUse, socketFQN)
+		}
+		if err = os.Remove(socketFQN); err != nil {
+			return
+		}
+	}
+
+	if listener, err = net.Listen("unix", socketFQN); err != nil {
+		return
+	}
+	if err = os.Chmod(socketFQN, CONTROL_SOCKET_PERMISSIONS); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+
+	return
+}
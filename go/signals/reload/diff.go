@@ -0,0 +1,91 @@
+package reload
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Diff - returns one line per field that is added (+), removed (-) or changed (~), using the YAML field names.
+// Nested fields are joined with dots and list items use their index, such as servers.0.port.
+func Diff(previous interface{}, current interface{}) (diff []string) {
+
+	var (
+		tCurrent  = make(map[string]string)
+		tNames    = make(map[string]bool)
+		tOrder    []string
+		tPrevious = make(map[string]string)
+	)
+
+	flatten(toYAMLValue(previous), "", tPrevious)
+	flatten(toYAMLValue(current), "", tCurrent)
+
+	for tName := range tPrevious {
+		tNames[tName] = true
+	}
+	for tName := range tCurrent {
+		tNames[tName] = true
+	}
+	for tName := range tNames {
+		tOrder = append(tOrder, tName)
+	}
+	sort.Strings(tOrder)
+
+	for _, tName := range tOrder {
+		tBefore, tInBefore := tPrevious[tName]
+		tAfter, tInAfter := tCurrent[tName]
+		switch {
+		case tInBefore == false:
+			diff = append(diff, fmt.Sprintf("+ %s: %s", tName, tAfter))
+		case tInAfter == false:
+			diff = append(diff, fmt.Sprintf("- %s: %s", tName, tBefore))
+		case tBefore != tAfter:
+			diff = append(diff, fmt.Sprintf("~ %s: %s -> %s", tName, tBefore, tAfter))
+		}
+	}
+
+	return
+}
+
+// toYAMLValue - round trips the value through YAML so the field names match the file.
+func toYAMLValue(value interface{}) (yamlValue interface{}) {
+
+	tData, err := yaml.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	_ = yaml.Unmarshal(tData, &yamlValue)
+
+	return
+}
+
+func flatten(value interface{}, path string, fields map[string]string) {
+
+	switch tValue := value.(type) {
+	case map[string]interface{}:
+		for tName, tChild := range tValue {
+			flatten(tChild, joinPath(path, tName), fields)
+		}
+	case []interface{}:
+		for tIndex, tChild := range tValue {
+			flatten(tChild, joinPath(path, fmt.Sprintf("%d", tIndex)), fields)
+		}
+	case nil:
+		if path != "" {
+			fields[path] = "null"
+		}
+	default:
+		fields[path] = strings.TrimSpace(fmt.Sprintf("%v", tValue))
+	}
+}
+
+func joinPath(path string, name string) string {
+
+	if path == "" {
+		return name
+	}
+
+	return path + "." + name
+}
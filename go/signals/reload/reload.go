@@ -0,0 +1,245 @@
+// Package reload
+/*
+This package reloads a YAML configuration file while the daemon runs. SIGHUP, or a 'reload' on the control socket,
+re-reads the file, validates it and publishes it to the subscribers.
+
+RESTRICTIONS:
+    * The configuration type must decode with gopkg.in/yaml.v3. Unknown fields are rejected so typos are caught.
+    * Subscribers are called one at a time, in the order they subscribed, and must not call Reload.
+    * Current returns the new configuration only after every subscriber has accepted it.
+
+NOTES:
+    A reload is all or nothing. When the file cannot be read or decoded, fails validation, or a subscriber refuses it,
+    the previous configuration stays current and the subscribers that already accepted the new one are called again
+    with the previous one. Every attempt logs the differences between the two configurations.
+
+    Once New has run, SIGHUP no longer stops the process. A SIGHUP while WatchSignals is not running is dropped.
+
+COPYRIGHT:
+	Copyright 2022
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+package reload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	// hangups keeps SIGHUP registered once New has run, so a SIGHUP while no WatchSignals is running is dropped
+	// instead of ending the process.
+	hangups = make(chan os.Signal, 1)
+)
+
+type Config[T any] struct {
+	Filename string         // The YAML configuration file.
+	Logger   *log.Logger    // The default is log.Default().
+	Validate func(*T) error // Optional. A configuration that fails validation is never published.
+}
+
+// Subscriber - applies a new configuration. Returning an error refuses it and rolls the reload back.
+type Subscriber[T any] func(previous *T, current *T) error
+
+type Reloader[T any] struct {
+	config      Config[T]
+	current     atomic.Pointer[T]
+	failures    int
+	loadedAt    time.Time
+	mu          sync.Mutex // Serializes reloads and guards subscribers and the counters.
+	reloads     int
+	subscribers []Subscriber[T]
+}
+
+// New - loads and validates the configuration file. The daemon should not start when this fails.
+// From here on, a SIGHUP outside WatchSignals is ignored.
+//
+//	Errors: ErrFilenameEmpty, ErrValidationFailed, errors returned by os and yaml
+func New[T any](config Config[T]) (reloaderPtr *Reloader[T], err error) {
+
+	var (
+		tConfigPtr *T
+	)
+
+	if config.Filename == "" {
+		return nil, ErrFilenameEmpty
+	}
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+
+	reloaderPtr = &Reloader[T]{config: config}
+	if tConfigPtr, err = reloaderPtr.load(); err != nil {
+		return nil, err
+	}
+	reloaderPtr.current.Store(tConfigPtr)
+	reloaderPtr.loadedAt = time.Now()
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	return
+}
+
+// Current - returns the published configuration. Callers must treat it as read only.
+func (reloaderPtr *Reloader[T]) Current() *T {
+	return reloaderPtr.current.Load()
+}
+
+// Subscribe - adds a subscriber. It is called on every successful reload, not with the initial configuration.
+func (reloaderPtr *Reloader[T]) Subscribe(subscriber Subscriber[T]) {
+
+	reloaderPtr.mu.Lock()
+	defer reloaderPtr.mu.Unlock()
+
+	reloaderPtr.subscribers = append(reloaderPtr.subscribers, subscriber)
+}
+
+// Reload - re-reads, validates and publishes the configuration file. On any failure the previous configuration stays current.
+//
+//	Errors: ErrSubscriberRefused, ErrValidationFailed, errors returned by os and yaml
+func (reloaderPtr *Reloader[T]) Reload() (err error) {
+
+	var (
+		tAccepted int
+		tCurrent  *T
+		tPrevious *T
+	)
+
+	reloaderPtr.mu.Lock()
+	defer reloaderPtr.mu.Unlock()
+	defer func() {
+		if err != nil {
+			reloaderPtr.failures++
+			return
+		}
+		reloaderPtr.loadedAt = time.Now()
+		reloaderPtr.reloads++
+	}()
+
+	tPrevious = reloaderPtr.current.Load()
+	tCurrent, err = reloaderPtr.load()
+	if tCurrent != nil {
+		reloaderPtr.logDiff(tPrevious, tCurrent)
+	}
+	if err != nil {
+		reloaderPtr.config.Logger.Printf("Reload of %s rejected, keeping the previous configuration: %s", reloaderPtr.config.Filename, err)
+		return
+	}
+
+	for _, tSubscriber := range reloaderPtr.subscribers {
+		if err = tSubscriber(tPrevious, tCurrent); err != nil {
+			break
+		}
+		tAccepted++
+	}
+	if err == nil {
+		reloaderPtr.current.Store(tCurrent)
+		reloaderPtr.config.Logger.Printf("Reload of %s published to %d subscribers.", reloaderPtr.config.Filename, tAccepted)
+		return
+	}
+
+	err = fmt.Errorf("%w: %s", ErrSubscriberRefused, err)
+	for _, tSubscriber := range reloaderPtr.subscribers[:tAccepted] {
+		if tErr := tSubscriber(tCurrent, tPrevious); tErr != nil {
+			reloaderPtr.config.Logger.Printf("Rollback of %s failed in a subscriber: %s", reloaderPtr.config.Filename, tErr)
+		}
+	}
+	reloaderPtr.config.Logger.Printf("Reload of %s rolled back: %s", reloaderPtr.config.Filename, err)
+
+	return
+}
+
+// WatchSignals - reloads on every SIGHUP until ctx is cancelled. Reload failures are logged, not returned.
+// A SIGHUP that arrives after ctx is cancelled is ignored, not acted on by the default handler.
+func (reloaderPtr *Reloader[T]) WatchSignals(ctx context.Context) {
+
+	var (
+		tSignals = make(chan os.Signal, 1)
+	)
+
+	signal.Notify(tSignals, syscall.SIGHUP)
+	defer signal.Stop(tSignals)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tSignals:
+			reloaderPtr.config.Logger.Printf("Caught %s, reloading %s", syscall.SIGHUP, reloaderPtr.config.Filename)
+			_ = reloaderPtr.Reload()
+		}
+	}
+}
+
+// load - reads, decodes and validates the file without publishing it. The decoded configuration is returned
+// even when validation fails so the caller can log the diff.
+func (reloaderPtr *Reloader[T]) load() (configPtr *T, err error) {
+
+	var (
+		tData    []byte
+		tDecoder *yaml.Decoder
+	)
+
+	if tData, err = os.ReadFile(reloaderPtr.config.Filename); err != nil {
+		return
+	}
+
+	configPtr = new(T)
+	tDecoder = yaml.NewDecoder(bytes.NewReader(tData))
+	tDecoder.KnownFields(true)
+	if err = tDecoder.Decode(configPtr); err != nil {
+		return nil, fmt.Errorf("%s: %w", reloaderPtr.config.Filename, err)
+	}
+
+	if reloaderPtr.config.Validate != nil {
+		if err = reloaderPtr.config.Validate(configPtr); err != nil {
+			err = fmt.Errorf("%w: %s", ErrValidationFailed, err)
+		}
+	}
+
+	return
+}
+
+func (reloaderPtr *Reloader[T]) logDiff(previous *T, current *T) {
+
+	var (
+		tDiff []string
+	)
+
+	if tDiff = Diff(previous, current); len(tDiff) == 0 {
+		reloaderPtr.config.Logger.Printf("Reload of %s: no changes", reloaderPtr.config.Filename)
+		return
+	}
+
+	reloaderPtr.config.Logger.Printf("Reload of %s changes:", reloaderPtr.config.Filename)
+	for _, tLine := range tDiff {
+		reloaderPtr.config.Logger.Printf("    %s", tLine)
+	}
+}
+
+func (reloaderPtr *Reloader[T]) status() string {
+
+	reloaderPtr.mu.Lock()
+	defer reloaderPtr.mu.Unlock()
+
+	return fmt.Sprintf("file=%s loaded=%s reloads=%d failures=%d", reloaderPtr.config.Filename, reloaderPtr.loadedAt.UTC().Format(time.RFC3339), reloaderPtr.reloads, reloaderPtr.failures)
+}
@@ -0,0 +1,298 @@
+package reload
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	TEST_WAIT = 5 * time.Second
+)
+
+type testConfig struct {
+	Name  string `yaml:"name"`
+	Ports []int  `yaml:"ports"`
+}
+
+// newTestReloader - writes contents to a configuration file and loads it. Port 0 fails validation.
+func newTestReloader(t *testing.T, contents string) (reloaderPtr *Reloader[testConfig], filename string) {
+
+	var (
+		err error
+	)
+
+	filename = filepath.Join(t.TempDir(), "config.yaml")
+	writeTestConfig(t, filename, contents)
+
+	if reloaderPtr, err = New(Config[testConfig]{
+		Filename: filename,
+		Logger:   log.New(io.Discard, "", 0),
+		Validate: func(configPtr *testConfig) error {
+			for _, tPort := range configPtr.Ports {
+				if tPort == 0 {
+					return errors.New("port 0")
+				}
+			}
+			return nil
+		},
+	}); err != nil {
+		t.Fatalf("New: %s", err)
+	}
+
+	return
+}
+
+func writeTestConfig(t *testing.T, filename string, contents string) {
+
+	if tErr := os.WriteFile(filename, []byte(contents), 0600); tErr != nil {
+		t.Fatal(tErr)
+	}
+}
+
+func TestNewErrors(t *testing.T) {
+
+	tDirectory := t.TempDir()
+
+	for _, tCase := range []struct {
+		name     string
+		contents string
+		wantErr  error
+	}{
+		{name: "validation", contents: "name: a\nports: [0]\n", wantErr: ErrValidationFailed},
+		{name: "unknown field", contents: "name: a\nport: 1\n"},
+		{name: "missing file"},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			tFilename := filepath.Join(tDirectory, tCase.name+".yaml")
+			if tCase.contents != "" {
+				writeTestConfig(t, tFilename, tCase.contents)
+			}
+			tReloaderPtr, tErr := New(Config[testConfig]{
+				Filename: tFilename,
+				Validate: func(configPtr *testConfig) error {
+					if len(configPtr.Ports) > 0 && configPtr.Ports[0] == 0 {
+						return errors.New("port 0")
+					}
+					return nil
+				},
+			})
+			if tErr == nil || tReloaderPtr != nil {
+				t.Fatalf("New = %v, %v, want an error", tReloaderPtr, tErr)
+			}
+			if tCase.wantErr != nil && errors.Is(tErr, tCase.wantErr) == false {
+				t.Errorf("New error = %s, want %s", tErr, tCase.wantErr)
+			}
+		})
+	}
+
+	if _, tErr := New(Config[testConfig]{}); errors.Is(tErr, ErrFilenameEmpty) == false {
+		t.Errorf("New without a filename = %v, want %s", tErr, ErrFilenameEmpty)
+	}
+}
+
+func TestReloadKeepsPreviousOnFailure(t *testing.T) {
+
+	tReloaderPtr, tFilename := newTestReloader(t, "name: a\nports: [1]\n")
+
+	for _, tCase := range []struct {
+		name     string
+		contents string
+		wantErr  error
+	}{
+		{name: "validation", contents: "name: b\nports: [0]\n", wantErr: ErrValidationFailed},
+		{name: "unknown field", contents: "name: b\nport: 2\n"},
+		{name: "not yaml", contents: "name: [b\n"},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			writeTestConfig(t, tFilename, tCase.contents)
+			tErr := tReloaderPtr.Reload()
+			if tErr == nil {
+				t.Fatal("Reload succeeded, want an error")
+			}
+			if tCase.wantErr != nil && errors.Is(tErr, tCase.wantErr) == false {
+				t.Errorf("Reload error = %s, want %s", tErr, tCase.wantErr)
+			}
+			if tName := tReloaderPtr.Current().Name; tName != "a" {
+				t.Errorf("Current().Name = %q after a failed reload, want a", tName)
+			}
+		})
+	}
+
+	if tStatus := tReloaderPtr.status(); strings.Contains(tStatus, "reloads=0 failures=3") == false {
+		t.Errorf("status = %q, want reloads=0 failures=3", tStatus)
+	}
+}
+
+func TestReloadSubscriberRefusalRollsBack(t *testing.T) {
+
+	var (
+		tCalls []string
+	)
+
+	tReloaderPtr, tFilename := newTestReloader(t, "name: a\n")
+
+	tReloaderPtr.Subscribe(func(previous *testConfig, current *testConfig) error {
+		tCalls = append(tCalls, "first "+previous.Name+"->"+current.Name)
+		return nil
+	})
+	tReloaderPtr.Subscribe(func(previous *testConfig, current *testConfig) error {
+		tCalls = append(tCalls, "second "+previous.Name+"->"+current.Name)
+		if current.Name == "refused" {
+			return errors.New("refused")
+		}
+		return nil
+	})
+
+	writeTestConfig(t, tFilename, "name: refused\n")
+	if tErr := tReloaderPtr.Reload(); errors.Is(tErr, ErrSubscriberRefused) == false {
+		t.Fatalf("Reload = %v, want %s", tErr, ErrSubscriberRefused)
+	}
+	if tName := tReloaderPtr.Current().Name; tName != "a" {
+		t.Errorf("Current().Name = %q after a refused reload, want a", tName)
+	}
+
+	writeTestConfig(t, tFilename, "name: b\n")
+	if tErr := tReloaderPtr.Reload(); tErr != nil {
+		t.Fatalf("Reload: %s", tErr)
+	}
+	if tName := tReloaderPtr.Current().Name; tName != "b" {
+		t.Errorf("Current().Name = %q, want b", tName)
+	}
+
+	tWant := []string{"first a->refused", "second a->refused", "first refused->a", "first a->b", "second a->b"}
+	if strings.Join(tCalls, ",") != strings.Join(tWant, ",") {
+		t.Errorf("subscriber calls = %q, want %q", tCalls, tWant)
+	}
+}
+
+func TestDiff(t *testing.T) {
+
+	tDiff := Diff(
+		&testConfig{Name: "a", Ports: []int{1, 2}},
+		&testConfig{Name: "b", Ports: []int{1}},
+	)
+	tWant := []string{"~ name: a -> b", "- ports.1: 2"}
+
+	if strings.Join(tDiff, ",") != strings.Join(tWant, ",") {
+		t.Errorf("Diff = %q, want %q", tDiff, tWant)
+	}
+}
+
+func TestControlSocket(t *testing.T) {
+
+	tReloaderPtr, tFilename := newTestReloader(t, "name: a\n")
+	tSocket := filepath.Join(t.TempDir(), "control.sock")
+
+	tContext, tCancel := context.WithCancel(context.Background())
+	tServed := make(chan error, 1)
+	go func() {
+		tServed <- tReloaderPtr.ServeControlSocket(tContext, tSocket)
+	}()
+	waitFor(t, func() bool {
+		_, tErr := os.Stat(tSocket)
+		return tErr == nil
+	})
+
+	if _, tErr := listenControlSocket(tSocket); errors.Is(tErr, ErrSocketInUse) == false {
+		t.Errorf("a second listener = %v, want %s", tErr, ErrSocketInUse)
+	}
+
+	writeTestConfig(t, tFilename, "name: b\n")
+	if tReply, tErr := SendCommand(tSocket, COMMAND_RELOAD); tErr != nil || tReply != REPLY_OK {
+		t.Errorf("reload = %q, %v, want %s", tReply, tErr, REPLY_OK)
+	}
+	if tName := tReloaderPtr.Current().Name; tName != "b" {
+		t.Errorf("Current().Name = %q, want b", tName)
+	}
+
+	writeTestConfig(t, tFilename, "name: c\nports: [0]\n")
+	if _, tErr := SendCommand(tSocket, COMMAND_RELOAD); tErr == nil || strings.Contains(tErr.Error(), ErrValidationFailed.Error()) == false {
+		t.Errorf("reload of an invalid file = %v, want %s", tErr, ErrValidationFailed)
+	}
+	if tReply, tErr := SendCommand(tSocket, COMMAND_STATUS); tErr != nil || strings.Contains(tReply, "reloads=1 failures=1") == false {
+		t.Errorf("status = %q, %v, want reloads=1 failures=1", tReply, tErr)
+	}
+	if _, tErr := SendCommand(tSocket, "restart"); tErr == nil || strings.Contains(tErr.Error(), ErrCommandUnknown.Error()) == false {
+		t.Errorf("restart = %v, want %s", tErr, ErrCommandUnknown)
+	}
+
+	tCancel()
+	select {
+	case tErr := <-tServed:
+		if tErr != nil {
+			t.Errorf("ServeControlSocket: %s", tErr)
+		}
+	case <-time.After(TEST_WAIT):
+		t.Fatal("ServeControlSocket did not return after the context was cancelled")
+	}
+	if _, tErr := os.Stat(tSocket); os.IsNotExist(tErr) == false {
+		t.Errorf("the control socket was not removed: %v", tErr)
+	}
+}
+
+// TestWatchSignals - a SIGHUP reloads while WatchSignals runs, and is dropped before it starts and after it stops.
+// Without the handler New installs, the SIGHUPs outside the watch would end the test binary.
+func TestWatchSignals(t *testing.T) {
+
+	tReloaderPtr, tFilename := newTestReloader(t, "name: a\n")
+
+	writeTestConfig(t, tFilename, "name: b\n")
+	sendSIGHUP(t)
+	time.Sleep(100 * time.Millisecond)
+	if tName := tReloaderPtr.Current().Name; tName != "a" {
+		t.Fatalf("Current().Name = %q after a SIGHUP outside WatchSignals, want a", tName)
+	}
+
+	tContext, tCancel := context.WithCancel(context.Background())
+	tWatched := make(chan struct{})
+	go func() {
+		tReloaderPtr.WatchSignals(tContext)
+		close(tWatched)
+	}()
+
+	// The watcher may not have registered yet, so SIGHUP is repeated until the reload is seen.
+	waitFor(t, func() bool {
+		sendSIGHUP(t)
+		return tReloaderPtr.Current().Name == "b"
+	})
+
+	tCancel()
+	select {
+	case <-tWatched:
+	case <-time.After(TEST_WAIT):
+		t.Fatal("WatchSignals did not return after the context was cancelled")
+	}
+
+	writeTestConfig(t, tFilename, "name: c\n")
+	sendSIGHUP(t)
+	time.Sleep(100 * time.Millisecond)
+	if tName := tReloaderPtr.Current().Name; tName != "b" {
+		t.Errorf("Current().Name = %q after a SIGHUP once WatchSignals returned, want b", tName)
+	}
+}
+
+func sendSIGHUP(t *testing.T) {
+
+	if tErr := syscall.Kill(os.Getpid(), syscall.SIGHUP); tErr != nil {
+		t.Fatalf("sending SIGHUP: %s", tErr)
+	}
+}
+
+func waitFor(t *testing.T, done func() bool) {
+
+	tDeadline := time.Now().Add(TEST_WAIT)
+	for done() == false {
+		if time.Now().After(tDeadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,52 @@
+package supervisor
+
+import (
+	"errors"
+	"time"
+)
+
+// RestartPolicy - when a worker that has returned is started again.
+type RestartPolicy int
+
+//goland:noinspection ALL
+const (
+	RESTART_PERMANENT RestartPolicy = iota // Always restarted, whether it returned an error or not.
+	RESTART_TRANSIENT                      // Restarted only when it returned an error or panicked.
+	RESTART_TEMPORARY                      // Never restarted.
+)
+
+//goland:noinspection ALL
+const (
+	DEFAULT_BACKOFF_INITIAL = 100 * time.Millisecond
+	DEFAULT_BACKOFF_MAX     = 30 * time.Second
+	DEFAULT_MAX_RESTARTS    = 5
+	DEFAULT_RESTART_WINDOW  = time.Minute
+	DEFAULT_STOP_TIMEOUT    = 5 * time.Second
+)
+
+var (
+	ErrDependencyCycle     = errors.New("the worker dependencies form a cycle")
+	ErrDependencyUnknown   = errors.New("the worker depends on a worker that was not added")
+	ErrIntensityExceeded   = errors.New("the workers restarted more than the maximum intensity")
+	ErrStarted             = errors.New("the supervisor has started, workers can no longer be added")
+	ErrStopTimeout         = errors.New("the worker did not return before its stop timeout")
+	ErrWorkerNameEmpty     = errors.New("the worker must have a name")
+	ErrWorkerNameInUse     = errors.New("a worker with this name is already added")
+	ErrWorkerNotRunning    = errors.New("the worker is not running")
+	ErrWorkerPolicyInvalid = errors.New("the worker restart policy is not valid")
+	ErrWorkerRunNil        = errors.New("the worker must have a Run function")
+)
+
+func (policy RestartPolicy) String() string {
+
+	switch policy {
+	case RESTART_PERMANENT:
+		return "permanent"
+	case RESTART_TRANSIENT:
+		return "transient"
+	case RESTART_TEMPORARY:
+		return "temporary"
+	}
+
+	return "unknown"
+}
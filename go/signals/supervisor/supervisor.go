@@ -0,0 +1,420 @@
+// Package supervisor
+/*
+This package keeps a daemon's workers running. A worker is a named func(ctx) error that runs until ctx is cancelled.
+When it returns early, its restart policy decides whether it is started again:
+    permanent  always
+    transient  only after an error or a panic
+    temporary  never
+
+RESTRICTIONS:
+    * Workers are added before Start. Start and Stop are each called once.
+    * A worker must return soon after its context is cancelled. One that does not is abandoned after its StopTimeout.
+
+NOTES:
+    Restarts wait an exponential backoff with jitter, from BackoffInitial doubling up to BackoffMax. A worker that ran for longer
+    than RestartWindow starts again from BackoffInitial.
+
+    When the workers together restart more than MaxRestarts times within RestartWindow, the supervisor stops restarting and calls
+    OnEscalate, which should start the daemon's shutdown. A crash loop then ends in an exit that systemd can see.
+
+    Workers are launched in dependency order, each after the workers in its DependsOn, and Stop stops them in the reverse order,
+    so a worker can use its dependencies until it has returned. Launching does not wait for a worker to be ready, so a worker that
+    needs a dependency to have finished its set-up must wait for it. Register Stop as a lifecycle hook.
+
+COPYRIGHT:
+	Copyright 2022
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Config struct {
+	BackoffInitial time.Duration       // The first restart delay. The default is DEFAULT_BACKOFF_INITIAL.
+	BackoffMax     time.Duration       // The longest restart delay. The default is DEFAULT_BACKOFF_MAX.
+	Logger         *log.Logger         // The default is log.Default().
+	MaxRestarts    int                 // The default is DEFAULT_MAX_RESTARTS.
+	OnEscalate     func(reason string) // Called once when the intensity is exceeded. Usually lifecycle.Shutdown.
+	RestartWindow  time.Duration       // The default is DEFAULT_RESTART_WINDOW.
+}
+
+type Worker struct {
+	DependsOn   []string                        // Workers that start before and stop after this one.
+	Name        string                          //
+	Policy      RestartPolicy                   // The zero value is RESTART_PERMANENT.
+	Run         func(ctx context.Context) error // Returns once ctx is cancelled.
+	StopTimeout time.Duration                   // The default is DEFAULT_STOP_TIMEOUT.
+}
+
+type WorkerStatus struct {
+	LastErr  error
+	Name     string
+	Policy   RestartPolicy
+	Restarts int
+	Running  bool
+}
+
+type Supervisor struct {
+	config    Config
+	escalated bool
+	mu        sync.Mutex
+	order     []*workerState // Dependency order, set by Start.
+	restarts  []time.Time    // Restart times within the window, for the intensity.
+	started   bool
+	workers   map[string]*workerState
+}
+
+type workerState struct {
+	cancel   context.CancelFunc
+	done     chan struct{}
+	lastErr  error
+	restarts int
+	running  bool
+	worker   Worker
+}
+
+// New - applies the defaults. Add the workers, then call Start.
+func New(config Config) (supervisorPtr *Supervisor) {
+
+	if config.BackoffInitial <= 0 {
+		config.BackoffInitial = DEFAULT_BACKOFF_INITIAL
+	}
+	if config.BackoffMax < config.BackoffInitial {
+		config.BackoffMax = max(DEFAULT_BACKOFF_MAX, config.BackoffInitial)
+	}
+	if config.Logger == nil {
+		config.Logger = log.Default()
+	}
+	if config.MaxRestarts <= 0 {
+		config.MaxRestarts = DEFAULT_MAX_RESTARTS
+	}
+	if config.RestartWindow <= 0 {
+		config.RestartWindow = DEFAULT_RESTART_WINDOW
+	}
+
+	return &Supervisor{config: config, workers: make(map[string]*workerState)}
+}
+
+// Add - adds a worker. Its dependencies are checked by Start, so workers can be added in any order.
+//
+//	Errors: ErrStarted, ErrWorkerNameEmpty, ErrWorkerNameInUse, ErrWorkerPolicyInvalid, ErrWorkerRunNil
+func (supervisorPtr *Supervisor) Add(worker Worker) (err error) {
+
+	supervisorPtr.mu.Lock()
+	defer supervisorPtr.mu.Unlock()
+
+	switch {
+	case supervisorPtr.started:
+		return ErrStarted
+	case worker.Name == "":
+		return ErrWorkerNameEmpty
+	case worker.Run == nil:
+		return fmt.Errorf("%w: %s", ErrWorkerRunNil, worker.Name)
+	case worker.Policy < RESTART_PERMANENT || worker.Policy > RESTART_TEMPORARY:
+		return fmt.Errorf("%w: %s", ErrWorkerPolicyInvalid, worker.Name)
+	}
+	if _, ok := supervisorPtr.workers[worker.Name]; ok {
+		return fmt.Errorf("%w: %s", ErrWorkerNameInUse, worker.Name)
+	}
+	if worker.StopTimeout <= 0 {
+		worker.StopTimeout = DEFAULT_STOP_TIMEOUT
+	}
+	supervisorPtr.workers[worker.Name] = &workerState{done: make(chan struct{}), worker: worker}
+
+	return
+}
+
+// Check - fails when the supervisor has escalated or a permanent worker is not running. It fits admin.Server.AddHealthCheck.
+//
+//	Errors: ErrIntensityExceeded, ErrWorkerNotRunning
+func (supervisorPtr *Supervisor) Check(_ context.Context) error {
+
+	supervisorPtr.mu.Lock()
+	defer supervisorPtr.mu.Unlock()
+
+	if supervisorPtr.escalated {
+		return ErrIntensityExceeded
+	}
+	for _, tStatePtr := range supervisorPtr.order {
+		if tStatePtr.worker.Policy == RESTART_PERMANENT && tStatePtr.running == false {
+			return fmt.Errorf("%w: %s", ErrWorkerNotRunning, tStatePtr.worker.Name)
+		}
+	}
+
+	return nil
+}
+
+// Start - checks the dependencies and starts every worker in dependency order.
+//
+//	Errors: ErrDependencyCycle, ErrDependencyUnknown, ErrStarted
+func (supervisorPtr *Supervisor) Start() (err error) {
+
+	supervisorPtr.mu.Lock()
+	defer supervisorPtr.mu.Unlock()
+
+	if supervisorPtr.started {
+		return ErrStarted
+	}
+	if supervisorPtr.order, err = dependencyOrder(supervisorPtr.workers); err != nil {
+		return
+	}
+	supervisorPtr.started = true
+
+	for _, tStatePtr := range supervisorPtr.order {
+		var tContext context.Context
+		tContext, tStatePtr.cancel = context.WithCancel(context.Background())
+		tStatePtr.running = true
+		go supervisorPtr.supervise(tContext, tStatePtr)
+	}
+
+	return
+}
+
+// Status - returns each worker in dependency order.
+func (supervisorPtr *Supervisor) Status() (statuses []WorkerStatus) {
+
+	supervisorPtr.mu.Lock()
+	defer supervisorPtr.mu.Unlock()
+
+	for _, tStatePtr := range supervisorPtr.order {
+		statuses = append(statuses, WorkerStatus{
+			LastErr:  tStatePtr.lastErr,
+			Name:     tStatePtr.worker.Name,
+			Policy:   tStatePtr.worker.Policy,
+			Restarts: tStatePtr.restarts,
+			Running:  tStatePtr.running,
+		})
+	}
+
+	return
+}
+
+// Stop - stops the workers in reverse dependency order, each one only after the workers that depend on it have returned.
+// A worker that does not return within its StopTimeout, or before ctx is cancelled, is abandoned and the next one is stopped.
+// It fits lifecycle.Hook.Run.
+//
+//	Errors: ErrStopTimeout, ctx.Err()
+func (supervisorPtr *Supervisor) Stop(ctx context.Context) (err error) {
+
+	var (
+		tErrors []error
+		tOrder  []*workerState
+	)
+
+	supervisorPtr.mu.Lock()
+	tOrder = supervisorPtr.order
+	supervisorPtr.mu.Unlock()
+
+	for tIndex := len(tOrder) - 1; tIndex >= 0; tIndex-- {
+		tStatePtr := tOrder[tIndex]
+		tStatePtr.cancel()
+
+		tTimer := time.NewTimer(tStatePtr.worker.StopTimeout)
+		select {
+		case <-tStatePtr.done:
+			supervisorPtr.config.Logger.Printf("Worker %s stopped.", tStatePtr.worker.Name)
+		case <-tTimer.C:
+			tErrors = append(tErrors, fmt.Errorf("%w: %s after %s", ErrStopTimeout, tStatePtr.worker.Name, tStatePtr.worker.StopTimeout))
+		case <-ctx.Done():
+			tTimer.Stop()
+			for _, tRemainingPtr := range tOrder[:tIndex] {
+				tRemainingPtr.cancel()
+			}
+			return errors.Join(append(tErrors, ctx.Err())...)
+		}
+		tTimer.Stop()
+	}
+
+	return errors.Join(tErrors...)
+}
+
+// allowRestart - records a restart and reports whether the intensity still allows it. The first restart over the
+// intensity escalates.
+func (supervisorPtr *Supervisor) allowRestart(name string) (allowed bool) {
+
+	var (
+		tNow    = time.Now()
+		tReason string
+	)
+
+	supervisorPtr.mu.Lock()
+	if supervisorPtr.escalated {
+		supervisorPtr.mu.Unlock()
+		return false
+	}
+	tKept := supervisorPtr.restarts[:0]
+	for _, tRestart := range supervisorPtr.restarts {
+		if tNow.Sub(tRestart) < supervisorPtr.config.RestartWindow {
+			tKept = append(tKept, tRestart)
+		}
+	}
+	supervisorPtr.restarts = append(tKept, tNow)
+	if len(supervisorPtr.restarts) <= supervisorPtr.config.MaxRestarts {
+		supervisorPtr.mu.Unlock()
+		return true
+	}
+	supervisorPtr.escalated = true
+	supervisorPtr.mu.Unlock()
+
+	tReason = fmt.Sprintf("%s: more than %d restarts in %s, last by %s", ErrIntensityExceeded, supervisorPtr.config.MaxRestarts, supervisorPtr.config.RestartWindow, name)
+	supervisorPtr.config.Logger.Printf("Supervisor escalating: %s", tReason)
+	if supervisorPtr.config.OnEscalate != nil {
+		supervisorPtr.config.OnEscalate(tReason)
+	}
+
+	return false
+}
+
+// backoff - doubles the delay for each consecutive restart, caps it at BackoffMax and picks a time in its upper half,
+// so workers that failed together do not restart together.
+func (supervisorPtr *Supervisor) backoff(attempt int) time.Duration {
+
+	tDelay := supervisorPtr.config.BackoffInitial
+	for i := 1; i < attempt && tDelay < supervisorPtr.config.BackoffMax; i++ {
+		tDelay *= 2
+	}
+	tDelay = min(tDelay, supervisorPtr.config.BackoffMax)
+
+	return tDelay/2 + time.Duration(rand.Int63n(int64(tDelay/2)+1))
+}
+
+// supervise - runs the worker until ctx is cancelled, restarting it as its policy and the intensity allow.
+func (supervisorPtr *Supervisor) supervise(ctx context.Context, statePtr *workerState) {
+
+	var (
+		tAttempt int
+		tName    = statePtr.worker.Name
+	)
+
+	defer close(statePtr.done)
+
+	for {
+		tStart := time.Now()
+		tErr := runWorker(ctx, statePtr.worker)
+
+		supervisorPtr.mu.Lock()
+		statePtr.lastErr = tErr
+		supervisorPtr.mu.Unlock()
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		tRestart := statePtr.worker.Policy == RESTART_PERMANENT || (statePtr.worker.Policy == RESTART_TRANSIENT && tErr != nil)
+		switch {
+		case tErr != nil:
+			supervisorPtr.config.Logger.Printf("Worker %s (%s) failed after %s: %s", tName, statePtr.worker.Policy, time.Since(tStart).Round(time.Millisecond), tErr)
+		default:
+			supervisorPtr.config.Logger.Printf("Worker %s (%s) returned after %s.", tName, statePtr.worker.Policy, time.Since(tStart).Round(time.Millisecond))
+		}
+		if tRestart == false || supervisorPtr.allowRestart(tName) == false {
+			break
+		}
+
+		if time.Since(tStart) > supervisorPtr.config.RestartWindow {
+			tAttempt = 0
+		}
+		tAttempt++
+		tDelay := supervisorPtr.backoff(tAttempt)
+		supervisorPtr.config.Logger.Printf("Restarting worker %s in %s.", tName, tDelay.Round(time.Millisecond))
+
+		tTimer := time.NewTimer(tDelay)
+		select {
+		case <-ctx.Done():
+			tTimer.Stop()
+		case <-tTimer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		supervisorPtr.mu.Lock()
+		statePtr.restarts++
+		supervisorPtr.mu.Unlock()
+	}
+
+	supervisorPtr.mu.Lock()
+	statePtr.running = false
+	supervisorPtr.mu.Unlock()
+}
+
+// dependencyOrder - sorts the workers so each comes after its dependencies. Workers without an ordering between them keep
+// the order of their names, so the start order is the same on every run.
+func dependencyOrder(workers map[string]*workerState) (order []*workerState, err error) {
+
+	var (
+		tNames []string
+		tState = make(map[string]int) // 0 not visited, 1 visiting, 2 placed
+		tVisit func(name string, path []string) error
+	)
+
+	for tName, tStatePtr := range workers {
+		tNames = append(tNames, tName)
+		for _, tDependency := range tStatePtr.worker.DependsOn {
+			if _, ok := workers[tDependency]; ok == false {
+				return nil, fmt.Errorf("%w: %s depends on %s", ErrDependencyUnknown, tName, tDependency)
+			}
+		}
+	}
+	sort.Strings(tNames)
+
+	tVisit = func(name string, path []string) error {
+		switch tState[name] {
+		case 1:
+			return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(append(path, name), " -> "))
+		case 2:
+			return nil
+		}
+		tState[name] = 1
+		tDependencies := append([]string(nil), workers[name].worker.DependsOn...)
+		sort.Strings(tDependencies)
+		for _, tDependency := range tDependencies {
+			if tErr := tVisit(tDependency, append(path, name)); tErr != nil {
+				return tErr
+			}
+		}
+		tState[name] = 2
+		order = append(order, workers[name])
+		return nil
+	}
+
+	for _, tName := range tNames {
+		if err = tVisit(tName, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// runWorker - a panic in a worker is reported as its error so it is handled by the restart policy.
+func runWorker(ctx context.Context, worker Worker) (err error) {
+
+	defer func() {
+		if tRecovered := recover(); tRecovered != nil {
+			err = fmt.Errorf("panic: %v", tRecovered)
+		}
+	}()
+
+	return worker.Run(ctx)
+}
@@ -0,0 +1,28 @@
+package systemd
+
+import (
+	"errors"
+)
+
+//goland:noinspection ALL
+const (
+	ENV_LISTEN_FDNAMES = "LISTEN_FDNAMES"
+	ENV_LISTEN_FDS     = "LISTEN_FDS"
+	ENV_LISTEN_PID     = "LISTEN_PID"
+	ENV_NOTIFY_SOCKET  = "NOTIFY_SOCKET"
+	ENV_WATCHDOG_PID   = "WATCHDOG_PID"
+	ENV_WATCHDOG_USEC  = "WATCHDOG_USEC"
+	//
+	LISTEN_FDS_START = 3 // SD_LISTEN_FDS_START
+	//
+	STATE_READY    = "READY=1"
+	STATE_RELOAD   = "RELOADING=1"
+	STATE_STOPPING = "STOPPING=1"
+	STATE_WATCHDOG = "WATCHDOG=1"
+	STATE_STATUS   = "STATUS="
+)
+
+var (
+	ErrListenFdsInvalid    = errors.New("the " + ENV_LISTEN_FDS + " environment variable is not a number")
+	ErrWatchdogUsecInvalid = errors.New("the " + ENV_WATCHDOG_USEC + " environment variable is not a positive number")
+)
@@ -0,0 +1,68 @@
+package systemd
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Listeners - returns the sockets passed by socket activation, keyed by their FileDescriptorName (LISTEN_FDNAMES).
+// Unnamed sockets are keyed by their position, such as "0". The environment variables are cleared so child processes
+// do not take the sockets too. It returns an empty map when the process was not socket activated.
+// Descriptors that are not stream sockets, such as ListenDatagram or ListenFIFO, are skipped and left open.
+//
+//	Errors: ErrListenFdsInvalid, errors returned by net.FileListener
+func Listeners() (listeners map[string]net.Listener, err error) {
+
+	var (
+		tCount int
+		tNames []string
+	)
+
+	listeners = make(map[string]net.Listener)
+
+	if tPid, tErr := strconv.Atoi(os.Getenv(ENV_LISTEN_PID)); tErr != nil || tPid != os.Getpid() {
+		return
+	}
+	defer func() {
+		_ = os.Unsetenv(ENV_LISTEN_PID)
+		_ = os.Unsetenv(ENV_LISTEN_FDS)
+		_ = os.Unsetenv(ENV_LISTEN_FDNAMES)
+	}()
+
+	if tCount, err = strconv.Atoi(os.Getenv(ENV_LISTEN_FDS)); err != nil {
+		return listeners, ErrListenFdsInvalid
+	}
+	if tFdNames := os.Getenv(ENV_LISTEN_FDNAMES); tFdNames != "" {
+		tNames = strings.Split(tFdNames, ":")
+	}
+
+	for tIndex := 0; tIndex < tCount; tIndex++ {
+		tFd := LISTEN_FDS_START + tIndex
+		syscall.CloseOnExec(tFd)
+
+		tName := strconv.Itoa(tIndex)
+		if tIndex < len(tNames) && tNames[tIndex] != "" {
+			tName = tNames[tIndex]
+		}
+
+		if tType, tErr := syscall.GetsockoptInt(tFd, syscall.SOL_SOCKET, syscall.SO_TYPE); tErr != nil || tType != syscall.SOCK_STREAM {
+			continue
+		}
+
+		tFile := os.NewFile(uintptr(tFd), tName)
+		tListener, tErr := net.FileListener(tFile)
+		_ = tFile.Close() // FileListener holds its own copy of the descriptor.
+		if tErr != nil {
+			for _, tOpened := range listeners {
+				_ = tOpened.Close()
+			}
+			return make(map[string]net.Listener), tErr
+		}
+		listeners[tName] = tListener
+	}
+
+	return
+}
@@ -0,0 +1,141 @@
+// Package systemd
+/*
+This package speaks the systemd service protocol without linking libsystemd. It sends sd_notify states,
+keeps the watchdog fed and picks up sockets passed by socket activation.
+
+RESTRICTIONS:
+    * Only useful on Linux under systemd. Everywhere else NOTIFY_SOCKET and LISTEN_FDS are unset and every call is a no-op.
+    * The unit must be Type=notify for READY=1 to matter, and must set WatchdogSec for the watchdog to run.
+
+NOTES:
+    Notify returns sent=false with no error when NOTIFY_SOCKET is unset, so callers do not need to know how they were started.
+    Socket names starting with '@' are Linux abstract sockets.
+
+COPYRIGHT:
+	Copyright 2022
+	Licensed under the Apache License, Version 2.0 (the "License");
+	you may not use this file except in compliance with the License.
+	You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+	Unless required by applicable law or agreed to in writing, software
+	distributed under the License is distributed on an "AS IS" BASIS,
+	WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+	See the License for the specific language governing permissions and
+	limitations under the License.
+*/
+package systemd
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notify - sends one or more newline separated states, such as READY=1, to the systemd notify socket.
+func Notify(state string) (sent bool, err error) {
+
+	var (
+		tConnection *net.UnixConn
+		tSocket     = os.Getenv(ENV_NOTIFY_SOCKET)
+	)
+
+	if tSocket == "" {
+		return
+	}
+	if strings.HasPrefix(tSocket, "@") {
+		tSocket = "\x00" + tSocket[1:]
+	}
+
+	if tConnection, err = net.DialUnix("unixgram", nil, &net.UnixAddr{Name: tSocket, Net: "unixgram"}); err != nil {
+		return
+	}
+	defer tConnection.Close()
+
+	if _, err = tConnection.Write([]byte(state)); err != nil {
+		return
+	}
+	sent = true
+
+	return
+}
+
+// Ready - tells systemd start-up has finished. With Type=notify, units ordered after this one wait for it.
+func Ready() (sent bool, err error) {
+	return Notify(STATE_READY)
+}
+
+// Reloading - tells systemd a configuration reload has started. Send Ready when it has finished.
+func Reloading() (sent bool, err error) {
+	return Notify(STATE_RELOAD)
+}
+
+// Status - sets the one line status shown by systemctl status.
+func Status(status string) (sent bool, err error) {
+	return Notify(STATE_STATUS + strings.ReplaceAll(status, "\n", " "))
+}
+
+// Stopping - tells systemd the shutdown has started, so it does not treat the exit as a crash.
+func Stopping() (sent bool, err error) {
+	return Notify(STATE_STOPPING)
+}
+
+// WatchdogInterval - returns WATCHDOG_USEC when the watchdog is enabled for this process. When WATCHDOG_PID is set,
+// it must be this process, otherwise the watchdog belongs to another process.
+func WatchdogInterval() (interval time.Duration, enabled bool, err error) {
+
+	var (
+		tMicroseconds int64
+		tPid          int
+		tUsec         = os.Getenv(ENV_WATCHDOG_USEC)
+	)
+
+	if tUsec == "" {
+		return
+	}
+	if tMicroseconds, err = strconv.ParseInt(tUsec, 10, 64); err != nil || tMicroseconds <= 0 {
+		return 0, false, ErrWatchdogUsecInvalid
+	}
+	if tWatchdogPid := os.Getenv(ENV_WATCHDOG_PID); tWatchdogPid != "" {
+		if tPid, err = strconv.Atoi(tWatchdogPid); err != nil || tPid != os.Getpid() {
+			return 0, false, nil
+		}
+	}
+
+	return time.Duration(tMicroseconds) * time.Microsecond, true, nil
+}
+
+// RunWatchdog - sends WATCHDOG=1 at half of WATCHDOG_USEC until ctx is cancelled. When healthy is set and returns an error,
+// the keep-alive is skipped, so systemd restarts a process that is running but stuck. It returns at once when the watchdog is off.
+func RunWatchdog(ctx context.Context, healthy func() error) (err error) {
+
+	var (
+		tEnabled  bool
+		tInterval time.Duration
+		tTicker   *time.Ticker
+	)
+
+	if tInterval, tEnabled, err = WatchdogInterval(); err != nil || tEnabled == false {
+		return
+	}
+
+	tTicker = time.NewTicker(tInterval / 2)
+	defer tTicker.Stop()
+
+	for {
+		if healthy == nil || healthy() == nil {
+			if _, err = Notify(STATE_WATCHDOG); err != nil {
+				return
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-tTicker.C:
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package systemd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	ENV_TEST_LISTENERS_CHILD = "SYSTEMD_TEST_LISTENERS_CHILD"
+	TEST_WAIT                = 5 * time.Second
+)
+
+// listenNotify - binds a unixgram socket in a temporary directory and points NOTIFY_SOCKET at it.
+func listenNotify(t *testing.T) (connection *net.UnixConn) {
+
+	var (
+		tErr    error
+		tSocket = filepath.Join(t.TempDir(), "notify.sock")
+	)
+
+	if connection, tErr = net.ListenUnixgram("unixgram", &net.UnixAddr{Name: tSocket, Net: "unixgram"}); tErr != nil {
+		t.Fatal(tErr)
+	}
+	t.Cleanup(func() { _ = connection.Close() })
+	t.Setenv(ENV_NOTIFY_SOCKET, tSocket)
+
+	return
+}
+
+func readDatagram(t *testing.T, connection *net.UnixConn) string {
+
+	var (
+		tBuffer = make([]byte, 4096)
+	)
+
+	_ = connection.SetReadDeadline(time.Now().Add(TEST_WAIT))
+	tLength, tErr := connection.Read(tBuffer)
+	if tErr != nil {
+		t.Fatalf("reading the notify socket: %s", tErr)
+	}
+
+	return string(tBuffer[:tLength])
+}
+
+func TestNotifyStates(t *testing.T) {
+
+	tConnection := listenNotify(t)
+
+	for _, tCase := range []struct {
+		name string
+		send func() (bool, error)
+		want string
+	}{
+		{"Ready", Ready, "READY=1"},
+		{"Reloading", Reloading, "RELOADING=1"},
+		{"Stopping", Stopping, "STOPPING=1"},
+		{"Status", func() (bool, error) { return Status("serving\n3 clients") }, "STATUS=serving 3 clients"},
+		{"Notify", func() (bool, error) { return Notify("RELOADING=1\nMONOTONIC_USEC=1") }, "RELOADING=1\nMONOTONIC_USEC=1"},
+	} {
+		tSent, tErr := tCase.send()
+		if tErr != nil || tSent == false {
+			t.Fatalf("%s() = %t, %v, want true, nil", tCase.name, tSent, tErr)
+		}
+		if tGot := readDatagram(t, tConnection); tGot != tCase.want {
+			t.Errorf("%s() sent %q, want %q", tCase.name, tGot, tCase.want)
+		}
+	}
+}
+
+func TestNotifyAbstractSocket(t *testing.T) {
+
+	tName := fmt.Sprintf("systemd-test-%d-%d", os.Getpid(), time.Now().UnixNano())
+	tConnection, tErr := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: "\x00" + tName, Net: "unixgram"})
+	if tErr != nil {
+		t.Skipf("abstract sockets are not available: %s", tErr)
+	}
+	defer tConnection.Close()
+	t.Setenv(ENV_NOTIFY_SOCKET, "@"+tName)
+
+	if tSent, tErr := Ready(); tErr != nil || tSent == false {
+		t.Fatalf("Ready() = %t, %v, want true, nil", tSent, tErr)
+	}
+	if tGot := readDatagram(t, tConnection); tGot != STATE_READY {
+		t.Errorf("Ready() sent %q, want %q", tGot, STATE_READY)
+	}
+}
+
+func TestNotifyWithoutSocket(t *testing.T) {
+
+	t.Setenv(ENV_NOTIFY_SOCKET, "")
+
+	if tSent, tErr := Ready(); tErr != nil || tSent {
+		t.Errorf("Ready() = %t, %v, want false, nil", tSent, tErr)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+
+	for _, tCase := range []struct {
+		name    string
+		usec    string
+		pid     string
+		want    time.Duration
+		enabled bool
+		wantErr error
+	}{
+		{"unset", "", "", 0, false, nil},
+		{"this process", "2000000", strconv.Itoa(os.Getpid()), 2 * time.Second, true, nil},
+		{"no pid", "500000", "", 500 * time.Millisecond, true, nil},
+		{"another process", "2000000", strconv.Itoa(os.Getpid() + 1), 0, false, nil},
+		{"not a number", "soon", "", 0, false, ErrWatchdogUsecInvalid},
+		{"zero", "0", "", 0, false, ErrWatchdogUsecInvalid},
+	} {
+		t.Run(tCase.name, func(t *testing.T) {
+			t.Setenv(ENV_WATCHDOG_USEC, tCase.usec)
+			t.Setenv(ENV_WATCHDOG_PID, tCase.pid)
+
+			tInterval, tEnabled, tErr := WatchdogInterval()
+			if errors.Is(tErr, tCase.wantErr) == false || (tCase.wantErr == nil && tErr != nil) {
+				t.Fatalf("error = %v, want %v", tErr, tCase.wantErr)
+			}
+			if tInterval != tCase.want || tEnabled != tCase.enabled {
+				t.Errorf("WatchdogInterval() = %s, %t, want %s, %t", tInterval, tEnabled, tCase.want, tCase.enabled)
+			}
+		})
+	}
+}
+
+func TestRunWatchdog(t *testing.T) {
+
+	var (
+		tHealthy = make(chan error, 10)
+	)
+
+	tConnection := listenNotify(t)
+	t.Setenv(ENV_WATCHDOG_USEC, "100000")
+	t.Setenv(ENV_WATCHDOG_PID, strconv.Itoa(os.Getpid()))
+
+	tContext, tCancel := context.WithCancel(context.Background())
+	tDone := make(chan error, 1)
+	tHealthy <- nil
+	tHealthy <- errors.New("stuck")
+	go func() {
+		tDone <- RunWatchdog(tContext, func() error {
+			select {
+			case tErr := <-tHealthy:
+				return tErr
+			default:
+				return nil
+			}
+		})
+	}()
+
+	// The first keep-alive goes out at once, the unhealthy tick is skipped and the next one is sent again.
+	tStart := time.Now()
+	for tCount := 0; tCount < 2; tCount++ {
+		if tGot := readDatagram(t, tConnection); tGot != STATE_WATCHDOG {
+			t.Fatalf("keep-alive %d = %q, want %q", tCount, tGot, STATE_WATCHDOG)
+		}
+	}
+	if tElapsed := time.Since(tStart); tElapsed < 80*time.Millisecond {
+		t.Errorf("two keep-alives arrived after %s, the unhealthy one was not skipped", tElapsed)
+	}
+
+	tCancel()
+	select {
+	case tErr := <-tDone:
+		if tErr != nil {
+			t.Errorf("RunWatchdog() = %v, want nil", tErr)
+		}
+	case <-time.After(TEST_WAIT):
+		t.Fatal("RunWatchdog did not return after the context was cancelled")
+	}
+}
+
+func TestRunWatchdogDisabled(t *testing.T) {
+
+	t.Setenv(ENV_WATCHDOG_USEC, "")
+
+	if tErr := RunWatchdog(context.Background(), nil); tErr != nil {
+		t.Errorf("RunWatchdog() = %v, want nil", tErr)
+	}
+}
+
+func TestListenersNotActivated(t *testing.T) {
+
+	t.Setenv(ENV_LISTEN_PID, strconv.Itoa(os.Getpid()+1))
+	t.Setenv(ENV_LISTEN_FDS, "1")
+
+	tListeners, tErr := Listeners()
+	if tErr != nil || len(tListeners) != 0 {
+		t.Errorf("Listeners() = %v, %v, want an empty map", tListeners, tErr)
+	}
+}
+
+// TestListeners - passes a TCP listener, a UDP socket and a unix listener to a child test process at descriptors 3 to 5,
+// the way systemd does. The UDP socket is skipped. The child cannot know its pid before it starts, so it sets LISTEN_PID itself.
+func TestListeners(t *testing.T) {
+
+	var (
+		tOutput strings.Builder
+	)
+
+	if os.Getenv(ENV_TEST_LISTENERS_CHILD) != "" {
+		runListenersChild()
+		return
+	}
+
+	tTCPListener, tErr := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	defer tTCPListener.Close()
+	tUDPConnection, tErr := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	defer tUDPConnection.Close()
+	tUnixListener, tErr := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(t.TempDir(), "admin.sock"), Net: "unix"})
+	if tErr != nil {
+		t.Fatal(tErr)
+	}
+	defer tUnixListener.Close()
+
+	tTCPFile, _ := tTCPListener.File()
+	defer tTCPFile.Close()
+	tUDPFile, _ := tUDPConnection.File()
+	defer tUDPFile.Close()
+	tUnixFile, _ := tUnixListener.File()
+	defer tUnixFile.Close()
+
+	tCommand := exec.Command(os.Args[0], "-test.run=^TestListeners$")
+	tCommand.Env = append(os.Environ(), ENV_TEST_LISTENERS_CHILD+"=1", ENV_LISTEN_FDS+"=3", ENV_LISTEN_FDNAMES+"=http:syslog:admin")
+	tCommand.ExtraFiles = []*os.File{tTCPFile, tUDPFile, tUnixFile}
+	tCommand.Stdout, tCommand.Stderr = &tOutput, &tOutput
+	if tErr = tCommand.Start(); tErr != nil {
+		t.Fatal(tErr)
+	}
+
+	for _, tCase := range []struct {
+		address net.Addr
+		name    string
+	}{
+		{tTCPListener.Addr(), "http"},
+		{tUnixListener.Addr(), "admin"},
+	} {
+		tConnection, tErr := net.DialTimeout(tCase.address.Network(), tCase.address.String(), TEST_WAIT)
+		if tErr != nil {
+			t.Fatal(tErr)
+		}
+		_ = tConnection.SetDeadline(time.Now().Add(TEST_WAIT))
+		tName, _ := io.ReadAll(tConnection)
+		_ = tConnection.Close()
+		if string(tName) != tCase.name {
+			t.Errorf("%s was accepted as %q, want %q", tCase.address, tName, tCase.name)
+		}
+	}
+
+	if tErr = tCommand.Wait(); tErr != nil {
+		t.Fatalf("child: %s\n%s", tErr, tOutput.String())
+	}
+}
+
+// runListenersChild - accepts one connection on each passed listener in order and writes the listener name to it.
+func runListenersChild() {
+
+	_ = os.Setenv(ENV_LISTEN_PID, strconv.Itoa(os.Getpid()))
+
+	tListeners, tErr := Listeners()
+	if tErr != nil {
+		fmt.Println(tErr)
+		os.Exit(1)
+	}
+	for _, tName := range []string{ENV_LISTEN_PID, ENV_LISTEN_FDS, ENV_LISTEN_FDNAMES} {
+		if tValue, tSet := os.LookupEnv(tName); tSet {
+			fmt.Printf("%s is still set to %q\n", tName, tValue)
+			os.Exit(1)
+		}
+	}
+	if len(tListeners) != 2 {
+		fmt.Printf("got %d listeners, want 2\n", len(tListeners))
+		os.Exit(1)
+	}
+
+	for _, tName := range []string{"http", "admin"} {
+		tListener, tFound := tListeners[tName]
+		if tFound == false {
+			fmt.Printf("listener %q is missing\n", tName)
+			os.Exit(1)
+		}
+		tConnection, tErr := tListener.Accept()
+		if tErr != nil {
+			fmt.Println(tErr)
+			os.Exit(1)
+		}
+		_, _ = tConnection.Write([]byte(tName))
+		_ = tConnection.Close()
+		_ = tListener.Close()
+	}
+
+	os.Exit(0)
+}